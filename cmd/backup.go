@@ -15,7 +15,13 @@ import (
 var backupCmd = &cobra.Command{
 	Use:     "backup [root_dir] [...files]",
 	Aliases: []string{"b", "bkp"},
-	Args:    cobra.MinimumNArgs(1),
+	Args: func(cmd *cobra.Command, args []string) error {
+		if commandName != "" {
+			// Command entries have no files.
+			return cobra.NoArgs(cmd, args)
+		}
+		return cobra.MinimumNArgs(1)(cmd, args)
+	},
 	Example: strings.Join([]string{
 		`cfgrr backup /path/to/root/config/dir`,
 		`cfgrr b ~/.bashrc`,
@@ -23,18 +29,48 @@ var backupCmd = &cobra.Command{
 		`cfgrr b ~/.config/ ~/.bashrc`,
 		`cfgrr b ~/.config ~/.bashrc -a`,
 		`cfgrr b ~/`,
+		`cfgrr b ~/.config/nvim --dir`,
+		`cfgrr b ~/.ssh/config --link copy`,
+		`cfgrr b ~/.gitconfig --template`,
+		`cfgrr b ~/.netrc --encrypt`,
+		`cfgrr b --command dconf --dump 'dconf dump /' --load 'dconf load /'`,
+		`cfgrr b --command crontab --dump 'crontab -l' --load 'crontab -'`,
 		`cfgrr b /path/to/root/config/dir -p "**/.*" -p "**/*config*"`,
 		`cfgrr b /path/to/root/config/dir -p "**/.*" -p "**/*config*" -d /path/to/backup/dir -i .cfgrrignore -m cfgrrmap.yaml`,
 	}, "\n"),
 	RunE:  runBackup,
 	Short: "Backup the configuration files to the backup directory",
 	Long: `Backup enables the user to move their files to the backup directory, and creates a symlink to the files in-place.
-This action could be reverted by using the delete command with the --replace flag, to learn more run 'cfgrr delete --help'.`,
+This action could be reverted by using the delete command with the --replace flag, to learn more run 'cfgrr delete --help'.
+With --link, the files could be hard linked or copied in place instead, for apps that don't play well with symlinks (run 'cfgrr link --help' to learn more).
+Identical files are stored once only if they're copied in place (copies, templates and encrypted files), a symlinked or hard linked file is edited through its backup, so each of them gets one of its own.
+With --template, the files are Go templates rendered into place on restore (run 'cfgrr template --help' to learn more).
+With --encrypt, the backups are encrypted, and decrypted into copies of the files on restore (run 'cfgrr encrypt --help' to learn more).
+With --dir, the given directories are tracked as a whole (new files created inside them are tracked too) instead of being searched for config files.
+With --command, state that isn't a file (e.g. dconf, crontab) is tracked under the given name instead: the output of --dump is backed up (again on every push), and fed to --load on restore.
+Command entries are referred to as command:<name>, e.g. 'cfgrr delete command:dconf'.`,
 }
 
 func runBackup(cmd *cobra.Command, args []string) error {
 	paths := args
 
+	mode, err := cf.ParseLinkMode(linkMode)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	if commandName != "" {
+		return runBackupCommand(cmd, mode)
+	}
+	if dumpCommand != "" || loadCommand != "" {
+		return errors.New("--dump and --load are only used with --command")
+	}
+
+	if (asTemplate || encrypt) && !cmd.Flags().Changed("link") {
+		// Templates and encrypted files are always copied in place.
+		mode = cf.LinkCopy
+	}
+
 	if _, err := ignorefile.InitDefaultIgnoreFile(); err != nil {
 		return errors.WithStack(err)
 	}
@@ -53,7 +89,7 @@ func runBackup(cmd *cobra.Command, args []string) error {
 			continue
 		}
 
-		if stats.IsDir() {
+		if stats.IsDir() && !trackDirs {
 			fs, err := core.FindFiles(path, ignContainer, configPatterns...)
 			if err != nil {
 				return errors.WithStack(err)
@@ -73,22 +109,78 @@ func runBackup(cmd *cobra.Command, args []string) error {
 
 	if !all {
 		// Trigger the prompt if the user didn't set the `--all` flag.
-		var err error
 		files, err = prompt.PromptForFileSelection(files, "Which files would you like to track? (this will overwrite existing files)")
 		if err != nil {
 			return errors.WithStack(err)
 		}
 	}
 
+	for _, file := range files {
+		if err := file.SetTemplate(asTemplate); err != nil {
+			return errors.WithStack(err)
+		}
+		if err := file.SetEncrypted(encrypt); err != nil {
+			return errors.WithStack(err)
+		}
+		if err := file.UpdateTags(tags, nil); err != nil {
+			return errors.WithStack(err)
+		}
+		if err := file.SetLinkMode(mode); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+
+	return backupFiles(files...)
+}
+
+// Backs up the output of --dump as the command entry named --command.
+func runBackupCommand(cmd *cobra.Command, mode cf.LinkMode) error {
+	file, err := cf.NewCommandFile(commandName, dumpCommand, loadCommand)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	if err := file.SetTemplate(asTemplate); err != nil {
+		return errors.WithStack(err)
+	}
+	if err := file.SetEncrypted(encrypt); err != nil {
+		return errors.WithStack(err)
+	}
+	if err := file.UpdateTags(tags, nil); err != nil {
+		return errors.WithStack(err)
+	}
+	if cmd.Flags().Changed("link") {
+		if err := file.SetLinkMode(mode); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+
+	return backupFiles(file)
+}
+
+// Backs up the files, running the backup hooks around it.
+func backupFiles(files ...*cf.ConfigFile) error {
+	if err := runHooks(cf.HookPreBackup, files...); err != nil {
+		return errors.WithStack(err)
+	}
+
 	if err := core.BackupFiles(files...); err != nil {
 		return errors.WithStack(err)
 	}
 
-	return nil
+	return errors.WithStack(runHooks(cf.HookPostBackup, files...))
 }
 
 func init() {
 	defaultPatterns := []string{`**/.*`, `**/*config*`}
 	backupCmd.Flags().StringSliceVarP(&configPatterns, "pattern", "p", defaultPatterns, "backup files matching the given patterns")
 	backupCmd.Flags().BoolVarP(&all, "all", "a", false, "backup all matched files (skip prompt)")
+	backupCmd.Flags().BoolVar(&trackDirs, "dir", false, "track the given directories as a whole instead of searching them for files")
+	backupCmd.Flags().BoolVar(&asTemplate, "template", false, "treat the files as templates rendered on restore")
+	backupCmd.Flags().StringSliceVar(&tags, "tag", nil, "tag the files (see 'cfgrr tag --help')")
+	backupCmd.Flags().BoolVar(&encrypt, "encrypt", false, "encrypt the backups of the files")
+	backupCmd.Flags().StringVarP(&linkMode, "link", "l", string(cf.LinkSymlink), "how to link the files in place (symlink, hardlink or copy)")
+	backupCmd.Flags().StringVar(&commandName, "command", "", "track the output of --dump under this name, instead of files")
+	backupCmd.Flags().StringVar(&dumpCommand, "dump", "", "the command whose output is backed up, with --command")
+	backupCmd.Flags().StringVar(&loadCommand, "load", "", "the command the backup is fed to on restore, with --command")
 }
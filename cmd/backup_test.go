@@ -37,7 +37,14 @@ func TestBackupCmd(t *testing.T) {
 			[]string{".config/nvim/coc-settings.json"}},
 		{"backup only files matching patterns", []string{backupDir, "-p", "**/*.json", "-p", "**/*.vim", "-a"}, false,
 			[]string{".config/nvim/coc-settings.json", ".config/nvim/init.vim"}},
+		{"backup a directory as a whole", []string{filepath.Join(backupDir, ".config/nvim"), "--dir", "-a"}, false,
+			[]string{".config/nvim"}},
+		{"encrypt a directory", []string{filepath.Join(backupDir, ".config/nvim"), "--dir", "--encrypt", "-a"}, true, nil},
+		{"encrypt a symlinked file", []string{filepath.Join(backupDir, ".vimrc"), "--encrypt", "--link", "symlink", "-a"}, true, nil},
 	}
+	// Flags persist between executions.
+	prevTrackDirs, prevEncrypt, prevLinkMode := trackDirs, encrypt, linkMode
+	t.Cleanup(func() { trackDirs, encrypt, linkMode = prevTrackDirs, prevEncrypt, prevLinkMode })
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -120,3 +127,32 @@ func _createFilesToBackup(dir string, names ...string) []*cf.ConfigFile {
 
 	return files
 }
+
+func TestBackupCmd_DryRun(t *testing.T) {
+	orgDir := t.TempDir()
+	_createFilesToBackup(orgDir, _dummyTestFiles...)
+	backupDir := t.TempDir()
+	c := vconfig.GetConfig()
+	c.SetBackupDir(backupDir)
+	// Flags persist between executions.
+	t.Cleanup(func() { dryRun = false })
+
+	rootCmd.SetArgs([]string{"backup", orgDir, "-a", "--dry-run"})
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for _, name := range _dummyTestFiles {
+		info, err := os.Lstat(filepath.Join(orgDir, name))
+		if err != nil || !info.Mode().IsRegular() {
+			t.Errorf("expected %s to be left as is, got %v, %v", name, info, err)
+		}
+	}
+	entries, err := os.ReadDir(backupDir)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, entry := range entries {
+		t.Errorf("expected nothing to be written to the backup dir, found %s", entry.Name())
+	}
+}
@@ -0,0 +1,97 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	cf "github.com/osamaadam/cfgrr/configfile"
+	"github.com/osamaadam/cfgrr/core"
+	"github.com/osamaadam/cfgrr/helpers"
+	"github.com/osamaadam/cfgrr/mapfile"
+	"github.com/osamaadam/cfgrr/prompt"
+	"github.com/osamaadam/cfgrr/vconfig"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+var conditionCmd = &cobra.Command{
+	Use:     "condition [...paths]",
+	Aliases: []string{"when"},
+	RunE:    runCondition,
+	Example: strings.Join([]string{
+		`cfgrr condition ~/.xinitrc --os linux --env DISPLAY`,
+		`cfgrr when ~/.config/nginx.conf --host 'web-*'`,
+		`cfgrr when ~/.tmux.conf --command tmux`,
+		`cfgrr condition ~/.xinitrc --clear`,
+	}, "\n"),
+	Short: "Restrict tracked files to the machines they belong on",
+	Long: `Restrict tracked files to the machines they belong on.
+A file with conditions is only restored, and checked by 'status', on the machines where all of them hold:
+  --host     the hostname matches any of the globs (e.g. 'web-*'), the short hostname before the first dot is matched too
+  --os       the operating system is any of the given ones (e.g. linux, darwin, windows)
+  --arch     the architecture is any of the given ones (e.g. amd64, arm64)
+  --env      all the given environment variables are set
+  --command  all the given commands are on the PATH
+The given conditions replace the file's previous ones, --clear removes them.
+The files that are skipped are listed with the reason by 'restore' and 'status', and labeled in the prompts.
+In case no files were provided, the user will be prompted to choose the files.`,
+}
+
+func runCondition(cmd *cobra.Command, args []string) error {
+	condition := &cf.Condition{
+		Hosts:    conditionHosts,
+		OS:       conditionOS,
+		Arch:     conditionArch,
+		Env:      conditionEnv,
+		Commands: conditionCommands,
+	}
+	if condition.IsEmpty() == !clearConditions {
+		return errors.New("either set conditions (--host, --os, --arch, --env or --command), or --clear them")
+	}
+
+	files, err := core.GetTrackedFiles(args...)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	if len(files) == 0 {
+		config := vconfig.GetConfig()
+		m, err := mapfile.NewMapFile(config.GetMapFilePath()).Parse()
+		if err != nil {
+			return errors.WithStack(err)
+		}
+
+		files, err = prompt.PromptForFileSelection(helpers.GetMapValues(m), "Select the files to set the conditions of: ")
+		if err != nil {
+			return errors.WithStack(err)
+		}
+	}
+
+	if len(files) == 0 {
+		fmt.Println("No files selected, terminating...")
+		return nil
+	}
+
+	if err := core.ConditionFiles(condition, files...); err != nil {
+		return errors.WithStack(err)
+	}
+
+	for _, file := range files {
+		if file.When.IsEmpty() {
+			fmt.Printf("%s belongs on every machine\n", file.PathAbs())
+			continue
+		}
+		fmt.Printf("%s belongs on the machines with %s\n", file.PathAbs(), file.When)
+	}
+
+	return nil
+}
+
+func init() {
+	conditionCmd.Flags().StringSliceVar(&conditionHosts, "host", nil, "globs of the hostnames the files belong on")
+	conditionCmd.Flags().StringSliceVar(&conditionOS, "os", nil, "the operating systems the files belong on")
+	conditionCmd.Flags().StringSliceVar(&conditionArch, "arch", nil, "the architectures the files belong on")
+	conditionCmd.Flags().StringSliceVar(&conditionEnv, "env", nil, "the environment variables that have to be set")
+	conditionCmd.Flags().StringSliceVar(&conditionCommands, "command", nil, "the commands that have to be on the PATH")
+	conditionCmd.Flags().BoolVar(&clearConditions, "clear", false, "remove the conditions of the files")
+}
@@ -0,0 +1,19 @@
+package cmd
+
+import (
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+var decryptCmd = &cobra.Command{
+	Use:  "decrypt [...paths]",
+	RunE: runEncrypt(false),
+	Example: strings.Join([]string{
+		`cfgrr decrypt ~/.netrc`,
+	}, "\n"),
+	Short: "Decrypt the backups of tracked files",
+	Long: `Decrypt the backups of encrypted files, so they're stored (and pushed) in clear text again.
+The files are still copied in place, run 'cfgrr link --help' to change that.
+In case no files were provided, the user will be prompted to choose the files.`,
+}
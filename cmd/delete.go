@@ -22,20 +22,17 @@ var deleteCmd = &cobra.Command{
 		"cfgrr delete ~/.vimrc",
 		"cfgrr delete ~/.vimrc ~/.zshrc",
 		"cfgrr delete -r ~/.vimrc",
+		"cfgrr delete --tag work",
 	}, "\n"),
 	Short: "Delete the configuration files from the backup directory",
-	Long:  `Delete the configuration files from the backup directory, also replacing symlinks with the original target if used with the --replace flag.`,
+	Long: `Delete the configuration files from the backup directory, also replacing symlinks with the original target if used with the --replace flag.
+In case no files were provided, the user will be prompted to choose the files, among the ones with any of the --tag tags if it's set.`,
 }
 
 func deleteRun(cmd *cobra.Command, args []string) (err error) {
-	files := make([]*cf.ConfigFile, 0)
-
-	for _, path := range args {
-		file, err := cf.NewConfigFile(path)
-		if err != nil {
-			return err
-		}
-		files = append(files, file)
+	files, err := core.GetTrackedFiles(args...)
+	if err != nil {
+		return err
 	}
 
 	config := vconfig.GetConfig()
@@ -49,7 +46,7 @@ func deleteRun(cmd *cobra.Command, args []string) (err error) {
 			return errors.WithStack(err)
 		}
 
-		files = helpers.GetMapValues(m)
+		files = core.FilterByTags(helpers.GetMapValues(m), tags...)
 
 		files, err = prompt.PromptForFileSelection(files, "Select the files to delete: ")
 		if err != nil {
@@ -61,13 +58,18 @@ func deleteRun(cmd *cobra.Command, args []string) (err error) {
 		return nil
 	}
 
+	if err := runHooks(cf.HookPreDelete, files...); err != nil {
+		return errors.WithStack(err)
+	}
+
 	if err := core.DeleteFiles(replace, files...); err != nil {
 		return errors.WithStack(err)
 	}
 
-	return nil
+	return errors.WithStack(runHooks(cf.HookPostDelete, files...))
 }
 
 func init() {
+	deleteCmd.Flags().StringSliceVar(&tags, "tag", nil, "only prompt for the files with any of the tags")
 	deleteCmd.Flags().BoolVarP(&replace, "replace", "r", false, "replace the symlinks with the original target")
 }
@@ -0,0 +1,113 @@
+package cmd
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	cf "github.com/osamaadam/cfgrr/configfile"
+	"github.com/osamaadam/cfgrr/core"
+	"github.com/osamaadam/cfgrr/helpers"
+	"github.com/osamaadam/cfgrr/mapfile"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+var diffCmd = &cobra.Command{
+	Use:  "diff [paths...]",
+	RunE: runDiff,
+	Example: strings.Join([]string{
+		`cfgrr diff`,
+		`cfgrr diff ~/.zshrc ~/.config/nvim`,
+		`cfgrr diff --rev HEAD~3 ~/.zshrc`,
+		`cfgrr diff --remote`,
+	}, "\n"),
+	Short: "Show how tracked files differ from their backups",
+	Long: `Show unified diffs of the tracked files (all of them if no paths are given), headed by their paths rather than the names of their backup files.
+By default, each backup is compared with the live file, e.g. a copy of the file that was edited, or a file an app saved in place of the symlink.
+Templates are compared as rendered and encrypted files as decrypted, i.e. as restoring them would put them in place.
+With '--rev', each backup is compared with itself as of a git revision of the backup directory (e.g. HEAD~3, or a commit hash).
+With '--remote', it's compared with the branch of the remote it's pushed to, which is fetched first.
+The backups are then compared as they're stored, decrypted but not rendered.
+Only the files that differ are shown, and the exit status is 1 if any did.`,
+}
+
+func runDiff(cmd *cobra.Command, args []string) error {
+	var files []*cf.ConfigFile
+	if len(args) > 0 {
+		var err error
+		if files, err = core.GetTrackedFiles(args...); err != nil {
+			return errors.WithStack(err)
+		}
+	} else {
+		m, err := mapfile.NewMapFile().Parse()
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		files = core.FilterByTags(helpers.GetMapValues(m), tags...)
+		sort.Slice(files, func(i, j int) bool { return files[i].PathAbs() < files[j].PathAbs() })
+	}
+
+	rev := diffRev
+	if diffRemote {
+		if err := core.FetchRemote(); err != nil {
+			fmt.Fprintf(cmd.ErrOrStderr(), "%v, comparing with the last fetched branch\n", err)
+		}
+		var err error
+		if rev, err = core.RemoteRevision(); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+
+	var diffs []core.FileDiff
+	var err error
+	fromLabel, toLabel := "backup", ""
+	if rev != "" {
+		diffs, err = core.DiffRevision(rev, files...)
+		fromLabel, toLabel = rev, "backup"
+	} else {
+		diffs, err = core.DiffLive(files...)
+	}
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	out := cmd.OutOrStdout()
+	for _, diff := range diffs {
+		if diff.Note != "" {
+			fmt.Fprintln(out, diff.Note)
+			continue
+		}
+		fromName := diffHeader(diff.Path, fromLabel, diff.From.Exists)
+		toName := diffHeader(diff.Path, toLabel, diff.To.Exists)
+		if text := helpers.UnifiedDiff(fromName, toName, diff.From.Content, diff.To.Content); text != "" {
+			fmt.Fprint(out, text)
+		} else {
+			// An empty file against a missing one.
+			fmt.Fprintf(out, "--- %s\n+++ %s\n", fromName, toName)
+		}
+	}
+
+	if len(diffs) > 0 {
+		return &ExitError{Code: 1}
+	}
+	return nil
+}
+
+// Names a version of the file in the header of its diff, e.g. '~/.zshrc (backup)'.
+func diffHeader(path, label string, exists bool) string {
+	if !exists {
+		return "/dev/null"
+	}
+	if label == "" {
+		return displayPath(path)
+	}
+	return fmt.Sprintf("%s (%s)", displayPath(path), label)
+}
+
+func init() {
+	diffCmd.Flags().StringVar(&diffRev, "rev", "", "compare the backups with the backups as of the git revision of the backup directory")
+	diffCmd.Flags().BoolVar(&diffRemote, "remote", false, "compare the backups with the backups on the remote")
+	diffCmd.Flags().StringSliceVar(&tags, "tag", nil, "only compare the files with any of the tags, if no paths are given")
+	diffCmd.MarkFlagsMutuallyExclusive("rev", "remote")
+}
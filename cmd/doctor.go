@@ -0,0 +1,81 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/osamaadam/cfgrr/core"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+var doctorCmd = &cobra.Command{
+	Use:  "doctor",
+	Args: cobra.NoArgs,
+	RunE: runDoctor,
+	Example: strings.Join([]string{
+		`cfgrr doctor`,
+		`cfgrr doctor --fix`,
+		`cfgrr doctor --check orphaned-backup --check stale-replica --fix`,
+	}, "\n"),
+	Short: "Check the consistency of the map file, the backup directory and the home directory",
+	Long: `Check the consistency of the map file, the backup directory and the home directory.
+Each problem is reported with its severity: errors mean data is missing or cfgrr can't work as expected, warnings are leftovers.
+The checks are:
+` + doctorUsage() + `
+With '--fix', the problems that could be fixed safely are fixed. What could hold data is moved into
+BACKUP_DIR/` + core.QuarantineDirName + ` (kept out of git) rather than deleted.
+The exit status is 1 if any problem is left.`,
+}
+
+func doctorUsage() string {
+	lines := make([]string, len(core.DoctorChecks))
+	for i, check := range core.DoctorChecks {
+		lines[i] = fmt.Sprintf("  %-17s %s", check.Name, check.Description)
+	}
+	return strings.Join(lines, "\n")
+}
+
+func runDoctor(cmd *cobra.Command, args []string) error {
+	findings, err := core.Diagnose(doctorChecks...)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	out := cmd.OutOrStdout()
+	if len(findings) == 0 {
+		fmt.Fprintln(out, "No problems found")
+		return nil
+	}
+
+	left := 0
+	for _, finding := range findings {
+		fmt.Fprintf(out, "%-7s %s: %s: %s\n", finding.Severity, finding.Check, displayPath(finding.Path), finding.Problem)
+
+		switch {
+		case !finding.Fixable():
+			left++
+		case !fix:
+			fmt.Fprintf(out, "        fixable with --fix: %s\n", finding.Remedy)
+			left++
+		default:
+			if err := finding.Fix(); err != nil {
+				fmt.Fprintf(out, "        couldn't %s: %s\n", finding.Remedy, err)
+				left++
+				continue
+			}
+			fmt.Fprintf(out, "        fixed: %s\n", finding.Remedy)
+		}
+	}
+
+	fmt.Fprintf(out, "%d problems found, %d left\n", len(findings), left)
+	if left > 0 {
+		return &ExitError{Code: 1}
+	}
+	return nil
+}
+
+func init() {
+	doctorCmd.Flags().BoolVar(&fix, "fix", false, "fix the problems that could be fixed safely")
+	doctorCmd.Flags().StringSliceVar(&doctorChecks, "check", nil, "only run the given checks")
+}
@@ -0,0 +1,152 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/kballard/go-shellquote"
+	cf "github.com/osamaadam/cfgrr/configfile"
+	"github.com/osamaadam/cfgrr/core"
+	"github.com/osamaadam/cfgrr/helpers"
+	"github.com/osamaadam/cfgrr/mapfile"
+	"github.com/osamaadam/cfgrr/prompt"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+var editCmd = &cobra.Command{
+	Use:  "edit <query>",
+	Args: cobra.ExactArgs(1),
+	RunE: runEdit,
+	Example: strings.Join([]string{
+		`cfgrr edit zshrc`,
+		`cfgrr edit nvinit`,
+		`cfgrr edit ~/.config/git/config`,
+	}, "\n"),
+	Short: "Edit the backup of a tracked file",
+	Long: `Edit the backup of a tracked file in $VISUAL (or $EDITOR), even if its symlink is gone.
+The file is either the tracked file at the given path, or the one fuzzy matching the query, i.e. whose name and path (as listed by the prompts, e.g. '.zshrc - (~/.zshrc)') contain the characters of the query in order.
+If several files match, you're prompted to pick one.
+Templates are edited unrendered, and encrypted files decrypted (in a temporary file only you can read).
+Afterwards, the live file is recreated from the edited backup, rendered, encrypted, copied, or linked according to the entry.
+The changes made to a copy of the file are pulled into the backup before it's edited, and a live file that isn't managed by cfgrr anymore has to be moved away first.`,
+}
+
+func runEdit(cmd *cobra.Command, args []string) error {
+	file, err := findFileToEdit(args[0])
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	changed, err := core.EditFile(file, editInEditor(file))
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	if changed {
+		fmt.Println("Edited", displayPath(file.PathAbs()))
+	} else {
+		fmt.Println("No changes to", displayPath(file.PathAbs()))
+	}
+
+	return nil
+}
+
+// Finds the tracked file at the path, or the one fuzzy matching the query.
+func findFileToEdit(query string) (*cf.ConfigFile, error) {
+	if files, err := core.GetTrackedFiles(query); err == nil {
+		return files[0], nil
+	}
+
+	m, err := mapfile.NewMapFile().Parse()
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	matches := core.FuzzyFind(query, helpers.GetMapValues(m)...)
+
+	switch len(matches) {
+	case 0:
+		return nil, errors.Errorf("no tracked file matches %q", query)
+	case 1:
+		return matches[0], nil
+	}
+
+	// A file named after the query wins, e.g. `zshrc` for ~/.zshrc rather than ~/.zshrc.local.
+	var named []*cf.ConfigFile
+	for _, file := range matches {
+		if name := file.Name(); name == query || name == "."+query {
+			named = append(named, file)
+		}
+	}
+	if len(named) == 1 {
+		return named[0], nil
+	}
+
+	file, err := prompt.PromptForFile(matches, fmt.Sprintf("Which file matching %q to edit?", query))
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if file == nil {
+		return nil, errors.New("no file selected")
+	}
+
+	return file, nil
+}
+
+// Returns the editor to run, split into its arguments, from $VISUAL or $EDITOR like git does.
+func editorCommand() ([]string, error) {
+	editor := os.Getenv("VISUAL")
+	if editor == "" {
+		editor = os.Getenv("EDITOR")
+	}
+	if editor == "" {
+		editor = "vi"
+		if runtime.GOOS == "windows" {
+			editor = "notepad"
+		}
+	}
+
+	args, err := shellquote.Split(editor)
+	if err != nil {
+		return nil, errors.WithMessagef(err, "couldn't parse the editor %q", editor)
+	}
+	if len(args) == 0 {
+		return nil, errors.New("the editor is empty, set $VISUAL or $EDITOR")
+	}
+
+	return args, nil
+}
+
+// Edits the content in a temporary file named after the file, so editors recognize its type.
+func editInEditor(file *cf.ConfigFile) func(content []byte) ([]byte, error) {
+	return func(content []byte) ([]byte, error) {
+		editor, err := editorCommand()
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+
+		dir, err := os.MkdirTemp("", "cfgrr-edit-")
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		defer os.RemoveAll(dir)
+
+		path := filepath.Join(dir, file.Name())
+		if err := os.WriteFile(path, content, 0600); err != nil {
+			return nil, errors.WithStack(err)
+		}
+
+		run := exec.Command(editor[0], append(editor[1:], path)...)
+		run.Stdin, run.Stdout, run.Stderr = os.Stdin, os.Stdout, os.Stderr
+		if err := run.Run(); err != nil {
+			return nil, errors.WithMessagef(err, "the editor %s failed", editor[0])
+		}
+
+		edited, err := os.ReadFile(path)
+		return edited, errors.WithStack(err)
+	}
+}
@@ -0,0 +1,72 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/osamaadam/cfgrr/core"
+	"github.com/osamaadam/cfgrr/helpers"
+	"github.com/osamaadam/cfgrr/mapfile"
+	"github.com/osamaadam/cfgrr/prompt"
+	"github.com/osamaadam/cfgrr/vconfig"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+var encryptCmd = &cobra.Command{
+	Use:  "encrypt [...paths]",
+	RunE: runEncrypt(true),
+	Example: strings.Join([]string{
+		`cfgrr encrypt ~/.netrc`,
+		`cfgrr encrypt ~/.aws/credentials ~/.ssh/config`,
+		`cfgrr set key_file ~/.config/cfgrr.key`,
+	}, "\n"),
+	Short: "Encrypt the backups of tracked files",
+	Long: `Encrypt the backups of tracked files, so they're never pushed in clear text.
+The backup is encrypted (XChaCha20-Poly1305) with a key derived from a secret, and decrypted into a copy of the file on restore.
+Changes made to the copy are encrypted into the backup when pushing.
+The secret is read from the file set as 'key_file' in the config, or the CFGRR_PASSPHRASE environment variable, otherwise the user is prompted for a passphrase, twice when encrypting unless it decrypted a file first.
+Keep the secret safe, encrypted files can't be restored without it.
+Note that encrypting a file doesn't erase its clear text from the history of the git repository.
+To decrypt the backups, run 'cfgrr decrypt --help'.
+In case no files were provided, the user will be prompted to choose the files.`,
+}
+
+// Returns a command encrypting (or decrypting) the given files.
+func runEncrypt(encrypted bool) func(cmd *cobra.Command, args []string) error {
+	return func(cmd *cobra.Command, args []string) error {
+		files, err := core.GetTrackedFiles(args...)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+
+		action := "encrypt"
+		if !encrypted {
+			action = "decrypt"
+		}
+
+		if len(files) == 0 {
+			config := vconfig.GetConfig()
+			m, err := mapfile.NewMapFile(config.GetMapFilePath()).Parse()
+			if err != nil {
+				return errors.WithStack(err)
+			}
+
+			files, err = prompt.PromptForFileSelection(helpers.GetMapValues(m), fmt.Sprintf("Select the files to %s: ", action))
+			if err != nil {
+				return errors.WithStack(err)
+			}
+		}
+
+		if len(files) == 0 {
+			fmt.Println("No files selected, terminating...")
+			return nil
+		}
+
+		if err := core.EncryptFiles(encrypted, files...); err != nil {
+			return errors.WithStack(err)
+		}
+
+		return nil
+	}
+}
@@ -0,0 +1,36 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/osamaadam/cfgrr/core"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+var exportCmd = &cobra.Command{
+	Use:  "export <file.tar.gz>",
+	Args: cobra.ExactArgs(1),
+	RunE: runExport,
+	Example: strings.Join([]string{
+		`cfgrr export /media/usb/cfgrr.tar.gz`,
+		`cfgrr import archive /media/usb/cfgrr.tar.gz`,
+	}, "\n"),
+	Short: "Bundle the backup into a portable archive",
+	Long: `Bundle the tracked files into a single gzipped tar archive, to move them where the git remote can't be reached.
+The archive holds the entries of the map file (with their permissions, link modes and flags), and their backup files.
+It's versioned, and imported with 'cfgrr import archive'.
+Encrypted files stay encrypted, the importing machine needs the same key to restore them.`,
+}
+
+func runExport(cmd *cobra.Command, args []string) error {
+	count, err := core.Export(args[0])
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	fmt.Printf("exported %d files to %s\n", count, args[0])
+
+	return nil
+}
@@ -0,0 +1,64 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/osamaadam/cfgrr/core"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+var historyCmd = &cobra.Command{
+	Use:     "history <path>",
+	Aliases: []string{"h", "hist"},
+	Args:    cobra.ExactArgs(1),
+	RunE:    runHistory,
+	Example: strings.Join([]string{
+		`cfgrr history ~/.zshrc`,
+		`cfgrr h ~/.config/nvim/init.vim`,
+	}, "\n"),
+	Short: "List the saved revisions of a tracked file",
+	Long: `List the saved revisions of a tracked file, newest first.
+cfgrr saves a revision of a file whenever it's backed up, pushed, or rolled back, as long as its content changed since the latest revision.
+The revisions are kept locally in the backup directory (they're never pushed), and only the latest 'history_limit' revisions are kept.
+To restore one of the revisions, run 'cfgrr rollback --help'.`,
+}
+
+func runHistory(cmd *cobra.Command, args []string) error {
+	files, err := core.GetTrackedFiles(args[0])
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	file := files[0]
+
+	if file.IsDir() {
+		return errors.Errorf("revisions aren't kept for directories, %s is a directory", file.Path)
+	}
+
+	revs, err := file.History()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	if len(revs) == 0 {
+		fmt.Println("No revisions saved for", file)
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "REV\tDATE\tSIZE\t")
+	for i := len(revs) - 1; i >= 0; i-- {
+		rev := revs[i]
+		current := ""
+		if ok, _ := file.IsCurrent(rev); ok {
+			current = "(current)"
+		}
+		fmt.Fprintf(w, "%d\t%s\t%d B\t%s\n", rev.ID, rev.Time.Format(time.RFC1123), rev.Size, current)
+	}
+
+	return w.Flush()
+}
@@ -0,0 +1,153 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	cf "github.com/osamaadam/cfgrr/configfile"
+	"github.com/osamaadam/cfgrr/core"
+	"github.com/osamaadam/cfgrr/helpers"
+	"github.com/osamaadam/cfgrr/mapfile"
+	"github.com/osamaadam/cfgrr/prompt"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+var hookCmd = &cobra.Command{
+	Use:  "hook [...paths]",
+	RunE: runHook,
+	Example: strings.Join([]string{
+		`cfgrr hook`,
+		`cfgrr hook ~/.tmux.conf --event post-restore --add 'tmux source-file ~/.tmux.conf'`,
+		`cfgrr hook --tag systemd --event post-restore --add 'systemctl --user daemon-reload'`,
+		`cfgrr hook ~/.tmux.conf --event post-restore --remove 'tmux source-file ~/.tmux.conf'`,
+		`cfgrr restore -a --no-hooks`,
+	}, "\n"),
+	Short: "Run commands before or after operations on tracked files",
+	Long: `Run commands before or after operations on tracked files, e.g. reloading an app after its config is restored.
+The hooks run at these events: ` + hookEventNames() + `.
+Global hooks are executables in the hooks directory of the backup directory, named after their event (e.g. hooks/post-restore), they run on every operation.
+The commands added with --add run (with 'sh -c', or 'cmd /C' on Windows) when an operation involves the files they were added to.
+With --tag, the command is added to the tags instead (kept in the backup directory), it runs for the files with any of the tags, whenever they were tagged, once however many of them are involved.
+The hooks run from the home directory with:
+  CFGRR_HOOK        the event
+  CFGRR_PATHS       the paths of the involved files, one per line
+  CFGRR_BACKUP_DIR  the backup directory
+A pre hook that fails aborts the operation before anything is changed. A post hook that fails is reported, the operation is done by then.
+With --no-hooks, no hooks are run. With --dry-run, the hooks that would run are listed instead.
+Without --add or --remove, the hooks are listed.`,
+}
+
+func hookEventNames() string {
+	names := make([]string, len(cf.HookEvents))
+	for i, event := range cf.HookEvents {
+		names[i] = string(event)
+	}
+	return strings.Join(names, ", ")
+}
+
+// Runs the hooks of the event for the files, unless --no-hooks is set.
+func runHooks(event cf.HookEvent, files ...*cf.ConfigFile) error {
+	if noHooks {
+		return nil
+	}
+	return errors.WithStack(core.RunHooks(event, files...))
+}
+
+func runHook(cmd *cobra.Command, args []string) error {
+	files, err := core.GetTrackedFiles(args...)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	m, err := mapfile.NewMapFile().Parse()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	var tagged []*cf.ConfigFile
+	if len(tags) > 0 {
+		tagged = core.FilterByTags(helpers.GetMapValues(m), tags...)
+	}
+
+	if len(addHooks) == 0 && len(removeHooks) == 0 {
+		if len(files) == 0 && len(tags) == 0 {
+			files = helpers.GetMapValues(m)
+		}
+		return listHooks(append(files, tagged...))
+	}
+
+	event, err := cf.ParseHookEvent(hookEvent)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	if len(files) == 0 && len(tags) == 0 {
+		files, err = prompt.PromptForFileSelection(helpers.GetMapValues(m), "Select the files to hook: ")
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		if len(files) == 0 {
+			fmt.Println("No files selected, terminating...")
+			return nil
+		}
+	}
+
+	if len(files) > 0 {
+		if err := core.HookFiles(event, addHooks, removeHooks, files...); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+	if len(tags) > 0 {
+		if err := core.HookTags(event, addHooks, removeHooks, tags...); err != nil {
+			return errors.WithStack(err)
+		}
+		if len(removeHooks) > 0 && len(tagged) > 0 {
+			// The commands used to be copied into the tagged entries.
+			if err := core.HookFiles(event, nil, removeHooks, tagged...); err != nil {
+				return errors.WithStack(err)
+			}
+		}
+	}
+
+	return listHooks(append(files, tagged...))
+}
+
+// Lists the hooks of each event that run for the files.
+func listHooks(files []*cf.ConfigFile) error {
+	listed := false
+	for _, event := range cf.HookEvents {
+		hooks, err := core.Hooks(event, files...)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		for _, hook := range hooks {
+			if hook.Script != "" {
+				fmt.Printf("%s: %s\n", event, displayPath(hook.Script))
+			} else {
+				paths := make([]string, len(hook.Files))
+				for i, file := range hook.Files {
+					paths[i] = displayPath(file.PathAbs())
+				}
+				where := strings.Join(paths, ", ")
+				if len(hook.Tags) > 0 {
+					where = "tagged " + strings.Join(hook.Tags, ", ") + ": " + where
+				}
+				fmt.Printf("%s: %s (%s)\n", event, hook.Command, where)
+			}
+			listed = true
+		}
+	}
+
+	if !listed {
+		fmt.Println("No hooks, run 'cfgrr hook --help' to add them")
+	}
+
+	return nil
+}
+
+func init() {
+	hookCmd.Flags().StringVar(&hookEvent, "event", "", "the event to run the commands at (e.g. post-restore)")
+	hookCmd.Flags().StringArrayVar(&addHooks, "add", nil, "a command to run at the event")
+	hookCmd.Flags().StringArrayVar(&removeHooks, "remove", nil, "a command not to run at the event anymore")
+	hookCmd.Flags().StringSliceVar(&tags, "tag", nil, "hook the files with any of the tags, including the ones tagged later")
+}
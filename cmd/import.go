@@ -0,0 +1,48 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	cf "github.com/osamaadam/cfgrr/configfile"
+	"github.com/osamaadam/cfgrr/core"
+	"github.com/spf13/cobra"
+)
+
+var importCmd = &cobra.Command{
+	Use:  "import",
+	Args: cobra.NoArgs,
+	Example: strings.Join([]string{
+		`cfgrr import stow ~/dotfiles`,
+		`cfgrr import chezmoi ~/.local/share/chezmoi`,
+	}, "\n"),
+	Short: "Import the files kept by another dotfiles manager",
+	Long: `Import the files kept by another dotfiles manager.
+The files are moved out of the other manager's directory into the backup directory, and its links (or copies) are replaced with cfgrr's.
+Run 'cfgrr push' afterwards to commit the imported files.`,
+}
+
+// Lists the imported files, and the ones that were skipped with why.
+func printImports(files []*cf.ConfigFile, skipped []core.Skipped) {
+	for _, file := range files {
+		var notes []string
+		if file.Package != "" {
+			notes = append(notes, file.Package)
+		}
+		if file.Template {
+			notes = append(notes, "template")
+		}
+		if file.Encrypted {
+			notes = append(notes, "encrypted")
+		}
+		line := "imported " + displayPath(file.PathAbs())
+		if len(notes) > 0 {
+			line += " (" + strings.Join(notes, ", ") + ")"
+		}
+		fmt.Println(line)
+	}
+
+	for _, s := range skipped {
+		fmt.Printf("skipped %s: %s\n", displayPath(s.Source), s.Reason)
+	}
+}
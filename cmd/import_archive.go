@@ -0,0 +1,94 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/osamaadam/cfgrr/core"
+	"github.com/osamaadam/cfgrr/prompt"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+var importArchiveCmd = &cobra.Command{
+	Use:  "archive <file>",
+	Args: cobra.ExactArgs(1),
+	RunE: runImportArchive,
+	Example: strings.Join([]string{
+		`cfgrr import archive /media/usb/cfgrr.tar.gz`,
+		`cfgrr import archive cfgrr.tar.gz --overwrite`,
+		`cfgrr import archive cfgrr.tar.gz --yes`,
+	}, "\n"),
+	Short: "Merge an archive written by 'cfgrr export' into the backup",
+	Long: `Merge an archive written by 'cfgrr export' into the backup directory.
+The files that aren't tracked are added, and the ones tracked with a different content, mode, link mode, flags, hooks, commands, conditions or tags are reported as conflicts.
+The local entries of the conflicts are kept, unless --overwrite is set.
+The hooks and the dump and load commands the imported entries bring along are listed, and only imported once confirmed (or with --yes), as they're run by later commands.
+Only the backup directory is changed, run 'cfgrr restore' afterwards to link the imported files in place.
+The exit status is 1 if any conflict was kept.`,
+}
+
+func runImportArchive(cmd *cobra.Command, args []string) error {
+	results, err := core.ImportArchive(args[0], overwrite, reviewArchiveCommands)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	counts := make(map[core.ArchiveStatus]int)
+	for _, result := range results {
+		counts[result.Status]++
+		switch result.Status {
+		case core.ArchiveUnchanged:
+			continue
+		case core.ArchiveConflict:
+			fmt.Printf("conflict %s: the %s differ, kept the local entry\n", displayPath(result.File.PathAbs()), strings.Join(result.Differences, ", "))
+		default:
+			fmt.Printf("%s %s\n", result.Status, displayPath(result.File.PathAbs()))
+		}
+	}
+
+	fmt.Printf("%d added, %d updated, %d unchanged, %d conflicts\n",
+		counts[core.ArchiveAdded], counts[core.ArchiveUpdated], counts[core.ArchiveUnchanged], counts[core.ArchiveConflict])
+	if counts[core.ArchiveAdded]+counts[core.ArchiveUpdated] > 0 {
+		fmt.Println("run 'cfgrr restore' to link the imported files in place")
+	}
+	if counts[core.ArchiveConflict] > 0 {
+		fmt.Println("run with --overwrite to take the archive's entries")
+		return &ExitError{Code: 1}
+	}
+
+	return nil
+}
+
+// Lists the commands the imported entries would run, and asks whether to import them.
+func reviewArchiveCommands(results []core.ArchiveResult) error {
+	listed := false
+	for _, result := range results {
+		if commands := core.EntryCommands(result.File); len(commands) > 0 {
+			listed = true
+			fmt.Printf("%s runs:\n", displayPath(result.File.PathAbs()))
+			for _, command := range commands {
+				fmt.Printf("  %s\n", command)
+			}
+		}
+	}
+	if !listed || assumeYes {
+		return nil
+	}
+
+	ok, err := prompt.PromptForConfirmation("Import these commands? They're run by later cfgrr commands (e.g. restore)")
+	if err != nil {
+		return errors.WithMessage(err, "couldn't confirm the imported commands, run with --yes to import them anyway")
+	}
+	if !ok {
+		return errors.New("nothing was imported")
+	}
+
+	return nil
+}
+
+func init() {
+	importArchiveCmd.Flags().BoolVar(&overwrite, "overwrite", false, "overwrite the local entries that differ from the archive's")
+	importArchiveCmd.Flags().BoolVarP(&assumeYes, "yes", "y", false, "import the hooks and commands of the entries without asking")
+	importCmd.AddCommand(importArchiveCmd)
+}
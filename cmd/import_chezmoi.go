@@ -0,0 +1,70 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/osamaadam/cfgrr/core"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+var importChezmoiCmd = &cobra.Command{
+	Use:  "chezmoi <source-dir>",
+	Args: cobra.ExactArgs(1),
+	RunE: runImportChezmoi,
+	Example: strings.Join([]string{
+		`cfgrr import chezmoi ~/.local/share/chezmoi`,
+		`cfgrr import chezmoi "$(chezmoi source-path)"`,
+	}, "\n"),
+	Short: "Import a chezmoi source directory",
+	Long: `Import the files of a chezmoi source directory.
+The attributes of the source files' names (dot_, private_, readonly_, executable_, ...) are decoded into the files' paths, relative to the target directory (the home directory by default), and permissions, the directories' permissions included.
+The files ignored by .chezmoiignore aren't imported.
+Templates (.tmpl) are converted into cfgrr templates, using .Hostname, .OS, .Arch, .User, .Home and .Env for chezmoi's equivalent variables (see 'cfgrr template --help').
+Encrypted files are imported from their live copy decrypted by chezmoi, and encrypted with cfgrr's key.
+What cfgrr can't express is skipped and reported, and left in the source directory:
+- scripts (run_, modify_), symlinks (symlink_), and removed files (remove_).
+- templates using chezmoi's data or functions, which have to be converted by hand.
+- files whose live copy changed since chezmoi applied them, run 'chezmoi apply' or 'chezmoi re-add' first.
+The attributes of the directories aren't imported, the existing directories are kept as they are.`,
+}
+
+func runImportChezmoi(cmd *cobra.Command, args []string) error {
+	sourceDir, err := filepath.Abs(args[0])
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	target := importTarget
+	if target == "" {
+		if target, err = os.UserHomeDir(); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+
+	imports, skipped, err := core.ChezmoiImports(sourceDir, target)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if len(imports) == 0 {
+		printImports(nil, skipped)
+		fmt.Println("No files to import, terminating...")
+		return nil
+	}
+
+	files, err := core.ImportFiles(sourceDir, imports...)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	printImports(files, skipped)
+
+	return nil
+}
+
+func init() {
+	importChezmoiCmd.Flags().StringVar(&importTarget, "target", "", "the directory chezmoi applies the files into (defaults to the home directory)")
+	importCmd.AddCommand(importChezmoiCmd)
+}
@@ -0,0 +1,64 @@
+package cmd
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/osamaadam/cfgrr/core"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+var importStowCmd = &cobra.Command{
+	Use:  "stow <dir> [...packages]",
+	Args: cobra.MinimumNArgs(1),
+	RunE: runImportStow,
+	Example: strings.Join([]string{
+		`cfgrr import stow ~/dotfiles`,
+		`cfgrr import stow ~/dotfiles vim zsh`,
+		`cfgrr import stow ~/dotfiles --dotfiles --target ~`,
+	}, "\n"),
+	Short: "Import a GNU Stow directory",
+	Long: `Import the packages of a GNU Stow directory, all of them if none were provided.
+Each file of a package becomes an entry at the place stow links it to, relative to the target directory (the parent of the stow directory by default, like stow).
+The package of each file is recorded in its entry.
+The files stow ignores (see .stow-local-ignore) aren't imported.
+The links stow made for the files, or for their directories, are replaced with cfgrr's, and the package directories left empty are removed.`,
+}
+
+func runImportStow(cmd *cobra.Command, args []string) error {
+	dir, err := filepath.Abs(args[0])
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	target := importTarget
+	if target == "" {
+		target = filepath.Dir(dir)
+	}
+
+	imports, err := core.StowImports(dir, target, stowDotfiles, args[1:]...)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if len(imports) == 0 {
+		fmt.Println("No files to import, terminating...")
+		return nil
+	}
+
+	files, err := core.ImportFiles(dir, imports...)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	printImports(files, nil)
+
+	return nil
+}
+
+func init() {
+	importStowCmd.Flags().StringVar(&importTarget, "target", "", "the directory stow links the packages into (defaults to the parent of the stow directory)")
+	importStowCmd.Flags().BoolVar(&stowDotfiles, "dotfiles", false, "replace the \"dot-\" prefixes of the files with dots, like stow's --dotfiles")
+	importCmd.AddCommand(importStowCmd)
+}
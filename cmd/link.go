@@ -0,0 +1,73 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	cf "github.com/osamaadam/cfgrr/configfile"
+	"github.com/osamaadam/cfgrr/core"
+	"github.com/osamaadam/cfgrr/helpers"
+	"github.com/osamaadam/cfgrr/mapfile"
+	"github.com/osamaadam/cfgrr/prompt"
+	"github.com/osamaadam/cfgrr/vconfig"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+var linkCmd = &cobra.Command{
+	Use:     "link <symlink|hardlink|copy> [...paths]",
+	Aliases: []string{"ln"},
+	Args:    cobra.MinimumNArgs(1),
+	RunE:    runLink,
+	Example: strings.Join([]string{
+		`cfgrr link copy ~/.ssh/config`,
+		`cfgrr link hardlink ~/.config/Code/User/settings.json`,
+		`cfgrr ln symlink ~/.ssh/config`,
+		`cfgrr link copy`,
+	}, "\n"),
+	Short: "Change how tracked files are linked in place",
+	Long: `Change how tracked files are linked in place.
+- symlink (default): the file is a symlink to its backup.
+- hardlink: the file is a hard link of its backup, for apps that refuse symlinks. The backup dir must be on the same filesystem.
+- copy: the file is a copy of its backup, for apps that replace the file when saving (or check its ownership strictly).
+Changes made to hard links and copies are pulled into the backup when pushing.
+Only copied files share their backup with identical files. Symlinks and hard links are written through to their backup, so each of them has its own, named after the content it was backed up with until the next push renames it.
+If the files are already restored, they're replaced right away, otherwise the new mode applies on the next restore.
+In case no files were provided, the user will be prompted to choose the files.`,
+}
+
+func runLink(cmd *cobra.Command, args []string) error {
+	mode, err := cf.ParseLinkMode(args[0])
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	files, err := core.GetTrackedFiles(args[1:]...)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	if len(files) == 0 {
+		config := vconfig.GetConfig()
+		m, err := mapfile.NewMapFile(config.GetMapFilePath()).Parse()
+		if err != nil {
+			return errors.WithStack(err)
+		}
+
+		files, err = prompt.PromptForFileSelection(helpers.GetMapValues(m), fmt.Sprintf("Select the files to %s: ", mode))
+		if err != nil {
+			return errors.WithStack(err)
+		}
+	}
+
+	if len(files) == 0 {
+		fmt.Println("No files selected, terminating...")
+		return nil
+	}
+
+	if err := core.RelinkFiles(mode, files...); err != nil {
+		return errors.WithStack(err)
+	}
+
+	return nil
+}
@@ -0,0 +1,200 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	cf "github.com/osamaadam/cfgrr/configfile"
+	"github.com/osamaadam/cfgrr/core"
+	"github.com/osamaadam/cfgrr/helpers"
+	"github.com/osamaadam/cfgrr/mapfile"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+var listCmd = &cobra.Command{
+	Use:     "list",
+	Aliases: []string{"ls"},
+	Args:    cobra.NoArgs,
+	RunE:    runList,
+	Example: strings.Join([]string{
+		`cfgrr list`,
+		`cfgrr ls --format tree`,
+		`cfgrr ls --format json --tag shell`,
+		`cfgrr list show ~/.zshrc`,
+	}, "\n"),
+	Short: "List the tracked files",
+	Long: `List the tracked files with their path, their key in the map file, mode, whether they're browsable, and their state on this machine.
+The state is 'ok', how the file drifted (see 'cfgrr status --help'), or 'skipped' if the file doesn't belong on this machine.
+The list is printed with --format:
+  table  a table, one file per line (the default)
+  tree   the files in a tree of their directories
+  json   a JSON array, in a format that's stable for scripts
+  yaml   a YAML list, in a format that's stable for scripts
+To see the whole entry of a file, run 'cfgrr list show --help'.`,
+}
+
+// A tracked file as it's listed.
+type listing struct {
+	Path      string   `yaml:"path" json:"Path"`
+	Key       string   `yaml:"key" json:"Key"`
+	Mode      string   `yaml:"mode" json:"Mode"`
+	Browsable bool     `yaml:"browsable" json:"Browsable"`
+	State     []string `yaml:"state" json:"State"`
+	Tags      []string `yaml:"tags,omitempty" json:"Tags,omitempty"`
+
+	file *cf.ConfigFile
+}
+
+func runList(cmd *cobra.Command, args []string) error {
+	m, err := mapfile.NewMapFile().Parse()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	files := core.FilterByTags(helpers.GetMapValues(m), tags...)
+	sort.Slice(files, func(i, j int) bool { return files[i].PathAbs() < files[j].PathAbs() })
+
+	listings, err := listFiles(files)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	return errors.WithStack(printListings(cmd.OutOrStdout(), listFormat, listings))
+}
+
+func listFiles(files []*cf.ConfigFile) ([]listing, error) {
+	statuses, err := core.Status(files...)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	listings := make([]listing, len(statuses))
+	for i, status := range statuses {
+		state := []string{"ok"}
+		if status.Unmet != "" {
+			state = []string{"skipped"}
+		} else if len(status.Drifts) > 0 {
+			state = strings.Split(joinDrifts(status.Drifts), ",")
+		}
+		listings[i] = listing{
+			Path:      status.File.PathAbs(),
+			Key:       status.File.HashShort(),
+			Mode:      status.File.Perm.String(),
+			Browsable: status.File.Browsable,
+			State:     state,
+			Tags:      status.File.Tags,
+			file:      status.File,
+		}
+	}
+
+	return listings, nil
+}
+
+func printListings(out io.Writer, format string, listings []listing) error {
+	switch format {
+	case "table":
+		w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "PATH\tKEY\tMODE\tBROWSABLE\tSTATE\tTAGS")
+		for _, l := range listings {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%t\t%s\t%s\n", displayPath(l.Path), l.Key, l.Mode, l.Browsable, strings.Join(l.State, ","), strings.Join(l.Tags, ","))
+		}
+		return errors.WithStack(w.Flush())
+	case "tree":
+		printTree(out, listings)
+		return nil
+	case "json":
+		if listings == nil {
+			listings = []listing{}
+		}
+		encoder := json.NewEncoder(out)
+		encoder.SetIndent("", "  ")
+		return errors.WithStack(encoder.Encode(listings))
+	case "yaml":
+		encoder := yaml.NewEncoder(out)
+		encoder.SetIndent(2)
+		if err := encoder.Encode(listings); err != nil {
+			return errors.WithStack(err)
+		}
+		return errors.WithStack(encoder.Close())
+	default:
+		return errors.Errorf("unknown format %q, expected one of: table, tree, json, yaml", format)
+	}
+}
+
+// A directory of the tree, or a listed file.
+type treeNode struct {
+	children map[string]*treeNode
+	listing  *listing
+}
+
+// Prints the files in a tree of their directories, rooted at the home directory and the filesystem root.
+// Command entries are listed under their own root.
+func printTree(out io.Writer, listings []listing) {
+	roots := make(map[string]*treeNode)
+	var rootNames []string
+	for i := range listings {
+		l := &listings[i]
+		rootName := "~"
+		if l.file.IsRoot() {
+			rootName = string(filepath.Separator)
+		}
+		if l.file.IsCommand() {
+			rootName = cf.CommandPrefix
+		}
+		root, ok := roots[rootName]
+		if !ok {
+			root = &treeNode{children: make(map[string]*treeNode)}
+			roots[rootName] = root
+			rootNames = append(rootNames, rootName)
+		}
+
+		node := root
+		for _, part := range strings.Split(l.file.Path, string(filepath.Separator)) {
+			child, ok := node.children[part]
+			if !ok {
+				child = &treeNode{children: make(map[string]*treeNode)}
+				node.children[part] = child
+			}
+			node = child
+		}
+		node.listing = l
+	}
+
+	for _, rootName := range rootNames {
+		fmt.Fprintln(out, rootName)
+		printTreeNode(out, roots[rootName], "")
+	}
+}
+
+func printTreeNode(out io.Writer, node *treeNode, indent string) {
+	names := helpers.GetMapKeys(node.children)
+	sort.Strings(names)
+	for i, name := range names {
+		child := node.children[name]
+		branch, childIndent := "├── ", "│   "
+		if i == len(names)-1 {
+			branch, childIndent = "└── ", "    "
+		}
+
+		label := name
+		if child.listing != nil {
+			if child.listing.file.IsDir() {
+				label += "/"
+			}
+			label += " [" + strings.Join(child.listing.State, ",") + "]"
+		}
+		fmt.Fprintln(out, indent+branch+label)
+		printTreeNode(out, child, indent+childIndent)
+	}
+}
+
+func init() {
+	listCmd.Flags().StringVar(&listFormat, "format", "table", "the output format (table, tree, json or yaml)")
+	listCmd.Flags().StringSliceVar(&tags, "tag", nil, "only list the files with any of the tags")
+}
@@ -0,0 +1,85 @@
+package cmd
+
+import (
+	"encoding/json"
+	"strings"
+
+	cf "github.com/osamaadam/cfgrr/configfile"
+	"github.com/osamaadam/cfgrr/core"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+var listShowCmd = &cobra.Command{
+	Use:  "show <path-or-hash>",
+	Args: cobra.ExactArgs(1),
+	RunE: runListShow,
+	Example: strings.Join([]string{
+		`cfgrr list show ~/.zshrc`,
+		`cfgrr list show 1a2b3c4d`,
+		`cfgrr list show ~/.config/cfgrr/.internals/blobs/9f86d081884c7d65`,
+		`cfgrr list show 9f86d0 --format json`,
+	}, "\n"),
+	Short: "Show the whole entry of a tracked file",
+	Long: `Show the whole entry of a tracked file, as in the map file, with where its backup is and its state on this machine.
+The file could be given by its path, its key in the map file, the name of its backup file in .internals (or a prefix of at least 6 characters of a blob's name), or the path of its backup file.
+All the files sharing a blob are shown.
+The entry is printed as YAML, or as JSON with '--format json'.`,
+}
+
+// A tracked file as it's shown.
+type entryDetails struct {
+	Key        string         `yaml:"key" json:"Key"`
+	Path       string         `yaml:"path" json:"Path"`
+	BackupPath string         `yaml:"backup_path" json:"BackupPath"`
+	State      []string       `yaml:"state" json:"State"`
+	Entry      *cf.ConfigFile `yaml:"entry" json:"Entry"`
+}
+
+func runListShow(cmd *cobra.Command, args []string) error {
+	files, err := core.ResolveEntries(args[0])
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	listings, err := listFiles(files)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	details := make([]entryDetails, len(listings))
+	for i, l := range listings {
+		details[i] = entryDetails{
+			Key:        l.Key,
+			Path:       l.Path,
+			BackupPath: l.file.BackupPath(),
+			State:      l.State,
+			Entry:      l.file,
+		}
+	}
+
+	out := cmd.OutOrStdout()
+	switch showFormat {
+	case "yaml":
+		encoder := yaml.NewEncoder(out)
+		encoder.SetIndent(2)
+		for _, d := range details {
+			if err := encoder.Encode(d); err != nil {
+				return errors.WithStack(err)
+			}
+		}
+		return errors.WithStack(encoder.Close())
+	case "json":
+		encoder := json.NewEncoder(out)
+		encoder.SetIndent("", "  ")
+		return errors.WithStack(encoder.Encode(details))
+	default:
+		return errors.Errorf("unknown format %q, expected yaml or json", showFormat)
+	}
+}
+
+func init() {
+	listShowCmd.Flags().StringVar(&showFormat, "format", "yaml", "the output format (yaml or json)")
+	listCmd.AddCommand(listShowCmd)
+}
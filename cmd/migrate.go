@@ -0,0 +1,58 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/osamaadam/cfgrr/core"
+	"github.com/osamaadam/cfgrr/helpers"
+	"github.com/osamaadam/cfgrr/mapfile"
+	"github.com/osamaadam/cfgrr/vconfig"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+var migrateCmd = &cobra.Command{
+	Use:  "migrate",
+	Args: cobra.NoArgs,
+	RunE: runMigrate,
+	Example: strings.Join([]string{
+		`cfgrr migrate`,
+		`cfgrr migrate -d /path/to/backup/dir`,
+	}, "\n"),
+	Short: "Move files backed up by older versions of cfgrr into the blob store",
+	Long: `Move files backed up by older versions of cfgrr into the blob store.
+Older versions named each backup file after a hash of its path, newer versions name it after a digest of its content (at .internals/blobs/).
+This deduplicates identical copied files (symlinked and hard linked files keep a backup of their own), makes integrity checks cheap, and keeps the names stable if a file is renamed.
+The symlinks pointing at the old backup files are updated, and the map file is rewritten. Running this more than once is harmless.
+Files outside the home directory tracked by older versions (as ../../etc/hosts for example) are anchored at the filesystem root too.`,
+}
+
+func runMigrate(cmd *cobra.Command, args []string) error {
+	config := vconfig.GetConfig()
+
+	m, err := mapfile.NewMapFile(config.GetMapFilePath()).Parse()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	migrated, err := core.MigrateFiles(helpers.GetMapValues(m)...)
+	for _, file := range migrated {
+		fmt.Println("Migrated", file)
+	}
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	fmt.Printf("Migrated %d file(s) to the blob store\n", len(migrated))
+
+	reanchored, err := core.ReanchorFiles(helpers.GetMapValues(m)...)
+	for _, file := range reanchored {
+		fmt.Println("Anchored", file, "at the filesystem root")
+	}
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	return nil
+}
@@ -0,0 +1,86 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/osamaadam/cfgrr/fileops"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+// Marks the commands that could be dry run.
+const dryRunAnnotation = "dry-run"
+
+// Makes the command plan its changes instead of making them when run with --dry-run.
+func dryRunnable(cmd *cobra.Command) {
+	run := cmd.RunE
+	cmd.RunE = func(cmd *cobra.Command, args []string) error {
+		if !dryRun {
+			return run(cmd, args)
+		}
+		return runPlanned(cmd, args, run)
+	}
+
+	if cmd.Annotations == nil {
+		cmd.Annotations = make(map[string]string)
+	}
+	cmd.Annotations[dryRunAnnotation] = "true"
+}
+
+// Rejects --dry-run for the commands that can't plan their changes.
+func checkDryRun(cmd *cobra.Command, args []string) error {
+	if dryRun && cmd.Annotations[dryRunAnnotation] == "" {
+		return errors.Errorf("%s doesn't support --dry-run", cmd.CommandPath())
+	}
+	return nil
+}
+
+// Runs the command with a planner in place of the filesystem, then prints the planned changes.
+// With --json, the plan is the only output, what the command prints goes to stderr instead.
+func runPlanned(cmd *cobra.Command, args []string, run func(cmd *cobra.Command, args []string) error) error {
+	planner := fileops.NewPlanner()
+	restore := fileops.Use(planner)
+	defer restore()
+
+	stdout := os.Stdout
+	if jsonOutput {
+		os.Stdout = os.Stderr
+	}
+	err := run(cmd, args)
+	os.Stdout = stdout
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	return printPlan(planner.Actions())
+}
+
+func printPlan(actions []fileops.Action) error {
+	if jsonOutput {
+		if actions == nil {
+			actions = []fileops.Action{}
+		}
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return errors.WithStack(encoder.Encode(actions))
+	}
+
+	if len(actions) == 0 {
+		fmt.Println("Dry run, nothing would be changed")
+		return nil
+	}
+
+	fmt.Printf("Dry run, %d changes would be made:\n", len(actions))
+	for i, action := range actions {
+		fmt.Printf("%4d. %s\n", i+1, action)
+	}
+	return nil
+}
+
+func init() {
+	for _, cmd := range []*cobra.Command{backupCmd, restoreCmd, deleteCmd, replicateCmd, pushCmd, importStowCmd, importChezmoiCmd, importArchiveCmd, exportCmd} {
+		dryRunnable(cmd)
+	}
+}
@@ -3,12 +3,20 @@ package cmd
 import (
 	"fmt"
 	"os"
+	"path/filepath"
+	"slices"
 	"strings"
 	"time"
 
 	"github.com/go-git/go-git/v5"
 	"github.com/go-git/go-git/v5/plumbing"
+	cf "github.com/osamaadam/cfgrr/configfile"
+	"github.com/osamaadam/cfgrr/core"
+	"github.com/osamaadam/cfgrr/fileops"
+	"github.com/osamaadam/cfgrr/helpers"
+	"github.com/osamaadam/cfgrr/mapfile"
 	"github.com/osamaadam/cfgrr/vconfig"
+	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
 )
 
@@ -43,25 +51,71 @@ func pushRun(cmd *cobra.Command, args []string) (err error) {
 		branch = config.GitBranch
 	}
 
-	repo, err := git.PlainInit(config.BackupDir, false)
+	m, err := mapfile.NewMapFile(config.GetMapFilePath()).Parse()
+	if err != nil {
+		return err
+	}
+	files := helpers.GetMapValues(m)
+
+	if err := runHooks(cf.HookPrePush, files...); err != nil {
+		return err
+	}
+
+	// With --dry-run, the git commands are planned rather than run.
+	if planner, ok := fileops.Current().(*fileops.Planner); ok {
+		if err := planPush(planner, remote, branch); err != nil {
+			return err
+		}
+		return runHooks(cf.HookPostPush, files...)
+	}
+
+	repo, w, err := openRepo(config.BackupDir, branch)
+	if err != nil {
+		return err
+	}
+
+	commitMsg := fmt.Sprintf("cfgrr push (%s)", time.Now().Format(time.RFC1123))
+
+	committed, err := commitBackup(w, config.BackupDir, commitMsg)
+	if err != nil {
+		return err
+	}
+	if !committed {
+		// Ignore the push if there are no changes.
+		fmt.Println("No changes to push")
+		return nil
+	}
+
+	fmt.Println(commitMsg)
+
+	if err := pushRepo(repo, remote); err != nil {
+		return err
+	}
+
+	return runHooks(cf.HookPostPush, files...)
+}
+
+// Opens the repository of the backup dir, initializing it if there's none, and checks out the branch if it's set.
+func openRepo(backupDir, branch string) (*git.Repository, *git.Worktree, error) {
+	repo, err := git.PlainInit(backupDir, false)
 	if err != nil {
 		if err == git.ErrRepositoryAlreadyExists {
 			// Repository already exists.
 			// Open the repository.
-			repo, err = git.PlainOpen(config.BackupDir)
+			repo, err = git.PlainOpen(backupDir)
 			if err != nil {
 				// Failed to open the repository.
-				return err
+				return nil, nil, err
 			}
 		} else {
 			// Failed to initialize the repository.
-			return err
+			return nil, nil, err
 		}
 	}
 
 	w, err := repo.Worktree()
 	if err != nil {
-		return err
+		return nil, nil, err
 	}
 
 	if branch != "" {
@@ -76,44 +130,52 @@ func pushRun(cmd *cobra.Command, args []string) (err error) {
 					Branch: branchRef,
 					Keep:   true,
 				}); err != nil {
-					return err
+					return nil, nil, err
 				}
 			} else {
-				return err
+				return nil, nil, err
 			}
 		}
 	}
 
-	// Replicate the files to make them browsable.
-	all, clean = true, true
-	if err := runReplicate(cmd, nil); err != nil {
-		return err
+	return repo, w, nil
+}
+
+// Brings the backup dir up to date, and commits all its changes with the message.
+// Returns false if there was nothing to commit.
+func commitBackup(w *git.Worktree, backupDir, message string) (bool, error) {
+	if err := prepareFiles(backupDir); err != nil {
+		return false, err
 	}
 
+	return commitWorktree(w, message)
+}
+
+// Commits the changes of the backup dir as they are.
+func commitWorktree(w *git.Worktree, message string) (bool, error) {
 	// Stage the changes.
 	if _, err := w.Add("."); err != nil {
-		return err
+		return false, err
 	}
 
 	status, err := w.Status()
 	if err != nil {
-		return err
+		return false, err
 	}
 
 	if status.IsClean() {
-		// Ignore the push if there are no changes.
-		fmt.Println("No changes to push")
-		return nil
+		return false, nil
 	}
 
-	commitMsg := fmt.Sprintf("cfgrr push (%s)", time.Now().Format(time.RFC1123))
-
-	if _, err := w.Commit(commitMsg, &git.CommitOptions{}); err != nil {
-		return err
+	if _, err := w.Commit(message, &git.CommitOptions{}); err != nil {
+		return false, err
 	}
 
-	fmt.Println(commitMsg)
+	return true, nil
+}
 
+// Pushes the commits to the remote.
+func pushRepo(repo *git.Repository, remote string) error {
 	fmt.Println("Pushing to", remote)
 
 	if err := repo.Push(&git.PushOptions{
@@ -127,3 +189,92 @@ func pushRun(cmd *cobra.Command, args []string) (err error) {
 
 	return nil
 }
+
+// Brings the backup dir up to date before it's committed.
+func prepareFiles(backupDir string) error {
+	if err := excludeLocalDirs(backupDir); err != nil {
+		return err
+	}
+
+	m, err := mapfile.NewMapFile(vconfig.GetConfig().GetMapFilePath()).Parse()
+	if err != nil {
+		return err
+	}
+	files := helpers.GetMapValues(m)
+
+	// The backups made before the shared settings were moved to the backup dir don't have them.
+	if config := vconfig.GetConfig(); !fileops.Exists(config.GetSharedFilePath()) {
+		if err := config.SaveShared(); err != nil {
+			return err
+		}
+	}
+
+	// Bring the map file up to date with the edits since the last push.
+	if err := core.SyncFiles(files...); err != nil {
+		return err
+	}
+
+	// Save revisions of the files changed since the last push.
+	if _, err := core.SaveRevisions(files...); err != nil {
+		return err
+	}
+
+	// Replicate the files to make them browsable.
+	return replicate("", replicaRoot, nil, true, true)
+}
+
+// Plans the push, the repository is only read.
+func planPush(planner *fileops.Planner, remote, branch string) error {
+	backupDir := vconfig.GetConfig().BackupDir
+
+	if _, err := git.PlainOpen(backupDir); err != nil {
+		if err != git.ErrRepositoryNotExists {
+			return err
+		}
+		planner.Plan("git init", backupDir, "")
+	}
+	if branch != "" {
+		planner.Plan("git checkout", backupDir, branch)
+	}
+
+	if err := prepareFiles(backupDir); err != nil {
+		return err
+	}
+
+	planner.Plan("git add", backupDir, ".")
+	planner.Plan("git commit", backupDir, "if anything changed")
+	planner.Plan("git push", backupDir, remote)
+	return nil
+}
+
+// Keeps the machine-local directories of the backup dir out of git.
+func excludeLocalDirs(backupDir string) error {
+	excludePath := filepath.Join(backupDir, ".git", "info", "exclude")
+	content, err := fileops.ReadFile(excludePath)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	var lines []string
+	if len(content) > 0 {
+		lines = strings.Split(strings.TrimSuffix(string(content), "\n"), "\n")
+	}
+
+	localDirs := []string{"/" + cf.HistoryDirName() + "/", "/" + core.JournalDirName + "/", "/" + core.QuarantineDirName + "/", "/" + core.WatchDirName + "/"}
+	missing := false
+	for _, dir := range localDirs {
+		if slices.Contains(lines, dir) {
+			continue
+		}
+		lines = append(lines, dir)
+		missing = true
+	}
+	if !missing {
+		return nil
+	}
+
+	if err := fileops.MkdirAll(filepath.Dir(excludePath)); err != nil {
+		return err
+	}
+
+	return fileops.WriteFile(excludePath, []byte(strings.Join(lines, "\n")+"\n"), 0644)
+}
@@ -0,0 +1,59 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/osamaadam/cfgrr/core"
+	"github.com/osamaadam/cfgrr/prompt"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+var recoverCmd = &cobra.Command{
+	Use:  "recover",
+	Args: cobra.NoArgs,
+	RunE: runRecover,
+	Example: strings.Join([]string{
+		`cfgrr recover`,
+		`cfgrr recover --revert`,
+	}, "\n"),
+	Short: "Resume or revert a backup, restore, delete or replicate that was interrupted",
+	Long: `Resume or revert a backup, restore, delete or replicate that was interrupted.
+These operations record each change they make in a journal (BACKUP_DIR/.journal), and undo their changes if they fail.
+If cfgrr is killed midway, the journal is left behind, and none of these operations runs until it's recovered.
+By default the operation is resumed: the file it was working on is started over, and the remaining files are done.
+With '--revert', all the changes it made are undone instead.`,
+}
+
+func runRecover(cmd *cobra.Command, args []string) error {
+	pending, err := core.PendingJournal()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if pending == nil {
+		fmt.Println("Nothing to recover.")
+		return nil
+	}
+
+	fmt.Printf("Found an interrupted %s started at %s.\n", pending.Command, pending.Started.Local().Format("2006-01-02 15:04:05"))
+
+	if revert {
+		if _, err := core.RevertJournal(); err != nil {
+			return errors.WithStack(err)
+		}
+		fmt.Printf("Reverted the %s.\n", pending.Command)
+		return nil
+	}
+
+	if _, err := core.ResumeJournal(prompt.PromptForConflictStrategy); err != nil {
+		return errors.WithStack(err)
+	}
+	fmt.Printf("Resumed the %s.\n", pending.Command)
+
+	return nil
+}
+
+func init() {
+	recoverCmd.Flags().BoolVar(&revert, "revert", false, "undo the changes of the interrupted operation instead of resuming it")
+}
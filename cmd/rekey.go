@@ -0,0 +1,57 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/osamaadam/cfgrr/core"
+	"github.com/osamaadam/cfgrr/vconfig"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+var rekeyCmd = &cobra.Command{
+	Use:  "rekey",
+	Args: cobra.NoArgs,
+	RunE: runRekey,
+	Example: strings.Join([]string{
+		`cfgrr rekey --length 12`,
+		`cfgrr rekey --algorithm sha256 --length 16`,
+	}, "\n"),
+	Short: "Change the format of the map file keys",
+	Long: `Change the format of the map file keys.
+Each file is keyed in the map file by a hash of its path, truncated to 8 characters by default.
+Two files hashing to the same key would be mixed up, so cfgrr refuses to track them together, in which case longer keys (or another algorithm) are needed.
+The map file, the tracked directories, the backups of older versions, and the histories are renamed to the new keys.
+The format is saved to ` + vconfig.SharedFileName + ` in the backup directory, so it's pushed along with the map file.
+Nothing is changed if the new keys collide, and the renames are undone if something fails midway.`,
+}
+
+func runRekey(cmd *cobra.Command, args []string) error {
+	config := vconfig.GetConfig()
+	if !cmd.Flags().Changed("algorithm") {
+		keyAlgorithm = config.KeyAlgorithm
+	}
+	if !cmd.Flags().Changed("length") {
+		keyLength = config.KeyLength
+	}
+
+	if keyAlgorithm == config.KeyAlgorithm && keyLength == config.KeyLength {
+		fmt.Printf("The keys are already %d characters of %s\n", keyLength, keyAlgorithm)
+		return nil
+	}
+
+	rekeyed, err := core.Rekey(keyAlgorithm, keyLength)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	fmt.Printf("Rekeyed %d file(s) to %d characters of %s\n", len(rekeyed), keyLength, keyAlgorithm)
+
+	return nil
+}
+
+func init() {
+	rekeyCmd.Flags().StringVar(&keyAlgorithm, "algorithm", "sha1", "the hash algorithm of the keys (sha1 or sha256)")
+	rekeyCmd.Flags().IntVar(&keyLength, "length", 8, "the length of the keys")
+}
@@ -0,0 +1,44 @@
+package cmd
+
+import (
+	"strings"
+
+	"github.com/osamaadam/cfgrr/core"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+var renderCmd = &cobra.Command{
+	Use:  "render <path>",
+	Args: cobra.ExactArgs(1),
+	RunE: runRender,
+	Example: strings.Join([]string{
+		`cfgrr render ~/.gitconfig`,
+	}, "\n"),
+	Short: "Preview a rendered template",
+	Long: `Print a tracked template rendered for the current machine, without touching the file.
+To learn more about templates, run 'cfgrr template --help'.`,
+}
+
+func runRender(cmd *cobra.Command, args []string) error {
+	files, err := core.GetTrackedFiles(args[0])
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	file := files[0]
+
+	if !file.Template {
+		return errors.Errorf("%s isn't a template, mark it as one with 'cfgrr template %s'", file.Path, args[0])
+	}
+
+	content, err := file.Render()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	if _, err := cmd.OutOrStdout().Write(content); err != nil {
+		return errors.WithStack(err)
+	}
+
+	return nil
+}
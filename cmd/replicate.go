@@ -2,7 +2,6 @@ package cmd
 
 import (
 	"fmt"
-	"os"
 	"strings"
 
 	"github.com/osamaadam/cfgrr/core"
@@ -23,15 +22,19 @@ var replicateCmd = &cobra.Command{
 		`cfgrr replicate --all`,
 		`cfgrr replicate -a`,
 		`cfgrr replicate -a --clean`,
+		`cfgrr replicate -a --tag shell`,
 		`cfgrr replicate ~/browsable/`,
 		`cfgrr replicate ~/browsable/ -a`,
+		`cfgrr replicate ~/browsable/home -a --root-dir ~/browsable/root`,
 	}, "\n"),
 	RunE:  runReplicate,
 	Short: "Creates a replica of the configuration files to root_dir. If the file is already browsable, updates the browsable replica",
 	Long: `Creates a replica of the configuration files to root_dir. If the file is already browsable, updates the browsable replica.
 This should be run if the user intends to put their configuration on display on any platform. By default cfgrr saves the backed up files as hashes.
 This is to avoid GNU stow's method of replicating the entire file's path structure, and instead relies on a map file to keep track which file should be restored where.
-If the user intends to keep the files private, it wouldn't make sense for them to replicate them. However, they may find it convenient for readability and syntax highlighting.`,
+If the user intends to keep the files private, it wouldn't make sense for them to replicate them. However, they may find it convenient for readability and syntax highlighting.
+Files outside the home directory (e.g. /etc/hosts) are replicated to a separate directory, 'root' by default.
+Relative directories are relative to the backup directory. With --clean, the replica directories are removed first, as long as they're inside the backup directory.`,
 }
 
 func runReplicate(cmd *cobra.Command, args []string) error {
@@ -39,6 +42,13 @@ func runReplicate(cmd *cobra.Command, args []string) error {
 	if len(args) > 0 {
 		baseDir = args[0]
 	}
+
+	return replicate(baseDir, replicaRoot, tags, all, clean)
+}
+
+// Replicates the tracked files with any of the tags (all of them if there are none) to baseDir, and the ones outside the home directory to rootDir.
+// The files are prompted for unless `all` is set, and the replica directories are removed first if `clean` is set.
+func replicate(baseDir, rootDir string, tags []string, all, clean bool) error {
 	config := vconfig.GetConfig()
 
 	mapFile := mapfile.NewMapFile(config.GetMapFilePath())
@@ -48,15 +58,18 @@ func runReplicate(cmd *cobra.Command, args []string) error {
 		return errors.WithStack(err)
 	}
 
-	files := helpers.GetMapValues(m)
+	files := core.FilterByTags(helpers.GetMapValues(m), tags...)
 
 	if baseDir == "" {
 		baseDir = "home"
 	}
 
 	if clean {
-		if err := os.RemoveAll(baseDir); err != nil {
-			return errors.WithStack(err)
+		// Relative directories are relative to the backup dir, not the working directory.
+		for _, dir := range []string{baseDir, rootDir} {
+			if err := core.RemoveReplica(dir); err != nil {
+				return errors.WithStack(err)
+			}
 		}
 	}
 
@@ -72,7 +85,7 @@ func runReplicate(cmd *cobra.Command, args []string) error {
 		return nil
 	}
 
-	if err := core.MakeFilesBrowsable(baseDir, files...); err != nil {
+	if err := core.MakeFilesBrowsable(baseDir, rootDir, files...); err != nil {
 		return errors.WithStack(err)
 	}
 
@@ -81,5 +94,7 @@ func runReplicate(cmd *cobra.Command, args []string) error {
 
 func init() {
 	replicateCmd.Flags().BoolVarP(&all, "all", "a", false, "replicate all files in the backup directory (skip prompt)")
-	replicateCmd.Flags().BoolVar(&clean, "clean", false, "remove all files in the replica directory before replicating")
+	replicateCmd.Flags().StringSliceVar(&tags, "tag", nil, "only replicate the files with any of the tags")
+	replicateCmd.Flags().StringVar(&replicaRoot, "root-dir", "root", "the replica directory of the files outside the home directory")
+	replicateCmd.Flags().BoolVar(&clean, "clean", false, "remove all files in the replica directories before replicating, they must be inside the backup directory")
 }
@@ -0,0 +1,68 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/osamaadam/cfgrr/core"
+	"github.com/osamaadam/cfgrr/helpers"
+	"github.com/osamaadam/cfgrr/vconfig"
+)
+
+func TestReplicateCmd_Clean(t *testing.T) {
+	orgDir := t.TempDir()
+	backupDir := t.TempDir()
+	vconfig.GetConfig().SetBackupDir(backupDir)
+	files := _createFilesToBackup(orgDir, ".vimrc")
+	if err := core.BackupFiles(files...); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// Flags persist between executions.
+	prevAll, prevClean, prevReplicaRoot := all, clean, replicaRoot
+	t.Cleanup(func() { all, clean, replicaRoot = prevAll, prevClean, prevReplicaRoot })
+
+	// The working directory has replica-like directories of its own.
+	cwd := t.TempDir()
+	for _, dir := range []string{"home", "root"} {
+		os.MkdirAll(filepath.Join(cwd, dir), 0755)
+		os.WriteFile(filepath.Join(cwd, dir, "keep"), []byte("keep"), 0644)
+	}
+	wd, _ := os.Getwd()
+	os.Chdir(cwd)
+	t.Cleanup(func() { os.Chdir(wd) })
+
+	rootCmd.SetArgs([]string{"replicate", "-a", "--clean"})
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for _, dir := range []string{"home", "root"} {
+		if !helpers.CheckFileExists(filepath.Join(cwd, dir, "keep")) {
+			t.Errorf("expected %s in the working directory to be left as is", dir)
+		}
+	}
+	replicaDir := "home"
+	if files[0].IsRoot() {
+		replicaDir = "root"
+	}
+	replica := filepath.Join(backupDir, replicaDir, files[0].Path)
+	if !helpers.CheckFileExists(replica) {
+		t.Errorf("expected the replica at %s", replica)
+	}
+
+	// Directories outside the backup dir are never cleaned.
+	for _, args := range [][]string{
+		{"replicate", cwd, "-a", "--clean"},
+		{"replicate", ".internals", "-a", "--clean"},
+		{"replicate", "-a", "--clean", "--root-dir", ".."},
+	} {
+		rootCmd.SetArgs(args)
+		if err := rootCmd.Execute(); err == nil {
+			t.Errorf("expected %v to be refused", args)
+		}
+	}
+	if !helpers.CheckFileExists(filepath.Join(cwd, "home", "keep")) || !helpers.CheckFileExists(files[0].BackupPath()) {
+		t.Errorf("expected nothing to be removed")
+	}
+}
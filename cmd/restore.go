@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"strings"
 
+	cf "github.com/osamaadam/cfgrr/configfile"
 	"github.com/osamaadam/cfgrr/core"
 	"github.com/osamaadam/cfgrr/helpers"
 	"github.com/osamaadam/cfgrr/mapfile"
@@ -20,6 +21,8 @@ var restoreCmd = &cobra.Command{
 	Example: strings.Join([]string{
 		`cfgrr restore`,
 		`cfgrr restore -a`,
+		`cfgrr restore -a --conflict prompt`,
+		`cfgrr restore -a --tag shell`,
 		`cfgrr r -d /path/to/config/dir`,
 		`cfgrr r -d /path/to/config/dir -m cfgrrmap.yaml`,
 	}, "\n"),
@@ -27,10 +30,21 @@ var restoreCmd = &cobra.Command{
 	Short: "Restore the configuration files from the backup directory",
 	Long: `Restore the configuration files from the backup directory.
 This creates a symlink to the file in the backup directory. cfgrr keeps track of where each file should be restored to in its 'cfgrrmap.yaml' file in the backup directory.
-The user would be prompted to pick which files they'd like to restore.`,
+The user would be prompted to pick which files they'd like to restore, only the files with any of the --tag tags are restored if it's set.
+The files whose conditions don't hold on this machine (see 'cfgrr condition --help') are skipped, and listed with the reason.
+A file already at the restore location that cfgrr doesn't manage is resolved with the '--conflict' strategy:
+  keep-both  moves the local file next to the restored one with a '` + cf.OrigSuffix + `' suffix (the default)
+  skip       leaves the local file as is
+  overwrite  replaces the local file
+  prompt     shows how the local file differs from the backup, and asks which of the above to do`,
 }
 
 func restore(cmd *cobra.Command, args []string) error {
+	strategy, err := cf.ParseConflictStrategy(conflict)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
 	config := vconfig.GetConfig()
 	backupDir := config.BackupDir
 
@@ -45,7 +59,10 @@ func restore(cmd *cobra.Command, args []string) error {
 		return errors.WithStack(err)
 	}
 
-	files := helpers.GetMapValues(m)
+	files, inapplicable := core.SplitApplicable(core.FilterByTags(helpers.GetMapValues(m), tags...)...)
+	for _, skipped := range inapplicable {
+		fmt.Printf("skipped %s, %s\n", skipped.File.PathAbs(), skipped.Reason)
+	}
 
 	if !all {
 		files, err = prompt.PromptForFileSelection(files, "Select the files to restore: ")
@@ -59,13 +76,50 @@ func restore(cmd *cobra.Command, args []string) error {
 		return nil
 	}
 
-	if err := core.RestoreFiles(files...); err != nil {
+	if err := runHooks(cf.HookPreRestore, files...); err != nil {
 		return errors.WithStack(err)
 	}
 
-	return nil
+	results, err := core.RestoreFiles(strategy, prompt.PromptForConflictStrategy, files...)
+	printRestoreSummary(results)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	restored := make([]*cf.ConfigFile, 0, len(results))
+	for _, result := range results {
+		if result.Action != cf.RestoreSkipped {
+			restored = append(restored, result.File)
+		}
+	}
+	if len(restored) == 0 {
+		return nil
+	}
+
+	return errors.WithStack(runHooks(cf.HookPostRestore, restored...))
+}
+
+// Prints what was done to each restored file, the ones that conflicted are listed.
+func printRestoreSummary(results []cf.RestoreResult) {
+	counts := make(map[cf.RestoreAction]int)
+	for _, result := range results {
+		counts[result.Action]++
+		switch result.Action {
+		case cf.RestoreSkipped:
+			fmt.Printf("skipped %s, the local file was kept\n", result.File.PathAbs())
+		case cf.RestoreOverwritten:
+			fmt.Printf("overwrote %s\n", result.File.PathAbs())
+		case cf.RestoreKeptBoth:
+			fmt.Printf("restored %s, the local file was moved to %s\n", result.File.PathAbs(), result.Sidecar)
+		}
+	}
+
+	fmt.Printf("%d restored, %d kept both, %d overwritten, %d skipped\n",
+		counts[cf.RestoreRestored], counts[cf.RestoreKeptBoth], counts[cf.RestoreOverwritten], counts[cf.RestoreSkipped])
 }
 
 func init() {
 	restoreCmd.Flags().BoolVarP(&all, "all", "a", false, "restore all files in the backup directory (skip prompt)")
+	restoreCmd.Flags().StringSliceVar(&tags, "tag", nil, "only restore the files with any of the tags")
+	restoreCmd.Flags().StringVar(&conflict, "conflict", string(cf.ConflictKeepBoth), "what to do with local files in the way (keep-both, skip, overwrite or prompt)")
 }
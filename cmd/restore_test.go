@@ -6,6 +6,7 @@ import (
 	"strings"
 	"testing"
 
+	cf "github.com/osamaadam/cfgrr/configfile"
 	"github.com/osamaadam/cfgrr/core"
 	"github.com/osamaadam/cfgrr/helpers"
 	"github.com/osamaadam/cfgrr/vconfig"
@@ -13,19 +14,24 @@ import (
 
 func TestRestoreCmd(t *testing.T) {
 	tests := []struct {
-		name                  string
-		args                  []string
+		name string
+		args []string
+		// The --all flag as an earlier execution left it, flags persist between executions.
+		all                   bool
 		filesToBackup         []string
 		expectedRestoredFiles []string
 	}{
-		{"no args", []string{}, _dummyTestFiles, nil},
-		{"restore all files", []string{"-a"}, _dummyTestFiles, _dummyTestFiles},
-		{"no files to restore", []string{"-a"}, nil, nil},
+		{"no args after --all", []string{}, true, _dummyTestFiles, nil},
+		{"restore all files", []string{"-a"}, false, _dummyTestFiles, _dummyTestFiles},
+		{"no files to restore", []string{"-a"}, false, nil, nil},
 	}
+	prevAll, prevTags := all, tags
+	t.Cleanup(func() { all, tags = prevAll, prevTags })
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			orgDir, _ := _restoreSetup(t, tt.filesToBackup...)
+			all, tags = tt.all, nil
 
 			args := append([]string{"restore"}, tt.args...)
 
@@ -66,3 +72,40 @@ func _restoreSetup(t *testing.T, fileNames ...string) (orgDir, backupDir string)
 
 	return orgDir, backupDir
 }
+
+func TestRestoreCmd_Conflict(t *testing.T) {
+	tests := []struct {
+		name        string
+		args        []string
+		wantLocal   bool
+		wantSidecar bool
+	}{
+		{"keep both by default", []string{"-a"}, false, true},
+		{"skip", []string{"-a", "--conflict", "skip"}, true, false},
+		{"overwrite", []string{"-a", "--conflict", "overwrite"}, false, false},
+	}
+	t.Cleanup(func() { conflict = string(cf.ConflictKeepBoth) })
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conflict = string(cf.ConflictKeepBoth)
+			orgDir, _ := _restoreSetup(t, ".bashrc")
+			localPath := filepath.Join(orgDir, ".bashrc")
+			os.MkdirAll(orgDir, 0755)
+			os.WriteFile(localPath, []byte("local"), 0644)
+
+			tCmd := rootCmd
+			tCmd.SetArgs(append([]string{"restore"}, tt.args...))
+			if err := tCmd.Execute(); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if content, _ := os.ReadFile(localPath); (string(content) == "local") != tt.wantLocal {
+				t.Errorf("expected the local file to be kept in place: %v, got %q", tt.wantLocal, content)
+			}
+			if exists := helpers.CheckFileExists(localPath + cf.OrigSuffix); exists != tt.wantSidecar {
+				t.Errorf("expected the sidecar to exist: %v, got %v", tt.wantSidecar, exists)
+			}
+		})
+	}
+}
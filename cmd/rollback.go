@@ -0,0 +1,66 @@
+package cmd
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/osamaadam/cfgrr/core"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+var rollbackCmd = &cobra.Command{
+	Use:     "rollback <path> [rev]",
+	Aliases: []string{"rb"},
+	Args:    cobra.RangeArgs(1, 2),
+	RunE:    runRollback,
+	Example: strings.Join([]string{
+		`cfgrr rollback ~/.zshrc`,
+		`cfgrr rollback ~/.zshrc 3`,
+		`cfgrr rb ~/.config/nvim/init.vim 7`,
+	}, "\n"),
+	Short: "Replace a tracked file with one of its saved revisions",
+	Long: `Replace a tracked file with one of its saved revisions (run 'cfgrr history <path>' to list them).
+If no revision is given, the latest revision that differs from the current content is used.
+The current content (including the changes made to a copy of the file) is saved as a revision before rolling back, so a rollback could be undone by rolling back again.`,
+}
+
+func runRollback(cmd *cobra.Command, args []string) error {
+	files, err := core.GetTrackedFiles(args[0])
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	file := files[0]
+
+	revs, err := file.History()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	id := 0
+	if len(args) > 1 {
+		id, err = strconv.Atoi(args[1])
+		if err != nil {
+			return errors.Errorf("invalid revision %q", args[1])
+		}
+	} else {
+		for i := len(revs) - 1; i >= 0; i-- {
+			if ok, _ := file.IsCurrent(revs[i]); !ok {
+				id = revs[i].ID
+				break
+			}
+		}
+		if id == 0 {
+			return errors.Errorf("no earlier revision of %s to roll back to", file.Path)
+		}
+	}
+
+	if err := core.RollbackFile(file, id); err != nil {
+		return errors.WithStack(err)
+	}
+
+	fmt.Printf("Rolled %s back to revision %d\n", file, id)
+
+	return nil
+}
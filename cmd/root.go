@@ -8,7 +8,9 @@ import (
 	"time"
 
 	"github.com/osamaadam/cfgrr/vconfig"
+	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 )
 
 var rootCmd = &cobra.Command{
@@ -17,8 +19,9 @@ var rootCmd = &cobra.Command{
 	Long: `cfgrr is a tool for managing config files inspired by GNU Stow.
 Essentially, what cfgrr enables you to do is to centralize your config files, creating symlinks of them wherever necessary.
 This enables the user to backup their config files to say Git, and restore the files easily.`,
-	SilenceErrors: true,
-	SilenceUsage:  true,
+	SilenceErrors:     true,
+	SilenceUsage:      true,
+	PersistentPreRunE: checkDryRun,
 }
 
 func Execute(version, tagdate, pkgPath string) error {
@@ -39,6 +42,10 @@ func Execute(version, tagdate, pkgPath string) error {
 	rootCmd.SetVersionTemplate(versionTemplate)
 
 	if err := rootCmd.Execute(); err != nil {
+		var exitErr *ExitError
+		if errors.As(err, &exitErr) {
+			return err
+		}
 		if tedious {
 			fmt.Fprintf(os.Stderr, "ERROR: %+v\n", err)
 		} else {
@@ -50,8 +57,26 @@ func Execute(version, tagdate, pkgPath string) error {
 	return nil
 }
 
+// Makes cfgrr exit with the given status, whatever caused it was already reported.
+type ExitError struct {
+	Code int
+}
+
+func (e *ExitError) Error() string {
+	return fmt.Sprintf("exit status %d", e.Code)
+}
+
+// Tags double as group names, so --group is accepted for --tag.
+func normalizeFlagName(f *pflag.FlagSet, name string) pflag.NormalizedName {
+	if name == "group" {
+		name = "tag"
+	}
+	return pflag.NormalizedName(name)
+}
+
 func init() {
 	cobra.OnInitialize(initConfig)
+	rootCmd.SetGlobalNormalizationFunc(normalizeFlagName)
 	homedir, err := os.UserHomeDir()
 	if err != nil {
 		panic(err)
@@ -64,6 +89,9 @@ func init() {
 	rootCmd.PersistentFlags().StringSliceP("ignore_files", "i", []string{".cfgrrignore", ".gitignore"}, "ignore file")
 	rootCmd.PersistentFlags().StringP("map_file", "m", c.MapFile, "map file")
 	rootCmd.PersistentFlags().BoolVarP(&tedious, "tedious", "t", false, "print verbose errors")
+	rootCmd.PersistentFlags().BoolVar(&dryRun, "dry-run", false, "print the changes instead of making them (backup, restore, delete, replicate, push, import and export)")
+	rootCmd.PersistentFlags().BoolVar(&jsonOutput, "json", false, "print the plan of --dry-run as JSON")
+	rootCmd.PersistentFlags().BoolVar(&noHooks, "no-hooks", false, "don't run the hooks (see 'cfgrr hook --help')")
 
 	rootCmd.MarkFlagDirname("backup_dir")
 	rootCmd.MarkFlagFilename("map_file", "yaml", "json")
@@ -88,6 +116,27 @@ func init() {
 	rootCmd.AddCommand(replicateCmd)
 	rootCmd.AddCommand(pushCmd)
 	rootCmd.AddCommand(cloneCmd)
+	rootCmd.AddCommand(historyCmd)
+	rootCmd.AddCommand(rollbackCmd)
+	rootCmd.AddCommand(migrateCmd)
+	rootCmd.AddCommand(linkCmd)
+	rootCmd.AddCommand(templateCmd)
+	rootCmd.AddCommand(renderCmd)
+	rootCmd.AddCommand(encryptCmd)
+	rootCmd.AddCommand(decryptCmd)
+	rootCmd.AddCommand(rekeyCmd)
+	rootCmd.AddCommand(recoverCmd)
+	rootCmd.AddCommand(statusCmd)
+	rootCmd.AddCommand(doctorCmd)
+	rootCmd.AddCommand(exportCmd)
+	rootCmd.AddCommand(importCmd)
+	rootCmd.AddCommand(conditionCmd)
+	rootCmd.AddCommand(tagCmd)
+	rootCmd.AddCommand(listCmd)
+	rootCmd.AddCommand(diffCmd)
+	rootCmd.AddCommand(editCmd)
+	rootCmd.AddCommand(hookCmd)
+	rootCmd.AddCommand(watchCmd)
 }
 
 func initConfig() {
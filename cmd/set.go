@@ -9,14 +9,15 @@ import (
 )
 
 var setCmd = &cobra.Command{
-	Use:     "set [key] [value]",
+	Use:     "set [key] [...values]",
 	Aliases: []string{"s"},
-	Args:    cobra.ExactArgs(2),
+	Args:    cobra.MinimumNArgs(2),
 	RunE:    runSet,
 	Example: strings.Join([]string{
 		`cfgrr set backup_dir /path/to/backup/dir`,
 		`cfgrr s map_file cfgrrmap.yaml`,
 		`cfgrr s ignore_file .cfgrrignore`,
+		`cfgrr s xattrs "user.*" "com.apple.metadata:*"`,
 	}, "\n"),
 	Short: "Set the value of a configuration variable",
 	Long: `Set the value of a configuration variable.
@@ -0,0 +1,179 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	cf "github.com/osamaadam/cfgrr/configfile"
+	"github.com/osamaadam/cfgrr/core"
+	"github.com/osamaadam/cfgrr/helpers"
+	"github.com/osamaadam/cfgrr/mapfile"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+var statusCmd = &cobra.Command{
+	Use:     "status",
+	Aliases: []string{"st"},
+	Args:    cobra.NoArgs,
+	RunE:    runStatus,
+	Example: strings.Join([]string{
+		`cfgrr status`,
+		`cfgrr st -s`,
+		`cfgrr status --porcelain`,
+		`cfgrr status --tag shell`,
+	}, "\n"),
+	Short: "Show which tracked files drifted from the map file",
+	Long: `Show which tracked files drifted from the map file, i.e. whether this machine is in sync.
+Each file is classified as:
+` + driftUsage() + `
+With '--short', only the drifted files are listed, one per line.
+The files whose conditions don't hold on this machine (see 'cfgrr condition --help') aren't checked, and are listed as skipped.
+With '--porcelain', every file is listed as '<drifts> <path>', with 'ok' for the files in sync and 'skipped' for the ones that don't belong on this machine, in a format that's stable for scripts.
+The exit status is 1 if any file drifted.`,
+}
+
+// The meaning of each drift, in the order they're listed.
+var driftDescriptions = []struct {
+	drift       cf.Drift
+	description string
+}{
+	{cf.DriftMissing, "nothing is at the file's location, run 'cfgrr restore' to restore it"},
+	{cf.DriftElsewhere, "the file is a symlink pointing somewhere other than its backup"},
+	{cf.DriftReplaced, "a regular file took the place of the link, e.g. an editor saved the file atomically"},
+	{cf.DriftNoBackup, "the backup file is missing from the backup directory"},
+	{cf.DriftModified, "the file (or the output of the dump command of a command entry) changed since the last push"},
+	{cf.DriftMode, "the permissions of the file changed"},
+}
+
+func driftUsage() string {
+	lines := []string{fmt.Sprintf("  %-10s the file is in sync", "ok")}
+	for _, d := range driftDescriptions {
+		lines = append(lines, fmt.Sprintf("  %-10s %s", d.drift, d.description))
+	}
+	return strings.Join(lines, "\n")
+}
+
+func runStatus(cmd *cobra.Command, args []string) error {
+	m, err := mapfile.NewMapFile().Parse()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	files := core.FilterByTags(helpers.GetMapValues(m), tags...)
+	sort.Slice(files, func(i, j int) bool { return files[i].PathAbs() < files[j].PathAbs() })
+
+	statuses, err := core.Status(files...)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	drifted := 0
+	for _, status := range statuses {
+		if len(status.Drifts) > 0 {
+			drifted++
+		}
+	}
+
+	out := cmd.OutOrStdout()
+	switch {
+	case porcelain:
+		for _, status := range statuses {
+			state := joinDrifts(status.Drifts)
+			if status.Unmet != "" {
+				state = "skipped"
+			}
+			fmt.Fprintf(out, "%s %s\n", state, status.File.PathAbs())
+		}
+	case short:
+		for _, status := range statuses {
+			if len(status.Drifts) > 0 {
+				fmt.Fprintf(out, "%s %s\n", joinDrifts(status.Drifts), displayPath(status.File.PathAbs()))
+			}
+		}
+	default:
+		printStatus(out, statuses, drifted)
+	}
+
+	if drifted > 0 {
+		return &ExitError{Code: 1}
+	}
+	return nil
+}
+
+func joinDrifts(drifts []cf.Drift) string {
+	if len(drifts) == 0 {
+		return "ok"
+	}
+	names := make([]string, len(drifts))
+	for i, drift := range drifts {
+		names[i] = string(drift)
+	}
+	return strings.Join(names, ",")
+}
+
+// Lists the drifted files grouped by how they drifted, and the ones that don't belong on this machine.
+func printStatus(out io.Writer, statuses []core.FileStatus, drifted int) {
+	var skipped []core.FileStatus
+	for _, status := range statuses {
+		if status.Unmet != "" {
+			skipped = append(skipped, status)
+		}
+	}
+	if len(skipped) > 0 {
+		fmt.Fprintln(out, "skipped (the files don't belong on this machine):")
+		for _, status := range skipped {
+			fmt.Fprintf(out, "    %s: %s\n", displayPath(status.File.PathAbs()), status.Unmet)
+		}
+		fmt.Fprintln(out)
+	}
+
+	checked := len(statuses) - len(skipped)
+	if drifted == 0 {
+		fmt.Fprintf(out, "All %d files are in sync\n", checked)
+		return
+	}
+
+	for _, d := range driftDescriptions {
+		var paths []string
+		for _, status := range statuses {
+			for _, drift := range status.Drifts {
+				if drift == d.drift {
+					paths = append(paths, displayPath(status.File.PathAbs()))
+				}
+			}
+		}
+		if len(paths) == 0 {
+			continue
+		}
+
+		fmt.Fprintf(out, "%s (%s):\n", d.drift, d.description)
+		for _, path := range paths {
+			fmt.Fprintf(out, "    %s\n", path)
+		}
+		fmt.Fprintln(out)
+	}
+
+	fmt.Fprintf(out, "%d of %d files drifted\n", drifted, checked)
+}
+
+// Returns the path relative to the home directory if it's in it.
+func displayPath(path string) string {
+	homedir, err := os.UserHomeDir()
+	if err != nil {
+		return path
+	}
+	if rel, err := filepath.Rel(homedir, path); err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return filepath.Join("~", rel)
+	}
+	return path
+}
+
+func init() {
+	statusCmd.Flags().StringSliceVar(&tags, "tag", nil, "only check the files with any of the tags")
+	statusCmd.Flags().BoolVarP(&short, "short", "s", false, "only list the drifted files, one per line")
+	statusCmd.Flags().BoolVar(&porcelain, "porcelain", false, "list every file in a format that's stable for scripts")
+}
@@ -0,0 +1,106 @@
+package cmd
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	cf "github.com/osamaadam/cfgrr/configfile"
+	"github.com/osamaadam/cfgrr/core"
+	"github.com/osamaadam/cfgrr/helpers"
+	"github.com/osamaadam/cfgrr/mapfile"
+	"github.com/osamaadam/cfgrr/prompt"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+var tagCmd = &cobra.Command{
+	Use:     "tag [...paths]",
+	Aliases: []string{"group"},
+	RunE:    runTag,
+	Example: strings.Join([]string{
+		`cfgrr tag`,
+		`cfgrr tag ~/.zshrc ~/.bashrc --add shell`,
+		`cfgrr tag ~/.zshrc --add work --remove personal`,
+		`cfgrr restore -a --tag shell`,
+	}, "\n"),
+	Short: "Tag tracked files, to select them by tag",
+	Long: `Tag tracked files (i.e. put them in named groups), to select them by tag.
+The files could be tagged on backup with 'cfgrr backup --tag <tag>' too.
+'restore', 'delete', 'replicate' and 'status' only work on the files with any of the tags given to --tag (or --group).
+Without --add or --remove, the tags of the given files are listed, or all the tags with their number of files if no files were provided.
+In case no files were provided to --add or --remove, the user will be prompted to choose the files.`,
+}
+
+func runTag(cmd *cobra.Command, args []string) error {
+	files, err := core.GetTrackedFiles(args...)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	if len(addTags) == 0 && len(removeTags) == 0 {
+		return listTags(files)
+	}
+
+	if len(files) == 0 {
+		m, err := mapfile.NewMapFile().Parse()
+		if err != nil {
+			return errors.WithStack(err)
+		}
+
+		files, err = prompt.PromptForFileSelection(helpers.GetMapValues(m), "Select the files to tag: ")
+		if err != nil {
+			return errors.WithStack(err)
+		}
+	}
+
+	if len(files) == 0 {
+		fmt.Println("No files selected, terminating...")
+		return nil
+	}
+
+	if err := core.TagFiles(addTags, removeTags, files...); err != nil {
+		return errors.WithStack(err)
+	}
+
+	return listTags(files)
+}
+
+// Lists the tags of the files, or all the tags with their number of files if there are no files.
+func listTags(files []*cf.ConfigFile) error {
+	if len(files) > 0 {
+		for _, file := range files {
+			fmt.Printf("%s: %s\n", displayPath(file.PathAbs()), strings.Join(file.Tags, ", "))
+		}
+		return nil
+	}
+
+	m, err := mapfile.NewMapFile().Parse()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	counts := make(map[string]int)
+	for _, file := range m {
+		for _, tag := range file.Tags {
+			counts[tag]++
+		}
+	}
+	if len(counts) == 0 {
+		fmt.Println("No files are tagged, run 'cfgrr tag --help' to tag them")
+		return nil
+	}
+
+	tags := helpers.GetMapKeys(counts)
+	sort.Strings(tags)
+	for _, tag := range tags {
+		fmt.Printf("%s (%d files)\n", tag, counts[tag])
+	}
+
+	return nil
+}
+
+func init() {
+	tagCmd.Flags().StringSliceVar(&addTags, "add", nil, "the tags to add to the files")
+	tagCmd.Flags().StringSliceVar(&removeTags, "remove", nil, "the tags to remove from the files")
+}
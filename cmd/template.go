@@ -0,0 +1,72 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/osamaadam/cfgrr/core"
+	"github.com/osamaadam/cfgrr/helpers"
+	"github.com/osamaadam/cfgrr/mapfile"
+	"github.com/osamaadam/cfgrr/prompt"
+	"github.com/osamaadam/cfgrr/vconfig"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+var templateCmd = &cobra.Command{
+	Use:     "template [...paths]",
+	Aliases: []string{"tmpl"},
+	RunE:    runTemplate,
+	Example: strings.Join([]string{
+		`cfgrr template ~/.gitconfig`,
+		`cfgrr tmpl ~/.gitconfig --off`,
+		`cfgrr set vars.email me@example.com`,
+	}, "\n"),
+	Short: "Mark tracked files as templates rendered per machine",
+	Long: `Mark tracked files as templates rendered per machine.
+The backup of a template is a Go template (https://pkg.go.dev/text/template), rendered into a copy of the file on restore.
+The templates have access to:
+- .Hostname, .OS, .Arch, .User and .Home of the current machine.
+- .Env, the environment variables (e.g. {{ .Env.EDITOR }}).
+- .Vars, the variables defined under 'vars' in the config file (e.g. {{ .Vars.email }}), set with 'cfgrr set vars.<name> <value>'.
+Referencing a missing variable is an error, use 'index' (e.g. {{ index .Env "EDITOR" }}) for optional ones.
+To edit a template, edit its backup file, then restore the file to render it again. Changes made to the rendered file are never pulled into the backup.
+With --off, the files are no longer rendered, and the raw backup is copied in place instead.
+To preview the rendered file, run 'cfgrr render --help'.
+In case no files were provided, the user will be prompted to choose the files.`,
+}
+
+func runTemplate(cmd *cobra.Command, args []string) error {
+	files, err := core.GetTrackedFiles(args...)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	if len(files) == 0 {
+		config := vconfig.GetConfig()
+		m, err := mapfile.NewMapFile(config.GetMapFilePath()).Parse()
+		if err != nil {
+			return errors.WithStack(err)
+		}
+
+		files, err = prompt.PromptForFileSelection(helpers.GetMapValues(m), "Select the files to mark as templates: ")
+		if err != nil {
+			return errors.WithStack(err)
+		}
+	}
+
+	if len(files) == 0 {
+		fmt.Println("No files selected, terminating...")
+		return nil
+	}
+
+	if err := core.TemplateFiles(!templateOff, files...); err != nil {
+		return errors.WithStack(err)
+	}
+
+	return nil
+}
+
+func init() {
+	templateCmd.Flags().BoolVar(&templateOff, "off", false, "stop treating the files as templates")
+}
@@ -1,11 +1,57 @@
 package cmd
 
+import "time"
+
 var (
-	clean          bool
-	all            bool
-	replace        bool
-	tedious        bool
-	configPatterns []string
-	cfgFile        string
-	branch         string
+	clean             bool
+	replicaRoot       string
+	keyAlgorithm      string
+	keyLength         int
+	all               bool
+	replace           bool
+	trackDirs         bool
+	linkMode          string
+	conflict          string
+	revert            bool
+	short             bool
+	porcelain         bool
+	fix               bool
+	doctorChecks      []string
+	importTarget      string
+	stowDotfiles      bool
+	overwrite         bool
+	assumeYes         bool
+	conditionHosts    []string
+	conditionOS       []string
+	conditionArch     []string
+	conditionEnv      []string
+	conditionCommands []string
+	clearConditions   bool
+	tags              []string
+	addTags           []string
+	removeTags        []string
+	listFormat        string
+	showFormat        string
+	diffRev           string
+	diffRemote        bool
+	noHooks           bool
+	hookEvent         string
+	addHooks          []string
+	removeHooks       []string
+	commandName       string
+	dumpCommand       string
+	loadCommand       string
+	watchDebounce     time.Duration
+	pushInterval      time.Duration
+	foreground        bool
+	stopWatch         bool
+	asTemplate        bool
+	templateOff       bool
+	encrypt           bool
+	tedious           bool
+	dryRun            bool
+	jsonOutput        bool
+	configPatterns    []string
+	cfgFile           string
+	branch            string
 )
@@ -0,0 +1,337 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	cf "github.com/osamaadam/cfgrr/configfile"
+	"github.com/osamaadam/cfgrr/core"
+	"github.com/osamaadam/cfgrr/crypt"
+	"github.com/osamaadam/cfgrr/fileops"
+	"github.com/osamaadam/cfgrr/helpers"
+	"github.com/osamaadam/cfgrr/mapfile"
+	"github.com/osamaadam/cfgrr/vconfig"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+var watchCmd = &cobra.Command{
+	Use:  "watch",
+	Args: cobra.NoArgs,
+	RunE: runWatch,
+	Example: strings.Join([]string{
+		`cfgrr watch`,
+		`cfgrr watch --push-interval 1h`,
+		`cfgrr watch --foreground --debounce 5s`,
+		`cfgrr watch --stop`,
+	}, "\n"),
+	Short: "Commit the changes to the tracked files as they happen",
+	Long: `Watch the tracked files, and commit their changes to the backup directory's repository as they happen.
+The blobs in .internals, the backups of the tracked directories, the live files and the map file are watched.
+A burst of writes (e.g. an editor saving a file) is committed once no more happened for --debounce, with a message listing the changed files.
+The files that drifted from their backup instead, e.g. a symlinked file an editor replaced with a copy, aren't committed but logged, run 'cfgrr status' to see them.
+With --push-interval, the commits are pushed to the remote that often, and when the watcher stops.
+The changes of command entries (see 'cfgrr backup --help') aren't watched, they're committed along with the next change of a file.
+The watcher can't prompt for a passphrase, if any file is encrypted it only starts with 'key_file' set in the config or ` + crypt.PassphraseEnv + ` set.
+The watcher runs in the background, its log is written to ` + filepath.Join(core.WatchDirName, "watch.log") + ` in the backup directory, run 'cfgrr watch --stop' to stop it.
+With --foreground, it runs in the foreground logging to the standard output instead, e.g. as a systemd user service:
+  [Service]
+  ExecStart=cfgrr watch --foreground --push-interval 1h
+On Windows, stopping the watcher drops the changes it didn't commit yet.`,
+}
+
+func pidPath() string {
+	return filepath.Join(core.WatchDir(), "watch.pid")
+}
+
+func watchLogPath() string {
+	return filepath.Join(core.WatchDir(), "watch.log")
+}
+
+func runWatch(cmd *cobra.Command, args []string) error {
+	if stopWatch {
+		return stopWatcher()
+	}
+
+	if p, err := runningWatcher(); err != nil {
+		return errors.WithStack(err)
+	} else if p != nil {
+		return errors.Errorf("a watcher is already running (pid %d), run 'cfgrr watch --stop' to stop it", p.Pid)
+	}
+
+	if err := checkWatchSecret(); err != nil {
+		return errors.WithStack(err)
+	}
+
+	if !foreground {
+		return startWatcher()
+	}
+
+	return watch(cmd)
+}
+
+// Checks the encrypted files could be backed up without a passphrase prompt, which the watcher can't answer.
+func checkWatchSecret() error {
+	m, err := mapfile.NewMapFile().Parse()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if !slices.ContainsFunc(helpers.GetMapValues(m), func(file *cf.ConfigFile) bool { return file.Encrypted }) {
+		return nil
+	}
+
+	if err := crypt.CheckSecret(); err != nil {
+		return errors.WithMessage(err, "the watcher can't prompt for the passphrase of the encrypted files")
+	}
+
+	return nil
+}
+
+// Returns the running watcher, or nil if there's none.
+func runningWatcher() (*os.Process, error) {
+	content, err := fileops.ReadFile(pidPath())
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	pid, err := strconv.Atoi(strings.TrimSpace(string(content)))
+	if err != nil {
+		// A stale pid file.
+		return nil, nil
+	}
+	p, err := os.FindProcess(pid)
+	if err != nil || !processAlive(p) {
+		return nil, nil
+	}
+
+	return p, nil
+}
+
+// Runs the watcher in the foreground again, detached in the background.
+func startWatcher() error {
+	executable, err := os.Executable()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	if err := fileops.MkdirAll(core.WatchDir()); err != nil {
+		return errors.WithStack(err)
+	}
+	logFile, err := os.OpenFile(watchLogPath(), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer logFile.Close()
+
+	c := exec.Command(executable, append(os.Args[1:], "--foreground")...)
+	c.Stdout, c.Stderr = logFile, logFile
+	detach(c)
+	if err := c.Start(); err != nil {
+		return errors.WithMessage(err, "couldn't start the watcher")
+	}
+
+	fmt.Printf("Watching in the background (pid %d), the log is at %s\n", c.Process.Pid, displayPath(watchLogPath()))
+	fmt.Println("Run 'cfgrr watch --stop' to stop it")
+
+	return errors.WithStack(c.Process.Release())
+}
+
+// Stops the running watcher, and waits for it to commit the pending changes.
+func stopWatcher() error {
+	p, err := runningWatcher()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if p == nil {
+		fmt.Println("No watcher is running")
+		return nil
+	}
+
+	if err := stopProcess(p); err != nil {
+		return errors.WithMessagef(err, "couldn't stop the watcher (pid %d)", p.Pid)
+	}
+
+	// The watcher removes its pid file once it's done.
+	for i := 0; i < 100 && fileops.Exists(pidPath()); i++ {
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	fmt.Printf("Stopped the watcher (pid %d)\n", p.Pid)
+	return nil
+}
+
+// Watches the files until it's interrupted, committing their changes and pushing them every --push-interval.
+func watch(cmd *cobra.Command) error {
+	config := vconfig.GetConfig()
+	logger := log.New(cmd.OutOrStdout(), "", log.LstdFlags)
+
+	if err := fileops.MkdirAll(core.WatchDir()); err != nil {
+		return errors.WithStack(err)
+	}
+	if err := fileops.WriteFile(pidPath(), []byte(strconv.Itoa(os.Getpid())+"\n"), 0644); err != nil {
+		return errors.WithStack(err)
+	}
+	defer os.Remove(pidPath())
+
+	repo, w, err := openRepo(config.BackupDir, config.GitBranch)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	watcher, err := core.NewWatcher(watchDebounce)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer watcher.Close()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	changes := make(chan []string)
+	done := make(chan error, 1)
+	go func() { done <- watcher.Run(ctx, changes) }()
+
+	var pushTicks <-chan time.Time
+	if pushInterval > 0 {
+		ticker := time.NewTicker(pushInterval)
+		defer ticker.Stop()
+		pushTicks = ticker.C
+	}
+
+	logger.Printf("Watching %d directories for changes", watcher.Watched())
+
+	var deferred []string
+	var retry <-chan time.Time
+	unpushed := false
+	commit := func(paths []string) {
+		if header, err := core.PendingJournal(); err != nil || header != nil {
+			// Another cfgrr command is changing the backup dir, it's committed once it's done.
+			deferred = mergePaths(deferred, paths)
+			retry = time.After(watchDebounce)
+			return
+		}
+		paths = mergePaths(deferred, paths)
+		deferred, retry = nil, nil
+
+		if err := prepareFiles(config.BackupDir); err != nil {
+			logger.Printf("couldn't commit the changes: %v", err)
+			return
+		}
+		// Only the files whose content made it into the backup dir are listed.
+		paths, drifted, err := core.SplitDrifted(paths)
+		if err != nil {
+			logger.Printf("couldn't commit the changes: %v", err)
+			return
+		}
+		if len(drifted) > 0 {
+			logger.Printf("%s drifted from the backup, run 'cfgrr status' to see how", strings.Join(displayPaths(drifted), ", "))
+		}
+		if len(paths) == 0 {
+			return
+		}
+
+		committed, err := commitWorktree(w, watchCommitMessage(paths, time.Now()))
+		if err != nil {
+			logger.Printf("couldn't commit the changes: %v", err)
+			return
+		}
+		if committed {
+			logger.Printf("committed the changes to %s", strings.Join(displayPaths(paths), ", "))
+			unpushed = true
+		}
+	}
+	push := func() {
+		if !unpushed {
+			return
+		}
+		if err := pushChanges(repo, config.GitRemote); err != nil {
+			logger.Printf("couldn't push the changes: %v", err)
+			return
+		}
+		unpushed = false
+	}
+
+	for {
+		select {
+		case paths := <-changes:
+			commit(paths)
+		case <-retry:
+			commit(nil)
+		case <-pushTicks:
+			push()
+		case err := <-done:
+			if len(deferred) > 0 {
+				commit(nil)
+			}
+			if pushInterval > 0 {
+				push()
+			}
+			logger.Printf("Stopped watching")
+			return errors.WithStack(err)
+		}
+	}
+}
+
+// Pushes the commits to the remote, running the push hooks around it.
+func pushChanges(repo *git.Repository, remote string) error {
+	m, err := mapfile.NewMapFile().Parse()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	files := helpers.GetMapValues(m)
+
+	if err := runHooks(cf.HookPrePush, files...); err != nil {
+		return errors.WithStack(err)
+	}
+	if err := pushRepo(repo, remote); err != nil {
+		return errors.WithStack(err)
+	}
+
+	return errors.WithStack(runHooks(cf.HookPostPush, files...))
+}
+
+// Describes the changes in a commit message, the first line lists the changed paths if they're few.
+func watchCommitMessage(paths []string, at time.Time) string {
+	display := displayPaths(paths)
+	subject := "cfgrr watch: " + strings.Join(display, ", ")
+	if len(display) > 3 {
+		subject = fmt.Sprintf("cfgrr watch: %s and %d more", strings.Join(display[:3], ", "), len(display)-3)
+	}
+
+	return fmt.Sprintf("%s\n\n%s\n\n(%s)\n", subject, strings.Join(display, "\n"), at.Format(time.RFC1123))
+}
+
+func displayPaths(paths []string) []string {
+	display := make([]string, len(paths))
+	for i, path := range paths {
+		display[i] = displayPath(path)
+	}
+	return display
+}
+
+// Merges the paths, sorted and without duplicates.
+func mergePaths(a, b []string) []string {
+	merged := append(slices.Clone(a), b...)
+	slices.Sort(merged)
+	return slices.Compact(merged)
+}
+
+func init() {
+	watchCmd.Flags().DurationVar(&watchDebounce, "debounce", 2*time.Second, "how long no more changes must happen before they're committed")
+	watchCmd.Flags().DurationVar(&pushInterval, "push-interval", 0, "how often the commits are pushed, they aren't if it's 0")
+	watchCmd.Flags().BoolVar(&foreground, "foreground", false, "watch in the foreground, logging to the standard output")
+	watchCmd.Flags().BoolVar(&stopWatch, "stop", false, "stop the watcher running in the background")
+}
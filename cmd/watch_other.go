@@ -0,0 +1,21 @@
+//go:build !unix
+
+package cmd
+
+import (
+	"os"
+	"os/exec"
+)
+
+// The watcher isn't tied to the terminal it was started from on this platform.
+func detach(c *exec.Cmd) {}
+
+// Finding the process succeeds only while it's running on this platform.
+func processAlive(p *os.Process) bool {
+	return true
+}
+
+// Signals can't be delivered on this platform, the watcher is killed.
+func stopProcess(p *os.Process) error {
+	return p.Kill()
+}
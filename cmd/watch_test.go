@@ -0,0 +1,33 @@
+package cmd
+
+import (
+	"testing"
+
+	cf "github.com/osamaadam/cfgrr/configfile"
+	"github.com/osamaadam/cfgrr/core"
+	"github.com/osamaadam/cfgrr/crypt"
+	"github.com/osamaadam/cfgrr/vconfig"
+)
+
+func TestCheckWatchSecret(t *testing.T) {
+	vconfig.GetConfig().SetBackupDir(t.TempDir())
+	files := _createFilesToBackup(t.TempDir(), ".netrc")
+	t.Setenv(crypt.PassphraseEnv, "hunter2")
+	if err := checkWatchSecret(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	files[0].SetLinkMode(cf.LinkCopy)
+	files[0].SetEncrypted(true)
+	if err := core.BackupFiles(files...); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := checkWatchSecret(); err != nil {
+		t.Errorf("expected the passphrase to be enough, got %v", err)
+	}
+
+	t.Setenv(crypt.PassphraseEnv, "")
+	if err := checkWatchSecret(); err == nil {
+		t.Errorf("expected the watcher to refuse to start without a key file or passphrase")
+	}
+}
@@ -0,0 +1,24 @@
+//go:build unix
+
+package cmd
+
+import (
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+// Starts the watcher in its own session, so it outlives the terminal it was started from.
+func detach(c *exec.Cmd) {
+	c.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+}
+
+// Checks whether the process is still running.
+func processAlive(p *os.Process) bool {
+	return p.Signal(syscall.Signal(0)) == nil
+}
+
+// Asks the watcher to stop, it commits the pending changes first.
+func stopProcess(p *os.Process) error {
+	return p.Signal(syscall.SIGTERM)
+}
@@ -0,0 +1,115 @@
+package configfile
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/osamaadam/cfgrr/fileops"
+	"github.com/pkg/errors"
+)
+
+// What the path of an entry is relative to.
+type Anchor string
+
+const (
+	// The path is relative to the home directory, this is the default for entries without an anchor.
+	AnchorHome Anchor = "home"
+	// The path is relative to the filesystem root, for files outside the home directory (e.g. /etc/hosts).
+	AnchorRoot Anchor = "root"
+)
+
+// Checks whether the entry lives outside the home directory.
+func (cf *ConfigFile) IsRoot() bool {
+	return cf.Anchor == AnchorRoot
+}
+
+// Returns the directory the path is relative to.
+func (cf *ConfigFile) anchorDir() string {
+	homedir, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	if cf.IsRoot() {
+		return fsRoot(homedir)
+	}
+	return homedir
+}
+
+// Returns the root of the filesystem holding the path.
+func fsRoot(path string) string {
+	return filepath.VolumeName(path) + string(filepath.Separator)
+}
+
+// Checks whether a path relative to the home directory escapes it.
+func isOutsideHome(relPath string) bool {
+	return relPath == ".." || strings.HasPrefix(relPath, ".."+string(filepath.Separator))
+}
+
+// Fixes entries outside the home directory tracked before anchors existed, whose paths climb out of it (e.g. ../../etc/hosts).
+// The path changes, so does the key of the entry in the map file, and the files named after it are renamed accordingly.
+// Returns false if the entry doesn't need fixing.
+func (cf *ConfigFile) Reanchor() (bool, error) {
+	if cf.IsRoot() || !isOutsideHome(cf.Path) {
+		return false, nil
+	}
+
+	oldHistoryDir := cf.HistoryDir()
+	oldBackupPath := cf.BackupPath()
+
+	absPath := cf.PathAbs()
+	relPath, err := filepath.Rel(fsRoot(absPath), absPath)
+	if err != nil {
+		return false, errors.WithStack(err)
+	}
+	cf.Path = relPath
+	cf.Anchor = AnchorRoot
+
+	if fileops.Exists(oldHistoryDir) {
+		if err := fileops.Move(cf.HistoryDir(), oldHistoryDir); err != nil {
+			return false, errors.WithMessagef(err, "couldn't move the history of %s", cf.PathAbs())
+		}
+	}
+
+	if oldBackupPath != cf.BackupPath() {
+		// Backups named after the path (directories and the legacy layout).
+		if err := fileops.Move(cf.BackupPath(), oldBackupPath); err != nil {
+			return false, errors.WithMessagef(err, "couldn't move the backup of %s", cf.PathAbs())
+		}
+		if err := cf.Repoint(oldBackupPath); err != nil {
+			return false, errors.WithStack(err)
+		}
+	}
+
+	return true, nil
+}
+
+// An error caused by missing permissions on a file outside the home directory.
+type PrivilegeError struct {
+	Path string
+	err  error
+}
+
+func (e *PrivilegeError) Error() string {
+	return fmt.Sprintf("%s\nhint: %s is outside your home directory and needs elevated permissions, try running cfgrr with 'sudo --preserve-env=HOME'", e.err, e.Path)
+}
+
+func (e *PrivilegeError) Unwrap() error {
+	return e.err
+}
+
+// Adds a hint to the permission errors of entries outside the home directory.
+func (cf *ConfigFile) privilegeHint(err error) error {
+	if err == nil || !cf.IsRoot() || !errors.Is(err, os.ErrPermission) {
+		return err
+	}
+
+	var privErr *PrivilegeError
+	if errors.As(err, &privErr) {
+		// Already hinted.
+		return err
+	}
+
+	return &PrivilegeError{Path: cf.PathAbs(), err: err}
+}
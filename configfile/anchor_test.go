@@ -0,0 +1,89 @@
+package configfile
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/osamaadam/cfgrr/helpers"
+	"github.com/pkg/errors"
+)
+
+func TestConfigFile_Hash(t *testing.T) {
+	home := &ConfigFile{Path: "etc/hosts"}
+	root := &ConfigFile{Path: "etc/hosts", Anchor: AnchorRoot}
+
+	if home.HashShort() == root.HashShort() {
+		t.Errorf("expected ~/etc/hosts and /etc/hosts to have different keys")
+	}
+}
+
+func TestConfigFile_Reanchor(t *testing.T) {
+	files := _setupBackupEnv(t.TempDir(), t.TempDir(), 1)
+	file := files[0]
+	if err := file.Backup(); err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+	file.SaveRevision()
+
+	// Entries outside the home directory used to climb out of it.
+	homedir, _ := os.UserHomeDir()
+	legacyPath, _ := filepath.Rel(homedir, file.PathAbs())
+	legacy := *file
+	legacy.Path, legacy.Anchor = legacyPath, ""
+	if !strings.HasPrefix(legacy.Path, "..") {
+		t.Skip("the temp dir is inside the home directory")
+	}
+	historyDir, legacyHistoryDir := file.HistoryDir(), legacy.HistoryDir()
+	os.Rename(historyDir, legacyHistoryDir)
+
+	ok, err := legacy.Reanchor()
+	if err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+	if !ok {
+		t.Fatalf("expected the entry to be reanchored")
+	}
+	if legacy.Path != file.Path || !legacy.IsRoot() || legacy.HashShort() != file.HashShort() {
+		t.Errorf("expected %+v, got %+v", file, legacy)
+	}
+	if !helpers.CheckFileExists(historyDir) {
+		t.Errorf("expected the history to be moved to %s", historyDir)
+	}
+
+	if ok, _ := legacy.Reanchor(); ok {
+		t.Errorf("expected reanchoring twice to do nothing")
+	}
+}
+
+func TestConfigFile_privilegeHint(t *testing.T) {
+	tests := []struct {
+		name     string
+		anchor   Anchor
+		err      error
+		wantHint bool
+	}{
+		{"root entry, permission denied", AnchorRoot, errors.WithStack(os.ErrPermission), true},
+		{"root entry, other error", AnchorRoot, errors.WithStack(os.ErrNotExist), false},
+		{"home entry, permission denied", "", errors.WithStack(os.ErrPermission), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file := &ConfigFile{Path: "etc/hosts", Anchor: tt.anchor}
+			err := file.privilegeHint(tt.err)
+
+			var privErr *PrivilegeError
+			if errors.As(err, &privErr) != tt.wantHint {
+				t.Errorf("expected the hint to be %v, got %v", tt.wantHint, err)
+			}
+			if !errors.Is(err, tt.err) {
+				t.Errorf("expected the original error to be kept")
+			}
+			if tt.wantHint && file.privilegeHint(err) != err {
+				t.Errorf("expected the hint to be added once")
+			}
+		})
+	}
+}
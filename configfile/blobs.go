@@ -0,0 +1,219 @@
+package configfile
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/osamaadam/cfgrr/fileops"
+	"github.com/osamaadam/cfgrr/vconfig"
+	"github.com/pkg/errors"
+)
+
+// Returns the digest of the backup file's current content.
+func (cf *ConfigFile) Digest() (string, error) {
+	digest, err := fileops.FileDigest(cf.BackupPath())
+	if err != nil {
+		return "", errors.WithMessagef(err, "couldn't hash the backup file of %s", cf.Path)
+	}
+	return digest, nil
+}
+
+// Checks whether the backup file's content still matches its blob name.
+// Editing the file through its symlink changes the content without renaming the blob.
+func (cf *ConfigFile) IsIntact() (bool, error) {
+	if cf.IsDir() {
+		// Directories aren't content addressed.
+		return true, nil
+	}
+	if cf.Blob == "" {
+		return false, errors.Errorf("%s isn't in the blob store yet, run 'cfgrr migrate'", cf.Path)
+	}
+	digest, err := cf.Digest()
+	if err != nil {
+		return false, errors.WithStack(err)
+	}
+	return digest == BlobDigest(cf.Blob), nil
+}
+
+// Returns the digest of the blob's content, the name of a private blob is suffixed with its entry's key.
+func BlobDigest(blob string) string {
+	digest, _, _ := strings.Cut(blob, ".")
+	return digest
+}
+
+// Checks whether the blob belongs to a single entry (see `OwnsBlob`).
+func isPrivateBlob(blob string) bool {
+	return strings.Contains(blob, ".")
+}
+
+// Checks whether the entry needs a blob of its own.
+// Writes through a symlink or a hard link edit the blob, so it can't be shared with other files,
+// while copies are independent of it.
+func (cf *ConfigFile) OwnsBlob() bool {
+	return !cf.IsDir() && !cf.IsCommand() && cf.LinkMode() != LinkCopy
+}
+
+// Returns the name of the entry's blob holding the content of the digest.
+// Entries owning their blob (see `OwnsBlob`) get a private one, e.g. <digest>.<key>.
+func (cf *ConfigFile) BlobName(digest string) string {
+	if cf.OwnsBlob() {
+		return digest + "." + cf.HashShort()
+	}
+	return digest
+}
+
+// Moves the backup to the blob the link mode of the entry calls for (see `OwnsBlob`).
+// A shared blob is copied, it's left for the other files using it.
+func (cf *ConfigFile) placeBlob() error {
+	if cf.Blob == "" || cf.IsDir() || cf.IsCommand() {
+		return nil
+	}
+	return errors.WithStack(cf.MoveBlob(BlobDigest(cf.Blob)))
+}
+
+// Moves the backup file to the blob named after `digest` (see `BlobName`).
+// If that blob already exists the current backup file is dropped in its favour.
+// A blob shared with other files is copied instead, and left for them.
+// The symlink is updated if it pointed at the old backup file, and so is the mode of a private blob.
+func (cf *ConfigFile) MoveBlob(digest string) error {
+	oldPath := cf.BackupPath()
+	// Legacy backup files are named after the path, so they belong to the entry.
+	shared := cf.Blob != "" && !isPrivateBlob(cf.Blob)
+	// Hard links survive the rename, but not replacing the blob with an existing one.
+	hardLinked := cf.LinkMode() == LinkHardlink && cf.IsLinked()
+	cf.Blob = cf.BlobName(digest)
+	cf.Browsable = true
+	newPath := cf.BackupPath()
+
+	if oldPath == newPath {
+		return nil
+	}
+
+	if err := fileops.MkdirAll(cf.BlobsDir()); err != nil {
+		return errors.WithStack(err)
+	}
+
+	if fileops.Exists(oldPath) {
+		switch {
+		case fileops.Exists(newPath):
+			if !shared {
+				if err := fileops.Remove(oldPath); err != nil {
+					return errors.WithStack(err)
+				}
+			}
+		case shared:
+			if err := fileops.CopyFile(newPath, oldPath); err != nil {
+				return errors.WithMessagef(err, "couldn't copy the backup file of %s", cf.Path)
+			}
+		default:
+			if err := fileops.Move(newPath, oldPath); err != nil {
+				return errors.WithMessagef(err, "couldn't move the backup file of %s", cf.Path)
+			}
+		}
+	}
+
+	if cf.OwnsBlob() && fileops.Exists(newPath) {
+		// The mode of a shared blob is the one of the file that stored it first.
+		if err := fileops.Chmod(newPath, cf.Perm.Perm()); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+
+	if err := cf.Repoint(oldPath); err != nil {
+		return errors.WithStack(err)
+	}
+
+	if hardLinked && !cf.IsLinked() {
+		if err := fileops.Remove(cf.PathAbs()); err != nil {
+			return errors.WithStack(err)
+		}
+		if err := cf.link(); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+
+	return nil
+}
+
+// Returns the path of the internals directory of the backup dir.
+func InternalsPath() string {
+	return filepath.Join(vconfig.GetConfig().BackupDir, internalsDir)
+}
+
+// Returns the path of the blob store.
+func BlobsPath() string {
+	return filepath.Join(InternalsPath(), blobsDir)
+}
+
+// Returns the path of a blob in the blob store.
+func BlobPath(digest string) string {
+	return filepath.Join(BlobsPath(), digest)
+}
+
+// Moves a file backed up with the legacy layout into the blob store.
+// Returns false if the file is already in the blob store.
+func (cf *ConfigFile) Migrate() (bool, error) {
+	if cf.Blob != "" || cf.IsDir() {
+		return false, nil
+	}
+
+	digest, err := cf.Digest()
+	if err != nil {
+		return false, errors.WithStack(err)
+	}
+
+	if err := cf.MoveBlob(digest); err != nil {
+		return false, errors.WithStack(err)
+	}
+
+	return true, nil
+}
+
+// Points the symlink at the current backup path if it points at `oldTarget`.
+// Symlinks pointing anywhere else are left alone.
+func (cf *ConfigFile) Repoint(oldTarget string) error {
+	target, err := fileops.Readlink(cf.PathAbs())
+	if err != nil {
+		// Either there's no file, or it isn't a symlink.
+		return nil
+	}
+
+	if target != oldTarget {
+		return nil
+	}
+
+	if err := fileops.Remove(cf.PathAbs()); err != nil {
+		return errors.WithStack(err)
+	}
+
+	if err := cf.Restore(); err != nil {
+		return errors.WithStack(err)
+	}
+
+	return nil
+}
+
+// Returns the paths of the backup files kept in the internals directory:
+// the blobs, the tracked directories and the legacy backups named after their path.
+func StoredBackups() ([]string, error) {
+	internals := InternalsPath()
+	var paths []string
+	for _, dir := range []string{internals, filepath.Join(internals, blobsDir), filepath.Join(internals, dirsDir)} {
+		entries, err := os.ReadDir(fileops.Locate(dir))
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		} else if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		for _, entry := range entries {
+			if dir == internals && entry.IsDir() {
+				// The blob store and the tracked directories.
+				continue
+			}
+			paths = append(paths, filepath.Join(dir, entry.Name()))
+		}
+	}
+
+	return paths, nil
+}
@@ -0,0 +1,169 @@
+package configfile
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/osamaadam/cfgrr/helpers"
+)
+
+// Only the files copied in place share blobs, the linked ones are written through to theirs, so each gets one of its own.
+func TestConfigFile_Backup_Dedup(t *testing.T) {
+	tests := []struct {
+		name     string
+		link     LinkMode
+		contents []string
+		outBlobs int
+	}{
+		{"identical files", LinkCopy, []string{"same", "same", "same"}, 1},
+		{"different files", LinkCopy, []string{"one", "two", "three"}, 3},
+		{"some identical files", LinkCopy, []string{"one", "two", "one"}, 2},
+		{"identical symlinked files aren't deduplicated", LinkSymlink, []string{"same", "same", "same"}, 3},
+		{"identical hard linked files aren't deduplicated", LinkHardlink, []string{"same", "same"}, 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			files := _setupBackupEnv(t.TempDir(), t.TempDir(), len(tt.contents))
+			for i, file := range files {
+				os.WriteFile(file.PathAbs(), []byte(tt.contents[i]), file.Perm)
+				file.SetLinkMode(tt.link)
+				if err := file.Backup(); err != nil {
+					t.Fatalf("expected no error, got %s", err)
+				}
+				if content, _ := os.ReadFile(file.PathAbs()); string(content) != tt.contents[i] {
+					t.Errorf("expected %q through the link, got %q", tt.contents[i], content)
+				}
+			}
+
+			blobs, err := os.ReadDir(files[0].BlobsDir())
+			if err != nil {
+				t.Fatalf("expected no error, got %s", err)
+			}
+			if len(blobs) != tt.outBlobs {
+				t.Errorf("expected %d blobs, got %d", tt.outBlobs, len(blobs))
+			}
+
+			// Writing through the link of one of the files leaves the others as is.
+			os.WriteFile(files[0].PathAbs(), []byte("edited"), files[0].Perm)
+			for i, file := range files[1:] {
+				if content, _ := os.ReadFile(file.PathAbs()); string(content) != tt.contents[i+1] {
+					t.Errorf("expected %s to be %q, got %q", file.Path, tt.contents[i+1], content)
+				}
+			}
+		})
+	}
+}
+
+func TestConfigFile_Migrate(t *testing.T) {
+	tests := []struct {
+		name      string
+		browsable bool
+	}{
+		{"browsable legacy file", true},
+		{"non-browsable legacy file", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			files := _setupBackupEnv(t.TempDir(), t.TempDir(), 1)
+			file := files[0]
+			file.Browsable = tt.browsable
+
+			// Mimic a backup made with the legacy layout.
+			legacyPath := file.BackupPath()
+			os.MkdirAll(filepath.Dir(legacyPath), 0755)
+			if err := os.WriteFile(legacyPath, []byte("legacy"), 0644); err != nil {
+				t.Fatalf("expected no error, got %s", err)
+			}
+			os.Remove(file.PathAbs())
+			if err := os.Symlink(legacyPath, file.PathAbs()); err != nil {
+				t.Fatalf("expected no error, got %s", err)
+			}
+
+			migrated, err := file.Migrate()
+			if err != nil || !migrated {
+				t.Fatalf("expected the file to be migrated, got %v, %v", migrated, err)
+			}
+
+			if helpers.CheckFileExists(legacyPath) {
+				t.Errorf("expected %s to be moved", legacyPath)
+			}
+			if intact, err := file.IsIntact(); err != nil || !intact {
+				t.Errorf("expected the blob to be intact, got %v, %v", intact, err)
+			}
+			if target, _ := os.Readlink(file.PathAbs()); target != file.BackupPath() {
+				t.Errorf("expected the symlink to point at %s, got %s", file.BackupPath(), target)
+			}
+
+			if migrated, _ := file.Migrate(); migrated {
+				t.Errorf("expected migrating twice to be a no-op")
+			}
+		})
+	}
+}
+
+func TestConfigFile_MoveBlob(t *testing.T) {
+	t.Run("renames an edited blob", func(t *testing.T) {
+		files := _setupBackupEnv(t.TempDir(), t.TempDir(), 1)
+		file := files[0]
+		if err := file.Backup(); err != nil {
+			t.Fatalf("expected no error, got %s", err)
+		}
+
+		// Edit through the symlink.
+		os.WriteFile(file.PathAbs(), []byte("edited"), file.Perm)
+		if intact, _ := file.IsIntact(); intact {
+			t.Fatalf("expected the edited blob not to be intact")
+		}
+
+		digest, _ := file.Digest()
+		if err := file.MoveBlob(digest); err != nil {
+			t.Fatalf("expected no error, got %s", err)
+		}
+		if intact, _ := file.IsIntact(); !intact {
+			t.Errorf("expected the blob to be intact after moving it")
+		}
+		if content, _ := os.ReadFile(file.PathAbs()); string(content) != "edited" {
+			t.Errorf("expected the symlink to follow the blob, got %q", content)
+		}
+	})
+}
+
+func TestConfigFile_Relink_Blob(t *testing.T) {
+	files := _setupBackupEnv(t.TempDir(), t.TempDir(), 2)
+	for i, file := range files {
+		os.WriteFile(file.PathAbs(), []byte("same"), 0600)
+		os.Chmod(file.PathAbs(), os.FileMode(0600+i*0044))
+		file.SetLinkMode(LinkCopy)
+		if err := file.Backup(); err != nil {
+			t.Fatalf("expected no error, got %s", err)
+		}
+	}
+	if files[0].Blob != files[1].Blob {
+		t.Fatalf("expected the copies to share a blob")
+	}
+
+	// The symlinked file gets a blob of its own, with its own mode.
+	if err := files[1].Relink(LinkSymlink); err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+	if files[0].Blob == files[1].Blob {
+		t.Errorf("expected the symlinked file to get a blob of its own")
+	}
+	if info, _ := os.Stat(files[1].PathAbs()); info.Mode().Perm() != 0644 {
+		t.Errorf("expected the mode of the symlinked file to be kept, got %s", info.Mode())
+	}
+	if _, err := os.Stat(files[0].BackupPath()); err != nil {
+		t.Errorf("expected the shared blob to be kept, got %s", err)
+	}
+
+	// Back to a copy, it shares the blob again.
+	if err := files[1].Relink(LinkCopy); err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+	if files[0].Blob != files[1].Blob {
+		t.Errorf("expected the copies to share a blob again")
+	}
+}
@@ -0,0 +1,176 @@
+package configfile
+
+import (
+	"bytes"
+	"os"
+	"os/exec"
+	"regexp"
+	"runtime"
+	"strings"
+
+	"github.com/osamaadam/cfgrr/fileops"
+	"github.com/pkg/errors"
+)
+
+// The prefix of the paths of command entries, e.g. command:dconf.
+// Command entries have no live file, this is how they're shown and selected instead.
+const CommandPrefix = "command:"
+
+var commandNameRegexp = regexp.MustCompile(`^[\w.-]+$`)
+
+/*
+Initializes an entry backed by commands rather than a file, for state only commands could read and write (e.g. dconf, crontab).
+The output of `dump` is stored as its backup, and fed to `load` on restore.
+
+	cf, _ := NewCommandFile("dconf", "dconf dump /", "dconf load /")
+	// cf.PathAbs() = "command:dconf"
+*/
+func NewCommandFile(name, dump, load string) (*ConfigFile, error) {
+	if !commandNameRegexp.MatchString(name) {
+		return nil, errors.Errorf("invalid command name %q, names are made of letters, digits, dots, dashes and underscores", name)
+	}
+	if strings.TrimSpace(dump) == "" || strings.TrimSpace(load) == "" {
+		return nil, errors.Errorf("%s%s needs both a dump and a load command", CommandPrefix, name)
+	}
+
+	return &ConfigFile{
+		Path: name,
+		Kind: KindCommand,
+		Dump: dump,
+		Load: load,
+		// The dumped state could hold secrets.
+		Perm:      os.FileMode(0600),
+		Browsable: true,
+	}, nil
+}
+
+// Returns the name of the command entry the path refers to (e.g. command:dconf), false if it isn't one.
+func ParseCommandPath(path string) (string, bool) {
+	name, ok := strings.CutPrefix(path, CommandPrefix)
+	return name, ok && name != ""
+}
+
+// Checks whether the entry is backed by commands rather than a file.
+func (cf *ConfigFile) IsCommand() bool {
+	return cf.Kind == KindCommand
+}
+
+// Returns the command running the shell command line, with 'sh -c' (or 'cmd /C' on Windows).
+func ShellCommand(command string) *exec.Cmd {
+	if runtime.GOOS == "windows" {
+		return exec.Command("cmd", "/C", command)
+	}
+	return exec.Command("sh", "-c", command)
+}
+
+// Returns the command running the command line from the home directory, fed `stdin`.
+func commandFrom(command string, stdin []byte) (*exec.Cmd, error) {
+	homedir, err := os.UserHomeDir()
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	cmd := ShellCommand(command)
+	cmd.Dir = homedir
+	cmd.Stdin = bytes.NewReader(stdin)
+	cmd.Stderr = os.Stderr
+
+	return cmd, nil
+}
+
+// Returns the current output of the dump command.
+func (cf *ConfigFile) dump() ([]byte, error) {
+	cmd, err := commandFrom(cf.Dump, nil)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	content, err := cmd.Output()
+	if err != nil {
+		return nil, errors.WithMessagef(err, "the dump command of %s (%s) failed", cf.PathAbs(), cf.Dump)
+	}
+	return content, nil
+}
+
+// Stores the output of the dump command as the backup.
+func (cf *ConfigFile) backupCommand() error {
+	content, err := cf.dump()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	return errors.WithMessagef(cf.SetContent(content), "couldn't store the output of %s", cf.PathAbs())
+}
+
+// Feeds the backup to the load command.
+// Planned operations (see `fileops.Planner`) plan the command rather than running it.
+func (cf *ConfigFile) restoreCommand() error {
+	content, err := cf.plainContent()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	if planner, ok := fileops.Current().(*fileops.Planner); ok {
+		planner.Plan("load", cf.PathAbs(), cf.Load)
+		return nil
+	}
+
+	cmd, err := commandFrom(cf.Load, content)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	cmd.Stdout = os.Stdout
+
+	if err := cmd.Run(); err != nil {
+		return errors.WithMessagef(err, "the load command of %s (%s) failed", cf.PathAbs(), cf.Load)
+	}
+
+	return nil
+}
+
+// Stores the output of the dump command as a new blob if it changed since it was backed up.
+// The old blob is left in place, as it could be shared with other files.
+func (cf *ConfigFile) syncCommand() (changed bool, err error) {
+	content, err := cf.dump()
+	if err != nil {
+		return false, errors.WithStack(err)
+	}
+
+	if backup, err := cf.plainContent(); err == nil && bytes.Equal(backup, content) {
+		return false, nil
+	}
+
+	if err := cf.SetContent(content); err != nil {
+		return false, errors.WithMessagef(err, "couldn't store the output of %s", cf.PathAbs())
+	}
+
+	return true, nil
+}
+
+// Returns how the state drifted from the backup: whether the backup is missing, or the output of the dump command changed.
+func (cf *ConfigFile) commandDrift() ([]Drift, error) {
+	backup, err := cf.plainContent()
+	if errors.Is(err, os.ErrNotExist) {
+		return []Drift{DriftNoBackup}, nil
+	} else if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	content, err := cf.dump()
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if !bytes.Equal(backup, content) {
+		return []Drift{DriftModified}, nil
+	}
+
+	return nil, nil
+}
+
+// Returns the current output of the dump command, as the live content of the entry.
+func (cf *ConfigFile) DumpContent() ([]byte, error) {
+	if !cf.IsCommand() {
+		return nil, errors.Errorf("%s isn't backed by a command", cf.PathAbs())
+	}
+	return cf.dump()
+}
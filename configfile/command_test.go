@@ -0,0 +1,108 @@
+package configfile
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"testing"
+
+	"github.com/osamaadam/cfgrr/vconfig"
+)
+
+func TestNewCommandFile(t *testing.T) {
+	tests := []struct {
+		name        string
+		entry       string
+		dump, load  string
+		expectError bool
+	}{
+		{"dump and load", "dconf", "dconf dump /", "dconf load /", false},
+		{"no dump", "dconf", "", "dconf load /", true},
+		{"no load", "dconf", "dconf dump /", " ", true},
+		{"name with a slash", "gnome/dconf", "dconf dump /", "dconf load /", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file, err := NewCommandFile(tt.entry, tt.dump, tt.load)
+			if tt.expectError {
+				if err == nil {
+					t.Fatal("expected error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !file.IsCommand() || file.PathAbs() != "command:"+tt.entry {
+				t.Errorf("expected a command entry at command:%s, got %s", tt.entry, file.PathAbs())
+			}
+			if name, ok := ParseCommandPath(file.PathAbs()); !ok || name != tt.entry {
+				t.Errorf("expected %s to parse as %s, got %q", file.PathAbs(), tt.entry, name)
+			}
+			// A file of the same name in the home directory is another entry.
+			homedir, _ := os.UserHomeDir()
+			other, _ := NewConfigFile(filepath.Join(homedir, tt.entry))
+			if file.HashShort() == other.HashShort() || file.SamePath(other) {
+				t.Errorf("expected the command entry not to collide with ~/%s", tt.entry)
+			}
+		})
+	}
+}
+
+func TestConfigFile_Command(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the commands are shell commands")
+	}
+
+	vconfig.GetConfig().SetBackupDir(t.TempDir())
+	state := filepath.Join(t.TempDir(), "state")
+	os.WriteFile(state, []byte("a=1\n"), 0644)
+
+	file, err := NewCommandFile("state", "cat "+state, "cat > "+state)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := file.Backup(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if content, _ := os.ReadFile(file.BackupPath()); string(content) != "a=1\n" {
+		t.Errorf("expected the output of the dump command to be backed up, got %q", content)
+	}
+	if drifts, err := file.Drift(); err != nil || len(drifts) != 0 {
+		t.Errorf("expected no drifts, got %v, %v", drifts, err)
+	}
+
+	// The state changed since it was backed up.
+	os.WriteFile(state, []byte("a=2\n"), 0644)
+	if drifts, _ := file.Drift(); !slices.Equal(drifts, []Drift{DriftModified}) {
+		t.Errorf("expected the state to be modified, got %v", drifts)
+	}
+	oldBlob := file.Blob
+	if changed, err := file.Sync(); err != nil || !changed || file.Blob == oldBlob {
+		t.Fatalf("expected the new output to be stored in a new blob, got %t, %v", changed, err)
+	}
+	if changed, err := file.Sync(); err != nil || changed {
+		t.Errorf("expected nothing to sync, got %t, %v", changed, err)
+	}
+
+	// The backup is fed to the load command.
+	os.WriteFile(state, []byte("lost\n"), 0644)
+	if file.HasConflict() {
+		t.Errorf("expected command entries never to conflict")
+	}
+	if err := file.Restore(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if content, _ := os.ReadFile(state); string(content) != "a=2\n" {
+		t.Errorf("expected the state to be loaded, got %q", content)
+	}
+
+	if err := file.SetLinkMode(LinkCopy); err == nil {
+		t.Errorf("expected command entries not to be linked")
+	}
+	if err := file.SetTemplate(true); err == nil {
+		t.Errorf("expected command entries not to be templates")
+	}
+}
@@ -0,0 +1,99 @@
+package configfile
+
+import (
+	"os"
+	"os/exec"
+	"path"
+	"runtime"
+	"slices"
+	"strings"
+)
+
+// The machines an entry belongs on, entries without conditions belong everywhere.
+// Each of the set criteria has to hold.
+type Condition struct {
+	// Globs of the hostnames (e.g. "web-*"), any of them could match.
+	Hosts []string `yaml:"hosts,omitempty" json:"Hosts,omitempty"`
+	// The operating systems, as in `runtime.GOOS` (e.g. linux, darwin), any of them could match.
+	OS []string `yaml:"os,omitempty" json:"OS,omitempty"`
+	// The architectures, as in `runtime.GOARCH` (e.g. amd64, arm64), any of them could match.
+	Arch []string `yaml:"arch,omitempty" json:"Arch,omitempty"`
+	// The environment variables that have to be set, all of them.
+	Env []string `yaml:"env,omitempty" json:"Env,omitempty"`
+	// The commands that have to be on the PATH, all of them.
+	Commands []string `yaml:"commands,omitempty" json:"Commands,omitempty"`
+}
+
+func (c *Condition) IsEmpty() bool {
+	return c == nil || len(c.Hosts)+len(c.OS)+len(c.Arch)+len(c.Env)+len(c.Commands) == 0
+}
+
+// Returns why the condition doesn't hold on the current machine, or an empty string if it does.
+func (c *Condition) Unmet() string {
+	if c.IsEmpty() {
+		return ""
+	}
+
+	if len(c.Hosts) > 0 && !matchesHostname(c.Hosts) {
+		return "only on the hosts " + strings.Join(c.Hosts, ", ")
+	}
+	if len(c.OS) > 0 && !slices.Contains(c.OS, runtime.GOOS) {
+		return "only on " + strings.Join(c.OS, ", ")
+	}
+	if len(c.Arch) > 0 && !slices.Contains(c.Arch, runtime.GOARCH) {
+		return "only on " + strings.Join(c.Arch, ", ")
+	}
+	for _, env := range c.Env {
+		if _, ok := os.LookupEnv(env); !ok {
+			return "$" + env + " isn't set"
+		}
+	}
+	for _, command := range c.Commands {
+		if _, err := exec.LookPath(command); err != nil {
+			return command + " isn't on the PATH"
+		}
+	}
+
+	return ""
+}
+
+// Returns a short description of the condition, e.g. "os=linux env=DISPLAY".
+func (c *Condition) String() string {
+	if c.IsEmpty() {
+		return ""
+	}
+
+	var parts []string
+	for _, criterion := range []struct {
+		name   string
+		values []string
+	}{{"host", c.Hosts}, {"os", c.OS}, {"arch", c.Arch}, {"env", c.Env}, {"command", c.Commands}} {
+		if len(criterion.values) > 0 {
+			parts = append(parts, criterion.name+"="+strings.Join(criterion.values, ","))
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+// Checks the full hostname, and the short one before the first dot, against the globs.
+func matchesHostname(globs []string) bool {
+	hostname, err := os.Hostname()
+	if err != nil {
+		return false
+	}
+	short, _, _ := strings.Cut(hostname, ".")
+
+	for _, glob := range globs {
+		for _, name := range []string{hostname, short} {
+			if ok, _ := path.Match(glob, name); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Returns why the entry doesn't belong on the current machine, or an empty string if it does.
+func (cf *ConfigFile) Unmet() string {
+	return cf.When.Unmet()
+}
@@ -0,0 +1,45 @@
+package configfile
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestCondition_Unmet(t *testing.T) {
+	t.Setenv("CFGRR_TEST_SET", "1")
+	hostname, _ := os.Hostname()
+	bin := t.TempDir()
+	os.WriteFile(filepath.Join(bin, "cfgrr-test-command"), []byte("#!/bin/sh\n"), 0755)
+	t.Setenv("PATH", bin)
+
+	tests := []struct {
+		name      string
+		condition *Condition
+		met       bool
+	}{
+		{"none", nil, true},
+		{"empty", &Condition{}, true},
+		{"os", &Condition{OS: []string{"plan9", runtime.GOOS}}, true},
+		{"other os", &Condition{OS: []string{"plan9"}}, false},
+		{"arch", &Condition{Arch: []string{runtime.GOARCH}}, true},
+		{"other arch", &Condition{Arch: []string{"mips"}}, false},
+		{"host glob", &Condition{Hosts: []string{hostname[:1] + "*"}}, true},
+		{"other host", &Condition{Hosts: []string{"no-such-host-*"}}, false},
+		{"env", &Condition{Env: []string{"CFGRR_TEST_SET"}}, true},
+		{"unset env", &Condition{Env: []string{"CFGRR_TEST_SET", "CFGRR_TEST_UNSET"}}, false},
+		{"command", &Condition{Commands: []string{"cfgrr-test-command"}}, true},
+		{"missing command", &Condition{Commands: []string{"no-such-command-cfgrr"}}, false},
+		{"all have to hold", &Condition{OS: []string{runtime.GOOS}, Env: []string{"CFGRR_TEST_UNSET"}}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reason := tt.condition.Unmet()
+			if (reason == "") != tt.met {
+				t.Errorf("expected the condition to be met: %v, got the reason %q", tt.met, reason)
+			}
+		})
+	}
+}
@@ -1,31 +1,67 @@
 package configfile
 
 import (
-	"crypto/sha1"
 	"encoding/hex"
-	"io"
-	"io/fs"
 	"os"
 	"path/filepath"
 
-	"github.com/osamaadam/cfgrr/helpers"
+	"github.com/osamaadam/cfgrr/fileops"
 	"github.com/osamaadam/cfgrr/vconfig"
 	"github.com/pkg/errors"
 )
 
 type ConfigFile struct {
+	// The path relative to the anchor.
 	Path      string
 	Perm      os.FileMode
 	Browsable bool
+	// The sha256 digest of the backup file's content, which is also its name in the blob store.
+	// Files backed up before the blob store existed don't have one until they're migrated.
+	Blob string `yaml:"blob,omitempty" json:"Blob,omitempty"`
+	// Entries without a kind are regular files.
+	Kind Kind `yaml:"kind,omitempty" json:"Kind,omitempty"`
+	// The sub directories of a tracked directory with their modes.
+	Dirs map[string]os.FileMode `yaml:"dirs,omitempty" json:"Dirs,omitempty"`
+	// How the live file is connected to the backup, entries without one are symlinked.
+	Link LinkMode `yaml:"link,omitempty" json:"Link,omitempty"`
+	// The backup file is a Go template rendered into a copy on restore.
+	Template bool `yaml:"template,omitempty" json:"Template,omitempty"`
+	// The backup file is encrypted, and decrypted into a copy on restore.
+	Encrypted bool `yaml:"encrypted,omitempty" json:"Encrypted,omitempty"`
+	// The ownership, modification time, and extended attributes, reapplied on restore.
+	Meta *Metadata `yaml:"meta,omitempty" json:"Meta,omitempty"`
+	// What the path is relative to, entries without an anchor are relative to the home directory.
+	Anchor Anchor `yaml:"anchor,omitempty" json:"Anchor,omitempty"`
+	// The package of the dotfiles manager the file was imported from (e.g. a stow package).
+	Package string `yaml:"package,omitempty" json:"Package,omitempty"`
+	// The machines the file belongs on, it's restored everywhere if there are none.
+	When *Condition `yaml:"when,omitempty" json:"When,omitempty"`
+	// The tags (or group names) the file could be selected by, e.g. shell.
+	Tags []string `yaml:"tags,omitempty" json:"Tags,omitempty"`
+	// The shell commands run at the events of the operations on the file, e.g. reloading the app after a restore.
+	Hooks map[HookEvent][]string `yaml:"hooks,omitempty" json:"Hooks,omitempty"`
+	// The shell command whose output is the backup of a command entry.
+	Dump string `yaml:"dump,omitempty" json:"Dump,omitempty"`
+	// The shell command the backup of a command entry is fed to on restore.
+	Load string `yaml:"load,omitempty" json:"Load,omitempty"`
 }
 
 var internalsDir = ".internals"
 
+// The content addressed store inside the internals dir.
+// Copied files with identical content share the same blob, linked files get one of their own (see `OwnsBlob`).
+var blobsDir = "blobs"
+
 /*
 Tidies the path before initializing the object.
 
 	cf, _ := NewConfigFile("~/path/../path/.config")
 	// cf.Path = "path/.config"
+
+Paths outside the home directory are anchored at the filesystem root.
+
+	cf, _ := NewConfigFile("/etc/hosts")
+	// cf.Path = "etc/hosts", cf.Anchor = AnchorRoot
 */
 func NewConfigFile(path string) (file *ConfigFile, err error) {
 	if path == "" {
@@ -42,13 +78,19 @@ func NewConfigFile(path string) (file *ConfigFile, err error) {
 		return nil, errors.WithMessage(err, "couldn't get an absolute path")
 	}
 
+	var anchor Anchor
 	relPath, err := filepath.Rel(homedir, absPath)
-	if err != nil {
-		return nil, errors.WithMessage(err, "couldn't get a path relative to home dir")
+	if err != nil || isOutsideHome(relPath) {
+		anchor = AnchorRoot
+		relPath, err = filepath.Rel(fsRoot(absPath), absPath)
+		if err != nil {
+			return nil, errors.WithMessage(err, "couldn't get a path relative to the filesystem root")
+		}
 	}
 
 	file = &ConfigFile{
-		Path: relPath,
+		Path:   relPath,
+		Anchor: anchor,
 		// This is to maintain backward compatibility.
 		// Files backed up after v1.5.0 will be browsable by default.
 		// The user could use `replicate` subcommand to turn old files browsable.
@@ -59,6 +101,10 @@ func NewConfigFile(path string) (file *ConfigFile, err error) {
 		return nil, errors.WithMessage(err, "couldn't save file permissions")
 	}
 
+	if file.Perm.IsDir() {
+		file.Kind = KindDir
+	}
+
 	return file, nil
 }
 
@@ -78,39 +124,76 @@ func (cf *ConfigFile) InternalsDir() string {
 
 // Returns the absolute path of the file.
 // Relies on there being a $HOME environment variable.
+// Command entries have no file, their path is the name prefixed with `CommandPrefix` (e.g. command:dconf).
 func (cf *ConfigFile) PathAbs() string {
-	homedir, err := os.UserHomeDir()
-	if err != nil {
+	if cf.IsCommand() {
+		return CommandPrefix + cf.Path
+	}
+
+	anchorDir := cf.anchorDir()
+	if anchorDir == "" {
 		return ""
 	}
 
-	return filepath.Join(homedir, cf.Path)
+	return filepath.Join(anchorDir, cf.Path)
 }
 
-// Returns the hash of the Path.
+// Returns the hash of the Path, hashed with the `key_algorithm` of the config.
+// Paths anchored at the filesystem root are hashed as absolute paths, so they don't collide with the ones in the home directory.
+// Command entries are hashed with their prefix for the same reason.
 func (cf *ConfigFile) Hash() string {
-	hasher := sha1.New()
-	hasher.Write([]byte(cf.Path))
+	path := cf.Path
+	if cf.IsRoot() {
+		path = "/" + filepath.ToSlash(path)
+	}
+	if cf.IsCommand() {
+		path = CommandPrefix + path
+	}
+
+	hasher := newKeyHash(vconfig.GetConfig().KeyAlgorithm)
+	hasher.Write([]byte(path))
 	hash := hex.EncodeToString(hasher.Sum(nil))
 
 	return hash
 }
 
-// Returns a truncated hash of the Path.
+// Returns a truncated hash of the Path, this is the key of the file in the map file.
+// It's truncated to the `key_length` of the config.
 func (cf *ConfigFile) HashShort() string {
-	return cf.Hash()[:8]
+	hash := cf.Hash()
+	length := vconfig.GetConfig().KeyLength
+	if length <= 0 || length > len(hash) {
+		length = 8
+	}
+	return hash[:length]
 }
 
 // Makes it printable, functions like fmt.Println know to call this automatically.
 func (cf *ConfigFile) String() string {
-	return cf.Name() + " - " + "(" + filepath.Join("~", cf.Path) + ")"
+	name := cf.Name()
+	if cf.IsDir() {
+		name += "/"
+	}
+	if cf.IsCommand() {
+		return name + " - " + "(" + cf.PathAbs() + ")"
+	}
+	anchor := "~"
+	if cf.IsRoot() {
+		anchor = fsRoot(cf.PathAbs())
+	}
+	return name + " - " + "(" + filepath.Join(anchor, cf.Path) + ")"
 }
 
-// Save file permissions.
+// Save file permissions, along with the rest of the metadata.
+// Command entries keep the permissions they were created with.
 func (cf *ConfigFile) SavePerm() error {
-	info, err := os.Stat(cf.PathAbs())
+	if cf.IsCommand() {
+		return nil
+	}
+
+	info, err := fileops.Stat(cf.PathAbs())
 	if err != nil {
-		if os.IsNotExist(err) {
+		if errors.Is(err, os.ErrNotExist) {
 			cf.Perm = os.FileMode(0644)
 			return nil
 		}
@@ -119,6 +202,12 @@ func (cf *ConfigFile) SavePerm() error {
 
 	cf.Perm = info.Mode()
 
+	meta, err := readMeta(cf.PathAbs(), info)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	cf.Meta = meta
+
 	return nil
 }
 
@@ -128,8 +217,20 @@ func (cf *ConfigFile) BackupDir() string {
 	return config.BackupDir
 }
 
+// Returns the blob store directory.
+func (cf *ConfigFile) BlobsDir() string {
+	return filepath.Join(cf.InternalsDir(), blobsDir)
+}
+
 // Constructs the backup file path.
 func (cf *ConfigFile) BackupPath() string {
+	if cf.IsDir() {
+		return filepath.Join(cf.InternalsDir(), dirsDir, cf.HashShort())
+	}
+	if cf.Blob != "" {
+		return filepath.Join(cf.BlobsDir(), cf.Blob)
+	}
+	// Legacy layout, the backup file is named after the hash of its path.
 	if cf.Browsable {
 		return filepath.Join(cf.InternalsDir(), cf.HashShort())
 	}
@@ -142,19 +243,8 @@ func (cf *ConfigFile) UpdateSymlink() error {
 		return errors.New("file is not browsable")
 	}
 
-	// Checks if a symlink exists.
-	symLinkExists, err := helpers.CheckIfSymlink(cf.PathAbs())
-	if err != nil {
-		if errors.Is(err, fs.ErrNotExist) {
-			// no symlink exists
-			return nil
-		}
-		// I don't know what happened, bubble your red flags
-		return errors.WithStack(err)
-	}
-
-	if !symLinkExists {
-		// no symlink exists
+	if !cf.isOwnSymlink() {
+		// No symlink to the backup exists.
 		return nil
 	}
 
@@ -168,7 +258,12 @@ func (cf *ConfigFile) UpdateSymlink() error {
 
 // Makes the backup file browsable by moving it into
 // backup_dir/home and mimicking its original structure.
+// Command entries have no path to mimick, they're skipped.
 func (cf *ConfigFile) MakeBrowsable(baseDir string) error {
+	if cf.IsCommand() {
+		return nil
+	}
+
 	if err := cf.updateBrowsable(baseDir); err != nil {
 		return errors.WithStack(err)
 	}
@@ -192,7 +287,14 @@ func (cf *ConfigFile) updateBrowsable(baseDir string) error {
 		mimickBackupPath = filepath.Join(cf.BackupDir(), baseDir, cf.Path)
 	}
 
-	if err := helpers.LinkFile(mimickBackupPath, cf.BackupPath()); err != nil {
+	if cf.IsDir() {
+		if err := fileops.LinkTree(mimickBackupPath, cf.BackupPath()); err != nil {
+			return errors.WithStack(err)
+		}
+		return nil
+	}
+
+	if err := fileops.LinkFile(mimickBackupPath, cf.BackupPath()); err != nil {
 		return errors.WithStack(err)
 	}
 
@@ -204,14 +306,14 @@ func (cf *ConfigFile) hideInternals() error {
 	if cf.Browsable {
 		return nil
 	}
-	if err := helpers.EnsureDirExists(cf.InternalsDir()); err != nil {
+	if err := fileops.MkdirAll(cf.InternalsDir()); err != nil {
 		return errors.WithStack(err)
 	}
 
 	orgBackupPath := cf.BackupPath()
 	cf.Browsable = true
 
-	if err := os.Rename(orgBackupPath, cf.BackupPath()); err != nil {
+	if err := fileops.Move(cf.BackupPath(), orgBackupPath); err != nil {
 		cf.Browsable = false
 		return errors.WithStack(err)
 	}
@@ -223,26 +325,41 @@ func (cf *ConfigFile) hideInternals() error {
 	return nil
 }
 
-// Creates a symlink to the backup file.
-func (cf *ConfigFile) Restore() error {
-	if err := helpers.EnsureDirExists(filepath.Dir(cf.PathAbs())); err != nil {
+// Creates a symlink to the backup file (or a hard link, or a copy, depending on the link mode).
+// A live file cfgrr doesn't manage is never replaced, a `*ConflictError` is returned instead (see `RestoreWith`).
+// The backup of command entries is fed to their load command instead.
+func (cf *ConfigFile) Restore() (err error) {
+	defer func() { err = cf.privilegeHint(err) }()
+
+	if cf.IsCommand() {
+		return cf.restoreCommand()
+	}
+
+	if err := cf.removeOwnLive(); err != nil {
 		return errors.WithStack(err)
 	}
-	if helpers.CheckFileExists(cf.PathAbs()) {
-		if err := os.Remove(cf.PathAbs()); err != nil {
-			return errors.WithMessagef(err, "couldn't remove the original file: %s", cf.PathAbs())
+
+	if err := fileops.MkdirAll(filepath.Dir(cf.PathAbs())); err != nil {
+		return errors.WithStack(err)
+	}
+
+	if cf.IsDir() {
+		if err := cf.restoreTree(); err != nil {
+			return errors.WithMessagef(err, "couldn't restore the directories of %s", cf.Path)
 		}
 	}
-	if err := os.Symlink(cf.BackupPath(), cf.PathAbs()); err != nil {
-		return errors.WithMessage(err, "couldn't create a symlink to the backup file")
+	if err := cf.link(); err != nil {
+		return errors.WithStack(err)
 	}
 
+	cf.applyMeta(cf.metaTarget())
+
 	return nil
 }
 
 // Updates the restore link if the original file is a symlink.
 func (cf *ConfigFile) updateRestoreLink() error {
-	symLinkExists, err := helpers.CheckIfSymlink(cf.PathAbs())
+	symLinkExists, err := fileops.IsSymlink(cf.PathAbs())
 	if err != nil {
 		// If the file doesn't exist, we don't need to update the restore link.
 		if errors.Is(err, os.ErrNotExist) {
@@ -253,7 +370,7 @@ func (cf *ConfigFile) updateRestoreLink() error {
 
 	if symLinkExists {
 		// If the file is a symlink, we need to update the restore link.
-		if err := os.Remove(cf.PathAbs()); err != nil {
+		if err := fileops.Remove(cf.PathAbs()); err != nil {
 			return errors.WithStack(err)
 		}
 		if err := cf.Restore(); err != nil {
@@ -266,89 +383,184 @@ func (cf *ConfigFile) updateRestoreLink() error {
 
 // Creates a copy of the backup file at the restore location.
 // This is usually used with the `DeleteBackup` method.
-func (cf *ConfigFile) HardRestore() error {
-	if err := helpers.EnsureDirExists(filepath.Dir(cf.PathAbs())); err != nil {
+func (cf *ConfigFile) HardRestore() (err error) {
+	defer func() { err = cf.privilegeHint(err) }()
+
+	if err := fileops.MkdirAll(filepath.Dir(cf.PathAbs())); err != nil {
 		return errors.WithMessage(err, "couldn't ensure the original file's dir exists")
 	}
 
-	if helpers.CheckFileExists(cf.PathAbs()) {
-		if err := os.Remove(cf.PathAbs()); err != nil {
-			return errors.WithMessagef(err, "couldn't remove the original file: %s", cf.PathAbs())
+	if err := cf.removeOwnLive(); err != nil {
+		return errors.WithStack(err)
+	}
+
+	if err := cf.writeCopy(); err != nil {
+		return errors.WithStack(err)
+	}
+
+	// It's a copy whatever the link mode, and the backup is usually deleted next.
+	cf.applyMeta(cf.PathAbs())
+
+	return nil
+}
+
+// Writes a copy of the backup file at the restore location.
+func (cf *ConfigFile) writeCopy() error {
+	if cf.IsDir() {
+		if err := cf.restoreTree(); err != nil {
+			return errors.WithStack(err)
 		}
+		if err := fileops.CopyTree(cf.PathAbs(), cf.BackupPath()); err != nil {
+			return errors.WithStack(err)
+		}
+		return nil
 	}
 
-	src, err := os.Open(cf.BackupPath())
+	content, err := cf.Content()
 	if err != nil {
 		return errors.WithStack(err)
 	}
-	defer src.Close()
 
-	dst, err := os.OpenFile(cf.PathAbs(), os.O_RDWR|os.O_CREATE, cf.Perm)
+	if err := fileops.WriteFile(cf.PathAbs(), content, cf.Perm); err != nil {
+		return errors.WithStack(err)
+	}
+
+	return nil
+}
+
+// Returns the content the live file should have.
+// That's the backup file's content, decrypted if the entry is encrypted, and rendered if it's a template.
+func (cf *ConfigFile) Content() ([]byte, error) {
+	content, err := cf.plainContent()
 	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	if cf.Template {
+		return cf.render(content)
+	}
+
+	return content, nil
+}
+
+// Deletes the backup file.
+func (cf *ConfigFile) DeleteBackup(restore bool) (err error) {
+	defer func() { err = cf.privilegeHint(err) }()
+
+	if err := cf.Unlink(restore); err != nil {
 		return errors.WithStack(err)
 	}
-	defer dst.Close()
 
-	if _, err := io.Copy(dst, src); err != nil {
+	if err := cf.RemoveBackup(); err != nil {
 		return errors.WithStack(err)
 	}
 
 	return nil
 }
 
-// Deletes the backup file.
-func (cf *ConfigFile) DeleteBackup(restore bool) error {
-	if err := cf.deleteSymlink(); err != nil {
+// Removes the backup file if it exists.
+func (cf *ConfigFile) RemoveBackup() error {
+	if cf.IsDir() {
+		return errors.WithStack(fileops.RemoveAll(cf.BackupPath()))
+	}
+
+	if err := fileops.Remove(cf.BackupPath()); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return errors.WithStack(err)
+	}
+
+	return nil
+}
+
+// Deletes the link to the backup file, replacing it with a copy of the backup if `restore` is set.
+// A hard link or a copy that was changed since it was restored is kept as is, as it holds the latest content,
+// and so is any other file that replaced the link.
+// The backup file itself is left untouched, this is used when the blob is shared with other files.
+// Command entries have no live file, their state is left as is.
+func (cf *ConfigFile) Unlink(restore bool) (err error) {
+	defer func() { err = cf.privilegeHint(err) }()
+
+	if cf.IsCommand() {
+		return nil
+	}
+
+	if err := cf.deleteLink(); err != nil {
 		return errors.WithStack(err)
 	}
 
+	if _, err := fileops.Lstat(cf.PathAbs()); restore && err == nil {
+		return nil
+	}
+
 	if restore {
 		if err := cf.HardRestore(); err != nil {
 			return errors.WithStack(err)
 		}
 	}
 
-	if err := os.Remove(cf.BackupPath()); err != nil && !errors.Is(err, os.ErrNotExist) {
-		return errors.WithStack(err)
-	}
-
 	return nil
 }
 
-// Deletes the symlink if it exists.
+// Deletes the symlink if it exists and points into the backup dir.
 func (cf *ConfigFile) deleteSymlink() error {
-	// Check if a symlink exists
-	if ok, err := helpers.CheckIfSymlink(cf.PathAbs()); err != nil && !errors.Is(err, os.ErrNotExist) {
-		// An error occurred and it's not because the file doesn't exist
+	if !cf.isOwnSymlink() {
+		// Either there's no symlink, or it isn't ours.
+		return nil
+	}
+
+	if err := fileops.Remove(cf.PathAbs()); err != nil {
 		return errors.WithStack(err)
-	} else if ok {
-		// The file is a symlink, we need to remove it
-		if err := os.Remove(cf.PathAbs()); err != nil {
-			return errors.WithStack(err)
-		}
 	}
 
 	return nil
 }
 
-func (cf *ConfigFile) Backup() error {
+func (cf *ConfigFile) Backup() (err error) {
+	defer func() { err = cf.privilegeHint(err) }()
+
 	// Save the file permissions
 	cf.SavePerm()
 
-	// Ensure the backup dir exists
-	if err := helpers.EnsureDirExists(cf.BackupDir()); err != nil {
-		return errors.WithMessage(err, "couldn't ensure backup dir exists")
+	if cf.IsDir() {
+		return cf.backupDir()
+	}
+	if cf.IsCommand() {
+		return cf.backupCommand()
 	}
 
-	if cf.Browsable {
-		// Ensure the internals dir exists
-		if err := helpers.EnsureDirExists(cf.InternalsDir()); err != nil {
-			return errors.WithMessage(err, "couldn't ensure internals dir exists")
+	// Ensure the blob store exists
+	if err := fileops.MkdirAll(cf.BlobsDir()); err != nil {
+		return errors.WithMessage(err, "couldn't ensure blobs dir exists")
+	}
+
+	if cf.Template {
+		// Check the template renders before moving the file, otherwise it couldn't be restored.
+		content, err := fileops.ReadFile(cf.PathAbs())
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		if _, err := cf.render(content); err != nil {
+			return errors.WithStack(err)
 		}
 	}
 
-	// Move the file to the backup dir
-	if err := os.Rename(cf.PathAbs(), cf.BackupPath()); err != nil {
+	if cf.Encrypted {
+		return cf.backupEncrypted()
+	}
+
+	digest, err := fileops.FileDigest(cf.PathAbs())
+	if err != nil {
+		return errors.WithMessage(err, "couldn't hash the file's content")
+	}
+	cf.Blob = cf.BlobName(digest)
+	cf.Browsable = true
+
+	if fileops.Exists(cf.BackupPath()) {
+		// A copied file with the same content is already backed up, share its blob.
+		if err := fileops.Remove(cf.PathAbs()); err != nil {
+			return errors.WithMessagef(err, "couldn't remove the original file: %s", cf.PathAbs())
+		}
+	} else if err := fileops.Move(cf.BackupPath(), cf.PathAbs()); err != nil {
+		// Move the file to the blob store
 		return errors.WithMessage(err, "couldn't move file to backup dir")
 	}
 
@@ -359,3 +571,34 @@ func (cf *ConfigFile) Backup() error {
 
 	return nil
 }
+
+// Moves the whole directory to the backup dir, and creates a symlink to it.
+func (cf *ConfigFile) backupDir() error {
+	if err := cf.checkNoTrackedFiles(); err != nil {
+		return errors.WithStack(err)
+	}
+
+	if err := fileops.MkdirAll(filepath.Dir(cf.BackupPath())); err != nil {
+		return errors.WithMessage(err, "couldn't ensure the dirs dir exists")
+	}
+
+	if fileops.Exists(cf.BackupPath()) {
+		return errors.Errorf("a backup of %s already exists at %s", cf.Path, cf.BackupPath())
+	}
+
+	cf.Browsable = true
+
+	if err := fileops.Move(cf.BackupPath(), cf.PathAbs()); err != nil {
+		return errors.WithMessage(err, "couldn't move directory to backup dir")
+	}
+
+	if _, err := cf.SaveTree(); err != nil {
+		return errors.WithStack(err)
+	}
+
+	if err := cf.Restore(); err != nil {
+		return errors.WithMessage(err, "couldn't create a symlink to the backup directory")
+	}
+
+	return nil
+}
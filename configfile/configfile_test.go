@@ -22,6 +22,8 @@ func TestNewConfigFile(t *testing.T) {
 		{"empty path", "", nil, true},
 		{"valid path", filepath.Join(homedir, "path/to/file"), &ConfigFile{Path: "path/to/file"}, false},
 		{"clean path", filepath.Join(homedir, "path/../path/.config"), &ConfigFile{Path: "path/.config"}, false},
+		{"outside home", "/etc/hosts", &ConfigFile{Path: "etc/hosts", Anchor: AnchorRoot}, false},
+		{"home sibling", "/home/user2/.bashrc", &ConfigFile{Path: "home/user2/.bashrc", Anchor: AnchorRoot}, false},
 	}
 
 	for _, test := range tests {
@@ -35,6 +37,12 @@ func TestNewConfigFile(t *testing.T) {
 			if file != nil && file.Path != test.out.Path {
 				t.Errorf("got path: %v, want: %v", file.Path, test.out.Path)
 			}
+			if file != nil && file.Anchor != test.out.Anchor {
+				t.Errorf("got anchor: %v, want: %v", file.Anchor, test.out.Anchor)
+			}
+			if file != nil && file.PathAbs() != filepath.Clean(test.in) {
+				t.Errorf("got absolute path: %v, want: %v", file.PathAbs(), filepath.Clean(test.in))
+			}
 		})
 	}
 }
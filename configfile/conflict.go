@@ -0,0 +1,221 @@
+package configfile
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/osamaadam/cfgrr/fileops"
+	"github.com/osamaadam/cfgrr/helpers"
+	"github.com/pkg/errors"
+)
+
+// How to restore a file when something that isn't managed by cfgrr is already at its location.
+type ConflictStrategy string
+
+const (
+	// Leaves the live file as is.
+	ConflictSkip ConflictStrategy = "skip"
+	// Replaces the live file with the backup.
+	ConflictOverwrite ConflictStrategy = "overwrite"
+	// Moves the live file next to the restored one, with the `OrigSuffix` suffix.
+	ConflictKeepBoth ConflictStrategy = "keep-both"
+	// Shows the differences and lets the user pick one of the other strategies.
+	ConflictPrompt ConflictStrategy = "prompt"
+)
+
+var conflictStrategies = []ConflictStrategy{ConflictSkip, ConflictOverwrite, ConflictKeepBoth, ConflictPrompt}
+
+// The suffix of the live files moved away by the keep-both strategy.
+const OrigSuffix = ".cfgrr-orig"
+
+// Parses a conflict strategy, an empty string is the default strategy (keep-both).
+func ParseConflictStrategy(strategy string) (ConflictStrategy, error) {
+	if strategy == "" {
+		return ConflictKeepBoth, nil
+	}
+	for _, s := range conflictStrategies {
+		if string(s) == strategy {
+			return s, nil
+		}
+	}
+
+	names := make([]string, len(conflictStrategies))
+	for i, s := range conflictStrategies {
+		names[i] = string(s)
+	}
+
+	return "", errors.Errorf("unknown conflict strategy %q, expected one of: %s", strategy, strings.Join(names, ", "))
+}
+
+// Returned when restoring would replace a live file that isn't managed by cfgrr.
+type ConflictError struct {
+	Path string
+}
+
+func (e *ConflictError) Error() string {
+	return fmt.Sprintf("%s already exists and isn't managed by cfgrr, pick a conflict strategy to restore it", e.Path)
+}
+
+// What restoring a file did.
+type RestoreAction string
+
+const (
+	// Nothing was in the way.
+	RestoreRestored RestoreAction = "restored"
+	// The live file was left as is.
+	RestoreSkipped RestoreAction = "skipped"
+	// The live file was replaced.
+	RestoreOverwritten RestoreAction = "overwritten"
+	// The live file was moved to a sidecar.
+	RestoreKeptBoth RestoreAction = "kept-both"
+)
+
+type RestoreResult struct {
+	File   *ConfigFile
+	Action RestoreAction
+	// Where the live file was moved to, for the keep-both strategy.
+	Sidecar string
+}
+
+// Checks whether something that isn't managed by cfgrr is at the live file's location.
+// Symlinks into the backup dir are cfgrr's, even if they're stale.
+func (cf *ConfigFile) HasConflict() bool {
+	if cf.IsCommand() {
+		return false
+	}
+
+	info, err := fileops.Lstat(cf.PathAbs())
+	if err != nil {
+		return false
+	}
+
+	return !cf.ownsLive(info)
+}
+
+// Checks whether the live file, described by `info`, is one cfgrr created.
+func (cf *ConfigFile) ownsLive(info os.FileInfo) bool {
+	if info.Mode()&os.ModeSymlink != 0 {
+		return cf.isOwnSymlink()
+	}
+
+	return cf.IsLinked()
+}
+
+// Checks whether the live file is a symlink into the backup dir.
+func (cf *ConfigFile) isOwnSymlink() bool {
+	target, err := fileops.Readlink(cf.PathAbs())
+	if err != nil {
+		return false
+	}
+
+	rel, err := filepath.Rel(filepath.Clean(cf.BackupDir()), target)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// Removes the live file if it's one cfgrr created, fails with a `*ConflictError` otherwise.
+func (cf *ConfigFile) removeOwnLive() error {
+	info, err := fileops.Lstat(cf.PathAbs())
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return errors.WithStack(err)
+	}
+
+	if !cf.ownsLive(info) {
+		return &ConflictError{Path: cf.PathAbs()}
+	}
+
+	if err := fileops.Remove(cf.PathAbs()); err != nil {
+		return errors.WithMessagef(err, "couldn't remove the original file: %s", cf.PathAbs())
+	}
+
+	return nil
+}
+
+// Restores the file, resolving a conflict with the live file with the given strategy.
+// The prompt strategy has to be resolved by the caller first.
+func (cf *ConfigFile) RestoreWith(strategy ConflictStrategy) (result RestoreResult, err error) {
+	defer func() { err = cf.privilegeHint(err) }()
+
+	result = RestoreResult{File: cf, Action: RestoreRestored}
+
+	if !cf.HasConflict() {
+		return result, errors.WithStack(cf.Restore())
+	}
+
+	switch strategy {
+	case ConflictSkip:
+		result.Action = RestoreSkipped
+		return result, nil
+	case ConflictOverwrite:
+		if err := fileops.RemoveAll(cf.PathAbs()); err != nil {
+			return result, errors.WithMessagef(err, "couldn't remove %s", cf.PathAbs())
+		}
+		result.Action = RestoreOverwritten
+	case ConflictKeepBoth:
+		sidecar := cf.sidecarPath()
+		if err := fileops.Move(sidecar, cf.PathAbs()); err != nil {
+			return result, errors.WithMessagef(err, "couldn't move %s away", cf.PathAbs())
+		}
+		result.Action = RestoreKeptBoth
+		result.Sidecar = sidecar
+	default:
+		return result, errors.Errorf("can't restore %s with the %q conflict strategy", cf.Path, strategy)
+	}
+
+	if err := cf.Restore(); err != nil {
+		return result, errors.WithStack(err)
+	}
+
+	return result, nil
+}
+
+// Returns a free path next to the live file to move it to.
+// Sidecars of earlier restores are kept, so the new one is numbered.
+func (cf *ConfigFile) sidecarPath() string {
+	path := cf.PathAbs() + OrigSuffix
+	for i := 1; ; i++ {
+		if _, err := fileops.Lstat(path); errors.Is(err, os.ErrNotExist) {
+			return path
+		}
+		path = fmt.Sprintf("%s%s.%d", cf.PathAbs(), OrigSuffix, i)
+	}
+}
+
+// Describes how the live file differs from what restoring would put in its place,
+// as a unified diff when both are regular files.
+func (cf *ConfigFile) ConflictDiff() (string, error) {
+	info, err := fileops.Lstat(cf.PathAbs())
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+
+	switch {
+	case info.Mode()&os.ModeSymlink != 0:
+		target, _ := fileops.Readlink(cf.PathAbs())
+		return fmt.Sprintf("%s is a symlink to %s\n", cf.PathAbs(), target), nil
+	case info.IsDir():
+		return fmt.Sprintf("%s is a directory\n", cf.PathAbs()), nil
+	case cf.IsDir():
+		return fmt.Sprintf("%s is a file, the backup is a directory\n", cf.PathAbs()), nil
+	}
+
+	live, err := fileops.ReadFile(cf.PathAbs())
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	content, err := cf.Content()
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+
+	diff := helpers.UnifiedDiff(cf.PathAbs(), "backup of "+cf.String(), live, content)
+	if diff == "" {
+		// Same content, only the link differs (e.g. a copy of a symlinked file).
+		return fmt.Sprintf("%s has the same content as the backup\n", cf.PathAbs()), nil
+	}
+
+	return diff, nil
+}
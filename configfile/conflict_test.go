@@ -0,0 +1,142 @@
+package configfile
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+func TestParseConflictStrategy(t *testing.T) {
+	tests := []struct {
+		in      string
+		out     ConflictStrategy
+		wantErr bool
+	}{
+		{"", ConflictKeepBoth, false},
+		{"skip", ConflictSkip, false},
+		{"overwrite", ConflictOverwrite, false},
+		{"keep-both", ConflictKeepBoth, false},
+		{"prompt", ConflictPrompt, false},
+		{"merge", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			strategy, err := ParseConflictStrategy(tt.in)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseConflictStrategy() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if strategy != tt.out {
+				t.Errorf("expected %s, got %s", tt.out, strategy)
+			}
+		})
+	}
+}
+
+func TestConfigFile_HasConflict(t *testing.T) {
+	tests := []struct {
+		name  string
+		setup func(file *ConfigFile)
+		out   bool
+	}{
+		{"nothing", func(file *ConfigFile) {}, false},
+		{"restored", func(file *ConfigFile) { file.Restore() }, false},
+		{"stale symlink", func(file *ConfigFile) {
+			os.Symlink(filepath.Join(file.BackupDir(), "gone"), file.PathAbs())
+		}, false},
+		{"foreign symlink", func(file *ConfigFile) {
+			os.Symlink(os.TempDir(), file.PathAbs())
+		}, true},
+		{"regular file", func(file *ConfigFile) {
+			os.WriteFile(file.PathAbs(), []byte("local"), 0644)
+		}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			files := _setupRestoreEnv(t.TempDir(), dir, 1)
+			file := files[0]
+			tt.setup(file)
+
+			if got := file.HasConflict(); got != tt.out {
+				t.Errorf("expected %v, got %v", tt.out, got)
+			}
+		})
+	}
+}
+
+func TestConfigFile_Restore_Conflict(t *testing.T) {
+	files := _setupRestoreEnv(t.TempDir(), t.TempDir(), 1)
+	file := files[0]
+	os.WriteFile(file.PathAbs(), []byte("local"), 0644)
+
+	var conflictErr *ConflictError
+	if err := file.Restore(); !errors.As(err, &conflictErr) {
+		t.Fatalf("expected a conflict error, got %v", err)
+	}
+	if err := file.HardRestore(); !errors.As(err, &conflictErr) {
+		t.Fatalf("expected a conflict error, got %v", err)
+	}
+	if content, _ := os.ReadFile(file.PathAbs()); string(content) != "local" {
+		t.Errorf("expected the live file to be kept, got %q", content)
+	}
+}
+
+func TestConfigFile_RestoreWith_KeepBoth(t *testing.T) {
+	files := _setupRestoreEnv(t.TempDir(), t.TempDir(), 1)
+	file := files[0]
+
+	// Sidecars of earlier restores are kept.
+	for i, want := range []string{file.PathAbs() + OrigSuffix, file.PathAbs() + OrigSuffix + ".1"} {
+		os.Remove(file.PathAbs())
+		os.WriteFile(file.PathAbs(), []byte{byte('a' + i)}, 0644)
+
+		result, err := file.RestoreWith(ConflictKeepBoth)
+		if err != nil {
+			t.Fatalf("expected no error, got %s", err)
+		}
+		if result.Sidecar != want {
+			t.Errorf("expected the sidecar at %s, got %s", want, result.Sidecar)
+		}
+		if content, _ := os.ReadFile(want); string(content) != string([]byte{byte('a' + i)}) {
+			t.Errorf("expected the sidecar to hold the live file, got %q", content)
+		}
+		if !file.IsLinked() {
+			t.Errorf("expected %s to be linked", file.PathAbs())
+		}
+	}
+}
+
+func TestConfigFile_Unlink_Foreign(t *testing.T) {
+	files := _setupRestoreEnv(t.TempDir(), t.TempDir(), 1)
+	file := files[0]
+	os.Symlink(os.TempDir(), file.PathAbs())
+
+	if err := file.Unlink(true); err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+	if target, _ := os.Readlink(file.PathAbs()); target != os.TempDir() {
+		t.Errorf("expected the foreign symlink to be kept, got %q", target)
+	}
+}
+
+func TestConfigFile_ConflictDiff(t *testing.T) {
+	files := _setupBackupEnv(t.TempDir(), t.TempDir(), 1)
+	file := files[0]
+	os.WriteFile(file.PathAbs(), []byte("backup\n"), 0644)
+	file.Backup()
+	os.Remove(file.PathAbs())
+	os.WriteFile(file.PathAbs(), []byte("local\n"), 0644)
+
+	diff, err := file.ConflictDiff()
+	if err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+	if !strings.Contains(diff, "-local\n") || !strings.Contains(diff, "+backup\n") {
+		t.Errorf("expected a diff from the live file to the backup, got %q", diff)
+	}
+}
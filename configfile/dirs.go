@@ -0,0 +1,110 @@
+package configfile
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/osamaadam/cfgrr/fileops"
+	"github.com/osamaadam/cfgrr/helpers"
+	"github.com/pkg/errors"
+)
+
+// The kind of a tracked entry.
+type Kind string
+
+const (
+	// A regular file, this is the default for entries without a kind.
+	KindFile Kind = "file"
+	// A directory tracked as a whole, new files created inside it are tracked too.
+	KindDir Kind = "dir"
+	// State that isn't a file (e.g. dconf, crontab), dumped and loaded by commands, see `NewCommandFile`.
+	KindCommand Kind = "command"
+)
+
+// The directory (inside the internals dir) holding the tracked directories.
+// Directories change all the time, so they're named after the hash of their path rather than their content.
+var dirsDir = "dirs"
+
+// Checks whether the entry is a directory.
+func (cf *ConfigFile) IsDir() bool {
+	return cf.Kind == KindDir
+}
+
+// Records the sub directories of the backed up directory with their modes.
+// Git doesn't track directories, so this is what allows restoring empty directories and their modes.
+func (cf *ConfigFile) SaveTree() (changed bool, err error) {
+	if !cf.IsDir() {
+		return false, nil
+	}
+
+	dirs, err := helpers.ListDirs(fileops.Locate(cf.BackupPath()))
+	if err != nil {
+		return false, errors.WithMessagef(err, "couldn't list the directories of %s", cf.Path)
+	}
+	if len(dirs) == 0 {
+		dirs = nil
+	}
+
+	changed = len(dirs) != len(cf.Dirs)
+	for dir, mode := range dirs {
+		if oldMode, ok := cf.Dirs[dir]; !ok || oldMode != mode {
+			changed = true
+		}
+	}
+	cf.Dirs = dirs
+
+	return changed, nil
+}
+
+// Recreates the recorded sub directories missing from the backed up directory, and reapplies the modes.
+func (cf *ConfigFile) restoreTree() error {
+	if err := fileops.MkdirAll(cf.BackupPath()); err != nil {
+		return errors.WithStack(err)
+	}
+
+	// Parents sort before their children, the modes are applied children first
+	// to avoid locking ourselves out of a read-only directory.
+	dirs := helpers.GetMapKeys(cf.Dirs)
+	sort.Strings(dirs)
+	for _, dir := range dirs {
+		if err := fileops.MkdirAll(filepath.Join(cf.BackupPath(), filepath.FromSlash(dir))); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+	for i := len(dirs) - 1; i >= 0; i-- {
+		path := filepath.Join(cf.BackupPath(), filepath.FromSlash(dirs[i]))
+		if err := fileops.Chmod(path, cf.Dirs[dirs[i]]); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+
+	return errors.WithStack(fileops.Chmod(cf.BackupPath(), cf.Perm.Perm()))
+}
+
+// Makes sure the directory doesn't contain files already tracked by cfgrr,
+// otherwise they'd be tracked twice.
+func (cf *ConfigFile) checkNoTrackedFiles() error {
+	backupDir := filepath.Clean(cf.BackupDir())
+
+	return filepath.WalkDir(cf.PathAbs(), func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		if d.Type()&os.ModeSymlink == 0 {
+			return nil
+		}
+
+		target, err := os.Readlink(path)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		if target == backupDir || strings.HasPrefix(target, backupDir+string(filepath.Separator)) {
+			return errors.Errorf("%s is already tracked by cfgrr, delete it with 'cfgrr delete -r' before backing up %s", path, cf.PathAbs())
+		}
+
+		return nil
+	})
+}
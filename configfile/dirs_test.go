@@ -0,0 +1,140 @@
+package configfile
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/osamaadam/cfgrr/helpers"
+	"github.com/osamaadam/cfgrr/vconfig"
+)
+
+func TestConfigFile_BackupDir(t *testing.T) {
+	tests := []struct {
+		name    string
+		files   []string
+		dirs    map[string]os.FileMode
+		wantErr bool
+	}{
+		{"empty directory", nil, nil, false},
+		{"nested files", []string{"init.vim", "lua/plugins.lua"}, map[string]os.FileMode{"lua": 0755}, false},
+		{"empty sub directories", []string{"init.vim"}, map[string]os.FileMode{"undo": 0700, "undo/deep": 0750}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file := _setupDirEnv(t, tt.files, tt.dirs)
+
+			if err := file.Backup(); (err != nil) != tt.wantErr {
+				t.Fatalf("ConfigFile.Backup() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if ok, _ := helpers.CheckIfSymlink(file.PathAbs()); !ok {
+				t.Errorf("expected %s to be a symlink", file.PathAbs())
+			}
+			for _, name := range tt.files {
+				if !helpers.CheckFileExists(filepath.Join(file.PathAbs(), name)) {
+					t.Errorf("expected %s to be reachable through the symlink", name)
+				}
+			}
+			if len(file.Dirs) != len(tt.dirs) {
+				t.Errorf("expected %v to be recorded, got %v", tt.dirs, file.Dirs)
+			}
+			for dir, mode := range tt.dirs {
+				if file.Dirs[dir] != mode {
+					t.Errorf("expected %s to be recorded as %v, got %v", dir, mode, file.Dirs[dir])
+				}
+			}
+		})
+	}
+}
+
+func TestConfigFile_RestoreDir(t *testing.T) {
+	t.Run("recreates empty directories", func(t *testing.T) {
+		dirs := map[string]os.FileMode{"undo": 0700, "undo/deep": 0750}
+		file := _setupDirEnv(t, []string{"init.vim"}, dirs)
+		if err := file.Backup(); err != nil {
+			t.Fatalf("expected no error, got %s", err)
+		}
+
+		// Git doesn't keep empty directories.
+		os.RemoveAll(filepath.Join(file.BackupPath(), "undo"))
+		os.Remove(file.PathAbs())
+
+		if err := file.Restore(); err != nil {
+			t.Fatalf("expected no error, got %s", err)
+		}
+
+		for dir, mode := range dirs {
+			info, err := os.Stat(filepath.Join(file.PathAbs(), dir))
+			if err != nil {
+				t.Fatalf("expected %s to be recreated, got %s", dir, err)
+			}
+			if info.Mode().Perm() != mode {
+				t.Errorf("expected %s to have mode %v, got %v", dir, mode, info.Mode().Perm())
+			}
+		}
+	})
+
+	t.Run("hard restores a copy", func(t *testing.T) {
+		file := _setupDirEnv(t, []string{"init.vim", "lua/plugins.lua"}, nil)
+		if err := file.Backup(); err != nil {
+			t.Fatalf("expected no error, got %s", err)
+		}
+
+		if err := file.DeleteBackup(true); err != nil {
+			t.Fatalf("expected no error, got %s", err)
+		}
+
+		if ok, _ := helpers.CheckIfSymlink(file.PathAbs()); ok {
+			t.Errorf("expected %s not to be a symlink", file.PathAbs())
+		}
+		if !helpers.CheckFileExists(filepath.Join(file.PathAbs(), "lua/plugins.lua")) {
+			t.Errorf("expected the directory's files to be restored")
+		}
+		if helpers.CheckFileExists(file.BackupPath()) {
+			t.Errorf("expected the backup to be deleted")
+		}
+	})
+
+	t.Run("refuses directories with tracked files", func(t *testing.T) {
+		file := _setupDirEnv(t, []string{"init.vim"}, nil)
+		inner, _ := NewConfigFile(filepath.Join(file.PathAbs(), "init.vim"))
+		if err := inner.Backup(); err != nil {
+			t.Fatalf("expected no error, got %s", err)
+		}
+
+		if err := file.Backup(); err == nil {
+			t.Errorf("expected an error, got nil")
+		}
+	})
+}
+
+func _setupDirEnv(t *testing.T, files []string, dirs map[string]os.FileMode) *ConfigFile {
+	c := vconfig.GetConfig()
+	c.SetBackupDir(t.TempDir())
+
+	root := filepath.Join(t.TempDir(), "nvim")
+	for dir := range dirs {
+		os.MkdirAll(filepath.Join(root, dir), 0755)
+	}
+	for dir, mode := range dirs {
+		os.Chmod(filepath.Join(root, dir), mode)
+	}
+	for _, name := range files {
+		path := filepath.Join(root, name)
+		os.MkdirAll(filepath.Dir(path), 0755)
+		os.WriteFile(path, []byte(name), 0644)
+	}
+	os.MkdirAll(root, 0755)
+
+	file, err := NewConfigFile(root)
+	if err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+	if !file.IsDir() {
+		t.Fatalf("expected %s to be a directory entry", root)
+	}
+
+	return file
+}
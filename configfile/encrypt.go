@@ -0,0 +1,163 @@
+package configfile
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+
+	"github.com/osamaadam/cfgrr/crypt"
+	"github.com/osamaadam/cfgrr/fileops"
+	"github.com/pkg/errors"
+)
+
+// Returns the backup file's content, decrypted if the entry is encrypted.
+func (cf *ConfigFile) plainContent() ([]byte, error) {
+	content, err := fileops.ReadFile(cf.BackupPath())
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return cf.Decrypt(content)
+}
+
+// Returns the backup file's content as it's edited, i.e. decrypted, with templates left unrendered.
+func (cf *ConfigFile) EditableContent() ([]byte, error) {
+	return cf.plainContent()
+}
+
+// Stores the edited content of the backup file as a new blob (encrypted if the entry is), and points the entry at it.
+// The old blob is left in place, as it could be shared with other files.
+func (cf *ConfigFile) SetContent(content []byte) error {
+	if cf.Encrypted {
+		return errors.WithStack(cf.storeEncrypted(content, cf.Perm.Perm()))
+	}
+	return errors.WithStack(cf.storeBlob(content, cf.Perm.Perm()))
+}
+
+// Decrypts the content of a backup file of the entry (e.g. read from a git revision), if the entry is encrypted.
+func (cf *ConfigFile) Decrypt(content []byte) ([]byte, error) {
+	if !cf.Encrypted {
+		return content, nil
+	}
+
+	secret, err := crypt.Secret()
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	plain, err := crypt.Decrypt(secret, content)
+	if err != nil {
+		return nil, errors.WithMessagef(err, "couldn't decrypt the backup file of %s", cf.Path)
+	}
+
+	return plain, nil
+}
+
+// Encrypts or decrypts the backup file of the entry.
+// Entries that aren't backed up yet are only marked, their backup is encrypted once it's made.
+// Encrypted files are always copied in place, as the live file differs from the backup.
+// It doesn't touch the live file, see `Reconfigure` for that.
+func (cf *ConfigFile) SetEncrypted(encrypted bool) error {
+	if cf.IsDir() {
+		if !encrypted {
+			return nil
+		}
+		return errors.Errorf("%s is a directory, only files can be encrypted", cf.Path)
+	}
+	if cf.Encrypted == encrypted {
+		return nil
+	}
+	if cf.Blob == "" {
+		if fileops.Exists(cf.BackupPath()) {
+			return errors.Errorf("%s isn't in the blob store yet, run 'cfgrr migrate'", cf.Path)
+		}
+		cf.Encrypted = encrypted
+		if encrypted && !cf.IsCommand() {
+			cf.Link = LinkCopy
+		}
+		return nil
+	}
+
+	content, err := cf.plainContent()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	info, err := fileops.Stat(cf.BackupPath())
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	if encrypted {
+		if err := cf.storeEncrypted(content, info.Mode().Perm()); err != nil {
+			return errors.WithStack(err)
+		}
+		cf.Link = LinkCopy
+	} else {
+		if err := cf.storeBlob(content, info.Mode().Perm()); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+	cf.Encrypted = encrypted
+
+	return nil
+}
+
+// Moves the live file into the blob store encrypted, and copies it back in place decrypted.
+func (cf *ConfigFile) backupEncrypted() error {
+	content, err := fileops.ReadFile(cf.PathAbs())
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	if err := cf.storeEncrypted(content, cf.Perm.Perm()); err != nil {
+		return errors.WithMessagef(err, "couldn't encrypt %s", cf.PathAbs())
+	}
+	cf.Browsable = true
+
+	if err := fileops.Remove(cf.PathAbs()); err != nil {
+		return errors.WithMessagef(err, "couldn't remove the original file: %s", cf.PathAbs())
+	}
+
+	if err := cf.Restore(); err != nil {
+		return errors.WithMessage(err, "couldn't copy the decrypted backup file in place")
+	}
+
+	return nil
+}
+
+// Encrypts the content into a new blob, and points the entry at it.
+func (cf *ConfigFile) storeEncrypted(content []byte, perm os.FileMode) error {
+	secret, err := crypt.EncryptionSecret()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	encrypted, err := crypt.Encrypt(secret, content)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	return cf.storeBlob(encrypted, perm)
+}
+
+// Writes the content to the blob store unless it's already there, and points the entry at it.
+// A blob edited through its link since it was stored is written over, as it's named after content it no longer has.
+func (cf *ConfigFile) storeBlob(content []byte, perm os.FileMode) error {
+	if err := fileops.MkdirAll(cf.BlobsDir()); err != nil {
+		return errors.WithStack(err)
+	}
+
+	sum := sha256.Sum256(content)
+	digest := hex.EncodeToString(sum[:])
+	blob := cf.BlobName(digest)
+
+	blobPath := BlobPath(blob)
+	if existing, err := fileops.FileDigest(blobPath); err != nil || existing != digest {
+		if err := fileops.WriteFile(blobPath, content, perm); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+	cf.Blob = blob
+
+	return nil
+}
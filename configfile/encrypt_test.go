@@ -0,0 +1,96 @@
+package configfile
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/osamaadam/cfgrr/crypt"
+	"github.com/osamaadam/cfgrr/helpers"
+	"github.com/osamaadam/cfgrr/vconfig"
+)
+
+func TestConfigFile_Encrypted(t *testing.T) {
+	t.Setenv(crypt.PassphraseEnv, "hunter2")
+	secret := []byte("machine example.com password hunter2")
+
+	files := _setupBackupEnv(t.TempDir(), t.TempDir(), 1)
+	file := files[0]
+	os.WriteFile(file.PathAbs(), secret, 0600)
+	file.Encrypted = true
+
+	if err := file.Backup(); err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+
+	backup, _ := os.ReadFile(file.BackupPath())
+	if bytes.Contains(backup, secret) || !crypt.IsEncrypted(backup) {
+		t.Errorf("expected the backup to be encrypted")
+	}
+	if content, _ := os.ReadFile(file.PathAbs()); !bytes.Equal(content, secret) {
+		t.Errorf("expected the live file to be decrypted, got %q", content)
+	}
+	if ok, _ := helpers.CheckIfSymlink(file.PathAbs()); ok || !file.IsLinked() {
+		t.Errorf("expected the live file to be a copy of the decrypted backup")
+	}
+
+	// Changes to the live file are encrypted into a new blob.
+	oldBlob := file.Blob
+	os.WriteFile(file.PathAbs(), []byte("changed"), 0600)
+	changed, err := file.Sync()
+	if err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+	if !changed || file.Blob == oldBlob {
+		t.Fatalf("expected the changes to be stored in a new blob")
+	}
+	if content, _ := file.Content(); string(content) != "changed" {
+		t.Errorf("expected %q, got %q", "changed", content)
+	}
+	if intact, _ := file.IsIntact(); !intact {
+		t.Errorf("expected the blob to be named after its encrypted content")
+	}
+
+	// A wrong passphrase can't decrypt the backup.
+	t.Setenv(crypt.PassphraseEnv, "hunter3")
+	if _, err := file.Content(); err == nil {
+		t.Errorf("expected a wrong passphrase to fail")
+	}
+	t.Setenv(crypt.PassphraseEnv, "hunter2")
+
+	if err := file.SetEncrypted(false); err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+	if backup, _ := os.ReadFile(file.BackupPath()); string(backup) != "changed" {
+		t.Errorf("expected the backup to be decrypted, got %q", backup)
+	}
+}
+
+func TestConfigFile_SetEncrypted(t *testing.T) {
+	vconfig.GetConfig().SetBackupDir(t.TempDir())
+	legacy := &ConfigFile{Path: "legacy", Browsable: true}
+	os.MkdirAll(filepath.Dir(legacy.BackupPath()), 0755)
+	os.WriteFile(legacy.BackupPath(), []byte("legacy"), 0644)
+
+	tests := []struct {
+		name    string
+		file    *ConfigFile
+		wantErr bool
+	}{
+		{"directory", &ConfigFile{Path: "dir", Kind: KindDir}, true},
+		{"not in the blob store", legacy, true},
+		{"not backed up yet", &ConfigFile{Path: "file"}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.file.SetEncrypted(true); (err != nil) != tt.wantErr {
+				t.Errorf("ConfigFile.SetEncrypted() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && (!tt.file.Encrypted || tt.file.LinkMode() != LinkCopy) {
+				t.Errorf("expected the file to be marked as an encrypted copy")
+			}
+		})
+	}
+}
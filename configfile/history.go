@@ -0,0 +1,206 @@
+package configfile
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/osamaadam/cfgrr/fileops"
+	"github.com/osamaadam/cfgrr/vconfig"
+	"github.com/pkg/errors"
+)
+
+// The directory (relative to the backup dir) holding the revisions of each file.
+// It is kept out of git, so the history is local to the machine.
+var historyDir = ".history"
+
+// A saved copy of the backup file at some point in time.
+type Revision struct {
+	ID   int
+	Time time.Time
+	Size int64
+	path string
+}
+
+// Returns the path of the revision's content.
+func (r *Revision) Path() string {
+	return r.path
+}
+
+// Returns the name of the directory (relative to the backup dir) holding the revisions.
+func HistoryDirName() string {
+	return historyDir
+}
+
+// Returns the directory holding the revisions of the file.
+func (cf *ConfigFile) HistoryDir() string {
+	return filepath.Join(cf.BackupDir(), historyDir, cf.HashShort())
+}
+
+// Lists the saved revisions of the file, oldest first.
+func (cf *ConfigFile) History() ([]*Revision, error) {
+	entries, err := os.ReadDir(fileops.Locate(cf.HistoryDir()))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return []*Revision{}, nil
+		}
+		return nil, errors.WithStack(err)
+	}
+
+	revs := make([]*Revision, 0, len(entries))
+	for _, entry := range entries {
+		// Revisions are named `<id>-<unix nano>`.
+		idStr, tsStr, ok := strings.Cut(entry.Name(), "-")
+		if !ok || entry.IsDir() {
+			continue
+		}
+		id, err := strconv.Atoi(idStr)
+		if err != nil {
+			continue
+		}
+		ts, err := strconv.ParseInt(tsStr, 10, 64)
+		if err != nil {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+
+		revs = append(revs, &Revision{
+			ID:   id,
+			Time: time.Unix(0, ts),
+			Size: info.Size(),
+			path: filepath.Join(cf.HistoryDir(), entry.Name()),
+		})
+	}
+
+	sort.Slice(revs, func(i, j int) bool {
+		return revs[i].ID < revs[j].ID
+	})
+
+	return revs, nil
+}
+
+// Finds a revision by its id.
+func (cf *ConfigFile) Revision(id int) (*Revision, error) {
+	revs, err := cf.History()
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	for _, rev := range revs {
+		if rev.ID == id {
+			return rev, nil
+		}
+	}
+
+	return nil, errors.Errorf("revision %d of %s doesn't exist", id, cf.Path)
+}
+
+// Checks whether the revision has the same content as the current backup file.
+func (cf *ConfigFile) IsCurrent(rev *Revision) (bool, error) {
+	return sameContent(rev.Path(), cf.BackupPath())
+}
+
+// Saves the current backup file as a new revision.
+// Nothing is saved if the content matches the latest revision.
+// Old revisions are pruned to respect the configured history limit.
+func (cf *ConfigFile) SaveRevision() (saved bool, err error) {
+	limit := vconfig.GetConfig().HistoryLimit
+	if limit <= 0 || cf.IsDir() {
+		// Revisions aren't kept for directories.
+		return false, nil
+	}
+
+	revs, err := cf.History()
+	if err != nil {
+		return false, errors.WithStack(err)
+	}
+
+	nextID := 1
+	if len(revs) > 0 {
+		latest := revs[len(revs)-1]
+		same, err := cf.IsCurrent(latest)
+		if err != nil {
+			return false, errors.WithStack(err)
+		}
+		if same {
+			return false, nil
+		}
+		nextID = latest.ID + 1
+	}
+
+	revPath := filepath.Join(cf.HistoryDir(), fmt.Sprintf("%d-%d", nextID, time.Now().UnixNano()))
+	if err := fileops.CopyFile(revPath, cf.BackupPath()); err != nil {
+		return false, errors.WithMessagef(err, "couldn't save a revision of %s", cf.Path)
+	}
+
+	revs = append(revs, &Revision{ID: nextID, path: revPath})
+	if err := cf.pruneHistory(revs, limit); err != nil {
+		return true, errors.WithStack(err)
+	}
+
+	return true, nil
+}
+
+// Removes the oldest revisions exceeding the limit.
+func (cf *ConfigFile) pruneHistory(revs []*Revision, limit int) error {
+	for len(revs) > limit {
+		if err := fileops.Remove(revs[0].Path()); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return errors.WithStack(err)
+		}
+		revs = revs[1:]
+	}
+
+	return nil
+}
+
+// Points the entry at the content of the revision, and recreates its live file.
+// The changes made to a copy of the file are pulled into the backup first, and the current content is saved as a revision,
+// so a rollback could be undone.
+// The revision is stored as a new blob, the old one is left in place as it could be shared with other files.
+func (cf *ConfigFile) Rollback(id int) error {
+	rev, err := cf.Revision(id)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	// Read the revision first, saving the current content might prune it.
+	content, err := fileops.ReadFile(rev.Path())
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	return cf.Reconfigure(func() error {
+		if _, err := cf.SaveRevision(); err != nil {
+			return errors.WithMessage(err, "couldn't save the current content before rolling back")
+		}
+
+		// Revisions are copies of the backup file, encrypted ones are stored as is.
+		if err := cf.storeBlob(content, cf.Perm.Perm()); err != nil {
+			return errors.WithMessagef(err, "couldn't store revision %d of %s", id, cf.Path)
+		}
+
+		return nil
+	})
+}
+
+// Compares the contents of two files.
+func sameContent(a, b string) (bool, error) {
+	contentA, err := fileops.ReadFile(a)
+	if err != nil {
+		return false, errors.WithStack(err)
+	}
+	contentB, err := fileops.ReadFile(b)
+	if err != nil {
+		return false, errors.WithStack(err)
+	}
+
+	return bytes.Equal(contentA, contentB), nil
+}
@@ -0,0 +1,135 @@
+package configfile
+
+import (
+	"os"
+	"testing"
+
+	"github.com/osamaadam/cfgrr/vconfig"
+)
+
+func TestConfigFile_SaveRevision(t *testing.T) {
+	tests := []struct {
+		name      string
+		limit     int
+		contents  []string
+		outRevs   int
+		outLatest int
+	}{
+		{"history disabled", 0, []string{"a", "b"}, 0, 0},
+		{"one revision", 10, []string{"a"}, 1, 1},
+		{"unchanged content", 10, []string{"a", "a", "a"}, 1, 1},
+		{"changed content", 10, []string{"a", "b", "a"}, 3, 3},
+		{"pruned to limit", 2, []string{"a", "b", "c", "d"}, 2, 4},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			files := _setupBackupEnv(t.TempDir(), t.TempDir(), 1)
+			file := files[0]
+			vconfig.GetConfig().SetHistoryLimit(tt.limit)
+			t.Cleanup(func() { vconfig.GetConfig().SetHistoryLimit(10) })
+
+			if err := file.Backup(); err != nil {
+				t.Fatalf("expected no error, got %s", err)
+			}
+
+			for _, content := range tt.contents {
+				if err := os.WriteFile(file.BackupPath(), []byte(content), file.Perm); err != nil {
+					t.Fatalf("expected no error, got %s", err)
+				}
+				if _, err := file.SaveRevision(); err != nil {
+					t.Fatalf("expected no error, got %s", err)
+				}
+			}
+
+			revs, err := file.History()
+			if err != nil {
+				t.Fatalf("expected no error, got %s", err)
+			}
+			if len(revs) != tt.outRevs {
+				t.Fatalf("expected %d revisions, got %d", tt.outRevs, len(revs))
+			}
+			if len(revs) > 0 {
+				latest := revs[len(revs)-1]
+				if ok, _ := file.IsCurrent(latest); !ok {
+					t.Errorf("expected the latest revision to match the backup file")
+				}
+				if latest.ID != tt.outLatest {
+					t.Errorf("expected the latest revision to be %d, got %d", tt.outLatest, latest.ID)
+				}
+			}
+		})
+	}
+}
+
+func TestConfigFile_Rollback(t *testing.T) {
+	tests := []struct {
+		name     string
+		link     LinkMode
+		contents []string
+		// Whether the current content was saved as a revision, as push does, before rolling back.
+		saved   bool
+		rev     int
+		out     string
+		wantErr bool
+	}{
+		{"to previous revision", LinkSymlink, []string{"a", "b"}, true, 1, "a", false},
+		{"to oldest revision", LinkSymlink, []string{"a", "b", "c"}, true, 1, "a", false},
+		{"to current revision", LinkSymlink, []string{"a", "b"}, true, 2, "b", false},
+		{"to missing revision", LinkSymlink, []string{"a"}, true, 7, "a", true},
+		{"edited through the symlink", LinkSymlink, []string{"a", "b"}, false, 1, "a", false},
+		{"copy to previous revision", LinkCopy, []string{"a", "b"}, true, 1, "a", false},
+		{"hard link to previous revision", LinkHardlink, []string{"a", "b"}, true, 1, "a", false},
+		{"edited through the hard link", LinkHardlink, []string{"a", "b"}, false, 1, "a", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			files := _setupBackupEnv(t.TempDir(), t.TempDir(), 1)
+			file := files[0]
+			if err := file.Backup(); err != nil {
+				t.Fatalf("expected no error, got %s", err)
+			}
+			if err := file.Relink(tt.link); err != nil {
+				t.Fatalf("expected no error, got %s", err)
+			}
+
+			for i, content := range tt.contents {
+				// Write through the live file, as an app would.
+				os.WriteFile(file.PathAbs(), []byte(content), file.Perm)
+				if tt.saved || i < len(tt.contents)-1 {
+					file.Sync()
+					file.SaveRevision()
+				}
+			}
+			oldBlob := file.Blob
+
+			if err := file.Rollback(tt.rev); (err != nil) != tt.wantErr {
+				t.Fatalf("ConfigFile.Rollback() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			// The live file should see the rolled back content.
+			content, err := os.ReadFile(file.PathAbs())
+			if err != nil {
+				t.Fatalf("expected no error, got %s", err)
+			}
+			if string(content) != tt.out {
+				t.Errorf("expected %q, got %q", tt.out, content)
+			}
+			if tt.wantErr {
+				return
+			}
+			if ok, err := file.IsIntact(); err != nil || !ok {
+				t.Errorf("expected the blob to be named after its content, got %t, %v", ok, err)
+			}
+			// The replaced blob is left as is, it could be shared with other files.
+			if content, _ := os.ReadFile(BlobPath(oldBlob)); string(content) != tt.contents[len(tt.contents)-1] {
+				t.Errorf("expected the old blob to be left as is, got %q", content)
+			}
+			// Syncing the live file doesn't undo the rollback.
+			if changed, err := file.Sync(); err != nil || changed {
+				t.Errorf("expected nothing to sync, got %t, %v", changed, err)
+			}
+		})
+	}
+}
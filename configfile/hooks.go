@@ -0,0 +1,66 @@
+package configfile
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// A point of an operation where hooks are run.
+type HookEvent string
+
+const (
+	HookPreBackup   HookEvent = "pre-backup"
+	HookPostBackup  HookEvent = "post-backup"
+	HookPreRestore  HookEvent = "pre-restore"
+	HookPostRestore HookEvent = "post-restore"
+	HookPreDelete   HookEvent = "pre-delete"
+	HookPostDelete  HookEvent = "post-delete"
+	HookPrePush     HookEvent = "pre-push"
+	HookPostPush    HookEvent = "post-push"
+)
+
+// The events in the order they're listed.
+var HookEvents = []HookEvent{
+	HookPreBackup, HookPostBackup,
+	HookPreRestore, HookPostRestore,
+	HookPreDelete, HookPostDelete,
+	HookPrePush, HookPostPush,
+}
+
+// Parses the name of an event, e.g. post-restore.
+func ParseHookEvent(event string) (HookEvent, error) {
+	if slices.Contains(HookEvents, HookEvent(event)) {
+		return HookEvent(event), nil
+	}
+
+	names := make([]string, len(HookEvents))
+	for i, e := range HookEvents {
+		names[i] = string(e)
+	}
+	return "", errors.Errorf("unknown hook event %q, expected one of: %s", event, strings.Join(names, ", "))
+}
+
+// Adds the commands run on the event, and removes the others, keeping the order they were added in.
+func (cf *ConfigFile) UpdateHooks(event HookEvent, add, remove []string) {
+	commands := slices.Clone(cf.Hooks[event])
+	for _, command := range add {
+		if command = strings.TrimSpace(command); command != "" && !slices.Contains(commands, command) {
+			commands = append(commands, command)
+		}
+	}
+	commands = slices.DeleteFunc(commands, func(command string) bool { return slices.Contains(remove, command) })
+
+	if len(commands) == 0 {
+		delete(cf.Hooks, event)
+		if len(cf.Hooks) == 0 {
+			cf.Hooks = nil
+		}
+		return
+	}
+	if cf.Hooks == nil {
+		cf.Hooks = make(map[HookEvent][]string)
+	}
+	cf.Hooks[event] = commands
+}
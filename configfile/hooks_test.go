@@ -0,0 +1,45 @@
+package configfile
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestConfigFile_UpdateHooks(t *testing.T) {
+	tests := []struct {
+		name     string
+		commands []string
+		add      []string
+		remove   []string
+		want     []string
+	}{
+		{"add", nil, []string{"tmux source-file ~/.tmux.conf"}, nil, []string{"tmux source-file ~/.tmux.conf"}},
+		{"in order and unique", []string{"b"}, []string{"a", "b", " a "}, nil, []string{"b", "a"}},
+		{"remove", []string{"a", "b"}, nil, []string{"a"}, []string{"b"}},
+		{"remove all", []string{"a"}, nil, []string{"a"}, nil},
+		{"blank", nil, []string{" "}, nil, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cf := &ConfigFile{}
+			if tt.commands != nil {
+				cf.Hooks = map[HookEvent][]string{HookPostRestore: tt.commands}
+			}
+			cf.UpdateHooks(HookPostRestore, tt.add, tt.remove)
+			if !slices.Equal(cf.Hooks[HookPostRestore], tt.want) {
+				t.Errorf("expected %v, got %v", tt.want, cf.Hooks[HookPostRestore])
+			}
+			if tt.want == nil && cf.Hooks != nil {
+				t.Errorf("expected no hooks, got %v", cf.Hooks)
+			}
+		})
+	}
+
+	if _, err := ParseHookEvent("post-restore"); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if _, err := ParseHookEvent("after-restore"); err == nil {
+		t.Errorf("expected an unknown event to fail")
+	}
+}
@@ -0,0 +1,49 @@
+package configfile
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"hash"
+	"strings"
+
+	"github.com/osamaadam/cfgrr/helpers"
+	"github.com/pkg/errors"
+)
+
+// The algorithms the keys of the map file could be hashed with.
+var keyAlgorithms = map[string]func() hash.Hash{
+	"sha1":   sha1.New,
+	"sha256": sha256.New,
+}
+
+// The shortest key allowed, shorter keys collide too often.
+const minKeyLength = 6
+
+// Checks whether the map file keys could be hashed with the algorithm and truncated to the length.
+func ValidateKeyFormat(algorithm string, length int) error {
+	newHash, ok := keyAlgorithms[algorithm]
+	if !ok {
+		names := helpers.GetMapKeys(keyAlgorithms)
+		return errors.Errorf("unknown key algorithm %q, expected one of: %s", algorithm, strings.Join(names, ", "))
+	}
+
+	maxLength := newHash().Size() * 2
+	if length < minKeyLength || length > maxLength {
+		return errors.Errorf("the key length of %s must be between %d and %d, got %d", algorithm, minKeyLength, maxLength, length)
+	}
+
+	return nil
+}
+
+// Returns a new hasher of the algorithm, falling back to sha1 for unknown ones.
+func newKeyHash(algorithm string) hash.Hash {
+	if newHash, ok := keyAlgorithms[algorithm]; ok {
+		return newHash()
+	}
+	return sha1.New()
+}
+
+// Checks whether both entries track the same file.
+func (cf *ConfigFile) SamePath(other *ConfigFile) bool {
+	return cf.Path == other.Path && cf.IsRoot() == other.IsRoot() && cf.IsCommand() == other.IsCommand()
+}
@@ -0,0 +1,274 @@
+package configfile
+
+import (
+	"bytes"
+	"os"
+	"strings"
+
+	"github.com/osamaadam/cfgrr/fileops"
+	"github.com/pkg/errors"
+)
+
+// How the live file is connected to its backup.
+type LinkMode string
+
+const (
+	// The live file is a symlink to the backup, this is the default.
+	LinkSymlink LinkMode = "symlink"
+	// The live file is a hard link to the backup, for apps that refuse symlinks.
+	// Both must be on the same filesystem.
+	LinkHardlink LinkMode = "hardlink"
+	// The live file is a copy of the backup, for apps that replace the file when saving.
+	// Changes to the copy are pulled into the backup on `push`.
+	LinkCopy LinkMode = "copy"
+)
+
+var linkModes = []LinkMode{LinkSymlink, LinkHardlink, LinkCopy}
+
+// Parses a link mode, an empty string is the default mode.
+func ParseLinkMode(mode string) (LinkMode, error) {
+	if mode == "" {
+		return LinkSymlink, nil
+	}
+	for _, m := range linkModes {
+		if string(m) == mode {
+			return m, nil
+		}
+	}
+
+	names := make([]string, len(linkModes))
+	for i, m := range linkModes {
+		names[i] = string(m)
+	}
+
+	return "", errors.Errorf("unknown link mode %q, expected one of: %s", mode, strings.Join(names, ", "))
+}
+
+// Returns the link mode of the entry, entries without one are symlinked.
+func (cf *ConfigFile) LinkMode() LinkMode {
+	if cf.Template || cf.Encrypted {
+		return LinkCopy
+	}
+	if cf.Link == "" {
+		return LinkSymlink
+	}
+	return cf.Link
+}
+
+// Sets the link mode of the entry.
+// It doesn't touch the live file, see `Relink` for that.
+func (cf *ConfigFile) SetLinkMode(mode LinkMode) error {
+	if cf.IsDir() && mode != LinkSymlink {
+		return errors.Errorf("%s is a directory, directories can only be symlinked", cf.Path)
+	}
+	if cf.IsCommand() && mode != LinkSymlink {
+		return errors.Errorf("%s is backed by a command, it has no file to link", cf.PathAbs())
+	}
+	if cf.Template && mode != LinkCopy {
+		return errors.Errorf("%s is a template, templates can only be copied", cf.Path)
+	}
+	if cf.Encrypted && mode != LinkCopy {
+		return errors.Errorf("%s is encrypted, encrypted files can only be copied", cf.Path)
+	}
+
+	if mode == LinkSymlink {
+		// Keep the map file tidy, symlink is the default.
+		cf.Link = ""
+	} else {
+		cf.Link = mode
+	}
+
+	return nil
+}
+
+// Checks whether the live file is the one cfgrr manages for the entry,
+// i.e. a symlink to the backup, a hard link of it, or an identical copy depending on the link mode.
+func (cf *ConfigFile) IsLinked() bool {
+	switch cf.LinkMode() {
+	case LinkHardlink:
+		liveInfo, err := fileops.Lstat(cf.PathAbs())
+		if err != nil {
+			return false
+		}
+		backupInfo, err := fileops.Stat(cf.BackupPath())
+		if err != nil {
+			return false
+		}
+		return os.SameFile(liveInfo, backupInfo)
+	case LinkCopy:
+		if ok, _ := fileops.IsSymlink(cf.PathAbs()); ok {
+			return false
+		}
+		live, err := fileops.ReadFile(cf.PathAbs())
+		if err != nil {
+			return false
+		}
+		content, err := cf.Content()
+		return err == nil && bytes.Equal(live, content)
+	default:
+		target, err := fileops.Readlink(cf.PathAbs())
+		return err == nil && target == cf.BackupPath()
+	}
+}
+
+// Creates the live file according to the link mode.
+func (cf *ConfigFile) link() error {
+	switch cf.LinkMode() {
+	case LinkHardlink:
+		if err := fileops.Link(cf.PathAbs(), cf.BackupPath()); err != nil {
+			return errors.WithMessagef(err, "couldn't hard link %s, the backup dir must be on the same filesystem", cf.PathAbs())
+		}
+	case LinkCopy:
+		if err := cf.writeCopy(); err != nil {
+			return errors.WithMessage(err, "couldn't copy the backup file")
+		}
+	default:
+		if err := fileops.Symlink(cf.PathAbs(), cf.BackupPath()); err != nil {
+			return errors.WithMessage(err, "couldn't create a symlink to the backup file")
+		}
+	}
+
+	return nil
+}
+
+// Deletes the live file if it's the one cfgrr manages.
+// Symlinks are deleted wherever they point in the backup dir, stale ones included.
+func (cf *ConfigFile) deleteLink() error {
+	if cf.LinkMode() == LinkSymlink {
+		return cf.deleteSymlink()
+	}
+
+	if !cf.IsLinked() {
+		return nil
+	}
+
+	if err := fileops.Remove(cf.PathAbs()); err != nil {
+		return errors.WithStack(err)
+	}
+
+	return nil
+}
+
+// Switches the live file to the given link mode.
+func (cf *ConfigFile) Relink(mode LinkMode) error {
+	return cf.Reconfigure(func() error {
+		return cf.SetLinkMode(mode)
+	})
+}
+
+// Applies a change to the entry that affects how its live file is created, and recreates the live file.
+// Changes made to a hard link or a copy are pulled into the backup first.
+// Command entries have no live file, only the change is applied.
+func (cf *ConfigFile) Reconfigure(change func() error) error {
+	if cf.IsCommand() {
+		return errors.WithStack(change())
+	}
+
+	if _, err := cf.Sync(); err != nil {
+		return errors.WithStack(err)
+	}
+
+	exists := fileops.Exists(cf.PathAbs())
+	if exists && !cf.IsLinked() {
+		return errors.Errorf("%s isn't managed by cfgrr anymore (it was probably replaced), move it away first", cf.PathAbs())
+	}
+
+	if err := change(); err != nil {
+		return errors.WithStack(err)
+	}
+
+	// Switching to a link mode writing through to the blob needs a blob of its own.
+	if err := cf.placeBlob(); err != nil {
+		return errors.WithStack(err)
+	}
+
+	if !exists {
+		// Nothing is restored yet, the new mode applies on the next restore.
+		return nil
+	}
+
+	if err := fileops.Remove(cf.PathAbs()); err != nil {
+		return errors.WithStack(err)
+	}
+
+	if err := cf.Restore(); err != nil {
+		return errors.WithStack(err)
+	}
+
+	return nil
+}
+
+// Pulls the changes made to a hard linked or copied live file into the blob store.
+// Hard links are broken by apps saving through a rename, in which case the live file is linked again.
+// The content is stored as a new blob, as the old one could be shared with other files.
+// The output of the dump command of command entries is stored the same way.
+// Returns true if the entry's blob changed.
+func (cf *ConfigFile) Sync() (changed bool, err error) {
+	if cf.IsCommand() {
+		return cf.syncCommand()
+	}
+
+	mode := cf.LinkMode()
+	if mode == LinkSymlink || cf.IsDir() || cf.Blob == "" || cf.Template {
+		// Rendered templates can't be turned back into templates.
+		return false, nil
+	}
+
+	info, err := fileops.Lstat(cf.PathAbs())
+	if err != nil || !info.Mode().IsRegular() {
+		// Nothing to pull from.
+		return false, nil
+	}
+
+	if cf.IsLinked() {
+		return false, nil
+	}
+
+	if cf.Encrypted {
+		// The live file differs from the decrypted backup, otherwise it'd be linked.
+		content, err := fileops.ReadFile(cf.PathAbs())
+		if err != nil {
+			return false, errors.WithStack(err)
+		}
+		if err := cf.storeEncrypted(content, info.Mode().Perm()); err != nil {
+			return false, errors.WithMessagef(err, "couldn't store the changes to %s", cf.Path)
+		}
+		changed = true
+	} else {
+		digest, err := fileops.FileDigest(cf.PathAbs())
+		if err != nil {
+			return false, errors.WithStack(err)
+		}
+
+		if digest != BlobDigest(cf.Blob) {
+			if err := fileops.MkdirAll(cf.BlobsDir()); err != nil {
+				return false, errors.WithStack(err)
+			}
+			blob := cf.BlobName(digest)
+			blobPath := BlobPath(blob)
+			if !fileops.Exists(blobPath) {
+				if err := fileops.CopyFile(blobPath, cf.PathAbs()); err != nil {
+					return false, errors.WithMessagef(err, "couldn't store the changes to %s", cf.Path)
+				}
+				if err := fileops.Chmod(blobPath, info.Mode().Perm()); err != nil {
+					return false, errors.WithStack(err)
+				}
+			}
+			cf.Blob = blob
+			changed = true
+		}
+	}
+
+	cf.Perm = info.Mode()
+
+	if mode == LinkHardlink {
+		if err := fileops.Remove(cf.PathAbs()); err != nil {
+			return changed, errors.WithStack(err)
+		}
+		if err := cf.link(); err != nil {
+			return changed, errors.WithStack(err)
+		}
+	}
+
+	return changed, nil
+}
@@ -0,0 +1,202 @@
+package configfile
+
+import (
+	"os"
+	"testing"
+
+	"github.com/osamaadam/cfgrr/helpers"
+)
+
+func TestParseLinkMode(t *testing.T) {
+	tests := []struct {
+		in      string
+		out     LinkMode
+		wantErr bool
+	}{
+		{"", LinkSymlink, false},
+		{"symlink", LinkSymlink, false},
+		{"hardlink", LinkHardlink, false},
+		{"copy", LinkCopy, false},
+		{"junction", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			mode, err := ParseLinkMode(tt.in)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseLinkMode() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if mode != tt.out {
+				t.Errorf("expected %s, got %s", tt.out, mode)
+			}
+		})
+	}
+}
+
+func TestConfigFile_LinkModes(t *testing.T) {
+	tests := []struct {
+		name        string
+		mode        LinkMode
+		wantSymlink bool
+	}{
+		{"symlink", LinkSymlink, true},
+		{"hardlink", LinkHardlink, false},
+		{"copy", LinkCopy, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			files := _setupBackupEnv(t.TempDir(), t.TempDir(), 1)
+			file := files[0]
+			os.WriteFile(file.PathAbs(), []byte("original"), 0600)
+			file.SetLinkMode(tt.mode)
+
+			if err := file.Backup(); err != nil {
+				t.Fatalf("expected no error, got %s", err)
+			}
+			if !file.IsLinked() {
+				t.Errorf("expected %s to be linked after backup", file.PathAbs())
+			}
+			if ok, _ := helpers.CheckIfSymlink(file.PathAbs()); ok != tt.wantSymlink {
+				t.Errorf("expected symlink to be %v, got %v", tt.wantSymlink, ok)
+			}
+
+			os.Remove(file.PathAbs())
+			if err := file.Restore(); err != nil {
+				t.Fatalf("expected no error, got %s", err)
+			}
+			if !file.IsLinked() {
+				t.Errorf("expected %s to be linked after restore", file.PathAbs())
+			}
+			if content, _ := os.ReadFile(file.PathAbs()); string(content) != "original" {
+				t.Errorf("expected %q, got %q", "original", content)
+			}
+		})
+	}
+}
+
+func TestConfigFile_Sync(t *testing.T) {
+	tests := []struct {
+		name        string
+		mode        LinkMode
+		atomicSave  bool
+		wantChanged bool
+	}{
+		{"symlink is never synced", LinkSymlink, false, false},
+		{"edited copy", LinkCopy, false, true},
+		{"copy replaced by a rename", LinkCopy, true, true},
+		{"hard link replaced by a rename", LinkHardlink, true, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			files := _setupBackupEnv(t.TempDir(), t.TempDir(), 1)
+			file := files[0]
+			os.WriteFile(file.PathAbs(), []byte("original"), 0644)
+			file.SetLinkMode(tt.mode)
+			if err := file.Backup(); err != nil {
+				t.Fatalf("expected no error, got %s", err)
+			}
+			oldBlob := file.Blob
+
+			if tt.atomicSave {
+				tmp := file.PathAbs() + ".tmp"
+				os.WriteFile(tmp, []byte("edited"), 0644)
+				os.Rename(tmp, file.PathAbs())
+			} else {
+				os.WriteFile(file.PathAbs(), []byte("edited"), 0644)
+			}
+
+			changed, err := file.Sync()
+			if err != nil {
+				t.Fatalf("expected no error, got %s", err)
+			}
+			if changed != tt.wantChanged {
+				t.Fatalf("expected changed to be %v, got %v", tt.wantChanged, changed)
+			}
+			if !changed {
+				return
+			}
+
+			if file.Blob == oldBlob {
+				t.Errorf("expected a new blob")
+			}
+			if content, _ := os.ReadFile(file.BackupPath()); string(content) != "edited" {
+				t.Errorf("expected the backup to hold %q, got %q", "edited", content)
+			}
+			if content, _ := os.ReadFile(BlobPath(oldBlob)); string(content) != "original" {
+				t.Errorf("expected the old blob to be untouched, got %q", content)
+			}
+			if !file.IsLinked() {
+				t.Errorf("expected %s to be linked after syncing", file.PathAbs())
+			}
+		})
+	}
+}
+
+func TestConfigFile_Relink(t *testing.T) {
+	tests := []struct {
+		name    string
+		from    LinkMode
+		to      LinkMode
+		restore bool
+	}{
+		{"symlink to copy", LinkSymlink, LinkCopy, true},
+		{"copy to hardlink", LinkCopy, LinkHardlink, true},
+		{"hardlink to symlink", LinkHardlink, LinkSymlink, true},
+		{"not restored", LinkSymlink, LinkCopy, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			files := _setupBackupEnv(t.TempDir(), t.TempDir(), 1)
+			file := files[0]
+			file.SetLinkMode(tt.from)
+			if err := file.Backup(); err != nil {
+				t.Fatalf("expected no error, got %s", err)
+			}
+			if !tt.restore {
+				os.Remove(file.PathAbs())
+			}
+
+			if err := file.Relink(tt.to); err != nil {
+				t.Fatalf("expected no error, got %s", err)
+			}
+			if file.LinkMode() != tt.to {
+				t.Errorf("expected the mode to be %s, got %s", tt.to, file.LinkMode())
+			}
+			if helpers.CheckFileExists(file.PathAbs()) != tt.restore {
+				t.Errorf("expected the live file to exist: %v", tt.restore)
+			}
+			if tt.restore && !file.IsLinked() {
+				t.Errorf("expected %s to be linked", file.PathAbs())
+			}
+		})
+	}
+
+	t.Run("directories are only symlinked", func(t *testing.T) {
+		file := _setupDirEnv(t, []string{"init.vim"}, nil)
+		if err := file.SetLinkMode(LinkCopy); err == nil {
+			t.Errorf("expected an error, got nil")
+		}
+	})
+}
+
+func TestConfigFile_DeleteBackup_EditedCopy(t *testing.T) {
+	t.Run("keeps the edits", func(t *testing.T) {
+		files := _setupBackupEnv(t.TempDir(), t.TempDir(), 1)
+		file := files[0]
+		file.SetLinkMode(LinkCopy)
+		if err := file.Backup(); err != nil {
+			t.Fatalf("expected no error, got %s", err)
+		}
+		os.WriteFile(file.PathAbs(), []byte("edited"), 0644)
+
+		if err := file.DeleteBackup(false); err != nil {
+			t.Fatalf("expected no error, got %s", err)
+		}
+		if content, _ := os.ReadFile(file.PathAbs()); string(content) != "edited" {
+			t.Errorf("expected the edited copy to be kept, got %q", content)
+		}
+	})
+}
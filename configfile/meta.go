@@ -0,0 +1,161 @@
+package configfile
+
+import (
+	"encoding/base64"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"time"
+
+	"github.com/osamaadam/cfgrr/fileops"
+	"github.com/osamaadam/cfgrr/vconfig"
+	"github.com/pkg/errors"
+)
+
+// The metadata of a file besides its mode.
+type Metadata struct {
+	// The names of the owner and group, or their ids if they don't have names.
+	Owner string `yaml:"owner,omitempty" json:"Owner,omitempty"`
+	Group string `yaml:"group,omitempty" json:"Group,omitempty"`
+	// The modification time, in UTC.
+	ModTime time.Time `yaml:"mtime,omitempty" json:"ModTime,omitempty"`
+	// The extended attributes matching the `xattrs` patterns of the config, the values are base64 encoded.
+	Xattrs map[string]string `yaml:"xattrs,omitempty" json:"Xattrs,omitempty"`
+}
+
+// Where the metadata that couldn't be reapplied is reported.
+// Failing to reapply metadata (e.g. changing the owner without root) doesn't fail the restore.
+var WarningsOutput io.Writer = os.Stderr
+
+func warnf(format string, args ...any) {
+	fmt.Fprintf(WarningsOutput, "WARNING: "+format+"\n", args...)
+}
+
+// Reads the metadata of the file at `path`.
+func readMeta(path string, info os.FileInfo) (*Metadata, error) {
+	meta := &Metadata{
+		ModTime: info.ModTime().UTC(),
+	}
+	meta.Owner, meta.Group = fileOwner(info)
+
+	attrs, err := listXattrs(fileops.Locate(path))
+	if err != nil {
+		return nil, errors.WithMessagef(err, "couldn't read the extended attributes of %s", path)
+	}
+	for name, value := range attrs {
+		if !matchXattr(name) {
+			continue
+		}
+		if meta.Xattrs == nil {
+			meta.Xattrs = make(map[string]string)
+		}
+		meta.Xattrs[name] = base64.StdEncoding.EncodeToString(value)
+	}
+
+	return meta, nil
+}
+
+// Checks whether the extended attribute should be kept.
+func matchXattr(name string) bool {
+	for _, pattern := range vconfig.GetConfig().Xattrs {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Records the current metadata of the live file (or its backup, if it's symlinked).
+// Command entries have no file, so no metadata.
+// Returns true if it changed.
+func (cf *ConfigFile) SaveMeta() (changed bool, err error) {
+	if cf.IsCommand() {
+		return false, nil
+	}
+
+	info, err := fileops.Stat(cf.PathAbs())
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return false, nil
+		}
+		return false, errors.WithStack(err)
+	}
+
+	meta, err := readMeta(cf.PathAbs(), info)
+	if err != nil {
+		return false, errors.WithStack(err)
+	}
+
+	changed = info.Mode() != cf.Perm || !meta.Equal(cf.Meta)
+	cf.Perm = info.Mode()
+	cf.Meta = meta
+
+	return changed, nil
+}
+
+// Checks whether both hold the same metadata.
+func (m *Metadata) Equal(other *Metadata) bool {
+	if m == nil || other == nil {
+		return m == other
+	}
+	if m.Owner != other.Owner || m.Group != other.Group || !m.ModTime.Equal(other.ModTime) || len(m.Xattrs) != len(other.Xattrs) {
+		return false
+	}
+	for name, value := range m.Xattrs {
+		if otherValue, ok := other.Xattrs[name]; !ok || otherValue != value {
+			return false
+		}
+	}
+	return true
+}
+
+// Returns the file the metadata applies to once restored, the live file unless it's a link to the backup.
+func (cf *ConfigFile) metaTarget() string {
+	if cf.LinkMode() == LinkCopy {
+		return cf.PathAbs()
+	}
+	return cf.BackupPath()
+}
+
+// Reapplies the mode and the recorded metadata to the target, either the live file or its backup (see `metaTarget`).
+// What can't be reapplied is reported to `WarningsOutput`.
+func (cf *ConfigFile) applyMeta(target string) {
+	if !fileops.Exists(target) {
+		return
+	}
+
+	if err := fileops.Chmod(target, cf.Perm&(os.ModePerm|os.ModeSetuid|os.ModeSetgid|os.ModeSticky)); err != nil {
+		warnf("couldn't restore the mode of %s: %s", cf.PathAbs(), err)
+	}
+
+	if cf.Meta == nil {
+		return
+	}
+
+	for name, encoded := range cf.Meta.Xattrs {
+		value, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			warnf("the extended attribute %s of %s is corrupted in the map file", name, cf.PathAbs())
+			continue
+		}
+		if err := fileops.Setxattr(target, name, value); err != nil {
+			warnf("couldn't restore the extended attribute %s of %s: %s", name, cf.PathAbs(), err)
+		}
+	}
+
+	if err := chown(target, cf.Meta.Owner, cf.Meta.Group); err != nil {
+		hint := ""
+		if errors.Is(err, os.ErrPermission) {
+			hint = " (run as root to restore the ownership)"
+		}
+		warnf("couldn't restore the owner of %s to %s:%s: %s%s", cf.PathAbs(), cf.Meta.Owner, cf.Meta.Group, err, hint)
+	}
+
+	// The modification time goes last, as the other changes could touch it.
+	if !cf.Meta.ModTime.IsZero() && !cf.IsDir() {
+		if err := fileops.Chtimes(target, cf.Meta.ModTime); err != nil {
+			warnf("couldn't restore the modification time of %s: %s", cf.PathAbs(), err)
+		}
+	}
+}
@@ -0,0 +1,14 @@
+//go:build !unix
+
+package configfile
+
+import "os"
+
+// Ownership isn't recorded on this platform.
+func fileOwner(info os.FileInfo) (owner, group string) {
+	return "", ""
+}
+
+func chown(path, owner, group string) error {
+	return nil
+}
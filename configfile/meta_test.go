@@ -0,0 +1,129 @@
+//go:build linux || darwin
+
+package configfile
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+func TestConfigFile_Metadata(t *testing.T) {
+	tests := []struct {
+		name string
+		mode LinkMode
+		// Whether a copy is restored whatever the link mode, as `delete -r` does.
+		hard bool
+	}{
+		{"symlink", LinkSymlink, false},
+		{"copy", LinkCopy, false},
+		{"hard restore of a symlink", LinkSymlink, true},
+		{"hard restore of a hard link", LinkHardlink, true},
+	}
+
+	mtime := time.Date(2020, 2, 20, 20, 20, 20, 0, time.UTC)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var warnings bytes.Buffer
+			WarningsOutput = &warnings
+			t.Cleanup(func() { WarningsOutput = os.Stderr })
+
+			files := _setupBackupEnv(t.TempDir(), t.TempDir(), 1)
+			file := files[0]
+			os.Chmod(file.PathAbs(), 0750)
+			os.Chtimes(file.PathAbs(), time.Time{}, mtime)
+			xattrs := unix.Setxattr(file.PathAbs(), "user.cfgrr", []byte("value"), 0) == nil
+			file.SetLinkMode(tt.mode)
+
+			if err := file.Backup(); err != nil {
+				t.Fatalf("expected no error, got %s", err)
+			}
+			if file.Meta == nil || !file.Meta.ModTime.Equal(mtime) {
+				t.Fatalf("expected the modification time to be recorded, got %+v", file.Meta)
+			}
+			if xattrs && file.Meta.Xattrs["user.cfgrr"] == "" {
+				t.Errorf("expected the extended attribute to be recorded")
+			}
+
+			// Restoring over a file with different metadata reapplies it.
+			os.Chmod(file.metaTarget(), 0600)
+			os.Chtimes(file.metaTarget(), time.Time{}, time.Now())
+			if xattrs {
+				unix.Removexattr(file.metaTarget(), "user.cfgrr")
+			}
+			restore := file.Restore
+			if tt.hard {
+				restore = file.HardRestore
+			}
+			if err := restore(); err != nil {
+				t.Fatalf("expected no error, got %s", err)
+			}
+			if tt.hard {
+				if err := os.Remove(file.BackupPath()); err != nil {
+					t.Fatalf("expected no error, got %s", err)
+				}
+			}
+
+			info, err := os.Stat(file.PathAbs())
+			if err != nil {
+				t.Fatalf("expected no error, got %s", err)
+			}
+			if info.Mode().Perm() != 0750 {
+				t.Errorf("expected mode %o, got %o", 0750, info.Mode().Perm())
+			}
+			if !info.ModTime().Equal(mtime) {
+				t.Errorf("expected modification time %s, got %s", mtime, info.ModTime())
+			}
+			if xattrs {
+				if value, err := getXattr(file.PathAbs(), "user.cfgrr"); err != nil || string(value) != "value" {
+					t.Errorf("expected the extended attribute to be restored, got %q (%v)", value, err)
+				}
+			}
+			if warnings.Len() != 0 {
+				t.Errorf("expected no warnings, got %q", warnings.String())
+			}
+		})
+	}
+}
+
+func TestConfigFile_MetadataWarnings(t *testing.T) {
+	var warnings bytes.Buffer
+	WarningsOutput = &warnings
+	t.Cleanup(func() { WarningsOutput = os.Stderr })
+
+	files := _setupBackupEnv(t.TempDir(), t.TempDir(), 1)
+	file := files[0]
+	if err := file.Backup(); err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+
+	file.Meta.Owner = "cfgrr-no-such-user"
+	if err := file.Restore(); err != nil {
+		t.Fatalf("expected metadata failures not to fail the restore, got %s", err)
+	}
+	if !strings.Contains(warnings.String(), "cfgrr-no-such-user") {
+		t.Errorf("expected a warning about the owner, got %q", warnings.String())
+	}
+}
+
+func TestConfigFile_SaveMeta(t *testing.T) {
+	files := _setupBackupEnv(t.TempDir(), t.TempDir(), 1)
+	file := files[0]
+	if err := file.Backup(); err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+
+	if changed, _ := file.SaveMeta(); changed {
+		t.Errorf("expected the metadata not to change")
+	}
+
+	os.Chtimes(file.PathAbs(), time.Time{}, time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+	if changed, _ := file.SaveMeta(); !changed {
+		t.Errorf("expected the modification time change to be detected")
+	}
+}
@@ -0,0 +1,92 @@
+//go:build unix
+
+package configfile
+
+import (
+	"os"
+	"os/user"
+	"strconv"
+	"syscall"
+
+	"github.com/osamaadam/cfgrr/fileops"
+	"github.com/pkg/errors"
+)
+
+// Returns the names of the file's owner and group, or their ids if they don't have names.
+func fileOwner(info os.FileInfo) (owner, group string) {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return "", ""
+	}
+
+	owner = strconv.FormatUint(uint64(stat.Uid), 10)
+	if u, err := user.LookupId(owner); err == nil {
+		owner = u.Username
+	}
+	group = strconv.FormatUint(uint64(stat.Gid), 10)
+	if g, err := user.LookupGroupId(group); err == nil {
+		group = g.Name
+	}
+
+	return owner, group
+}
+
+// Changes the owner and group of the file, unless they're already set.
+// They're looked up by name, falling back to treating them as ids.
+func chown(path, owner, group string) error {
+	if owner == "" && group == "" {
+		return nil
+	}
+
+	info, err := fileops.Stat(path)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return nil
+	}
+
+	uid, gid := int(stat.Uid), int(stat.Gid)
+	if owner != "" {
+		if uid, err = lookupId(owner, func(name string) (string, error) {
+			u, err := user.Lookup(name)
+			if err != nil {
+				return "", err
+			}
+			return u.Uid, nil
+		}); err != nil {
+			return errors.WithMessagef(err, "unknown user %s", owner)
+		}
+	}
+	if group != "" {
+		if gid, err = lookupId(group, func(name string) (string, error) {
+			g, err := user.LookupGroup(name)
+			if err != nil {
+				return "", err
+			}
+			return g.Gid, nil
+		}); err != nil {
+			return errors.WithMessagef(err, "unknown group %s", group)
+		}
+	}
+
+	if uid == int(stat.Uid) && gid == int(stat.Gid) {
+		return nil
+	}
+
+	return errors.WithStack(fileops.Chown(path, uid, gid))
+}
+
+func lookupId(name string, lookup func(name string) (string, error)) (int, error) {
+	id, err := lookup(name)
+	if err != nil {
+		// Owners without names are recorded by id.
+		if id, convErr := strconv.Atoi(name); convErr == nil {
+			return id, nil
+		}
+		return 0, errors.WithStack(err)
+	}
+
+	return strconv.Atoi(id)
+}
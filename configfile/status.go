@@ -0,0 +1,83 @@
+package configfile
+
+import (
+	"os"
+
+	"github.com/osamaadam/cfgrr/fileops"
+	"github.com/pkg/errors"
+)
+
+// How the machine drifted from the entry of the map file.
+type Drift string
+
+const (
+	// Nothing is at the live file's location.
+	DriftMissing Drift = "missing"
+	// The live file is a symlink pointing somewhere other than the backup.
+	DriftElsewhere Drift = "elsewhere"
+	// A regular file took the place of the link, e.g. an editor saved the file atomically.
+	DriftReplaced Drift = "replaced"
+	// The backup file is missing from the backup dir.
+	DriftNoBackup Drift = "no-backup"
+	// The file changed since it was last pushed.
+	DriftModified Drift = "modified"
+	// The mode of the file isn't the recorded one.
+	DriftMode Drift = "mode"
+)
+
+// Returns how the live file drifted from the entry, nil if it's in sync.
+// Changes since the last push are only detected for copies, whose edits aren't pulled into the backup yet,
+// the backup files are compared with the git repository by `core.Status`.
+// The backups of command entries are compared with the output of their dump command.
+func (cf *ConfigFile) Drift() ([]Drift, error) {
+	if cf.IsCommand() {
+		return cf.commandDrift()
+	}
+
+	var drifts []Drift
+	if _, err := fileops.Lstat(cf.BackupPath()); errors.Is(err, os.ErrNotExist) {
+		drifts = append(drifts, DriftNoBackup)
+	} else if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	info, err := fileops.Lstat(cf.PathAbs())
+	if errors.Is(err, os.ErrNotExist) {
+		return append(drifts, DriftMissing), nil
+	} else if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	switch {
+	case info.Mode()&os.ModeSymlink != 0:
+		if cf.LinkMode() != LinkSymlink || !cf.IsLinked() {
+			return append(drifts, DriftElsewhere), nil
+		}
+	case cf.LinkMode() == LinkSymlink:
+		return append(drifts, DriftReplaced), nil
+	case len(drifts) > 0:
+		// Without a backup, hard links and copies can't be compared.
+		return drifts, nil
+	case cf.LinkMode() == LinkHardlink && !cf.IsLinked():
+		return append(drifts, DriftReplaced), nil
+	case cf.LinkMode() == LinkCopy && !cf.IsLinked():
+		drifts = append(drifts, DriftModified)
+	}
+
+	if cf.Perm != 0 {
+		info, err := fileops.Stat(cf.PathAbs())
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				// A dangling symlink, its backup is missing.
+				return drifts, nil
+			}
+			return nil, errors.WithStack(err)
+		}
+		modeBits := os.ModePerm | os.ModeSetuid | os.ModeSetgid | os.ModeSticky
+		if info.Mode()&modeBits != cf.Perm&modeBits {
+			drifts = append(drifts, DriftMode)
+		}
+	}
+
+	return drifts, nil
+}
@@ -0,0 +1,60 @@
+package configfile
+
+import (
+	"os"
+	"slices"
+	"testing"
+)
+
+func TestConfigFile_Drift(t *testing.T) {
+	tests := []struct {
+		name  string
+		mode  LinkMode
+		setup func(file *ConfigFile)
+		out   []Drift
+	}{
+		{"in sync", LinkSymlink, func(file *ConfigFile) {}, nil},
+		{"missing", LinkSymlink, func(file *ConfigFile) { os.Remove(file.PathAbs()) }, []Drift{DriftMissing}},
+		{"elsewhere", LinkSymlink, func(file *ConfigFile) {
+			os.Remove(file.PathAbs())
+			os.Symlink(os.TempDir(), file.PathAbs())
+		}, []Drift{DriftElsewhere}},
+		{"replaced", LinkSymlink, func(file *ConfigFile) {
+			os.Remove(file.PathAbs())
+			os.WriteFile(file.PathAbs(), []byte("saved"), 0644)
+		}, []Drift{DriftReplaced}},
+		{"no backup", LinkSymlink, func(file *ConfigFile) { os.Remove(file.BackupPath()) }, []Drift{DriftNoBackup}},
+		{"mode", LinkSymlink, func(file *ConfigFile) { os.Chmod(file.BackupPath(), 0640) }, []Drift{DriftMode}},
+		{"replaced hard link", LinkHardlink, func(file *ConfigFile) {
+			os.Remove(file.PathAbs())
+			os.WriteFile(file.PathAbs(), []byte("saved"), file.Perm)
+		}, []Drift{DriftReplaced}},
+		{"edited copy", LinkCopy, func(file *ConfigFile) {
+			os.WriteFile(file.PathAbs(), []byte("edited"), file.Perm)
+		}, []Drift{DriftModified}},
+		{"symlinked copy", LinkCopy, func(file *ConfigFile) {
+			os.Remove(file.PathAbs())
+			os.Symlink(file.BackupPath(), file.PathAbs())
+		}, []Drift{DriftElsewhere}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			files := _setupBackupEnv(t.TempDir(), t.TempDir(), 1)
+			file := files[0]
+			file.SetLinkMode(tt.mode)
+			if err := file.Backup(); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			tt.setup(file)
+
+			drifts, err := file.Drift()
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !slices.Equal(drifts, tt.out) {
+				t.Errorf("expected %v, got %v", tt.out, drifts)
+			}
+		})
+	}
+}
@@ -0,0 +1,47 @@
+package configfile
+
+import (
+	"regexp"
+	"slices"
+
+	"github.com/pkg/errors"
+)
+
+var tagRegexp = regexp.MustCompile(`^[\w.-]+$`)
+
+// Checks whether the tag could be used, tags are made of letters, digits, dots, dashes and underscores.
+func ValidateTag(tag string) error {
+	if !tagRegexp.MatchString(tag) {
+		return errors.Errorf("invalid tag %q, tags are made of letters, digits, dots, dashes and underscores", tag)
+	}
+	return nil
+}
+
+// Checks whether the entry is tagged with any of the tags.
+func (cf *ConfigFile) HasTag(tags ...string) bool {
+	for _, tag := range tags {
+		if slices.Contains(cf.Tags, tag) {
+			return true
+		}
+	}
+	return false
+}
+
+// Adds the tags to the entry, and removes the others, keeping the tags sorted.
+func (cf *ConfigFile) UpdateTags(add, remove []string) error {
+	for _, tag := range add {
+		if err := ValidateTag(tag); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+
+	tags := append(slices.Clone(cf.Tags), add...)
+	tags = slices.DeleteFunc(tags, func(tag string) bool { return slices.Contains(remove, tag) })
+	slices.Sort(tags)
+	cf.Tags = slices.Compact(tags)
+	if len(cf.Tags) == 0 {
+		cf.Tags = nil
+	}
+
+	return nil
+}
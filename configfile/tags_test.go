@@ -0,0 +1,37 @@
+package configfile
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestConfigFile_UpdateTags(t *testing.T) {
+	tests := []struct {
+		name    string
+		tags    []string
+		add     []string
+		remove  []string
+		want    []string
+		wantErr bool
+	}{
+		{"add", nil, []string{"shell", "work"}, nil, []string{"shell", "work"}, false},
+		{"sorted and unique", []string{"work"}, []string{"shell", "work"}, nil, []string{"shell", "work"}, false},
+		{"remove", []string{"shell", "work"}, nil, []string{"work"}, []string{"shell"}, false},
+		{"remove all", []string{"shell"}, nil, []string{"shell"}, nil, false},
+		{"add and remove", []string{"personal"}, []string{"work"}, []string{"personal"}, []string{"work"}, false},
+		{"invalid", nil, []string{"bad tag"}, nil, nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cf := &ConfigFile{Tags: tt.tags}
+			err := cf.UpdateTags(tt.add, tt.remove)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("expected an error: %v, got %v", tt.wantErr, err)
+			}
+			if !tt.wantErr && !slices.Equal(cf.Tags, tt.want) {
+				t.Errorf("expected %v, got %v", tt.want, cf.Tags)
+			}
+		})
+	}
+}
@@ -0,0 +1,106 @@
+package configfile
+
+import (
+	"bytes"
+	"os"
+	"os/user"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"text/template"
+
+	"github.com/osamaadam/cfgrr/vconfig"
+	"github.com/pkg/errors"
+)
+
+// The data templates are rendered with.
+type TemplateData struct {
+	Hostname string
+	// The operating system, as in `runtime.GOOS` (e.g. linux, darwin).
+	OS string
+	// The architecture, as in `runtime.GOARCH` (e.g. amd64, arm64).
+	Arch string
+	User string
+	Home string
+	// The environment variables.
+	Env map[string]string
+	// The `vars` defined in the config file.
+	Vars map[string]string
+}
+
+// Collects the template data of the current machine.
+func NewTemplateData() *TemplateData {
+	data := &TemplateData{
+		OS:   runtime.GOOS,
+		Arch: runtime.GOARCH,
+		Env:  make(map[string]string),
+		Vars: make(map[string]string),
+	}
+
+	data.Hostname, _ = os.Hostname()
+	data.Home, _ = os.UserHomeDir()
+	if u, err := user.Current(); err == nil {
+		data.User = u.Username
+	} else {
+		data.User = os.Getenv("USER")
+	}
+
+	for _, env := range os.Environ() {
+		if key, value, ok := strings.Cut(env, "="); ok {
+			data.Env[key] = value
+		}
+	}
+	for key, value := range vconfig.GetConfig().Vars {
+		data.Vars[key] = value
+	}
+
+	return data
+}
+
+// Marks the entry as a template, or unmarks it.
+// Templates are always copied in place, as the live file differs from the backup.
+// It doesn't touch the live file, see `Reconfigure` for that.
+func (cf *ConfigFile) SetTemplate(template bool) error {
+	if template && cf.IsDir() {
+		return errors.Errorf("%s is a directory, only files can be templates", cf.Path)
+	}
+	if template && cf.IsCommand() {
+		return errors.Errorf("%s is backed by a command, only files can be templates", cf.PathAbs())
+	}
+
+	cf.Template = template
+	if template {
+		cf.Link = LinkCopy
+	}
+
+	return nil
+}
+
+// Renders the backup file with the current machine's data.
+func (cf *ConfigFile) Render() ([]byte, error) {
+	content, err := cf.plainContent()
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return cf.render(content)
+}
+
+func (cf *ConfigFile) render(content []byte) ([]byte, error) {
+	return RenderTemplate(cf.Path, content)
+}
+
+// Renders the template with the current machine's data, `name` is the file it's reported as in the errors.
+func RenderTemplate(name string, content []byte) ([]byte, error) {
+	tmpl, err := template.New(filepath.Base(name)).Option("missingkey=error").Parse(string(content))
+	if err != nil {
+		return nil, errors.WithMessagef(err, "couldn't parse the template of %s", name)
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, NewTemplateData()); err != nil {
+		return nil, errors.WithMessagef(err, "couldn't render the template of %s", name)
+	}
+
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,79 @@
+package configfile
+
+import (
+	"os"
+	"runtime"
+	"testing"
+
+	"github.com/osamaadam/cfgrr/vconfig"
+)
+
+func TestConfigFile_Render(t *testing.T) {
+	t.Setenv("CFGRR_TEST_EDITOR", "nvim")
+	vconfig.GetConfig().SetVar("email", "me@example.com")
+
+	tests := []struct {
+		name    string
+		in      string
+		out     string
+		wantErr bool
+	}{
+		{"plain text", "[user]\n", "[user]\n", false},
+		{"machine data", "{{ .OS }}/{{ .Arch }}", runtime.GOOS + "/" + runtime.GOARCH, false},
+		{"env", "editor = {{ .Env.CFGRR_TEST_EDITOR }}", "editor = nvim", false},
+		{"vars", "email = {{ .Vars.email }}", "email = me@example.com", false},
+		{"missing var", "{{ .Vars.missing }}", "", true},
+		{"invalid template", "{{ .OS", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			files := _setupBackupEnv(t.TempDir(), t.TempDir(), 1)
+			file := files[0]
+			os.WriteFile(file.PathAbs(), []byte(tt.in), 0600)
+			if err := file.SetTemplate(true); err != nil {
+				t.Fatalf("expected no error, got %s", err)
+			}
+
+			if err := file.Backup(); (err != nil) != tt.wantErr {
+				t.Fatalf("ConfigFile.Backup() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				// A broken template is never moved out of place.
+				if content, _ := os.ReadFile(file.PathAbs()); string(content) != tt.in {
+					t.Errorf("expected the file to be left alone, got %q", content)
+				}
+				return
+			}
+
+			// The backup keeps the template, while the live file is rendered.
+			if content, _ := os.ReadFile(file.BackupPath()); string(content) != tt.in {
+				t.Errorf("expected the backup to be %q, got %q", tt.in, content)
+			}
+			if content, _ := os.ReadFile(file.PathAbs()); string(content) != tt.out {
+				t.Errorf("expected the live file to be %q, got %q", tt.out, content)
+			}
+			if !file.IsLinked() {
+				t.Errorf("expected %s to be linked", file.PathAbs())
+			}
+		})
+	}
+}
+
+func TestConfigFile_SetTemplate(t *testing.T) {
+	file := &ConfigFile{Path: "dir", Kind: KindDir}
+	if err := file.SetTemplate(true); err == nil {
+		t.Errorf("expected directories not to be templates")
+	}
+
+	file = &ConfigFile{Path: "file"}
+	if err := file.SetTemplate(true); err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+	if file.LinkMode() != LinkCopy {
+		t.Errorf("expected templates to be copied, got %s", file.LinkMode())
+	}
+	if err := file.SetLinkMode(LinkSymlink); err == nil {
+		t.Errorf("expected templates not to be symlinked")
+	}
+}
@@ -0,0 +1,8 @@
+//go:build !linux && !darwin
+
+package configfile
+
+// Extended attributes aren't supported on this platform.
+func listXattrs(path string) (map[string][]byte, error) {
+	return nil, nil
+}
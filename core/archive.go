@@ -0,0 +1,606 @@
+package core
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"io/fs"
+	"maps"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	cf "github.com/osamaadam/cfgrr/configfile"
+	"github.com/osamaadam/cfgrr/fileops"
+	"github.com/osamaadam/cfgrr/helpers"
+	"github.com/osamaadam/cfgrr/mapfile"
+	"github.com/pkg/errors"
+)
+
+// The version of the archives written by `Export`, archives of newer versions can't be imported.
+const ArchiveVersion = 1
+
+// The first file of the archive, describing the rest.
+const archiveManifestName = "manifest.json"
+
+type archiveManifest struct {
+	Version int
+	Created time.Time
+	Entries []archiveEntry
+}
+
+// An entry of the map file, with where its backup is in the archive.
+type archiveEntry struct {
+	File *cf.ConfigFile
+	// A blob ("blobs/<digest>") for files, a tree ("dirs/<name>/...") for directories.
+	Backup string
+}
+
+// Bundles the map file's entries and their backups into a gzipped tar archive at `dest`.
+// The entries are archived by path, so the archive could be imported whatever the key format of the importing backup dir.
+// Returns the number of archived entries.
+func Export(dest string) (int, error) {
+	m, err := mapfile.NewMapFile().Parse()
+	if err != nil {
+		return 0, errors.WithStack(err)
+	}
+	files := helpers.GetMapValues(m)
+	sort.Slice(files, func(i, j int) bool { return files[i].PathAbs() < files[j].PathAbs() })
+
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+
+	manifest := archiveManifest{Version: ArchiveVersion, Created: time.Now()}
+	type backup struct{ name, path string }
+	var backups []backup
+	archived := make(map[string]bool)
+	for _, file := range files {
+		// The entry is changed without touching the local one.
+		exported := *file
+		entry := archiveEntry{File: &exported}
+
+		if file.IsDir() {
+			entry.Backup = path.Join("dirs", file.HashShort())
+		} else {
+			// The blob might have been edited through its link, or predate the blob store.
+			digest, err := file.Digest()
+			if err != nil {
+				return 0, errors.WithStack(err)
+			}
+			exported.Blob = digest
+			exported.Browsable = true
+			entry.Backup = path.Join("blobs", digest)
+		}
+
+		manifest.Entries = append(manifest.Entries, entry)
+		if !archived[entry.Backup] {
+			archived[entry.Backup] = true
+			backups = append(backups, backup{entry.Backup, file.BackupPath()})
+		}
+	}
+
+	content, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return 0, errors.WithStack(err)
+	}
+	header := &tar.Header{Name: archiveManifestName, Mode: 0644, Size: int64(len(content)), ModTime: manifest.Created}
+	if err := writeTarFile(tw, header, content); err != nil {
+		return 0, errors.WithStack(err)
+	}
+
+	for _, b := range backups {
+		if err := addToArchive(tw, b.name, b.path); err != nil {
+			return 0, errors.WithMessagef(err, "couldn't archive %s", b.path)
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return 0, errors.WithStack(err)
+	}
+	if err := gz.Close(); err != nil {
+		return 0, errors.WithStack(err)
+	}
+
+	if err := fileops.WriteFile(dest, buf.Bytes(), 0600); err != nil {
+		return 0, errors.WithStack(err)
+	}
+
+	return len(manifest.Entries), nil
+}
+
+// Adds the backup file, or the backup directory's tree, to the archive under `name`.
+func addToArchive(tw *tar.Writer, name, backupPath string) error {
+	root := fileops.Locate(backupPath)
+	return filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		info, err := d.Info()
+		if err != nil {
+			return errors.WithStack(err)
+		}
+
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		var link string
+		if info.Mode()&os.ModeSymlink != 0 {
+			if link, err = os.Readlink(p); err != nil {
+				return errors.WithStack(err)
+			}
+		}
+
+		header, err := tar.FileInfoHeader(info, link)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		header.Name = path.Join(name, filepath.ToSlash(rel))
+		if d.IsDir() {
+			header.Name += "/"
+		}
+		// The archive shouldn't depend on the exporting machine's users.
+		header.Uid, header.Gid, header.Uname, header.Gname = 0, 0, "", ""
+
+		if !info.Mode().IsRegular() {
+			return errors.WithStack(tw.WriteHeader(header))
+		}
+		content, err := os.ReadFile(p)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		return writeTarFile(tw, header, content)
+	})
+}
+
+func writeTarFile(tw *tar.Writer, header *tar.Header, content []byte) error {
+	if err := tw.WriteHeader(header); err != nil {
+		return errors.WithStack(err)
+	}
+	_, err := tw.Write(content)
+	return errors.WithStack(err)
+}
+
+// What importing an archived entry did.
+type ArchiveStatus string
+
+const (
+	// The entry wasn't tracked, it was added.
+	ArchiveAdded ArchiveStatus = "added"
+	// The entry differed from the local one, which was overwritten.
+	ArchiveUpdated ArchiveStatus = "updated"
+	// The entry is the same as the local one.
+	ArchiveUnchanged ArchiveStatus = "unchanged"
+	// The entry differed from the local one, which was kept.
+	ArchiveConflict ArchiveStatus = "conflict"
+)
+
+type ArchiveResult struct {
+	File   *cf.ConfigFile
+	Status ArchiveStatus
+	// What differs from the local entry, for the updated and conflicting ones.
+	Differences []string
+}
+
+// A file of the archive.
+type archivedFile struct {
+	header  *tar.Header
+	content []byte
+}
+
+// Merges the entries of the archive written by `Export` into the backup dir.
+// Entries that aren't tracked are added, the ones differing from the local entries are reported as conflicts,
+// and overwritten if `overwrite` is set.
+// The entries about to be added or updated are passed to `review` (if it's set) before anything is changed,
+// as they could bring commands along (see `EntryCommands`), nothing is imported if it fails.
+// Only the backup dir is changed, the imported files are linked in place by `restore`.
+// Runs as a transaction, nothing is imported if anything fails.
+func ImportArchive(src string, overwrite bool, review func(results []ArchiveResult) error) ([]ArchiveResult, error) {
+	manifest, archived, err := readArchive(src)
+	if err != nil {
+		return nil, errors.WithMessagef(err, "couldn't read the archive %s", src)
+	}
+
+	m, err := mapfile.NewMapFile().Parse()
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	var results, reviewed []ArchiveResult
+	var applied []archiveEntry
+	for _, entry := range manifest.Entries {
+		if err := validateArchiveEntry(entry); err != nil {
+			return nil, errors.WithStack(err)
+		}
+		result := ArchiveResult{File: entry.File, Status: ArchiveAdded}
+		if local, ok := m[entry.File.HashShort()]; ok && local.SamePath(entry.File) {
+			result.Differences, err = archiveDifferences(local, entry, archived)
+			if err != nil {
+				return nil, errors.WithStack(err)
+			}
+			switch {
+			case len(result.Differences) == 0:
+				result.Status = ArchiveUnchanged
+			case overwrite:
+				result.Status = ArchiveUpdated
+			default:
+				result.Status = ArchiveConflict
+			}
+		}
+
+		results = append(results, result)
+		if result.Status == ArchiveAdded || result.Status == ArchiveUpdated {
+			applied = append(applied, entry)
+			reviewed = append(reviewed, result)
+		}
+	}
+	if len(applied) == 0 {
+		return results, nil
+	}
+	if review != nil {
+		if err := review(reviewed); err != nil {
+			return nil, errors.WithStack(err)
+		}
+	}
+
+	files := make([]*cf.ConfigFile, len(applied))
+	for i, entry := range applied {
+		files[i] = entry.File
+	}
+	err = transact("import", map[string]string{"archive": src}, files, func(j *fileops.Journal) error {
+		for _, entry := range applied {
+			if err := extractBackup(entry.File, entry.Backup, archived); err != nil {
+				return errors.WithMessagef(err, "couldn't extract the backup of %s", entry.File.Path)
+			}
+		}
+		if err := mapfile.NewMapFile().AddFiles(files...); err != nil {
+			return errors.WithStack(err)
+		}
+		_, err := SaveRevisions(files...)
+		return errors.WithStack(err)
+	})
+
+	return results, errors.WithStack(err)
+}
+
+// Returns the shell commands the entry runs, its hooks and the dump and load commands of command entries,
+// e.g. "post-restore: tmux source ~/.tmux.conf".
+func EntryCommands(file *cf.ConfigFile) []string {
+	var commands []string
+	if file.IsCommand() {
+		commands = append(commands, "dump: "+file.Dump, "load: "+file.Load)
+	}
+	for _, event := range cf.HookEvents {
+		for _, command := range file.Hooks[event] {
+			commands = append(commands, string(event)+": "+command)
+		}
+	}
+
+	return commands
+}
+
+// Checks the archived entry only refers to paths inside the backup dir and to its own backup,
+// as the manifest could have been written by anything.
+func validateArchiveEntry(entry archiveEntry) error {
+	file := entry.File
+	if file == nil || file.Path == "" {
+		return errors.New("the archive has an entry without a path")
+	}
+	if !slices.Contains([]cf.Anchor{"", cf.AnchorHome, cf.AnchorRoot}, file.Anchor) {
+		return errors.Errorf("the archived entry of %s has an unknown anchor %q", file.Path, file.Anchor)
+	}
+
+	switch file.Kind {
+	case cf.KindCommand:
+		if _, err := cf.NewCommandFile(file.Path, file.Dump, file.Load); err != nil {
+			return errors.WithMessage(err, "the archive has an invalid command entry")
+		}
+	case "", cf.KindFile, cf.KindDir:
+		if !filepath.IsLocal(filepath.FromSlash(file.Path)) {
+			return errors.Errorf("the archive has an entry outside of its anchor: %s", file.Path)
+		}
+	default:
+		return errors.Errorf("the archived entry of %s has an unknown kind %q", file.Path, file.Kind)
+	}
+
+	if file.IsDir() {
+		for dir := range file.Dirs {
+			if !filepath.IsLocal(filepath.FromSlash(dir)) {
+				return errors.Errorf("the archived directory %s has a sub directory outside of it: %s", file.Path, dir)
+			}
+		}
+		if !strings.HasPrefix(entry.Backup, "dirs/") {
+			return errors.Errorf("the archived directory %s has an invalid backup %s", file.Path, entry.Backup)
+		}
+		return nil
+	}
+
+	// The blob is named after its content, which is checked when it's read.
+	digest := cf.BlobDigest(file.Blob)
+	if sum, err := hex.DecodeString(digest); err != nil || len(sum) != sha256.Size || entry.Backup != path.Join("blobs", digest) {
+		return errors.Errorf("the archived entry of %s has an invalid blob %q", file.Path, file.Blob)
+	}
+
+	return nil
+}
+
+// Reads the manifest and the files of the archive, checking the blobs weren't corrupted.
+func readArchive(src string) (*archiveManifest, map[string]archivedFile, error) {
+	f, err := os.Open(src)
+	if err != nil {
+		return nil, nil, errors.WithStack(err)
+	}
+	defer f.Close()
+
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, nil, errors.WithMessage(err, "not a gzipped archive")
+	}
+	tr := tar.NewReader(gz)
+
+	var manifest *archiveManifest
+	archived := make(map[string]archivedFile)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, nil, errors.WithStack(err)
+		}
+
+		name := strings.TrimSuffix(path.Clean(header.Name), "/")
+		if path.IsAbs(name) || name == ".." || strings.HasPrefix(name, "../") {
+			return nil, nil, errors.Errorf("the archive has a file outside of it: %s", header.Name)
+		}
+		content, err := io.ReadAll(tr)
+		if err != nil {
+			return nil, nil, errors.WithStack(err)
+		}
+
+		if manifest == nil {
+			if name != archiveManifestName {
+				return nil, nil, errors.New("the archive has no manifest, it wasn't written by 'cfgrr export'")
+			}
+			manifest = &archiveManifest{}
+			if err := json.Unmarshal(content, manifest); err != nil {
+				return nil, nil, errors.WithMessage(err, "couldn't parse the manifest")
+			}
+			if manifest.Version > ArchiveVersion {
+				return nil, nil, errors.Errorf("the archive's version is %d, this version of cfgrr only imports archives up to version %d", manifest.Version, ArchiveVersion)
+			}
+			continue
+		}
+
+		if digest, ok := strings.CutPrefix(name, "blobs/"); ok {
+			sum := sha256.Sum256(content)
+			if hex.EncodeToString(sum[:]) != digest {
+				return nil, nil, errors.Errorf("the blob %s is corrupted", digest)
+			}
+		}
+		archived[name] = archivedFile{header: header, content: content}
+	}
+	if manifest == nil {
+		return nil, nil, errors.New("the archive is empty")
+	}
+
+	return manifest, archived, nil
+}
+
+// Lists what differs between the local entry and the archived one.
+func archiveDifferences(local *cf.ConfigFile, entry archiveEntry, archived map[string]archivedFile) ([]string, error) {
+	var differences []string
+	archivedFile := entry.File
+
+	switch {
+	case local.IsDir() != archivedFile.IsDir():
+		differences = append(differences, "kind")
+	case local.IsDir():
+		same, err := sameArchivedTree(local.BackupPath(), entry.Backup, archived)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		if !same {
+			differences = append(differences, "content")
+		}
+	default:
+		digest, err := local.Digest()
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, errors.WithStack(err)
+		}
+		if digest != cf.BlobDigest(archivedFile.Blob) {
+			differences = append(differences, "content")
+		}
+	}
+
+	if local.Perm != archivedFile.Perm {
+		differences = append(differences, "mode")
+	}
+	if local.LinkMode() != archivedFile.LinkMode() {
+		differences = append(differences, "link")
+	}
+	if local.Template != archivedFile.Template {
+		differences = append(differences, "template")
+	}
+	if local.Encrypted != archivedFile.Encrypted {
+		differences = append(differences, "encrypted")
+	}
+	if local.Dump != archivedFile.Dump || local.Load != archivedFile.Load {
+		differences = append(differences, "commands")
+	}
+	if !maps.EqualFunc(local.Hooks, archivedFile.Hooks, slices.Equal[[]string]) {
+		differences = append(differences, "hooks")
+	}
+	if local.When.String() != archivedFile.When.String() {
+		differences = append(differences, "conditions")
+	}
+	localTags, archivedTags := slices.Clone(local.Tags), slices.Clone(archivedFile.Tags)
+	slices.Sort(localTags)
+	slices.Sort(archivedTags)
+	if !slices.Equal(localTags, archivedTags) {
+		differences = append(differences, "tags")
+	}
+
+	return differences, nil
+}
+
+// Checks whether the local backup directory has the same files as the archived one.
+func sameArchivedTree(backupPath, name string, archived map[string]archivedFile) (bool, error) {
+	prefix := name + "/"
+	remaining := make(map[string]archivedFile)
+	for archivedName, file := range archived {
+		if rel, ok := strings.CutPrefix(archivedName, prefix); ok && file.header.Typeflag != tar.TypeDir {
+			remaining[rel] = file
+		}
+	}
+
+	root := fileops.Locate(backupPath)
+	same := true
+	err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if errors.Is(err, os.ErrNotExist) && p == root {
+			same = false
+			return filepath.SkipDir
+		} else if err != nil {
+			return errors.WithStack(err)
+		}
+		if d.IsDir() {
+			return nil
+		}
+
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		file, ok := remaining[filepath.ToSlash(rel)]
+		delete(remaining, filepath.ToSlash(rel))
+		if !ok {
+			same = false
+			return filepath.SkipAll
+		}
+
+		var content []byte
+		if d.Type()&os.ModeSymlink != 0 {
+			link, err := os.Readlink(p)
+			same = err == nil && link == file.header.Linkname
+		} else if content, err = os.ReadFile(p); err != nil {
+			return errors.WithStack(err)
+		} else {
+			same = bytes.Equal(content, file.content)
+		}
+		if !same {
+			return filepath.SkipAll
+		}
+		return nil
+	})
+	if err != nil {
+		return false, errors.WithStack(err)
+	}
+
+	return same && len(remaining) == 0, nil
+}
+
+// Writes the archived backup of the entry to its local backup path.
+func extractBackup(file *cf.ConfigFile, name string, archived map[string]archivedFile) error {
+	if !file.IsDir() {
+		// The blobs are archived by their content, the entry might need a blob of its own.
+		file.Blob = file.BlobName(cf.BlobDigest(file.Blob))
+	}
+	dest := file.BackupPath()
+	if !file.IsDir() {
+		blob, ok := archived[name]
+		if !ok {
+			return errors.Errorf("the archive is missing %s", name)
+		}
+		if fileops.Exists(dest) {
+			// Blobs are named after their content, the existing one is the same.
+			return nil
+		}
+		if err := fileops.MkdirAll(filepath.Dir(dest)); err != nil {
+			return errors.WithStack(err)
+		}
+		return errors.WithStack(writeArchived(dest, blob))
+	}
+
+	if err := fileops.RemoveAll(dest); err != nil {
+		return errors.WithStack(err)
+	}
+	if err := fileops.MkdirAll(dest); err != nil {
+		return errors.WithStack(err)
+	}
+
+	// Parents sort before their children.
+	var names []string
+	for archivedName := range archived {
+		if strings.HasPrefix(archivedName, name+"/") {
+			names = append(names, archivedName)
+		}
+	}
+	sort.Strings(names)
+	for _, archivedName := range names {
+		rel := filepath.FromSlash(strings.TrimPrefix(archivedName, name+"/"))
+		if err := checkArchivedPath(dest, rel, archived[archivedName]); err != nil {
+			return errors.WithStack(err)
+		}
+		if err := writeArchived(filepath.Join(dest, rel), archived[archivedName]); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+
+	if _, err := file.SaveTree(); err != nil {
+		return errors.WithStack(err)
+	}
+
+	return nil
+}
+
+// Checks the archived file of a directory's tree could be written at `rel` inside `root`
+// without following a symlink out of the tree, or leaving a symlink pointing out of it.
+func checkArchivedPath(root, rel string, file archivedFile) error {
+	dest := filepath.Join(root, rel)
+	for dir := filepath.Dir(dest); dir != root && isInside(root, dir); dir = filepath.Dir(dir) {
+		info, err := fileops.Lstat(dir)
+		if err != nil {
+			continue
+		}
+		if info.Mode()&os.ModeSymlink != 0 {
+			return errors.Errorf("the archive writes %s through the symlink %s", file.header.Name, dir)
+		}
+	}
+
+	if file.header.Typeflag == tar.TypeSymlink {
+		target := filepath.FromSlash(file.header.Linkname)
+		if filepath.IsAbs(target) || !isInside(root, filepath.Join(filepath.Dir(dest), target)) {
+			return errors.Errorf("the archived symlink %s points outside of its directory: %s", file.header.Name, file.header.Linkname)
+		}
+	}
+
+	return nil
+}
+
+func writeArchived(dest string, file archivedFile) error {
+	mode := os.FileMode(file.header.Mode).Perm()
+	switch file.header.Typeflag {
+	case tar.TypeDir:
+		if err := fileops.MkdirAll(dest); err != nil {
+			return errors.WithStack(err)
+		}
+		return errors.WithStack(fileops.Chmod(dest, mode))
+	case tar.TypeSymlink:
+		return errors.WithStack(fileops.Symlink(dest, file.header.Linkname))
+	case tar.TypeReg:
+		if err := fileops.WriteFile(dest, file.content, mode); err != nil {
+			return errors.WithStack(err)
+		}
+		return errors.WithStack(fileops.Chtimes(dest, file.header.ModTime))
+	default:
+		return errors.Errorf("unsupported file type of %s in the archive", file.header.Name)
+	}
+}
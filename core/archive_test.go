@@ -0,0 +1,237 @@
+package core
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	cf "github.com/osamaadam/cfgrr/configfile"
+	"github.com/osamaadam/cfgrr/mapfile"
+	"github.com/osamaadam/cfgrr/vconfig"
+	"github.com/pkg/errors"
+)
+
+func TestExportImportArchive(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	files := _setupBackupEnv(filepath.Join(home, "backup"), home, 2)
+	// Identical files would share their backup.
+	for i, file := range files {
+		os.WriteFile(file.PathAbs(), []byte{byte(i)}, 0640)
+	}
+	dir := filepath.Join(home, ".vim")
+	os.MkdirAll(filepath.Join(dir, "colors"), 0700)
+	os.WriteFile(filepath.Join(dir, "colors", "dark.vim"), []byte("hi Normal guibg=black"), 0644)
+	dirFile, _ := cf.NewConfigFile(dir)
+	if err := BackupFiles(append(files, dirFile)...); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	archive := filepath.Join(t.TempDir(), "cfgrr.tar.gz")
+	count, err := Export(archive)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if count != 3 {
+		t.Errorf("expected 3 archived entries, got %d", count)
+	}
+
+	// Another machine, with a different key format, tracking the first file with another content.
+	vconfig.GetConfig().SetBackupDir(filepath.Join(home, "other"))
+	vconfig.GetConfig().KeyLength = 12
+	t.Cleanup(func() { vconfig.GetConfig().KeyLength = 8 })
+	os.Remove(files[0].PathAbs())
+	os.WriteFile(files[0].PathAbs(), []byte("local"), 0640)
+	local, _ := cf.NewConfigFile(files[0].PathAbs())
+	if err := BackupFiles(local); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		overwrite bool
+		want      map[ArchiveStatus]int
+	}{
+		{"merge", false, map[ArchiveStatus]int{ArchiveAdded: 2, ArchiveConflict: 1}},
+		{"again", false, map[ArchiveStatus]int{ArchiveUnchanged: 2, ArchiveConflict: 1}},
+		{"overwrite", true, map[ArchiveStatus]int{ArchiveUnchanged: 2, ArchiveUpdated: 1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			results, err := ImportArchive(archive, tt.overwrite, nil)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			got := make(map[ArchiveStatus]int)
+			for _, result := range results {
+				got[result.Status]++
+			}
+			for status, count := range tt.want {
+				if got[status] != count {
+					t.Errorf("expected %d %s entries, got %v", count, status, got)
+				}
+			}
+		})
+	}
+
+	m, err := mapfile.NewMapFile().Parse()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(m) != 3 {
+		t.Fatalf("expected 3 entries, got %d", len(m))
+	}
+	for _, file := range m {
+		if _, err := os.Stat(file.BackupPath()); err != nil {
+			t.Errorf("expected the backup of %s to be extracted, got %v", file.Path, err)
+		}
+		if file.IsDir() {
+			content, _ := os.ReadFile(filepath.Join(file.BackupPath(), "colors", "dark.vim"))
+			if string(content) != "hi Normal guibg=black" {
+				t.Errorf("expected the directory's tree to be extracted, got %q", content)
+			}
+		}
+		if file.SamePath(files[0]) && cf.BlobDigest(file.Blob) != cf.BlobDigest(files[0].Blob) {
+			t.Errorf("expected the conflicting entry to be overwritten")
+		}
+	}
+}
+
+func TestImportArchive_NewerVersion(t *testing.T) {
+	archive := _writeArchive(t, archiveManifest{Version: 99})
+
+	if _, err := ImportArchive(archive, false, nil); err == nil {
+		t.Errorf("expected an error importing an archive of a newer version")
+	}
+}
+
+func TestImportArchive_Unsafe(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	vconfig.GetConfig().SetBackupDir(filepath.Join(home, "backup"))
+
+	content := []byte("evil")
+	sum := sha256.Sum256(content)
+	digest := hex.EncodeToString(sum[:])
+	blob := _archivedFile("blobs/"+digest, tar.TypeReg, content, "")
+	dirEntry := func(files ...archivedFile) []archivedFile {
+		return append([]archivedFile{_archivedFile("dirs/vim/", tar.TypeDir, nil, "")}, files...)
+	}
+
+	tests := []struct {
+		name  string
+		entry archiveEntry
+		files []archivedFile
+	}{
+		{"path climbing out of home", archiveEntry{&cf.ConfigFile{Path: "../evil", Blob: digest}, "blobs/" + digest}, []archivedFile{blob}},
+		{"absolute path", archiveEntry{&cf.ConfigFile{Path: "/tmp/evil", Blob: digest}, "blobs/" + digest}, []archivedFile{blob}},
+		{"unknown anchor", archiveEntry{&cf.ConfigFile{Path: "evil", Blob: digest, Anchor: "../.."}, "blobs/" + digest}, []archivedFile{blob}},
+		{"blob climbing out of the blob store", archiveEntry{&cf.ConfigFile{Path: "evil", Blob: "../../evil"}, "blobs/" + digest}, []archivedFile{blob}},
+		{"blob of another content", archiveEntry{&cf.ConfigFile{Path: "evil", Blob: strings.Repeat("0", 64)}, "blobs/" + digest}, []archivedFile{blob}},
+		{"invalid command name", archiveEntry{&cf.ConfigFile{Path: "../evil", Kind: cf.KindCommand, Dump: "true", Load: "true", Blob: digest}, "blobs/" + digest}, []archivedFile{blob}},
+		{"symlink out of the tree", archiveEntry{&cf.ConfigFile{Path: ".vim", Kind: cf.KindDir}, "dirs/vim"},
+			dirEntry(_archivedFile("dirs/vim/link", tar.TypeSymlink, nil, "../../../evil"))},
+		{"absolute symlink", archiveEntry{&cf.ConfigFile{Path: ".vim", Kind: cf.KindDir}, "dirs/vim"},
+			dirEntry(_archivedFile("dirs/vim/link", tar.TypeSymlink, nil, home))},
+		{"file written through a symlink", archiveEntry{&cf.ConfigFile{Path: ".vim", Kind: cf.KindDir}, "dirs/vim"},
+			dirEntry(_archivedFile("dirs/vim/link", tar.TypeSymlink, nil, "."), _archivedFile("dirs/vim/link/evil", tar.TypeReg, content, ""))},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			archive := _writeArchive(t, archiveManifest{Version: ArchiveVersion, Entries: []archiveEntry{tt.entry}}, tt.files...)
+			if _, err := ImportArchive(archive, true, nil); err == nil {
+				t.Errorf("expected the archive to be refused")
+			}
+
+			if m, _ := mapfile.NewMapFile().Parse(); len(m) != 0 {
+				t.Errorf("expected nothing to be imported, got %d entries", len(m))
+			}
+			for _, path := range []string{filepath.Join(filepath.Dir(home), "evil"), "/tmp/evil", filepath.Join(home, "evil")} {
+				if _, err := os.Lstat(path); err == nil {
+					t.Errorf("expected %s not to be written", path)
+				}
+			}
+		})
+	}
+}
+
+func TestImportArchive_Review(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	files := _setupBackupEnv(filepath.Join(home, "backup"), home, 1)
+	files[0].UpdateHooks(cf.HookPostRestore, []string{"echo restored"}, nil)
+	if err := BackupFiles(files...); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	archive := filepath.Join(t.TempDir(), "cfgrr.tar.gz")
+	if _, err := Export(archive); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	vconfig.GetConfig().SetBackupDir(filepath.Join(home, "other"))
+
+	var reviewed []string
+	_, err := ImportArchive(archive, false, func(results []ArchiveResult) error {
+		for _, result := range results {
+			reviewed = append(reviewed, EntryCommands(result.File)...)
+		}
+		return errors.New("declined")
+	})
+	if err == nil {
+		t.Fatalf("expected the declined import to fail")
+	}
+	if len(reviewed) != 1 || reviewed[0] != "post-restore: echo restored" {
+		t.Errorf("expected the hook to be reviewed, got %v", reviewed)
+	}
+	if m, _ := mapfile.NewMapFile().Parse(); len(m) != 0 {
+		t.Errorf("expected nothing to be imported, got %d entries", len(m))
+	}
+
+	// The same file with other hooks and tags conflicts.
+	local, _ := cf.NewConfigFile(files[0].PathAbs())
+	local.Blob = files[0].Blob
+	local.Tags = []string{"shell"}
+	if err := BackupFiles(local); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	results, err := ImportArchive(archive, false, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(results) != 1 || results[0].Status != ArchiveConflict || !slices.Equal(results[0].Differences, []string{"hooks", "tags"}) {
+		t.Errorf("expected a conflict over the hooks and tags, got %+v", results)
+	}
+}
+
+func _archivedFile(name string, typeflag byte, content []byte, linkname string) archivedFile {
+	return archivedFile{&tar.Header{Name: name, Typeflag: typeflag, Mode: 0644, Size: int64(len(content)), Linkname: linkname}, content}
+}
+
+// Writes an archive with the manifest and the files, returning its path.
+func _writeArchive(t *testing.T, manifest archiveManifest, files ...archivedFile) string {
+	archive := filepath.Join(t.TempDir(), "cfgrr.tar.gz")
+	f, _ := os.Create(archive)
+	defer f.Close()
+	gz := gzip.NewWriter(f)
+	tw := tar.NewWriter(gz)
+
+	content, _ := json.Marshal(manifest)
+	files = append([]archivedFile{{&tar.Header{Name: archiveManifestName, Mode: 0644}, content}}, files...)
+	for _, file := range files {
+		file.header.Size = int64(len(file.content))
+		if err := writeTarFile(tw, file.header, file.content); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	tw.Close()
+	gz.Close()
+
+	return archive
+}
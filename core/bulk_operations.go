@@ -1,16 +1,30 @@
 package core
 
 import (
+	"os"
+	"path/filepath"
+	"strconv"
+
 	cf "github.com/osamaadam/cfgrr/configfile"
+	"github.com/osamaadam/cfgrr/fileops"
+	"github.com/osamaadam/cfgrr/helpers"
 	"github.com/osamaadam/cfgrr/mapfile"
+	"github.com/osamaadam/cfgrr/vconfig"
 	"github.com/pkg/errors"
 )
 
 // Backs up the files to the backup directory.
 // And creates a symlink to the backup files at the original file locations.
+// Runs as a transaction, nothing is backed up if any of the files fails.
 func BackupFiles(files ...*cf.ConfigFile) error {
+	return transact("backup", nil, files, func(j *fileops.Journal) error {
+		return backupFiles(j, files...)
+	})
+}
+
+func backupFiles(j *fileops.Journal, files ...*cf.ConfigFile) error {
 	for _, file := range files {
-		if err := file.Backup(); err != nil {
+		if err := checkpoint(j, "backup", file, file.Backup); err != nil {
 			return errors.WithStack(err)
 		}
 	}
@@ -21,34 +35,148 @@ func BackupFiles(files ...*cf.ConfigFile) error {
 		return errors.WithStack(err)
 	}
 
+	if _, err := SaveRevisions(files...); err != nil {
+		return errors.WithStack(err)
+	}
+
 	return nil
 }
 
+// Saves a revision of each file whose backup changed since its latest revision.
+// Returns the files that got a new revision.
+func SaveRevisions(files ...*cf.ConfigFile) (saved []*cf.ConfigFile, err error) {
+	for _, file := range files {
+		ok, err := file.SaveRevision()
+		if err != nil {
+			return saved, errors.WithStack(err)
+		}
+		if ok {
+			saved = append(saved, file)
+		}
+	}
+
+	return saved, nil
+}
+
+// Rolls the file back to one of its revisions, and updates the map file.
+// The replaced blobs are deleted unless other files use them, their content is kept as revisions.
+func RollbackFile(file *cf.ConfigFile, id int) error {
+	return transact("rollback", map[string]string{"path": file.PathAbs(), "rev": strconv.Itoa(id)}, []*cf.ConfigFile{file}, func(j *fileops.Journal) error {
+		oldBlob := file.Blob
+		// The changes made to a copy are pulled here, and the blob edited through a link is named after its content again,
+		// so the blob the current content is stored in is known.
+		if _, err := file.Sync(); err != nil {
+			return errors.WithStack(err)
+		}
+		if _, err := RehashFiles(file); err != nil {
+			return errors.WithStack(err)
+		}
+		syncedBlob := file.Blob
+
+		if err := file.Rollback(id); err != nil {
+			return errors.WithStack(err)
+		}
+
+		mapFile := mapfile.NewMapFile()
+		if err := mapFile.AddFiles(file); err != nil {
+			return errors.WithStack(err)
+		}
+		m, err := mapFile.Parse()
+		if err != nil {
+			return errors.WithStack(err)
+		}
+
+		return errors.WithStack(removeUnusedBlobs(countBlobRefs(helpers.GetMapValues(m)...), oldBlob, syncedBlob))
+	})
+}
+
+// Picks how to restore a file conflicting with its live file, used by the prompt strategy.
+type ConflictResolver func(file *cf.ConfigFile) (cf.ConflictStrategy, error)
+
 // Restores the files from the backup directory.
+// Live files cfgrr doesn't manage are resolved with the given strategy,
+// `resolve` picks the strategy of each of them when it's the prompt strategy.
 // Tidies the mapfile before execution.
-func RestoreFiles(files ...*cf.ConfigFile) error {
+// Runs as a transaction, nothing is restored if any of the files fails.
+// Returns what was done to each file.
+func RestoreFiles(strategy cf.ConflictStrategy, resolve ConflictResolver, files ...*cf.ConfigFile) (results []cf.RestoreResult, err error) {
+	err = transact("restore", map[string]string{"conflict": string(strategy)}, files, func(j *fileops.Journal) error {
+		results, err = restoreFiles(j, strategy, resolve, files...)
+		return err
+	})
+
+	return results, errors.WithStack(err)
+}
+
+func restoreFiles(j *fileops.Journal, strategy cf.ConflictStrategy, resolve ConflictResolver, files ...*cf.ConfigFile) (results []cf.RestoreResult, err error) {
 	mf := mapfile.NewMapFile()
 	if err := mf.Tidy(); err != nil {
-		return errors.WithStack(err)
+		return nil, errors.WithStack(err)
 	}
 	for _, file := range files {
-		if err := file.Restore(); err != nil {
-			return errors.WithStack(err)
+		err := checkpoint(j, "restore", file, func() error {
+			fileStrategy := strategy
+			if strategy == cf.ConflictPrompt && file.HasConflict() {
+				if resolve == nil {
+					return errors.Errorf("%s conflicts with its backup, and there's no way to prompt for it", file.PathAbs())
+				}
+				var err error
+				if fileStrategy, err = resolve(file); err != nil {
+					return errors.WithStack(err)
+				}
+			}
+
+			result, err := file.RestoreWith(fileStrategy)
+			if err != nil {
+				return errors.WithStack(err)
+			}
+			results = append(results, result)
+			return nil
+		})
+		if err != nil {
+			return results, errors.WithStack(err)
 		}
 	}
 
-	return nil
+	return results, nil
 }
 
 // Deletes the files from the backup directory.
+// A blob shared with files that aren't deleted is kept.
+// Runs as a transaction, nothing is deleted if any of the files fails.
 func DeleteFiles(restore bool, files ...*cf.ConfigFile) error {
+	return transact("delete", map[string]string{"restore": strconv.FormatBool(restore)}, files, func(j *fileops.Journal) error {
+		return deleteFiles(j, restore, files...)
+	})
+}
+
+func deleteFiles(j *fileops.Journal, restore bool, files ...*cf.ConfigFile) error {
+	mapFile := mapfile.NewMapFile()
+
+	m, err := mapFile.Parse()
+	if err != nil {
+		return errors.WithStack(err)
+	}
 	for _, file := range files {
-		if err := file.DeleteBackup(restore); err != nil {
+		delete(m, file.HashShort())
+	}
+	refs := countBlobRefs(helpers.GetMapValues(m)...)
+
+	// Unlink all the files first, files sharing a blob need it for their hard restore.
+	for _, file := range files {
+		if err := checkpoint(j, "unlink", file, func() error { return file.Unlink(restore) }); err != nil {
 			return errors.WithStack(err)
 		}
 	}
 
-	mapFile := mapfile.NewMapFile()
+	for _, file := range files {
+		if file.Blob != "" && refs[file.Blob] > 0 {
+			continue
+		}
+		if err := checkpoint(j, "remove", file, file.RemoveBackup); err != nil {
+			return errors.WithStack(err)
+		}
+	}
 
 	if err := mapFile.RemoveFiles(files...); err != nil {
 		return errors.WithStack(err)
@@ -57,10 +185,265 @@ func DeleteFiles(restore bool, files ...*cf.ConfigFile) error {
 	return nil
 }
 
-// Creates a browsable replica of the backedup config files at `baseDir`.
-func MakeFilesBrowsable(baseDir string, files ...*cf.ConfigFile) error {
+// Counts the files referencing each blob.
+func countBlobRefs(files ...*cf.ConfigFile) map[string]int {
+	refs := make(map[string]int)
+	for _, file := range files {
+		if file.Blob != "" {
+			refs[file.Blob]++
+		}
+	}
+
+	return refs
+}
+
+// Brings the map file up to date with the backup files.
+// Pulls the changes made to hard links and copies, renames the edited blobs,
+// and records the current metadata of the files and structure of the tracked directories.
+// All the files of the map file should be given, so the blobs that aren't used anymore could be deleted.
+func SyncFiles(files ...*cf.ConfigFile) error {
+	changed := make([]*cf.ConfigFile, 0)
+	replacedBlobs := make([]string, 0)
+
+	for _, file := range files {
+		oldBlob := file.Blob
+		ok, err := file.Sync()
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		if ok {
+			changed = append(changed, file)
+			replacedBlobs = append(replacedBlobs, oldBlob)
+		}
+	}
+
+	if len(changed) > 0 {
+		if err := mapfile.NewMapFile().AddFiles(changed...); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+
+	if _, err := RehashFiles(files...); err != nil {
+		return errors.WithStack(err)
+	}
+
+	changed = changed[:0]
 	for _, file := range files {
-		if err := file.MakeBrowsable(baseDir); err != nil {
+		if !fileops.Exists(file.BackupPath()) {
+			continue
+		}
+		treeChanged, err := file.SaveTree()
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		metaChanged := false
+		if file.IsLinked() {
+			// Replaced files aren't managed by cfgrr anymore, their metadata isn't ours.
+			if metaChanged, err = file.SaveMeta(); err != nil {
+				return errors.WithStack(err)
+			}
+		}
+		if treeChanged || metaChanged {
+			changed = append(changed, file)
+		}
+	}
+
+	if len(changed) > 0 {
+		if err := mapfile.NewMapFile().AddFiles(changed...); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+
+	// Delete the blobs replaced by the synced files, unless other files still use them.
+	if err := removeUnusedBlobs(countBlobRefs(files...), replacedBlobs...); err != nil {
+		return errors.WithStack(err)
+	}
+
+	return nil
+}
+
+// Deletes the given blobs, unless they're referenced.
+func removeUnusedBlobs(refs map[string]int, blobs ...string) error {
+	for _, blob := range blobs {
+		if blob == "" || refs[blob] > 0 {
+			continue
+		}
+		if err := fileops.Remove(cf.BlobPath(blob)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return errors.WithStack(err)
+		}
+	}
+
+	return nil
+}
+
+// Switches the files to the given link mode, and updates the map file.
+// The blobs the files stopped sharing are deleted unless other files still use them.
+func RelinkFiles(mode cf.LinkMode, files ...*cf.ConfigFile) error {
+	return reconfigureFiles(func(file *cf.ConfigFile) error { return file.SetLinkMode(mode) }, files...)
+}
+
+// Marks the files as templates (or unmarks them), re-rendering the restored ones.
+// The map file is updated, and the replaced blobs are deleted unless other files still use them.
+func TemplateFiles(template bool, files ...*cf.ConfigFile) error {
+	return reconfigureFiles(func(file *cf.ConfigFile) error { return file.SetTemplate(template) }, files...)
+}
+
+// Applies the change to each of the files (see `Reconfigure`), and updates the map file.
+// Changing how a file is linked could move it to another blob, the replaced blobs are deleted unless other files still use them.
+func reconfigureFiles(change func(file *cf.ConfigFile) error, files ...*cf.ConfigFile) error {
+	replacedBlobs := make([]string, 0, len(files))
+	for _, file := range files {
+		replacedBlobs = append(replacedBlobs, file.Blob)
+		if err := file.Reconfigure(func() error { return change(file) }); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+
+	mapFile := mapfile.NewMapFile()
+
+	if err := mapFile.AddFiles(files...); err != nil {
+		return errors.WithStack(err)
+	}
+
+	m, err := mapFile.Parse()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	return errors.WithStack(removeUnusedBlobs(countBlobRefs(helpers.GetMapValues(m)...), replacedBlobs...))
+}
+
+// Encrypts the backups of the files (or decrypts them), re-copying the restored ones.
+// The map file is updated, and the replaced blobs are deleted unless other files still use them.
+func EncryptFiles(encrypted bool, files ...*cf.ConfigFile) error {
+	return reconfigureFiles(func(file *cf.ConfigFile) error { return file.SetEncrypted(encrypted) }, files...)
+}
+
+// Renames the blobs whose content changed since they were stored (e.g. edited through the symlink),
+// so they're named after their content again. The map file is updated with the new names.
+// Linked files sharing a blob (backed up before they got blobs of their own) are given a copy of it,
+// the blobs left unused are deleted.
+func RehashFiles(files ...*cf.ConfigFile) (rehashed []*cf.ConfigFile, err error) {
+	// Files sharing a blob have the same content, so each blob is hashed once.
+	digests := make(map[string]string)
+	replacedBlobs := make([]string, 0)
+
+	for _, file := range files {
+		oldBlob := file.Blob
+		if oldBlob == "" {
+			continue
+		}
+
+		digest, ok := digests[oldBlob]
+		if !ok {
+			if !fileops.Exists(file.BackupPath()) {
+				continue
+			}
+			if digest, err = file.Digest(); err != nil {
+				return rehashed, errors.WithStack(err)
+			}
+			digests[oldBlob] = digest
+		}
+
+		if file.BlobName(digest) == oldBlob {
+			continue
+		}
+
+		if err := file.MoveBlob(digest); err != nil {
+			return rehashed, errors.WithStack(err)
+		}
+		rehashed = append(rehashed, file)
+		replacedBlobs = append(replacedBlobs, oldBlob)
+	}
+
+	if len(rehashed) == 0 {
+		return rehashed, nil
+	}
+
+	mapFile := mapfile.NewMapFile()
+	if err := mapFile.AddFiles(rehashed...); err != nil {
+		return rehashed, errors.WithStack(err)
+	}
+	m, err := mapFile.Parse()
+	if err != nil {
+		return rehashed, errors.WithStack(err)
+	}
+
+	return rehashed, errors.WithStack(removeUnusedBlobs(countBlobRefs(helpers.GetMapValues(m)...), replacedBlobs...))
+}
+
+// Moves the files backed up with the legacy layout into the blob store, and updates the map file.
+func MigrateFiles(files ...*cf.ConfigFile) (migrated []*cf.ConfigFile, err error) {
+	for _, file := range files {
+		if !fileops.Exists(file.BackupPath()) {
+			// Nothing to migrate, `Tidy` takes care of these.
+			continue
+		}
+		ok, err := file.Migrate()
+		if err != nil {
+			return migrated, errors.WithStack(err)
+		}
+		if ok {
+			migrated = append(migrated, file)
+		}
+	}
+
+	if len(migrated) > 0 {
+		if err := mapfile.NewMapFile().AddFiles(migrated...); err != nil {
+			return migrated, errors.WithStack(err)
+		}
+	}
+
+	return migrated, nil
+}
+
+// Anchors the files outside the home directory tracked before anchors existed at the filesystem root.
+// Their keys in the map file change accordingly.
+func ReanchorFiles(files ...*cf.ConfigFile) (reanchored []*cf.ConfigFile, err error) {
+	oldEntries := make([]*cf.ConfigFile, 0)
+	for _, file := range files {
+		oldEntry := *file
+		ok, err := file.Reanchor()
+		if err != nil {
+			return reanchored, errors.WithStack(err)
+		}
+		if ok {
+			oldEntries = append(oldEntries, &oldEntry)
+			reanchored = append(reanchored, file)
+		}
+	}
+
+	if len(reanchored) == 0 {
+		return reanchored, nil
+	}
+
+	mapFile := mapfile.NewMapFile()
+	if err := mapFile.RemoveFiles(oldEntries...); err != nil {
+		return reanchored, errors.WithStack(err)
+	}
+	if err := mapFile.AddFiles(reanchored...); err != nil {
+		return reanchored, errors.WithStack(err)
+	}
+
+	return reanchored, nil
+}
+
+// Creates a browsable replica of the backedup config files at `homeDir`.
+// Files outside the home directory are replicated at `rootDir`.
+// Runs as a transaction, nothing is replicated if any of the files fails.
+func MakeFilesBrowsable(homeDir, rootDir string, files ...*cf.ConfigFile) error {
+	return transact("replicate", map[string]string{"home": homeDir, "root": rootDir}, files, func(j *fileops.Journal) error {
+		return makeFilesBrowsable(j, homeDir, rootDir, files...)
+	})
+}
+
+func makeFilesBrowsable(j *fileops.Journal, homeDir, rootDir string, files ...*cf.ConfigFile) error {
+	for _, file := range files {
+		baseDir := homeDir
+		if file.IsRoot() {
+			baseDir = rootDir
+		}
+		if err := checkpoint(j, "replicate", file, func() error { return file.MakeBrowsable(baseDir) }); err != nil {
 			return errors.WithStack(err)
 		}
 	}
@@ -73,3 +456,71 @@ func MakeFilesBrowsable(baseDir string, files ...*cf.ConfigFile) error {
 
 	return nil
 }
+
+// Returns the path of a replica directory, relative ones are relative to the backup dir (as in `MakeBrowsable`).
+func ReplicaPath(dir string) string {
+	if filepath.IsAbs(dir) {
+		return filepath.Clean(dir)
+	}
+	return filepath.Join(vconfig.GetConfig().BackupDir, dir)
+}
+
+// Removes a replica directory before the files are replicated again.
+// Only directories inside the backup dir are removed, and never the ones cfgrr keeps its own state in.
+func RemoveReplica(dir string) error {
+	backupDir, err := filepath.Abs(vconfig.GetConfig().BackupDir)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	path, err := filepath.Abs(ReplicaPath(dir))
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	if path == backupDir || !isInside(backupDir, path) {
+		return errors.Errorf("refusing to clean %s, only replicas inside the backup dir (%s) are cleaned", path, backupDir)
+	}
+	reserved := []string{".git", filepath.Base(cf.InternalsPath()), cf.HistoryDirName(), JournalDirName, QuarantineDirName, WatchDirName}
+	for _, name := range reserved {
+		if own := filepath.Join(backupDir, name); isInside(path, own) || isInside(own, path) {
+			return errors.Errorf("refusing to clean %s, it holds cfgrr's %s directory", path, name)
+		}
+	}
+	if mapPath, err := filepath.Abs(vconfig.GetConfig().GetMapFilePath()); err == nil && isInside(path, mapPath) {
+		return errors.Errorf("refusing to clean %s, it holds the map file", path)
+	}
+
+	return errors.WithStack(fileops.RemoveAll(path))
+}
+
+// Returns an entry of the path to look it up in the map file by, the path could be a command entry's (e.g. command:dconf).
+func lookupFile(path string) (*cf.ConfigFile, error) {
+	if name, ok := cf.ParseCommandPath(path); ok {
+		return &cf.ConfigFile{Path: name, Kind: cf.KindCommand}, nil
+	}
+	return cf.NewConfigFile(path)
+}
+
+// Finds the map file entries of the given paths.
+// Fails if any of the paths isn't tracked.
+func GetTrackedFiles(paths ...string) ([]*cf.ConfigFile, error) {
+	m, err := mapfile.NewMapFile().Parse()
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	files := make([]*cf.ConfigFile, 0, len(paths))
+	for _, path := range paths {
+		file, err := lookupFile(path)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		tracked, ok := m[file.HashShort()]
+		if !ok {
+			return nil, errors.Errorf("%s isn't tracked by cfgrr", path)
+		}
+		files = append(files, tracked)
+	}
+
+	return files, nil
+}
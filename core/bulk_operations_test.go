@@ -2,10 +2,13 @@ package core
 
 import (
 	"os"
+	"path/filepath"
+	"runtime"
 	"testing"
 
 	cf "github.com/osamaadam/cfgrr/configfile"
 	"github.com/osamaadam/cfgrr/helpers"
+	"github.com/osamaadam/cfgrr/mapfile"
 	"github.com/osamaadam/cfgrr/vconfig"
 )
 
@@ -47,7 +50,7 @@ func TestRestoreFiles(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			files := _setupRestoreEnv(t.TempDir(), t.TempDir(), tt.in)
-			if err := RestoreFiles(files...); err != nil && !tt.expectedErr {
+			if _, err := RestoreFiles(cf.ConflictKeepBoth, nil, files...); err != nil && !tt.expectedErr {
 				t.Errorf("Expected no error, got %s", err)
 			}
 
@@ -63,6 +66,313 @@ func TestRestoreFiles(t *testing.T) {
 	}
 }
 
+func TestRestoreFiles_Conflicts(t *testing.T) {
+	tests := []struct {
+		name        string
+		strategy    cf.ConflictStrategy
+		resolved    cf.ConflictStrategy
+		outAction   cf.RestoreAction
+		wantLinked  bool
+		wantSidecar bool
+	}{
+		{"skip", cf.ConflictSkip, "", cf.RestoreSkipped, false, false},
+		{"overwrite", cf.ConflictOverwrite, "", cf.RestoreOverwritten, true, false},
+		{"keep-both", cf.ConflictKeepBoth, "", cf.RestoreKeptBoth, true, true},
+		{"prompt", cf.ConflictPrompt, cf.ConflictKeepBoth, cf.RestoreKeptBoth, true, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			files := _setupRestoreEnv(t.TempDir(), dir, 2)
+			os.MkdirAll(dir, 0755)
+			os.WriteFile(files[0].PathAbs(), []byte("local"), 0644)
+
+			prompted := 0
+			resolve := func(file *cf.ConfigFile) (cf.ConflictStrategy, error) {
+				prompted++
+				return tt.resolved, nil
+			}
+
+			results, err := RestoreFiles(tt.strategy, resolve, files...)
+			if err != nil {
+				t.Fatalf("Expected no error, got %s", err)
+			}
+			if len(results) != 2 {
+				t.Fatalf("Expected 2 results, got %d", len(results))
+			}
+			if tt.strategy == cf.ConflictPrompt && prompted != 1 {
+				t.Errorf("Expected to be prompted once, got %d", prompted)
+			}
+			if results[0].Action != tt.outAction {
+				t.Errorf("Expected %s, got %s", tt.outAction, results[0].Action)
+			}
+			if results[1].Action != cf.RestoreRestored || !files[1].IsLinked() {
+				t.Errorf("Expected the file without a conflict to be restored, got %s", results[1].Action)
+			}
+			if files[0].IsLinked() != tt.wantLinked {
+				t.Errorf("Expected linked to be %v", tt.wantLinked)
+			}
+			if !tt.wantLinked {
+				if content, _ := os.ReadFile(files[0].PathAbs()); string(content) != "local" {
+					t.Errorf("Expected the live file to be kept, got %q", content)
+				}
+			}
+			if tt.wantSidecar {
+				content, err := os.ReadFile(results[0].Sidecar)
+				if err != nil || string(content) != "local" {
+					t.Errorf("Expected the live file to be kept at %q, got %q, %v", results[0].Sidecar, content, err)
+				}
+			} else if results[0].Sidecar != "" {
+				t.Errorf("Expected no sidecar, got %s", results[0].Sidecar)
+			}
+		})
+	}
+}
+
+func TestDeleteFiles(t *testing.T) {
+	tests := []struct {
+		name     string
+		in       int
+		toDelete int
+	}{
+		{"no files", 0, 0},
+		{"some files sharing a blob", 7, 3},
+		{"all files sharing a blob", 7, 7},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// The files are empty, so they all share the same blob.
+			files := _setupBackupEnv(t.TempDir(), t.TempDir(), tt.in)
+			if err := BackupFiles(files...); err != nil {
+				t.Fatalf("Expected no error, got %s", err)
+			}
+
+			if err := DeleteFiles(true, files[:tt.toDelete]...); err != nil {
+				t.Fatalf("Expected no error, got %s", err)
+			}
+
+			for _, f := range files[:tt.toDelete] {
+				if ok, _ := helpers.CheckIfSymlink(f.PathAbs()); ok {
+					t.Errorf("Expected %s to be restored, but it's still a symlink", f.PathAbs())
+				}
+			}
+			for _, f := range files[tt.toDelete:] {
+				if !helpers.CheckFileExists(f.PathAbs()) {
+					t.Errorf("Expected the shared blob of %s to be kept", f.PathAbs())
+				}
+			}
+			if tt.in > 0 && tt.in == tt.toDelete && helpers.CheckFileExists(files[0].BackupPath()) {
+				t.Errorf("Expected the blob to be deleted with its last file")
+			}
+		})
+	}
+}
+
+func TestRehashFiles(t *testing.T) {
+	tests := []struct {
+		name        string
+		in          int
+		edit        bool
+		outRehashed int
+	}{
+		{"no files", 0, false, 0},
+		{"untouched files", 3, false, 0},
+		{"edited identical file", 3, true, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			files := _setupBackupEnv(t.TempDir(), t.TempDir(), tt.in)
+			if err := BackupFiles(files...); err != nil {
+				t.Fatalf("Expected no error, got %s", err)
+			}
+			if tt.edit {
+				os.WriteFile(files[0].PathAbs(), []byte("edited"), 0644)
+			}
+
+			rehashed, err := RehashFiles(files...)
+			if err != nil {
+				t.Fatalf("Expected no error, got %s", err)
+			}
+			if len(rehashed) != tt.outRehashed {
+				t.Errorf("Expected %d rehashed files, got %d", tt.outRehashed, len(rehashed))
+			}
+
+			m, _ := mapfile.NewMapFile().Parse()
+			for i, f := range files {
+				if intact, err := f.IsIntact(); err != nil || !intact {
+					t.Errorf("Expected %s to be intact, got %v, %v", f.Path, intact, err)
+				}
+				if m[f.HashShort()].Blob != f.Blob {
+					t.Errorf("Expected the map file to reference %s, got %s", f.Blob, m[f.HashShort()].Blob)
+				}
+				// The identical files don't see the edit.
+				if content, _ := os.ReadFile(f.PathAbs()); i > 0 && len(content) != 0 {
+					t.Errorf("Expected %s to be left unchanged, got %q", f.Path, content)
+				}
+			}
+		})
+	}
+}
+
+func TestRehashFiles_SharedLinkedBlob(t *testing.T) {
+	files := _setupBackupEnv(t.TempDir(), t.TempDir(), 2)
+	if err := BackupFiles(files...); err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+
+	// Mimic symlinked files sharing a blob, as they were before they got blobs of their own.
+	digest, _ := files[0].Digest()
+	os.Rename(files[0].BackupPath(), cf.BlobPath(digest))
+	os.Remove(files[1].BackupPath())
+	for _, f := range files {
+		f.Blob = digest
+		os.Remove(f.PathAbs())
+		os.Symlink(f.BackupPath(), f.PathAbs())
+	}
+	mapfile.NewMapFile().AddFiles(files...)
+
+	rehashed, err := RehashFiles(files...)
+	if err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+	if len(rehashed) != 2 || files[0].Blob == files[1].Blob {
+		t.Fatalf("Expected the files to get blobs of their own, got %v", rehashed)
+	}
+	if _, err := os.Stat(cf.BlobPath(digest)); !os.IsNotExist(err) {
+		t.Errorf("Expected the shared blob to be deleted, got %v", err)
+	}
+
+	os.WriteFile(files[0].PathAbs(), []byte("edited"), 0644)
+	if content, _ := os.ReadFile(files[1].PathAbs()); len(content) != 0 {
+		t.Errorf("Expected %s to be left unchanged, got %q", files[1].Path, content)
+	}
+}
+
+func TestRollbackFile(t *testing.T) {
+	files := _setupBackupEnv(t.TempDir(), t.TempDir(), 2)
+	for _, file := range files {
+		os.WriteFile(file.PathAbs(), []byte("a"), 0644)
+	}
+	if err := BackupFiles(files...); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := RelinkFiles(cf.LinkCopy, files[0]); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	sharedBlob := files[1].Blob
+
+	// The edit of the copy isn't pulled into the backup yet.
+	os.WriteFile(files[0].PathAbs(), []byte("b"), 0644)
+	if err := RollbackFile(files[0], 1); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if content, _ := os.ReadFile(files[0].PathAbs()); string(content) != "a" {
+		t.Errorf("expected the copy to be rolled back, got %q", content)
+	}
+	if content, _ := os.ReadFile(files[1].PathAbs()); string(content) != "a" || files[1].Blob != sharedBlob {
+		t.Errorf("expected %s to be left as is, got %q", files[1].Path, content)
+	}
+	if m, _ := mapfile.NewMapFile().Parse(); m[files[0].HashShort()].Blob != files[0].Blob {
+		t.Errorf("expected the map file to reference %s", files[0].Blob)
+	}
+	// The edit is kept as a revision, so the rollback could be undone.
+	if err := RollbackFile(files[0], 2); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if content, _ := os.ReadFile(files[0].PathAbs()); string(content) != "b" {
+		t.Errorf("expected the rollback to be undone, got %q", content)
+	}
+}
+
+func TestRollbackFile_EditedThroughSymlink(t *testing.T) {
+	file := _setupBackupEnv(t.TempDir(), t.TempDir(), 1)[0]
+	os.WriteFile(file.PathAbs(), []byte("one"), 0644)
+	if err := BackupFiles(file); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// The edit goes straight to the blob, which is still named after the old content.
+	os.WriteFile(file.PathAbs(), []byte("two"), 0644)
+	if err := RollbackFile(file, 1); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if content, _ := os.ReadFile(file.PathAbs()); string(content) != "one" {
+		t.Errorf("expected the file to be rolled back, got %q", content)
+	}
+	if ok, err := file.IsIntact(); err != nil || !ok {
+		t.Errorf("expected the blob to be named after its content, got %t, %v", ok, err)
+	}
+	if m, _ := mapfile.NewMapFile().Parse(); m[file.HashShort()].Blob != file.Blob {
+		t.Errorf("expected the map file to reference %s", file.Blob)
+	}
+	if err := RollbackFile(file, 2); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if content, _ := os.ReadFile(file.PathAbs()); string(content) != "two" {
+		t.Errorf("expected the rollback to be undone, got %q", content)
+	}
+}
+
+func TestCommandFiles(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the commands are shell commands")
+	}
+
+	files := _setupBackupEnv(t.TempDir(), t.TempDir(), 1)
+	state := filepath.Join(t.TempDir(), "crontab")
+	os.WriteFile(state, []byte("@daily backup\n"), 0644)
+	command, _ := cf.NewCommandFile("crontab", "cat "+state, "cat > "+state)
+	files = append(files, command)
+
+	if err := BackupFiles(files...); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	tracked, err := GetTrackedFiles("command:crontab")
+	if err != nil || len(tracked) != 1 || tracked[0].Load != command.Load {
+		t.Fatalf("expected the command entry to be tracked, got %v, %v", tracked, err)
+	}
+
+	// Syncing stores the new output of the dump command.
+	os.WriteFile(state, []byte("@hourly backup\n"), 0644)
+	oldBlob := command.Blob
+	if err := SyncFiles(files...); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	m, _ := mapfile.NewMapFile().Parse()
+	if synced := m[command.HashShort()]; synced.Blob == oldBlob {
+		t.Errorf("expected the new output to be stored")
+	}
+	if _, err := os.Stat(cf.BlobPath(oldBlob)); err == nil {
+		t.Errorf("expected the replaced blob to be removed")
+	}
+
+	statuses, err := Status(helpers.GetMapValues(m)...)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, status := range statuses {
+		if len(status.Drifts) > 0 {
+			t.Errorf("expected %s to be in sync, got %v", status.File.PathAbs(), status.Drifts)
+		}
+	}
+
+	// Deleting the entry leaves the state as is.
+	if err := DeleteFiles(true, command); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if content, _ := os.ReadFile(state); string(content) != "@hourly backup\n" {
+		t.Errorf("expected the state to be left as is, got %q", content)
+	}
+	if m, _ := mapfile.NewMapFile().Parse(); len(m) != 1 {
+		t.Errorf("expected only the file to be left in the map file, got %d entries", len(m))
+	}
+}
+
 func _setupBackupEnv(backupDir, dir string, num int) []*cf.ConfigFile {
 	c := vconfig.GetConfig()
 	c.SetBackupDir(backupDir)
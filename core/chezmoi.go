@@ -0,0 +1,381 @@
+package core
+
+import (
+	"bufio"
+	"bytes"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	cf "github.com/osamaadam/cfgrr/configfile"
+	"github.com/osamaadam/cfgrr/fileops"
+	"github.com/pkg/errors"
+)
+
+const (
+	// The file naming the directory of the source state, relative to the source directory.
+	chezmoiRootFile = ".chezmoiroot"
+	// The file listing the targets chezmoi doesn't manage.
+	chezmoiIgnoreFile = ".chezmoiignore"
+)
+
+// The attribute prefixes of the source files' names, in any order before "dot_".
+var chezmoiFilePrefixes = []string{
+	"after_", "before_", "once_", "onchange_", "run_", "create_", "modify_", "remove_", "symlink_",
+	"encrypted_", "private_", "readonly_", "empty_", "executable_",
+}
+
+// The attribute prefixes of the source directories' names.
+var chezmoiDirPrefixes = []string{"exact_", "external_", "private_", "readonly_", "remove_"}
+
+// The suffixes of encrypted source files.
+var chezmoiEncryptedSuffixes = []string{".age", ".asc"}
+
+// The variables of chezmoi's templates, and their equivalent in cfgrr's.
+var chezmoiTemplateVars = map[string]string{
+	"hostname": ".Hostname",
+	"os":       ".OS",
+	"arch":     ".Arch",
+	"username": ".User",
+	"homeDir":  ".Home",
+	"homedir":  ".Home",
+}
+
+var (
+	templateActionRegexp = regexp.MustCompile(`(?s)\{\{.*?\}\}`)
+	chezmoiVarRegexp     = regexp.MustCompile(`\.chezmoi\.(\w+)`)
+	chezmoiEnvRegexp     = regexp.MustCompile(`\benv\s+("[^"]*")`)
+)
+
+// The target name and the attributes encoded in the name of a chezmoi source file or directory.
+type chezmoiName struct {
+	name  string
+	attrs map[string]bool
+}
+
+func (n chezmoiName) is(attrs ...string) bool {
+	for _, attr := range attrs {
+		if n.attrs[attr] {
+			return true
+		}
+	}
+	return false
+}
+
+// Decodes the attribute prefixes and suffixes of a source name, like chezmoi.
+func decodeChezmoiName(name string, isDir bool) chezmoiName {
+	decoded := chezmoiName{attrs: make(map[string]bool)}
+	prefixes := chezmoiFilePrefixes
+	if isDir {
+		prefixes = chezmoiDirPrefixes
+	}
+
+prefixes:
+	for {
+		switch {
+		case strings.HasPrefix(name, "literal_"):
+			name = strings.TrimPrefix(name, "literal_")
+			break prefixes
+		case strings.HasPrefix(name, "dot_"):
+			name = "." + strings.TrimPrefix(name, "dot_")
+			break prefixes
+		}
+
+		matched := false
+		for _, prefix := range prefixes {
+			if strings.HasPrefix(name, prefix) {
+				decoded.attrs[strings.TrimSuffix(prefix, "_")] = true
+				name = strings.TrimPrefix(name, prefix)
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			break
+		}
+	}
+
+	if !isDir {
+		if strings.HasSuffix(name, ".literal") {
+			name = strings.TrimSuffix(name, ".literal")
+		} else {
+			if decoded.is("encrypted") {
+				for _, suffix := range chezmoiEncryptedSuffixes {
+					name = strings.TrimSuffix(name, suffix)
+				}
+			}
+			if strings.HasSuffix(name, ".tmpl") {
+				decoded.attrs["tmpl"] = true
+				name = strings.TrimSuffix(name, ".tmpl")
+			}
+		}
+	}
+
+	decoded.name = name
+	return decoded
+}
+
+// Lists the files of the chezmoi source directory `sourceDir`, as chezmoi would apply them into `target`.
+// The attributes of the files' names are decoded into their paths and permissions.
+// The templates are converted to cfgrr's, and the encrypted files are imported from their decrypted live copy, encrypted with cfgrr's key.
+// What cfgrr can't express (scripts, symlinks, templates using chezmoi's data or functions, and files changed since they were applied) is skipped.
+// The targets ignored by chezmoi aren't listed at all.
+func ChezmoiImports(sourceDir, target string) ([]Import, []Skipped, error) {
+	root := sourceDir
+	if content, err := os.ReadFile(filepath.Join(sourceDir, chezmoiRootFile)); err == nil {
+		root = filepath.Join(sourceDir, strings.TrimSpace(string(content)))
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return nil, nil, errors.WithStack(err)
+	}
+
+	ignores, err := readChezmoiIgnores(root)
+	if err != nil {
+		return nil, nil, errors.WithStack(err)
+	}
+
+	var imports []Import
+	var skipped []Skipped
+	// The target path of each walked source directory, and whether its names are literal.
+	targets := map[string]string{root: ""}
+	literal := map[string]bool{}
+	// The permissions of the walked source directories whose attributes change them.
+	dirPerms := map[string]os.FileMode{}
+	err = filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		if path == root {
+			return nil
+		}
+		// The special files, and the hidden ones (e.g. .git), aren't part of the source state.
+		if strings.HasPrefix(d.Name(), ".") {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		parent := filepath.Dir(path)
+		decoded := chezmoiName{name: d.Name(), attrs: map[string]bool{}}
+		if !literal[parent] {
+			decoded = decodeChezmoiName(d.Name(), d.IsDir())
+		}
+		rel := filepath.Join(targets[parent], decoded.name)
+
+		if chezmoiIgnored(ignores, rel) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		if d.IsDir() {
+			if decoded.is("remove") {
+				skipped = append(skipped, Skipped{path, "chezmoi removes it, there's nothing to track"})
+				return filepath.SkipDir
+			}
+			targets[path] = rel
+			literal[path] = literal[parent] || decoded.is("external")
+			if decoded.is("private") || decoded.is("readonly") {
+				dirPerms[path] = chezmoiPerm(decoded, true)
+			}
+			return nil
+		}
+
+		if !d.Type().IsRegular() {
+			skipped = append(skipped, Skipped{path, "isn't a regular file"})
+			return nil
+		}
+
+		imp, reason, err := chezmoiImport(path, filepath.Join(target, rel), decoded)
+		if err != nil {
+			return errors.WithMessagef(err, "couldn't import %s", path)
+		}
+		if reason != "" {
+			skipped = append(skipped, Skipped{path, reason})
+			return nil
+		}
+		for dir := parent; dir != root; dir = filepath.Dir(dir) {
+			if perm, ok := dirPerms[dir]; ok {
+				if imp.DirPerms == nil {
+					imp.DirPerms = make(map[string]os.FileMode)
+				}
+				imp.DirPerms[filepath.Join(target, targets[dir])] = perm
+			}
+		}
+		imports = append(imports, *imp)
+
+		return nil
+	})
+	if err != nil {
+		return nil, nil, errors.WithStack(err)
+	}
+
+	return imports, skipped, nil
+}
+
+// Returns how the source file is imported, or why it can't be.
+func chezmoiImport(source, live string, decoded chezmoiName) (*Import, string, error) {
+	switch {
+	case decoded.is("after", "before", "once", "onchange", "run"):
+		return nil, "a script, cfgrr doesn't run scripts", nil
+	case decoded.is("modify"):
+		return nil, "a modify script, cfgrr doesn't run scripts", nil
+	case decoded.is("remove"):
+		return nil, "chezmoi removes it, there's nothing to track", nil
+	case decoded.is("symlink"):
+		return nil, "a symlink, cfgrr doesn't track symlinks", nil
+	case decoded.is("encrypted") && decoded.is("tmpl"):
+		return nil, "an encrypted template, cfgrr can't encrypt templates", nil
+	}
+
+	file, err := cf.NewConfigFile(live)
+	if err != nil {
+		return nil, "", errors.WithStack(err)
+	}
+	imp := &Import{Source: source, File: file, Perm: chezmoiPerm(decoded, false)}
+
+	var liveContent []byte
+	info, err := fileops.Lstat(live)
+	if err == nil {
+		if !info.Mode().IsRegular() {
+			return nil, "the live file isn't a regular file", nil
+		}
+		if liveContent, err = fileops.ReadFile(live); err != nil {
+			return nil, "", errors.WithStack(err)
+		}
+		imp.Deployed = true
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return nil, "", errors.WithStack(err)
+	}
+
+	if decoded.is("encrypted") {
+		if liveContent == nil {
+			return nil, "encrypted with chezmoi's key, run 'chezmoi apply' to decrypt it first", nil
+		}
+		// The decrypted copy is imported, and encrypted with cfgrr's key.
+		imp.Content = liveContent
+		if err := file.SetEncrypted(true); err != nil {
+			return nil, "", errors.WithStack(err)
+		}
+		return imp, "", nil
+	}
+
+	content, err := fileops.ReadFile(source)
+	if err != nil {
+		return nil, "", errors.WithStack(err)
+	}
+	applied := content
+
+	if decoded.is("tmpl") {
+		converted := convertChezmoiTemplate(content)
+		if applied, err = cf.RenderTemplate(live, converted); err != nil {
+			return nil, "a template cfgrr can't express: " + errors.Cause(err).Error(), nil
+		}
+		imp.Content = converted
+		if err := file.SetTemplate(true); err != nil {
+			return nil, "", errors.WithStack(err)
+		}
+	}
+
+	if liveContent != nil && !bytes.Equal(liveContent, applied) {
+		if decoded.is("create") {
+			// chezmoi only creates the file, the live one holds the latest content.
+			imp.Content = liveContent
+			return imp, "", nil
+		}
+		return nil, "the live file changed since it was applied, run 'chezmoi apply' or 'chezmoi re-add' first", nil
+	}
+
+	return imp, "", nil
+}
+
+// Returns the permissions chezmoi applies the file (or directory) with, assuming the usual umask of 022.
+func chezmoiPerm(decoded chezmoiName, isDir bool) os.FileMode {
+	perm := os.FileMode(0644)
+	if isDir || decoded.is("executable") {
+		perm = 0755
+	}
+	if decoded.is("private") {
+		perm &^= 0077
+	}
+	if decoded.is("readonly") {
+		perm &^= 0222
+	}
+	return perm
+}
+
+// Replaces the variables of chezmoi's template with cfgrr's equivalent ones.
+// The rest is left as is, and fails to render if cfgrr doesn't support it.
+func convertChezmoiTemplate(content []byte) []byte {
+	return templateActionRegexp.ReplaceAllFunc(content, func(action []byte) []byte {
+		action = chezmoiVarRegexp.ReplaceAllFunc(action, func(ref []byte) []byte {
+			name := chezmoiVarRegexp.FindSubmatch(ref)[1]
+			if replacement, ok := chezmoiTemplateVars[string(name)]; ok {
+				return []byte(replacement)
+			}
+			return ref
+		})
+		return chezmoiEnvRegexp.ReplaceAll(action, []byte(`index .Env $1`))
+	})
+}
+
+// A pattern of the chezmoi ignore file.
+type chezmoiIgnore struct {
+	pattern string
+	// Excluded targets aren't ignored, even if other patterns match them.
+	exclude bool
+}
+
+// Reads the ignore file of the source directory, rendering it first if it's a template.
+func readChezmoiIgnores(root string) ([]chezmoiIgnore, error) {
+	path := filepath.Join(root, chezmoiIgnoreFile)
+	content, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	if bytes.Contains(content, []byte("{{")) {
+		if content, err = cf.RenderTemplate(path, convertChezmoiTemplate(content)); err != nil {
+			return nil, errors.WithStack(err)
+		}
+	}
+
+	var ignores []chezmoiIgnore
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		ignore := chezmoiIgnore{pattern: strings.TrimPrefix(line, "!"), exclude: strings.HasPrefix(line, "!")}
+		ignores = append(ignores, ignore)
+	}
+
+	return ignores, nil
+}
+
+// Checks whether chezmoi ignores the target, or one of its parent directories.
+func chezmoiIgnored(ignores []chezmoiIgnore, rel string) bool {
+	ignored := false
+	for p := filepath.ToSlash(rel); p != "." && p != "/"; p = filepath.ToSlash(filepath.Dir(p)) {
+		for _, ignore := range ignores {
+			if !CheckIfGlobsMatch(p, ignore.pattern) {
+				continue
+			}
+			if ignore.exclude {
+				return false
+			}
+			ignored = true
+		}
+	}
+	return ignored
+}
@@ -0,0 +1,162 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	cf "github.com/osamaadam/cfgrr/configfile"
+	"github.com/osamaadam/cfgrr/crypt"
+	"github.com/osamaadam/cfgrr/mapfile"
+	"github.com/osamaadam/cfgrr/vconfig"
+)
+
+func TestDecodeChezmoiName(t *testing.T) {
+	tests := []struct {
+		name  string
+		isDir bool
+		want  string
+		attrs []string
+	}{
+		{"dot_bashrc", false, ".bashrc", nil},
+		{"private_dot_ssh", true, ".ssh", []string{"private"}},
+		{"executable_hello", false, "hello", []string{"executable"}},
+		{"private_readonly_dot_netrc.tmpl", false, ".netrc", []string{"private", "readonly", "tmpl"}},
+		{"encrypted_private_dot_token.age", false, ".token", []string{"encrypted", "private"}},
+		{"literal_dot_keep", false, "dot_keep", nil},
+		{"dot_config.tmpl.literal", false, ".config.tmpl", nil},
+		{"run_once_install.sh", false, "install.sh", []string{"run", "once"}},
+		{"exact_dot_vim", true, ".vim", []string{"exact"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := decodeChezmoiName(tt.name, tt.isDir)
+			if got.name != tt.want {
+				t.Errorf("expected the name %q, got %q", tt.want, got.name)
+			}
+			if len(got.attrs) != len(tt.attrs) {
+				t.Errorf("expected the attributes %v, got %v", tt.attrs, got.attrs)
+			}
+			for _, attr := range tt.attrs {
+				if !got.is(attr) {
+					t.Errorf("expected the attribute %s, got %v", attr, got.attrs)
+				}
+			}
+		})
+	}
+}
+
+func TestImportChezmoi(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv(crypt.PassphraseEnv, "hunter2")
+	vconfig.GetConfig().SetBackupDir(filepath.Join(home, "backup"))
+	sourceDir := filepath.Join(home, ".local", "share", "chezmoi")
+
+	source := map[string]string{
+		"dot_bashrc":                     "alias ll='ls -l'",
+		"private_dot_ssh/private_config": "Host *",
+		"dot_local/bin/executable_hello": "echo hello",
+		"dot_gitconfig.tmpl":             "[user]\n\tname = {{ .chezmoi.username }}",
+		"dot_npmrc.tmpl":                 "email={{ .email }}",
+		"encrypted_dot_token.age":        "ciphertext",
+		"symlink_dot_vimrc":              ".config/nvim/init.vim",
+		"run_once_install.sh":            "exit 0",
+		"dot_zshrc":                      "export EDITOR=vim",
+		"README.md":                      "not applied",
+		".chezmoiignore":                 "README.md",
+	}
+	for path, content := range source {
+		path = filepath.Join(sourceDir, path)
+		os.MkdirAll(filepath.Dir(path), 0755)
+		os.WriteFile(path, []byte(content), 0644)
+	}
+	// What chezmoi applied, the .zshrc was changed since.
+	live := map[string]string{
+		".bashrc": "alias ll='ls -l'",
+		".token":  "s3cret",
+		".zshrc":  "export EDITOR=nano",
+	}
+	for path, content := range live {
+		os.WriteFile(filepath.Join(home, path), []byte(content), 0644)
+	}
+
+	imports, skipped, err := ChezmoiImports(sourceDir, home)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var skippedNames []string
+	for _, s := range skipped {
+		skippedNames = append(skippedNames, filepath.Base(s.Source))
+	}
+	sort.Strings(skippedNames)
+	wantSkipped := []string{"dot_npmrc.tmpl", "dot_zshrc", "run_once_install.sh", "symlink_dot_vimrc"}
+	if strings.Join(skippedNames, " ") != strings.Join(wantSkipped, " ") {
+		t.Errorf("expected %v to be skipped, got %v", wantSkipped, skippedNames)
+	}
+
+	if _, err := ImportFiles(sourceDir, imports...); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	m, err := mapfile.NewMapFile().Parse()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(m) != 5 {
+		t.Errorf("expected 5 entries, got %d", len(m))
+	}
+
+	tests := []struct {
+		path    string
+		perm    os.FileMode
+		content string
+	}{
+		{".bashrc", 0644, "alias ll='ls -l'"},
+		{filepath.Join(".ssh", "config"), 0600, "Host *"},
+		// The directory is private too, as chezmoi would apply it.
+		{".ssh", 0700, ""},
+		{filepath.Join(".local", "bin", "hello"), 0755, "echo hello"},
+		{".gitconfig", 0644, "[user]\n\tname = " + cf.NewTemplateData().User},
+		{".token", 0644, "s3cret"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			path := filepath.Join(home, tt.path)
+			info, err := os.Stat(path)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if info.Mode().Perm() != tt.perm {
+				t.Errorf("expected the mode %v, got %v", tt.perm, info.Mode().Perm())
+			}
+			content, _ := os.ReadFile(path)
+			if string(content) != tt.content {
+				t.Errorf("expected %q, got %q", tt.content, content)
+			}
+		})
+	}
+
+	for _, file := range m {
+		switch file.Path {
+		case ".gitconfig":
+			backup, _ := os.ReadFile(file.BackupPath())
+			if !file.Template || !strings.Contains(string(backup), "{{ .User }}") {
+				t.Errorf("expected .gitconfig to be converted into a template, got %q", backup)
+			}
+		case ".token":
+			if !file.Encrypted {
+				t.Errorf("expected .token to be encrypted")
+			}
+		}
+	}
+	if _, err := os.Stat(filepath.Join(sourceDir, "dot_bashrc")); !os.IsNotExist(err) {
+		t.Errorf("expected the imported source to be moved, got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(sourceDir, "dot_zshrc")); err != nil {
+		t.Errorf("expected the skipped source to be left, got %v", err)
+	}
+}
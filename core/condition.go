@@ -0,0 +1,42 @@
+package core
+
+import (
+	cf "github.com/osamaadam/cfgrr/configfile"
+	"github.com/osamaadam/cfgrr/mapfile"
+	"github.com/pkg/errors"
+)
+
+// An entry that doesn't belong on the current machine, with why.
+type Inapplicable struct {
+	File   *cf.ConfigFile
+	Reason string
+}
+
+// Splits the files into the ones whose conditions hold on the current machine, and the others.
+func SplitApplicable(files ...*cf.ConfigFile) (applicable []*cf.ConfigFile, inapplicable []Inapplicable) {
+	for _, file := range files {
+		if reason := file.Unmet(); reason != "" {
+			inapplicable = append(inapplicable, Inapplicable{File: file, Reason: reason})
+			continue
+		}
+		applicable = append(applicable, file)
+	}
+	return applicable, inapplicable
+}
+
+// Sets the conditions of the files, an empty condition clears them.
+// The map file is updated, the live files are left as they are.
+func ConditionFiles(condition *cf.Condition, files ...*cf.ConfigFile) error {
+	if condition.IsEmpty() {
+		condition = nil
+	}
+	for _, file := range files {
+		file.When = condition
+	}
+
+	if err := mapfile.NewMapFile().AddFiles(files...); err != nil {
+		return errors.WithStack(err)
+	}
+
+	return nil
+}
@@ -0,0 +1,355 @@
+package core
+
+import (
+	"bytes"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	cf "github.com/osamaadam/cfgrr/configfile"
+	"github.com/osamaadam/cfgrr/fileops"
+	"github.com/osamaadam/cfgrr/mapfile"
+	"github.com/osamaadam/cfgrr/vconfig"
+	"github.com/pkg/errors"
+)
+
+// One side of a comparison, missing versions are empty.
+type Version struct {
+	Content []byte
+	Exists  bool
+}
+
+// A file whose two versions differ.
+type FileDiff struct {
+	File *cf.ConfigFile
+	// The path of the compared file, each file inside a tracked directory is compared on its own.
+	Path     string
+	From, To Version
+	// Why the versions can't be compared line by line, e.g. the live file is a directory.
+	Note string
+}
+
+// Compares the backup of each file with the live file.
+// What restoring the file would put in place (i.e. the rendered and decrypted backup) is compared, so the live file being a copy rather than a link makes no difference.
+// The backups of command entries are compared with the output of their dump command.
+// The files in sync, and the ones that don't belong on this machine, are left out.
+func DiffLive(files ...*cf.ConfigFile) ([]FileDiff, error) {
+	var diffs []FileDiff
+	for _, file := range files {
+		if file.Unmet() != "" || !file.IsCommand() && file.IsLinked() {
+			continue
+		}
+
+		fileDiffs, err := diffLive(file)
+		if err != nil {
+			return nil, errors.WithMessagef(err, "couldn't compare %s with its backup", file.PathAbs())
+		}
+		diffs = append(diffs, fileDiffs...)
+	}
+
+	return diffs, nil
+}
+
+func diffLive(file *cf.ConfigFile) ([]FileDiff, error) {
+	if file.IsCommand() {
+		return diffCommand(file)
+	}
+
+	info, err := fileops.Stat(file.PathAbs())
+	liveExists := err == nil
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, errors.WithStack(err)
+	}
+
+	if file.IsDir() {
+		if liveExists && !info.IsDir() {
+			return []FileDiff{{File: file, Path: file.PathAbs(), Note: fmt.Sprintf("%s is a file, the backup is a directory", file.PathAbs())}}, nil
+		}
+		backup, err := readTree(fileops.Locate(file.BackupPath()))
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		live := map[string][]byte{}
+		if liveExists {
+			// The root is walked even if it's a symlink to a directory.
+			root, err := filepath.EvalSymlinks(file.PathAbs())
+			if err != nil {
+				return nil, errors.WithStack(err)
+			}
+			if live, err = readTree(root); err != nil {
+				return nil, errors.WithStack(err)
+			}
+		}
+		return diffTrees(file, backup, live), nil
+	}
+
+	if liveExists && info.IsDir() {
+		return []FileDiff{{File: file, Path: file.PathAbs(), Note: fmt.Sprintf("%s is a directory", file.PathAbs())}}, nil
+	}
+
+	var from, to Version
+	if from.Content, err = file.Content(); err == nil {
+		from.Exists = true
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return nil, errors.WithStack(err)
+	}
+	if liveExists {
+		if to.Content, err = fileops.ReadFile(file.PathAbs()); err != nil {
+			return nil, errors.WithStack(err)
+		}
+		to.Exists = true
+	}
+
+	return diffVersions(file, file.PathAbs(), from, to), nil
+}
+
+// Compares the backup of the command entry with the current output of its dump command.
+func diffCommand(file *cf.ConfigFile) ([]FileDiff, error) {
+	var from, to Version
+	var err error
+	if from.Content, err = file.Content(); err == nil {
+		from.Exists = true
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return nil, errors.WithStack(err)
+	}
+	if to.Content, err = file.DumpContent(); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	to.Exists = true
+
+	return diffVersions(file, file.PathAbs(), from, to), nil
+}
+
+// Compares the backup of each file as of the git revision of the backup dir (e.g. HEAD~3, or origin/main) with its current backup.
+// The backups are compared as they're stored, only decrypted, templates aren't rendered.
+// The entries are looked up in the map file of the revision, so the files backed up since are compared with nothing.
+func DiffRevision(rev string, files ...*cf.ConfigFile) ([]FileDiff, error) {
+	tree, err := revisionTree(rev)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	backupDir := vconfig.GetConfig().BackupDir
+	treePath := func(path string) string {
+		rel, _ := filepath.Rel(backupDir, path)
+		return filepath.ToSlash(rel)
+	}
+
+	mapFilePath := vconfig.GetConfig().GetMapFilePath()
+	old := make(map[string]*cf.ConfigFile)
+	if mapFile, err := tree.File(treePath(mapFilePath)); err == nil {
+		content, err := mapFile.Contents()
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		if old, err = mapfile.ParseContent(mapFilePath, []byte(content)); err != nil {
+			return nil, errors.WithMessagef(err, "couldn't parse the map file of %s", rev)
+		}
+	} else if !errors.Is(err, object.ErrFileNotFound) {
+		return nil, errors.WithStack(err)
+	}
+
+	var diffs []FileDiff
+	for _, file := range files {
+		past, ok := old[file.HashShort()]
+		if ok && !past.SamePath(file) {
+			past = nil
+		}
+
+		if past != nil && past.IsDir() != file.IsDir() {
+			diffs = append(diffs, FileDiff{File: file, Path: file.PathAbs(), Note: fmt.Sprintf("%s changed between a file and a directory since %s", file.PathAbs(), rev)})
+			continue
+		}
+
+		if file.IsDir() {
+			from := map[string][]byte{}
+			if past != nil {
+				if from, err = readRevisionTree(tree, treePath(past.BackupPath())); err != nil {
+					return nil, errors.WithMessagef(err, "couldn't read the backup of %s in %s", file.PathAbs(), rev)
+				}
+			}
+			to, err := readTree(fileops.Locate(file.BackupPath()))
+			if err != nil {
+				return nil, errors.WithStack(err)
+			}
+			diffs = append(diffs, diffTrees(file, from, to)...)
+			continue
+		}
+
+		var from, to Version
+		if past != nil {
+			pastFile, err := tree.File(treePath(past.BackupPath()))
+			if err == nil {
+				content, err := pastFile.Contents()
+				if err != nil {
+					return nil, errors.WithStack(err)
+				}
+				if from.Content, err = past.Decrypt([]byte(content)); err != nil {
+					return nil, errors.WithStack(err)
+				}
+				from.Exists = true
+			} else if !errors.Is(err, object.ErrFileNotFound) {
+				return nil, errors.WithStack(err)
+			}
+		}
+		content, err := fileops.ReadFile(file.BackupPath())
+		if err == nil {
+			if to.Content, err = file.Decrypt(content); err != nil {
+				return nil, errors.WithStack(err)
+			}
+			to.Exists = true
+		} else if !errors.Is(err, os.ErrNotExist) {
+			return nil, errors.WithStack(err)
+		}
+
+		diffs = append(diffs, diffVersions(file, file.PathAbs(), from, to)...)
+	}
+
+	return diffs, nil
+}
+
+// Returns the name of the branch of the remote (as last fetched) the backup dir is pushed to, as a revision (e.g. origin/main).
+func RemoteRevision() (string, error) {
+	config := vconfig.GetConfig()
+	branch := config.GitBranch
+	if branch == "" {
+		repo, err := openBackupRepo()
+		if err != nil {
+			return "", errors.WithStack(err)
+		}
+		head, err := repo.Head()
+		if err != nil {
+			return "", errors.WithMessage(err, "couldn't find the current branch of the backup dir's repository")
+		}
+		branch = head.Name().Short()
+	}
+
+	return config.GitRemote + "/" + branch, nil
+}
+
+// Fetches the branches of the remote into the backup dir's repository.
+func FetchRemote() error {
+	repo, err := openBackupRepo()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	remote := vconfig.GetConfig().GitRemote
+	if err := repo.Fetch(&git.FetchOptions{RemoteName: remote}); err != nil && !errors.Is(err, git.NoErrAlreadyUpToDate) {
+		return errors.WithMessagef(err, "couldn't fetch from %s", remote)
+	}
+
+	return nil
+}
+
+func openBackupRepo() (*git.Repository, error) {
+	repo, err := git.PlainOpen(vconfig.GetConfig().BackupDir)
+	if errors.Is(err, git.ErrRepositoryNotExists) {
+		return nil, errors.New("the backup dir isn't a git repository, run 'cfgrr push' first")
+	}
+	return repo, errors.WithStack(err)
+}
+
+// Returns the tree of the backup dir at the git revision.
+func revisionTree(rev string) (*object.Tree, error) {
+	repo, err := openBackupRepo()
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	hash, err := repo.ResolveRevision(plumbing.Revision(rev))
+	if err != nil {
+		return nil, errors.WithMessagef(err, "couldn't resolve the revision %s", rev)
+	}
+	commit, err := repo.CommitObject(*hash)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return commit.Tree()
+}
+
+// Reads the regular files of the directory, by their paths relative to it.
+// A missing directory has no files.
+func readTree(root string) (map[string][]byte, error) {
+	files := make(map[string][]byte)
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if path == root && errors.Is(err, os.ErrNotExist) {
+				return filepath.SkipAll
+			}
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(root, path)
+		files[rel] = content
+		return nil
+	})
+
+	return files, errors.WithStack(err)
+}
+
+// Reads the files of the directory of the git tree, by their paths relative to it.
+func readRevisionTree(tree *object.Tree, dir string) (map[string][]byte, error) {
+	files := make(map[string][]byte)
+	subtree, err := tree.Tree(dir)
+	if errors.Is(err, object.ErrDirectoryNotFound) {
+		return files, nil
+	} else if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	err = subtree.Files().ForEach(func(f *object.File) error {
+		content, err := f.Contents()
+		if err != nil {
+			return err
+		}
+		files[filepath.FromSlash(f.Name)] = []byte(content)
+		return nil
+	})
+
+	return files, errors.WithStack(err)
+}
+
+// Compares the files of two versions of a tracked directory.
+func diffTrees(file *cf.ConfigFile, from, to map[string][]byte) []FileDiff {
+	paths := make([]string, 0, len(from)+len(to))
+	for path := range from {
+		paths = append(paths, path)
+	}
+	for path := range to {
+		if _, ok := from[path]; !ok {
+			paths = append(paths, path)
+		}
+	}
+	sort.Strings(paths)
+
+	var diffs []FileDiff
+	for _, path := range paths {
+		fromContent, fromExists := from[path]
+		toContent, toExists := to[path]
+		diffs = append(diffs, diffVersions(file, filepath.Join(file.PathAbs(), path),
+			Version{fromContent, fromExists}, Version{toContent, toExists})...)
+	}
+
+	return diffs
+}
+
+// Returns the diff of the versions, or nothing if they're identical.
+func diffVersions(file *cf.ConfigFile, path string, from, to Version) []FileDiff {
+	if from.Exists == to.Exists && bytes.Equal(from.Content, to.Content) {
+		return nil
+	}
+	return []FileDiff{{File: file, Path: path, From: from, To: to}}
+}
@@ -0,0 +1,101 @@
+package core
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/osamaadam/cfgrr/vconfig"
+)
+
+func TestDiffLive(t *testing.T) {
+	backupDir := t.TempDir()
+	files := _setupBackupEnv(backupDir, t.TempDir(), 3)
+	for i, file := range files {
+		os.WriteFile(file.PathAbs(), []byte{'a' + byte(i), '\n'}, 0644)
+	}
+	if err := BackupFiles(files...); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	diffs, err := DiffLive(files...)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(diffs) != 0 {
+		t.Fatalf("expected the linked files not to differ, got %d diffs", len(diffs))
+	}
+
+	// Saved in place of the symlink, and removed.
+	os.Remove(files[0].PathAbs())
+	os.WriteFile(files[0].PathAbs(), []byte("edited\n"), 0644)
+	os.Remove(files[1].PathAbs())
+
+	diffs, err = DiffLive(files...)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(diffs) != 2 {
+		t.Fatalf("expected 2 diffs, got %d", len(diffs))
+	}
+	if diffs[0].Path != files[0].PathAbs() || string(diffs[0].From.Content) != "a\n" || string(diffs[0].To.Content) != "edited\n" {
+		t.Errorf("expected %s to be compared with its backup, got %+v", files[0].Path, diffs[0])
+	}
+	if diffs[1].Path != files[1].PathAbs() || !diffs[1].From.Exists || diffs[1].To.Exists {
+		t.Errorf("expected %s to be missing, got %+v", files[1].Path, diffs[1])
+	}
+}
+
+func TestDiffRevision(t *testing.T) {
+	backupDir := t.TempDir()
+	files := _setupBackupEnv(backupDir, t.TempDir(), 2)
+	os.WriteFile(files[0].PathAbs(), []byte("pushed\n"), 0644)
+	if err := BackupFiles(files[0]); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	repo, err := git.PlainInit(vconfig.GetConfig().BackupDir, false)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	w, _ := repo.Worktree()
+	w.Add(".")
+	signature := &object.Signature{Name: "test", Email: "test@example.com", When: time.Now()}
+	if _, err := w.Commit("push", &git.CommitOptions{Author: signature}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// The edit is moved to a new blob, and a file is backed up after the commit.
+	os.WriteFile(files[0].PathAbs(), []byte("edited\n"), 0644)
+	os.WriteFile(files[1].PathAbs(), []byte("new\n"), 0644)
+	if err := SyncFiles(files[0]); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := BackupFiles(files[1]); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	tracked, err := GetTrackedFiles(files[0].PathAbs(), files[1].PathAbs())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	diffs, err := DiffRevision("HEAD", tracked...)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(diffs) != 2 {
+		t.Fatalf("expected 2 diffs, got %d", len(diffs))
+	}
+	if string(diffs[0].From.Content) != "pushed\n" || string(diffs[0].To.Content) != "edited\n" {
+		t.Errorf("expected the pushed backup of %s to be compared with the current one, got %+v", files[0].Path, diffs[0])
+	}
+	if diffs[1].From.Exists || string(diffs[1].To.Content) != "new\n" {
+		t.Errorf("expected %s to be new since the commit, got %+v", files[1].Path, diffs[1])
+	}
+
+	if _, err := DiffRevision("nope", tracked...); err == nil {
+		t.Errorf("expected an unknown revision to fail")
+	}
+}
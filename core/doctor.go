@@ -0,0 +1,415 @@
+package core
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	cf "github.com/osamaadam/cfgrr/configfile"
+	"github.com/osamaadam/cfgrr/fileops"
+	"github.com/osamaadam/cfgrr/helpers"
+	"github.com/osamaadam/cfgrr/ignorefile"
+	"github.com/osamaadam/cfgrr/mapfile"
+	"github.com/osamaadam/cfgrr/vconfig"
+	"github.com/pkg/errors"
+)
+
+// What `doctor --fix` removes, but could lose data, is moved into this directory of the backup dir.
+const QuarantineDirName = ".quarantine"
+
+// The replica directories checked by the doctor, the defaults of `replicate`.
+var replicaDirs = []string{"home", "root"}
+
+type Severity string
+
+const (
+	// Data is missing, or cfgrr can't work as expected.
+	SeverityError Severity = "error"
+	// Leftovers, nothing is lost.
+	SeverityWarning Severity = "warning"
+)
+
+// A problem found by a doctor check.
+type Finding struct {
+	Check    string
+	Severity Severity
+	Path     string
+	Problem  string
+	// What fixing the problem does, empty if it can't be fixed safely.
+	Remedy string
+	fix    func() error
+}
+
+func (f *Finding) Fixable() bool {
+	return f.fix != nil
+}
+
+// Fixes the problem, see `Remedy`.
+func (f *Finding) Fix() error {
+	if f.fix == nil {
+		return errors.Errorf("%s can't be fixed safely", f.Path)
+	}
+	return errors.WithStack(f.fix())
+}
+
+type DoctorCheck struct {
+	Name        string
+	Description string
+	run         func(env *doctorEnv) ([]*Finding, error)
+}
+
+var DoctorChecks = []DoctorCheck{
+	{"pending-journal", "an interrupted operation left its journal behind", checkPendingJournal},
+	{"missing-backup", "map file entries whose backup file is missing", checkMissingBackups},
+	{"orphaned-backup", "backup files in .internals that no map file entry uses", checkOrphanedBackups},
+	{"stale-replica", "files in the replica that aren't hard links of the current backups", checkStaleReplica},
+	{"dangling-symlink", "symlinks into the backup dir whose target is gone", checkDanglingSymlinks},
+}
+
+// What the checks share.
+type doctorEnv struct {
+	backupDir string
+	files     []*cf.ConfigFile
+	// Where this run quarantines files, created on demand.
+	quarantineDir string
+}
+
+// Runs the checks with the given names, or all of them if there are none.
+func Diagnose(names ...string) ([]*Finding, error) {
+	checks := DoctorChecks
+	if len(names) > 0 {
+		checks = nil
+		for _, name := range names {
+			check, ok := findCheck(name)
+			if !ok {
+				return nil, errors.Errorf("unknown check %q", name)
+			}
+			checks = append(checks, check)
+		}
+	}
+
+	m, err := mapfile.NewMapFile().Parse()
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	backupDir := vconfig.GetConfig().BackupDir
+	env := &doctorEnv{
+		backupDir:     backupDir,
+		files:         helpers.GetMapValues(m),
+		quarantineDir: filepath.Join(backupDir, QuarantineDirName, time.Now().Format("20060102-150405")),
+	}
+
+	var findings []*Finding
+	for _, check := range checks {
+		found, err := check.run(env)
+		if err != nil {
+			return nil, errors.WithMessagef(err, "the %s check failed", check.Name)
+		}
+		for _, finding := range found {
+			finding.Check = check.Name
+		}
+		findings = append(findings, found...)
+	}
+
+	return findings, nil
+}
+
+func findCheck(name string) (DoctorCheck, bool) {
+	for _, check := range DoctorChecks {
+		if check.Name == name {
+			return check, true
+		}
+	}
+	return DoctorCheck{}, false
+}
+
+// Moves the file into the quarantine directory, keeping its path relative to the backup dir.
+func (env *doctorEnv) quarantine(path string) error {
+	rel, err := filepath.Rel(env.backupDir, path)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	dest := filepath.Join(env.quarantineDir, rel)
+
+	if err := fileops.MkdirAll(filepath.Dir(dest)); err != nil {
+		return errors.WithStack(err)
+	}
+	return errors.WithStack(fileops.Move(dest, path))
+}
+
+func (env *doctorEnv) rel(path string) string {
+	if rel, err := filepath.Rel(env.backupDir, path); err == nil {
+		return rel
+	}
+	return path
+}
+
+func checkPendingJournal(env *doctorEnv) ([]*Finding, error) {
+	header, err := PendingJournal()
+	if err != nil || header == nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return []*Finding{{
+		Severity: SeverityError,
+		Path:     JournalDir(),
+		Problem:  fmt.Sprintf("a %s was interrupted, run 'cfgrr recover' to resume or revert it", header.Command),
+	}}, nil
+}
+
+func checkMissingBackups(env *doctorEnv) ([]*Finding, error) {
+	var findings []*Finding
+	var head *object.Tree
+	headRead := false
+	for _, file := range env.files {
+		if _, err := fileops.Lstat(file.BackupPath()); !errors.Is(err, os.ErrNotExist) {
+			if err != nil {
+				return nil, errors.WithStack(err)
+			}
+			continue
+		}
+
+		finding := &Finding{
+			Severity: SeverityError,
+			Path:     file.PathAbs(),
+			Problem:  fmt.Sprintf("the backup file %s is missing", env.rel(file.BackupPath())),
+		}
+		findings = append(findings, finding)
+		if file.IsDir() {
+			continue
+		}
+
+		// The blobs are named after their content, the last pushed one is as good as the missing one.
+		if !headRead {
+			var err error
+			if head, err = headTree(env.backupDir); err != nil {
+				return nil, errors.WithStack(err)
+			}
+			headRead = true
+		}
+		if head == nil {
+			continue
+		}
+		pushed, err := head.File(filepath.ToSlash(env.rel(file.BackupPath())))
+		if err != nil {
+			continue
+		}
+		content, err := pushed.Contents()
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+
+		file := file
+		finding.Remedy = "restore it from the last push"
+		finding.fix = func() error {
+			if err := fileops.MkdirAll(filepath.Dir(file.BackupPath())); err != nil {
+				return errors.WithStack(err)
+			}
+			return errors.WithStack(fileops.WriteFile(file.BackupPath(), []byte(content), file.Perm.Perm()))
+		}
+	}
+
+	return findings, nil
+}
+
+// Returns the tree of the last commit of the backup dir, or nil if there's none.
+func headTree(backupDir string) (*object.Tree, error) {
+	repo, err := git.PlainOpen(backupDir)
+	if errors.Is(err, git.ErrRepositoryNotExists) {
+		return nil, nil
+	} else if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	ref, err := repo.Head()
+	if err != nil {
+		// Nothing was committed yet.
+		return nil, nil
+	}
+	commit, err := repo.CommitObject(ref.Hash())
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return commit.Tree()
+}
+
+func checkOrphanedBackups(env *doctorEnv) ([]*Finding, error) {
+	used := make(map[string]bool, len(env.files))
+	for _, file := range env.files {
+		used[filepath.Clean(file.BackupPath())] = true
+	}
+
+	candidates, err := cf.StoredBackups()
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	var findings []*Finding
+	for _, path := range candidates {
+		if used[path] {
+			continue
+		}
+		path := path
+		findings = append(findings, &Finding{
+			Severity: SeverityWarning,
+			Path:     path,
+			Problem:  "no map file entry uses this backup",
+			Remedy:   "quarantine it",
+			fix:      func() error { return env.quarantine(path) },
+		})
+	}
+
+	return findings, nil
+}
+
+func checkStaleReplica(env *doctorEnv) ([]*Finding, error) {
+	// The backup file each replicated path should be a hard link of.
+	expected := make(map[string]string)
+	for _, file := range env.files {
+		replicaDir := replicaDirs[0]
+		if file.IsRoot() {
+			replicaDir = replicaDirs[1]
+		}
+		expected[filepath.Join(env.backupDir, replicaDir, file.Path)] = file.BackupPath()
+	}
+
+	var findings []*Finding
+	for _, replicaDir := range replicaDirs {
+		root := filepath.Join(env.backupDir, replicaDir)
+		err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+			if errors.Is(err, os.ErrNotExist) && path == root {
+				return filepath.SkipDir
+			} else if err != nil {
+				return errors.WithStack(err)
+			}
+			if d.IsDir() {
+				return nil
+			}
+
+			if isReplicaOf(path, expected) {
+				return nil
+			}
+			path = filepath.Clean(path)
+			findings = append(findings, &Finding{
+				Severity: SeverityWarning,
+				Path:     path,
+				Problem:  "the replica isn't a hard link of a current backup, run 'cfgrr replicate' to refresh it",
+				Remedy:   "quarantine it",
+				fix:      func() error { return env.quarantine(path) },
+			})
+			return nil
+		})
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+	}
+
+	return findings, nil
+}
+
+// Checks whether the replicated file is a hard link of its backup file, or of the file at the same place in its backup directory.
+func isReplicaOf(path string, expected map[string]string) bool {
+	for dir := path; ; dir = filepath.Dir(dir) {
+		if backupPath, ok := expected[dir]; ok {
+			rel, _ := filepath.Rel(dir, path)
+			return sameFile(path, filepath.Join(backupPath, rel))
+		}
+		if dir == filepath.Dir(dir) {
+			return false
+		}
+	}
+}
+
+func sameFile(a, b string) bool {
+	infoA, err := os.Lstat(a)
+	if err != nil {
+		return false
+	}
+	infoB, err := os.Lstat(b)
+	if err != nil {
+		return false
+	}
+	return os.SameFile(infoA, infoB)
+}
+
+func checkDanglingSymlinks(env *doctorEnv) ([]*Finding, error) {
+	homedir, err := os.UserHomeDir()
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	ignoreGlobs, _ := ignorefile.NewIgnoresContainer(".cfgrrignore").ReadLines()
+	backupDir := filepath.Clean(env.backupDir)
+
+	var links []string
+	err = filepath.WalkDir(homedir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if path != homedir && errors.Is(err, os.ErrPermission) {
+				// Not ours to check.
+				return nil
+			}
+			return errors.WithStack(err)
+		}
+		if d.IsDir() {
+			if path == backupDir || CheckIfGlobsMatch(path, ignoreGlobs...) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.Type()&os.ModeSymlink != 0 {
+			links = append(links, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	// The files outside the home directory aren't walked, only their own locations are checked.
+	for _, file := range env.files {
+		if file.IsRoot() {
+			links = append(links, file.PathAbs())
+		}
+	}
+
+	// The links of the entries whose backup is missing are reported by the missing-backup check.
+	entryLinks := make(map[string]string, len(env.files))
+	for _, file := range env.files {
+		entryLinks[file.PathAbs()] = file.BackupPath()
+	}
+
+	var findings []*Finding
+	for _, link := range links {
+		target, err := os.Readlink(link)
+		if err != nil {
+			continue
+		}
+		if !filepath.IsAbs(target) {
+			target = filepath.Join(filepath.Dir(link), target)
+		}
+		if target != backupDir && !strings.HasPrefix(target, backupDir+string(filepath.Separator)) {
+			continue
+		}
+		if _, err := os.Stat(link); !errors.Is(err, os.ErrNotExist) || entryLinks[link] == target {
+			continue
+		}
+
+		link := link
+		findings = append(findings, &Finding{
+			Severity: SeverityWarning,
+			Path:     link,
+			Problem:  fmt.Sprintf("the symlink points to %s, which is gone", env.rel(target)),
+			Remedy:   "remove the symlink",
+			fix:      func() error { return fileops.Remove(link) },
+		})
+	}
+
+	return findings, nil
+}
@@ -0,0 +1,72 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/osamaadam/cfgrr/helpers"
+)
+
+func TestDiagnose(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	backupDir := filepath.Join(home, "backup")
+	files := _setupBackupEnv(backupDir, home, 3)
+	// Identical files would share their backup.
+	for i, file := range files {
+		os.WriteFile(file.PathAbs(), []byte{byte(i)}, 0644)
+	}
+	if err := BackupFiles(files...); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := MakeFilesBrowsable("home", "root", files...); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// The first file lost its backup, and the second file's replica is stale.
+	os.Remove(files[0].BackupPath())
+	replica := filepath.Join(backupDir, "home", files[1].Path)
+	os.Remove(replica)
+	os.WriteFile(replica, []byte("stale"), 0644)
+	orphan := filepath.Join(filepath.Dir(files[2].BackupPath()), "orphan")
+	os.WriteFile(orphan, []byte("orphan"), 0644)
+	dangling := filepath.Join(home, "dangling")
+	os.Symlink(filepath.Join(filepath.Dir(files[2].BackupPath()), "gone"), dangling)
+
+	findings, err := Diagnose()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	counts := make(map[string]int)
+	for _, finding := range findings {
+		counts[finding.Check]++
+		if finding.Fixable() {
+			if err := finding.Fix(); err != nil {
+				t.Errorf("couldn't fix %s: %v", finding.Path, err)
+			}
+		}
+	}
+	want := map[string]int{"missing-backup": 1, "orphaned-backup": 1, "stale-replica": 2, "dangling-symlink": 1}
+	for check, count := range want {
+		if counts[check] != count {
+			t.Errorf("expected %d %s findings, got %d", count, check, counts[check])
+		}
+	}
+
+	if helpers.CheckFileExists(orphan) || helpers.CheckFileExists(replica) {
+		t.Errorf("expected the orphaned backup and the stale replica to be quarantined")
+	}
+	if _, err := os.Lstat(dangling); !os.IsNotExist(err) {
+		t.Errorf("expected the dangling symlink to be removed, got %v", err)
+	}
+
+	// Without a push to restore it from, the missing backup can't be fixed.
+	findings, err = Diagnose()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(findings) != 1 || findings[0].Check != "missing-backup" || findings[0].Fixable() {
+		t.Errorf("expected only the missing backup to be left, got %v", findings)
+	}
+}
@@ -0,0 +1,95 @@
+package core
+
+import (
+	"bytes"
+	"sort"
+
+	cf "github.com/osamaadam/cfgrr/configfile"
+	"github.com/osamaadam/cfgrr/fileops"
+	"github.com/osamaadam/cfgrr/helpers"
+	"github.com/osamaadam/cfgrr/mapfile"
+	"github.com/pkg/errors"
+)
+
+// Returns the files whose display form (e.g. `.zshrc - (~/.zshrc)`) fuzzy matches the query, best matches first.
+func FuzzyFind(query string, files ...*cf.ConfigFile) []*cf.ConfigFile {
+	scores := make(map[*cf.ConfigFile]int)
+	matches := make([]*cf.ConfigFile, 0)
+	for _, file := range files {
+		if score, ok := helpers.FuzzyScore(query, file.String()); ok {
+			scores[file] = score
+			matches = append(matches, file)
+		}
+	}
+
+	sort.SliceStable(matches, func(i, j int) bool {
+		if scores[matches[i]] != scores[matches[j]] {
+			return scores[matches[i]] > scores[matches[j]]
+		}
+		return matches[i].PathAbs() < matches[j].PathAbs()
+	})
+
+	return matches
+}
+
+// Edits the backup of the file, and recreates its live file (rendered, encrypted, copied or linked according to the entry).
+// The changes made to a copy of the file are pulled into the backup first, so they're edited too.
+// `edit` is given the backup's content decrypted, with templates unrendered, and returns the edited content.
+// The edited content is stored as a new blob, the old one is deleted unless other files use it.
+// Returns false if nothing changed.
+func EditFile(file *cf.ConfigFile, edit func(content []byte) ([]byte, error)) (changed bool, err error) {
+	if file.IsDir() {
+		return false, errors.Errorf("%s is a directory, only files can be edited", file.PathAbs())
+	}
+	if file.IsCommand() {
+		return false, errors.Errorf("%s is backed by a command, only files can be edited", file.PathAbs())
+	}
+	if file.Blob == "" {
+		return false, errors.Errorf("%s isn't in the blob store yet, run 'cfgrr migrate'", file.Path)
+	}
+
+	err = transact("edit", map[string]string{"path": file.PathAbs()}, []*cf.ConfigFile{file}, func(j *fileops.Journal) error {
+		oldBlob := file.Blob
+		synced, err := file.Sync()
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		if fileops.Exists(file.PathAbs()) && !file.IsLinked() {
+			return errors.Errorf("%s isn't managed by cfgrr anymore (it was probably replaced), move it away first", file.PathAbs())
+		}
+
+		syncedBlob := file.Blob
+
+		content, err := file.EditableContent()
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		edited, err := edit(content)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+
+		if !bytes.Equal(edited, content) {
+			if err := file.Reconfigure(func() error { return file.SetContent(edited) }); err != nil {
+				return errors.WithMessagef(err, "couldn't store the changes to %s", file.PathAbs())
+			}
+			changed = true
+		}
+		if !changed && !synced {
+			return nil
+		}
+
+		mapFile := mapfile.NewMapFile()
+		if err := mapFile.AddFiles(file); err != nil {
+			return errors.WithStack(err)
+		}
+		m, err := mapFile.Parse()
+		if err != nil {
+			return errors.WithStack(err)
+		}
+
+		return errors.WithStack(removeUnusedBlobs(countBlobRefs(helpers.GetMapValues(m)...), oldBlob, syncedBlob))
+	})
+
+	return changed, errors.WithStack(err)
+}
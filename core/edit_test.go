@@ -0,0 +1,76 @@
+package core
+
+import (
+	"os"
+	"testing"
+
+	cf "github.com/osamaadam/cfgrr/configfile"
+)
+
+func TestEditFile(t *testing.T) {
+	backupDir := t.TempDir()
+	files := _setupBackupEnv(backupDir, t.TempDir(), 3)
+	// The first two are copies sharing a blob.
+	os.WriteFile(files[0].PathAbs(), []byte("shared\n"), 0644)
+	os.WriteFile(files[1].PathAbs(), []byte("shared\n"), 0644)
+	os.WriteFile(files[2].PathAbs(), []byte("copied\n"), 0644)
+	if err := BackupFiles(files...); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := RelinkFiles(cf.LinkCopy, files...); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	sharedBlob := files[0].Blob
+
+	appendLine := func(content []byte) ([]byte, error) {
+		return append(content, "edited\n"...), nil
+	}
+
+	for _, file := range []*cf.ConfigFile{files[0], files[2]} {
+		changed, err := EditFile(file, appendLine)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !changed {
+			t.Errorf("expected %s to change", file.Path)
+		}
+	}
+
+	want := []string{"shared\nedited\n", "shared\n", "copied\nedited\n"}
+	for i, file := range files {
+		if content, _ := os.ReadFile(file.PathAbs()); string(content) != want[i] {
+			t.Errorf("expected %s to be %q, got %q", file.Path, want[i], content)
+		}
+	}
+	if !files[2].IsLinked() {
+		t.Errorf("expected %s to be copied in place again", files[2].Path)
+	}
+	if files[0].Blob == sharedBlob {
+		t.Errorf("expected the edit to be stored in a new blob")
+	}
+	if _, err := os.Stat(cf.BlobPath(sharedBlob)); err != nil {
+		t.Errorf("expected the blob still used by %s to be kept", files[1].Path)
+	}
+
+	unchanged := func(content []byte) ([]byte, error) { return content, nil }
+	if changed, err := EditFile(files[1], unchanged); err != nil || changed {
+		t.Errorf("expected nothing to change, got %t, %v", changed, err)
+	}
+}
+
+func TestFuzzyFind(t *testing.T) {
+	files := []*cf.ConfigFile{
+		{Path: ".grepit.conf"},
+		{Path: ".config/nvim/init.vim"},
+		{Path: ".gitconfig"},
+	}
+
+	// The scattered match (.confiG/nvIm/iniT.vim) comes last.
+	matches := FuzzyFind("git", files...)
+	if len(matches) != 3 || matches[0] != files[2] || matches[1] != files[0] || matches[2] != files[1] {
+		t.Errorf("expected .gitconfig, .grepit.conf, then init.vim, got %v", matches)
+	}
+	if matches := FuzzyFind("nvinit", files...); len(matches) != 1 || matches[0] != files[1] {
+		t.Errorf("expected init.vim, got %v", matches)
+	}
+}
@@ -0,0 +1,178 @@
+package core
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	cf "github.com/osamaadam/cfgrr/configfile"
+	"github.com/osamaadam/cfgrr/fileops"
+	"github.com/osamaadam/cfgrr/mapfile"
+	"github.com/osamaadam/cfgrr/vconfig"
+	"github.com/pkg/errors"
+)
+
+// The directory of the backup dir holding the global hooks, each named after its event (e.g. hooks/post-restore).
+const HooksDirName = "hooks"
+
+func HooksDir() string {
+	return filepath.Join(vconfig.GetConfig().BackupDir, HooksDirName)
+}
+
+// A hook to run on an event, either a script of the hooks dir or a command of entries.
+type Hook struct {
+	Event cf.HookEvent
+	// The path of the global hook's script.
+	Script string
+	// The shell command of the entries' hook.
+	Command string
+	// The tags the command was added to, if it wasn't added to the entries themselves.
+	Tags []string
+	// The files the hook runs for.
+	Files []*cf.ConfigFile
+}
+
+func (h *Hook) String() string {
+	if h.Script != "" {
+		return h.Script
+	}
+	return h.Command
+}
+
+// Returns the hooks of the event for the files: the global hook if there's one, then the commands of the files' entries,
+// and of the tags they have at the moment (see `HookTags`).
+// Each command runs once, for all the files it was added to.
+func Hooks(event cf.HookEvent, files ...*cf.ConfigFile) ([]*Hook, error) {
+	var hooks []*Hook
+
+	script := filepath.Join(HooksDir(), string(event))
+	info, err := fileops.Stat(script)
+	if err == nil && !info.IsDir() {
+		hooks = append(hooks, &Hook{Event: event, Script: script, Files: files})
+	} else if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, errors.WithStack(err)
+	}
+
+	byCommand := make(map[string]*Hook)
+	add := func(command string, file *cf.ConfigFile) *Hook {
+		hook, ok := byCommand[command]
+		if !ok {
+			hook = &Hook{Event: event, Command: command}
+			byCommand[command] = hook
+			hooks = append(hooks, hook)
+		}
+		if !slices.Contains(hook.Files, file) {
+			hook.Files = append(hook.Files, file)
+		}
+		return hook
+	}
+	for _, file := range files {
+		for _, command := range file.Hooks[event] {
+			add(command, file)
+		}
+		for _, tagHook := range vconfig.GetConfig().TagHooks {
+			if tagHook.Event != string(event) || !file.HasTag(tagHook.Tag) {
+				continue
+			}
+			if hook := add(tagHook.Command, file); !slices.Contains(hook.Tags, tagHook.Tag) {
+				hook.Tags = append(hook.Tags, tagHook.Tag)
+			}
+		}
+	}
+
+	return hooks, nil
+}
+
+// Runs the hooks of the event for the files, stopping at the first one that fails.
+// The hooks are run from the home directory, with the event in $CFGRR_HOOK, the backup dir in $CFGRR_BACKUP_DIR,
+// and the paths of the files in $CFGRR_PATHS, one per line.
+// Planned operations (see `fileops.Planner`) plan the hooks rather than running them.
+func RunHooks(event cf.HookEvent, files ...*cf.ConfigFile) error {
+	hooks, err := Hooks(event, files...)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	for _, hook := range hooks {
+		if planner, ok := fileops.Current().(*fileops.Planner); ok {
+			planner.Plan("hook "+string(event), hook.String(), strings.Join(hookPaths(hook.Files), ", "))
+			continue
+		}
+		if err := hook.run(); err != nil {
+			return errors.WithMessagef(err, "the %s hook %q failed", event, hook)
+		}
+	}
+
+	return nil
+}
+
+func (h *Hook) run() error {
+	var cmd *exec.Cmd
+	if h.Script != "" {
+		cmd = exec.Command(h.Script)
+	} else {
+		cmd = cf.ShellCommand(h.Command)
+	}
+
+	homedir, err := os.UserHomeDir()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	cmd.Dir = homedir
+	cmd.Env = append(os.Environ(),
+		"CFGRR_HOOK="+string(h.Event),
+		"CFGRR_BACKUP_DIR="+vconfig.GetConfig().BackupDir,
+		"CFGRR_PATHS="+strings.Join(hookPaths(h.Files), "\n"),
+	)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+
+	return errors.WithStack(cmd.Run())
+}
+
+func hookPaths(files []*cf.ConfigFile) []string {
+	paths := make([]string, len(files))
+	for i, file := range files {
+		paths[i] = file.PathAbs()
+	}
+	return paths
+}
+
+// Adds the commands run on the event to the files, and removes the others.
+// The map file is updated.
+func HookFiles(event cf.HookEvent, add, remove []string, files ...*cf.ConfigFile) error {
+	for _, file := range files {
+		file.UpdateHooks(event, add, remove)
+	}
+
+	if err := mapfile.NewMapFile().AddFiles(files...); err != nil {
+		return errors.WithStack(err)
+	}
+
+	return nil
+}
+
+// Adds the commands run on the event for the files with any of the tags, and removes the others.
+// They're kept by tag in the shared settings of the backup dir, so they run for the files tagged later, or on other machines, too.
+func HookTags(event cf.HookEvent, add, remove []string, tags ...string) error {
+	config := vconfig.GetConfig()
+	hooks := slices.Clone(config.TagHooks)
+	for _, tag := range tags {
+		if err := cf.ValidateTag(tag); err != nil {
+			return errors.WithStack(err)
+		}
+		for _, command := range add {
+			hook := vconfig.TagHook{Tag: tag, Event: string(event), Command: strings.TrimSpace(command)}
+			if hook.Command != "" && !slices.Contains(hooks, hook) {
+				hooks = append(hooks, hook)
+			}
+		}
+	}
+	hooks = slices.DeleteFunc(hooks, func(hook vconfig.TagHook) bool {
+		return hook.Event == string(event) && slices.Contains(tags, hook.Tag) && slices.Contains(remove, hook.Command)
+	})
+
+	config.SetTagHooks(hooks)
+	return errors.WithStack(config.SaveShared())
+}
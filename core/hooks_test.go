@@ -0,0 +1,81 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"testing"
+
+	cf "github.com/osamaadam/cfgrr/configfile"
+	"github.com/osamaadam/cfgrr/vconfig"
+)
+
+func TestRunHooks(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the hooks are shell scripts")
+	}
+
+	backupDir := t.TempDir()
+	files := _setupBackupEnv(backupDir, t.TempDir(), 3)
+	log := filepath.Join(t.TempDir(), "log")
+
+	// A global hook, and a command shared by two entries.
+	os.MkdirAll(HooksDir(), 0755)
+	os.WriteFile(filepath.Join(HooksDir(), "post-restore"), []byte("#!/bin/sh\necho \"global $CFGRR_HOOK\" >> "+log+"\n"), 0755)
+	shared := `echo "shared $(echo "$CFGRR_PATHS" | wc -l)" >> ` + log
+	files[0].UpdateHooks(cf.HookPostRestore, []string{shared}, nil)
+	files[1].UpdateHooks(cf.HookPostRestore, []string{shared}, nil)
+	files[2].UpdateHooks(cf.HookPreRestore, []string{"echo pre >> " + log}, nil)
+
+	if err := RunHooks(cf.HookPostRestore, files...); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// wc pads the count on some systems.
+	content, _ := os.ReadFile(log)
+	if got := strings.Join(strings.Fields(string(content)), " "); got != "global post-restore shared 2" {
+		t.Errorf("expected the global hook then the shared command once, got %q", got)
+	}
+
+	files[2].UpdateHooks(cf.HookPreRestore, []string{"exit 3"}, nil)
+	if err := RunHooks(cf.HookPreRestore, files...); err == nil {
+		t.Errorf("expected the failing hook to fail")
+	}
+}
+
+func TestHookTags(t *testing.T) {
+	c := vconfig.GetConfig()
+	t.Cleanup(func() { c.SetTagHooks(nil) })
+
+	files := _setupBackupEnv(t.TempDir(), t.TempDir(), 3)
+	files[0].UpdateTags([]string{"Shell"}, nil)
+	files[1].UpdateHooks(cf.HookPostRestore, []string{"reload"}, nil)
+	if err := HookTags(cf.HookPostRestore, []string{"reload"}, nil, "Shell"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// Tagged after the hook was added.
+	files[1].UpdateTags([]string{"Shell"}, nil)
+
+	// The hooks are saved to the backup dir, so another machine cloning it reads them, with the tag's case kept.
+	c.SetTagHooks(nil)
+	c.SetBackupDir(c.BackupDir)
+	if want := []vconfig.TagHook{{Tag: "Shell", Event: string(cf.HookPostRestore), Command: "reload"}}; !slices.Equal(c.TagHooks, want) {
+		t.Errorf("expected the hook to be read from the backup dir, got %+v", c.TagHooks)
+	}
+	hooks, err := Hooks(cf.HookPostRestore, files...)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(hooks) != 1 || hooks[0].Command != "reload" || len(hooks[0].Files) != 2 || !slices.Equal(hooks[0].Tags, []string{"Shell"}) {
+		t.Fatalf("expected the command to run once for both tagged files, got %+v", hooks)
+	}
+
+	if err := HookTags(cf.HookPostRestore, nil, []string{"reload"}, "Shell"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	hooks, _ = Hooks(cf.HookPostRestore, files...)
+	if len(hooks) != 1 || len(hooks[0].Files) != 1 || len(hooks[0].Tags) != 0 {
+		t.Errorf("expected only the entry's own hook to be left, got %+v", hooks)
+	}
+}
@@ -0,0 +1,197 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	cf "github.com/osamaadam/cfgrr/configfile"
+	"github.com/osamaadam/cfgrr/fileops"
+	"github.com/pkg/errors"
+)
+
+// A file to import from another dotfiles manager.
+type Import struct {
+	// Where the content of the file is kept by the other manager.
+	Source string
+	// The entry of the file, its live location is where the other manager puts the file.
+	File *cf.ConfigFile
+	// The permissions the file gets in place, zero to keep the source's.
+	Perm os.FileMode
+	// The permissions the other manager gives the live directories of the file, by path (e.g. a private ~/.ssh).
+	DirPerms map[string]os.FileMode
+	// The live file is a copy the other manager made of the source, it's replaced with the source.
+	Deployed bool
+	// The content the file is imported with instead of the source's (e.g. the source is encrypted), the source is only removed.
+	Content []byte
+}
+
+// A file kept by another dotfiles manager that can't be imported.
+type Skipped struct {
+	Source string
+	Reason string
+}
+
+// Imports the files kept by another dotfiles manager in `managedDir`, and backs them up.
+// The manager's symlinks into `managedDir` at the live locations (or at their parent directories), and its deployed copies,
+// are replaced with cfgrr's links, the directories of `managedDir` left empty are removed.
+// Runs as a transaction, nothing is imported if any of the files fails.
+func ImportFiles(managedDir string, imports ...Import) ([]*cf.ConfigFile, error) {
+	managedDir, err := filepath.Abs(managedDir)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	files := make([]*cf.ConfigFile, len(imports))
+	for i, imp := range imports {
+		files[i] = imp.File
+	}
+
+	err = transact("import", map[string]string{"from": managedDir}, files, func(j *fileops.Journal) error {
+		return importFiles(j, managedDir, imports...)
+	})
+
+	return files, errors.WithStack(err)
+}
+
+func importFiles(j *fileops.Journal, managedDir string, imports ...Import) error {
+	sourceDirs := make(map[string]bool)
+	dirPerms := make(map[string]os.FileMode)
+	for _, imp := range imports {
+		live := imp.File.PathAbs()
+		if err := unlinkManaged(managedDir, live); err != nil {
+			return errors.WithStack(err)
+		}
+		if err := placeImport(live, imp); err != nil {
+			return errors.WithStack(err)
+		}
+		if imp.Perm != 0 {
+			if err := fileops.Chmod(live, imp.Perm); err != nil {
+				return errors.WithStack(err)
+			}
+		}
+		sourceDirs[filepath.Dir(imp.Source)] = true
+		for dir, perm := range imp.DirPerms {
+			dirPerms[dir] = perm
+		}
+	}
+
+	files := make([]*cf.ConfigFile, len(imports))
+	for i, imp := range imports {
+		files[i] = imp.File
+	}
+	if err := backupFiles(j, files...); err != nil {
+		return errors.WithStack(err)
+	}
+
+	// The directories are changed last, a read-only one couldn't be linked into otherwise.
+	dirs := make([]string, 0, len(dirPerms))
+	for dir := range dirPerms {
+		dirs = append(dirs, dir)
+	}
+	sort.Strings(dirs)
+	for _, dir := range dirs {
+		if err := fileops.Chmod(dir, dirPerms[dir]); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+
+	return errors.WithStack(removeEmptyDirs(managedDir, sourceDirs))
+}
+
+// Puts the content of the imported file at its live location.
+func placeImport(live string, imp Import) error {
+	if _, err := fileops.Lstat(live); err == nil {
+		if !imp.Deployed {
+			return errors.Errorf("%s already exists, and isn't a link of the imported file", live)
+		}
+		if err := fileops.Remove(live); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+
+	if err := fileops.MkdirAll(filepath.Dir(live)); err != nil {
+		return errors.WithStack(err)
+	}
+	if imp.Content != nil {
+		if err := fileops.Remove(imp.Source); err != nil {
+			return errors.WithStack(err)
+		}
+		perm := imp.Perm
+		if perm == 0 {
+			perm = 0644
+		}
+		return errors.WithStack(fileops.WriteFile(live, imp.Content, perm))
+	}
+	if err := fileops.Move(live, imp.Source); err != nil {
+		return errors.WithMessagef(err, "couldn't move %s into place", imp.Source)
+	}
+
+	return nil
+}
+
+// Removes the symlinks into `managedDir` at the path, or at its parent directories.
+func unlinkManaged(managedDir, path string) error {
+	var links []string
+	for p := path; p != filepath.Dir(p); p = filepath.Dir(p) {
+		target, err := fileops.Readlink(p)
+		if err != nil {
+			continue
+		}
+		if !filepath.IsAbs(target) {
+			target = filepath.Join(filepath.Dir(p), target)
+		}
+		if isInside(managedDir, target) {
+			links = append(links, p)
+		}
+	}
+
+	// The parents go first, the links under them are gone with them.
+	for i := len(links) - 1; i >= 0; i-- {
+		if _, err := fileops.Lstat(links[i]); err != nil {
+			continue
+		}
+		if err := fileops.Remove(links[i]); err != nil {
+			return errors.WithMessagef(err, "couldn't remove the link %s", links[i])
+		}
+	}
+
+	return nil
+}
+
+// Checks whether `path` is `dir` or inside it.
+func isInside(dir, path string) bool {
+	rel, err := filepath.Rel(dir, filepath.Clean(path))
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// Removes the given directories, and their parents up to `root`, if they're empty.
+func removeEmptyDirs(root string, dirs map[string]bool) error {
+	for dir := range dirs {
+		for p := filepath.Dir(dir); p != root && isInside(root, p) && p != filepath.Dir(p); p = filepath.Dir(p) {
+			dirs[p] = true
+		}
+	}
+
+	// Children sort after their parents.
+	sorted := make([]string, 0, len(dirs))
+	for dir := range dirs {
+		if dir != root && isInside(root, dir) {
+			sorted = append(sorted, dir)
+		}
+	}
+	sort.Sort(sort.Reverse(sort.StringSlice(sorted)))
+
+	for _, dir := range sorted {
+		entries, err := os.ReadDir(fileops.Locate(dir))
+		if err != nil || len(entries) > 0 {
+			continue
+		}
+		if err := fileops.Remove(dir); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+
+	return nil
+}
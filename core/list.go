@@ -0,0 +1,60 @@
+package core
+
+import (
+	"path/filepath"
+	"sort"
+	"strings"
+
+	cf "github.com/osamaadam/cfgrr/configfile"
+	"github.com/osamaadam/cfgrr/mapfile"
+	"github.com/pkg/errors"
+)
+
+// The shortest prefix of a blob's digest a query could use.
+const minDigestPrefix = 6
+
+// Finds the entries the query refers to, it could be:
+// - the path of a tracked file, or of a command entry (e.g. command:dconf).
+// - a key of the map file, or the name of a backup file in .internals (e.g. the digest of a blob, or a prefix of it).
+// - the path of a backup file in .internals.
+// Files sharing a blob are all returned.
+func ResolveEntries(query string) ([]*cf.ConfigFile, error) {
+	m, err := mapfile.NewMapFile().Parse()
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	name := query
+	internalsDir := cf.InternalsPath()
+	if abs, err := filepath.Abs(query); err == nil && isInside(internalsDir, abs) && abs != internalsDir {
+		// The backup file of a tracked directory is its top directory.
+		rel, _ := filepath.Rel(internalsDir, abs)
+		parts := strings.Split(rel, string(filepath.Separator))
+		name = parts[len(parts)-1]
+		if len(parts) > 1 && parts[0] == "dirs" {
+			name = parts[1]
+		}
+	}
+
+	var found []*cf.ConfigFile
+	for key, file := range m {
+		if key == name || filepath.Base(file.BackupPath()) == name ||
+			len(name) >= minDigestPrefix && file.Blob != "" && strings.HasPrefix(file.Blob, name) {
+			found = append(found, file)
+		}
+	}
+	if len(found) > 0 {
+		sort.Slice(found, func(i, j int) bool { return found[i].PathAbs() < found[j].PathAbs() })
+		return found, nil
+	}
+
+	file, err := lookupFile(query)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if tracked, ok := m[file.HashShort()]; ok && tracked.SamePath(file) {
+		return []*cf.ConfigFile{tracked}, nil
+	}
+
+	return nil, errors.Errorf("%s isn't a tracked file, nor a key or a backup file of one", query)
+}
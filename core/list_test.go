@@ -0,0 +1,63 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	cf "github.com/osamaadam/cfgrr/configfile"
+)
+
+func TestResolveEntries(t *testing.T) {
+	backupDir := t.TempDir()
+	files := _setupBackupEnv(backupDir, t.TempDir(), 3)
+	// The last two are copies sharing a blob.
+	os.WriteFile(files[0].PathAbs(), []byte("first"), 0644)
+	os.WriteFile(files[1].PathAbs(), []byte("shared"), 0644)
+	os.WriteFile(files[2].PathAbs(), []byte("shared"), 0644)
+	if err := BackupFiles(files...); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := RelinkFiles(cf.LinkCopy, files[1:]...); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		name  string
+		query string
+		want  []*cf.ConfigFile
+	}{
+		{"path", files[0].PathAbs(), files[:1]},
+		{"key", files[1].HashShort(), files[1:2]},
+		{"digest", files[1].Blob, files[1:]},
+		{"digest prefix", files[0].Blob[:8], files[:1]},
+		{"backup path", files[2].BackupPath(), files[1:]},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			found, err := ResolveEntries(tt.query)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(found) != len(tt.want) {
+				t.Fatalf("expected %d entries, got %d", len(tt.want), len(found))
+			}
+			for _, want := range tt.want {
+				matched := false
+				for _, file := range found {
+					matched = matched || file.SamePath(want)
+				}
+				if !matched {
+					t.Errorf("expected %s to be found", want.Path)
+				}
+			}
+		})
+	}
+
+	for _, query := range []string{files[0].Blob[:minDigestPrefix-1], filepath.Join(t.TempDir(), "untracked")} {
+		if _, err := ResolveEntries(query); err == nil {
+			t.Errorf("expected %s not to resolve", query)
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package core
+
+import (
+	cf "github.com/osamaadam/cfgrr/configfile"
+	"github.com/osamaadam/cfgrr/fileops"
+	"github.com/osamaadam/cfgrr/helpers"
+	"github.com/osamaadam/cfgrr/mapfile"
+	"github.com/osamaadam/cfgrr/vconfig"
+	"github.com/pkg/errors"
+)
+
+// A file named after a map file key, and its name under the new key.
+type rename struct {
+	from, to string
+}
+
+// Changes the format of the map file keys, renaming the backups and histories named after them.
+// The format is saved to the shared settings of the backup dir, so the map file is read with it wherever it's cloned.
+// Nothing is changed if the new keys collide, and the renames are undone if anything fails before the format is saved.
+// Returns the files whose keys changed.
+func Rekey(algorithm string, length int) (rekeyed []*cf.ConfigFile, err error) {
+	if err := cf.ValidateKeyFormat(algorithm, length); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	config := vconfig.GetConfig()
+	oldAlgorithm, oldLength := config.KeyAlgorithm, config.KeyLength
+
+	mapFile := mapfile.NewMapFile()
+	m, err := mapFile.Parse()
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	files := helpers.GetMapValues(m)
+
+	oldKeys := make([]string, len(files))
+	oldPaths := make([][]string, len(files))
+	for i, file := range files {
+		oldKeys[i] = file.HashShort()
+		oldPaths[i] = keyedPaths(file)
+	}
+
+	config.SetKeyFormat(algorithm, length)
+	undoFormat := func() { config.SetKeyFormat(oldAlgorithm, oldLength) }
+
+	renames := make([]rename, 0)
+	movedBackups := make(map[*cf.ConfigFile]string)
+	keys := make(map[string]*cf.ConfigFile, len(files))
+	for i, file := range files {
+		key := file.HashShort()
+		if existing, ok := keys[key]; ok {
+			undoFormat()
+			return nil, errors.WithStack(&mapfile.KeyCollisionError{Key: key, File: file, Existing: existing})
+		}
+		keys[key] = file
+
+		if key == oldKeys[i] {
+			continue
+		}
+		rekeyed = append(rekeyed, file)
+
+		for j, newPath := range keyedPaths(file) {
+			oldPath := oldPaths[i][j]
+			if oldPath == newPath || !fileops.Exists(oldPath) {
+				continue
+			}
+			if fileops.Exists(newPath) {
+				undoFormat()
+				return nil, errors.Errorf("couldn't rekey %s, %s already exists", file.PathAbs(), newPath)
+			}
+			renames = append(renames, rename{oldPath, newPath})
+			if j == 0 {
+				movedBackups[file] = oldPath
+			}
+		}
+	}
+
+	done, err := applyRenames(renames)
+	if err != nil {
+		undoRenames(done)
+		undoFormat()
+		return nil, errors.WithMessage(err, "couldn't rename the files named after the keys")
+	}
+
+	if err := mapFile.SetFiles(files...); err != nil {
+		undoRenames(done)
+		undoFormat()
+		return nil, errors.WithStack(err)
+	}
+
+	if err := config.SaveShared(); err != nil {
+		undoFormat()
+		undoRenames(done)
+		if undoErr := mapFile.SetFiles(files...); undoErr != nil {
+			return nil, errors.WithMessagef(err, "couldn't save the key format, nor restore the map file (%s)", undoErr)
+		}
+		return nil, errors.WithMessage(err, "couldn't save the key format")
+	}
+
+	// The symlinks of the renamed backups are dangling now.
+	for file, oldBackupPath := range movedBackups {
+		if err := file.Repoint(oldBackupPath); err != nil {
+			return rekeyed, errors.WithMessagef(err, "couldn't update the symlink of %s, restore it", file.PathAbs())
+		}
+	}
+
+	return rekeyed, nil
+}
+
+// Returns the paths named after the key of the file, the backup path first.
+func keyedPaths(file *cf.ConfigFile) []string {
+	return []string{file.BackupPath(), file.HistoryDir()}
+}
+
+// Renames the files, returning the renames that succeeded.
+func applyRenames(renames []rename) (done []rename, err error) {
+	for _, r := range renames {
+		if err := fileops.Move(r.to, r.from); err != nil {
+			return done, errors.WithStack(err)
+		}
+		done = append(done, r)
+	}
+
+	return done, nil
+}
+
+// Reverts the renames, latest first.
+func undoRenames(renames []rename) {
+	for i := len(renames) - 1; i >= 0; i-- {
+		fileops.Move(renames[i].from, renames[i].to)
+	}
+}
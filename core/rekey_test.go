@@ -0,0 +1,95 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	cf "github.com/osamaadam/cfgrr/configfile"
+	"github.com/osamaadam/cfgrr/helpers"
+	"github.com/osamaadam/cfgrr/mapfile"
+	"github.com/osamaadam/cfgrr/vconfig"
+)
+
+func TestRekey(t *testing.T) {
+	tests := []struct {
+		name      string
+		algorithm string
+		length    int
+		wantErr   bool
+	}{
+		{"longer keys", "sha1", 12, false},
+		{"another algorithm", "sha256", 16, false},
+		{"unknown algorithm", "md5", 8, true},
+		{"too short", "sha1", 2, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := vconfig.GetConfig()
+			configFile := vconfig.GetViper().ConfigFileUsed()
+			c.SetConfigFile(filepath.Join(t.TempDir(), ".cfgrr.yaml"))
+			t.Cleanup(func() {
+				c.SetKeyFormat("sha1", 8)
+				c.SetConfigFile(configFile)
+			})
+
+			files := _setupBackupEnv(t.TempDir(), t.TempDir(), 2)
+			dir := filepath.Join(t.TempDir(), "dir")
+			os.Mkdir(dir, 0755)
+			os.WriteFile(filepath.Join(dir, "file"), []byte("content"), 0644)
+			dirFile, _ := cf.NewConfigFile(dir)
+			files = append(files, dirFile)
+			if err := BackupFiles(files...); err != nil {
+				t.Fatalf("expected no error, got %s", err)
+			}
+			oldKeys := make([]string, len(files))
+			for i, file := range files {
+				oldKeys[i] = file.HashShort()
+			}
+
+			rekeyed, err := Rekey(tt.algorithm, tt.length)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Rekey() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				if c.KeyAlgorithm != "sha1" || c.KeyLength != 8 {
+					t.Errorf("expected the key format to be kept, got %d characters of %s", c.KeyLength, c.KeyAlgorithm)
+				}
+				return
+			}
+			if len(rekeyed) != len(files) {
+				t.Errorf("expected %d files to be rekeyed, got %d", len(files), len(rekeyed))
+			}
+
+			m, err := mapfile.NewMapFile().Parse()
+			if err != nil {
+				t.Fatalf("expected no error, got %s", err)
+			}
+			for i, file := range files {
+				key := file.HashShort()
+				if len(key) != tt.length || key == oldKeys[i] {
+					t.Errorf("expected a new key of length %d, got %s", tt.length, key)
+				}
+				if m[key] == nil {
+					t.Errorf("expected %s to be in the map file as %s", file.Path, key)
+				}
+				if !helpers.CheckFileExists(file.HistoryDir()) && !file.IsDir() {
+					t.Errorf("expected the history of %s to be renamed", file.Path)
+				}
+			}
+
+			// The symlink of the directory follows its renamed backup.
+			if content, err := os.ReadFile(filepath.Join(dir, "file")); err != nil || string(content) != "content" {
+				t.Errorf("expected the directory to be reachable through its symlink, got %q (%v)", content, err)
+			}
+
+			// Another machine cloning the backup dir reads the map file with the new format, whatever its config says.
+			c.SetKeyFormat("sha1", 8)
+			c.SetBackupDir(c.BackupDir)
+			if c.KeyAlgorithm != tt.algorithm || c.KeyLength != tt.length {
+				t.Errorf("expected the key format to be read from the backup dir, got %d characters of %s", c.KeyLength, c.KeyAlgorithm)
+			}
+		})
+	}
+}
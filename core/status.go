@@ -0,0 +1,108 @@
+package core
+
+import (
+	"path/filepath"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+	cf "github.com/osamaadam/cfgrr/configfile"
+	"github.com/osamaadam/cfgrr/vconfig"
+	"github.com/pkg/errors"
+)
+
+// How a tracked file drifted, no drifts means it's in sync.
+type FileStatus struct {
+	File   *cf.ConfigFile
+	Drifts []cf.Drift
+	// Why the file doesn't belong on this machine, its drifts aren't checked then.
+	Unmet string
+}
+
+// Classifies how each file drifted from the map file.
+// The backup files are compared with the last commit of the backup dir's git repository,
+// if it has none (i.e. it was never pushed) they aren't.
+// The files whose conditions don't hold on this machine aren't checked.
+func Status(files ...*cf.ConfigFile) ([]FileStatus, error) {
+	changes, err := uncommittedChanges()
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	statuses := make([]FileStatus, 0, len(files))
+	for _, file := range files {
+		if reason := file.Unmet(); reason != "" {
+			statuses = append(statuses, FileStatus{File: file, Unmet: reason})
+			continue
+		}
+		drifts, err := file.Drift()
+		if err != nil {
+			return nil, errors.WithMessagef(err, "couldn't check %s", file.PathAbs())
+		}
+		if changes != nil && !hasDrift(drifts, cf.DriftModified) && changes.touch(file.BackupPath()) {
+			drifts = append(drifts, cf.DriftModified)
+		}
+		statuses = append(statuses, FileStatus{File: file, Drifts: drifts})
+	}
+
+	return statuses, nil
+}
+
+func hasDrift(drifts []cf.Drift, drift cf.Drift) bool {
+	for _, d := range drifts {
+		if d == drift {
+			return true
+		}
+	}
+	return false
+}
+
+// The paths of the backup dir that changed since the last commit, relative to it.
+type worktreeChanges struct {
+	backupDir string
+	paths     []string
+}
+
+// Returns the changes of the backup dir's repository, or nil if there's no repository.
+func uncommittedChanges() (*worktreeChanges, error) {
+	backupDir := vconfig.GetConfig().BackupDir
+	repo, err := git.PlainOpen(backupDir)
+	if errors.Is(err, git.ErrRepositoryNotExists) {
+		return nil, nil
+	} else if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	w, err := repo.Worktree()
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	status, err := w.Status()
+	if err != nil {
+		return nil, errors.WithMessage(err, "couldn't read the status of the backup dir's repository")
+	}
+
+	changes := &worktreeChanges{backupDir: backupDir}
+	for path, fileStatus := range status {
+		if fileStatus.Worktree != git.Unmodified || fileStatus.Staging != git.Unmodified {
+			changes.paths = append(changes.paths, path)
+		}
+	}
+
+	return changes, nil
+}
+
+// Checks whether the backup file, or anything in the backup directory, changed.
+func (c *worktreeChanges) touch(backupPath string) bool {
+	rel, err := filepath.Rel(c.backupDir, backupPath)
+	if err != nil {
+		return false
+	}
+	rel = filepath.ToSlash(rel)
+
+	for _, path := range c.paths {
+		if path == rel || strings.HasPrefix(path, rel+"/") {
+			return true
+		}
+	}
+	return false
+}
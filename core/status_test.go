@@ -0,0 +1,61 @@
+package core
+
+import (
+	"os"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	cf "github.com/osamaadam/cfgrr/configfile"
+	"github.com/osamaadam/cfgrr/vconfig"
+)
+
+func TestStatus_Modified(t *testing.T) {
+	backupDir := t.TempDir()
+	files := _setupBackupEnv(backupDir, t.TempDir(), 2)
+	// Identical files would share their backup.
+	for i, file := range files {
+		os.WriteFile(file.PathAbs(), []byte{byte(i)}, 0644)
+	}
+	if err := BackupFiles(files...); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// Without a repository, the backup files aren't compared.
+	statuses, err := Status(files...)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, status := range statuses {
+		if len(status.Drifts) > 0 {
+			t.Errorf("expected %s to be in sync, got %v", status.File.Path, status.Drifts)
+		}
+	}
+
+	repo, err := git.PlainInit(vconfig.GetConfig().BackupDir, false)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	w, _ := repo.Worktree()
+	w.Add(".")
+	signature := &object.Signature{Name: "test", Email: "test@example.com", When: time.Now()}
+	if _, err := w.Commit("push", &git.CommitOptions{Author: signature}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// Edited through the symlink.
+	os.WriteFile(files[0].PathAbs(), []byte("edited"), files[0].Perm)
+
+	statuses, err = Status(files...)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := [][]cf.Drift{{cf.DriftModified}, nil}
+	for i, status := range statuses {
+		if !slices.Equal(status.Drifts, want[i]) {
+			t.Errorf("expected %s to have drifted by %v, got %v", status.File.Path, want[i], status.Drifts)
+		}
+	}
+}
@@ -0,0 +1,181 @@
+package core
+
+import (
+	"bufio"
+	"bytes"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	cf "github.com/osamaadam/cfgrr/configfile"
+	"github.com/pkg/errors"
+)
+
+// The file a stow package lists the files stow ignores in, replacing the defaults.
+const stowIgnoreFile = ".stow-local-ignore"
+
+// What stow ignores in packages without a `stowIgnoreFile`.
+var defaultStowIgnores = []string{
+	`RCS`, `.+,v`, `CVS`, `\.\#.+`, `\.cvsignore`, `\.svn`, `_darcs`, `\.hg`,
+	`\.git`, `\.gitignore`, `\.gitmodules`, `.+~`, `\#.*\#`,
+	`^/README.*`, `^/LICENSE.*`, `^/COPYING`,
+}
+
+// Lists the files of the packages of the stow directory `dir`, as stow would link them into `target`.
+// All the packages are listed if none are given.
+// With `dotfiles`, the "dot-" prefixes are replaced with dots, like stow's --dotfiles.
+// Each entry records the package it's from.
+func StowImports(dir, target string, dotfiles bool, packages ...string) ([]Import, error) {
+	if len(packages) == 0 {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		for _, entry := range entries {
+			if entry.IsDir() && !strings.HasPrefix(entry.Name(), ".") {
+				packages = append(packages, entry.Name())
+			}
+		}
+	}
+
+	var imports []Import
+	for _, pkg := range packages {
+		pkgImports, err := stowPackageImports(filepath.Join(dir, pkg), target, dotfiles)
+		if err != nil {
+			return nil, errors.WithMessagef(err, "couldn't read the stow package %s", pkg)
+		}
+		imports = append(imports, pkgImports...)
+	}
+
+	return imports, nil
+}
+
+func stowPackageImports(pkgDir, target string, dotfiles bool) ([]Import, error) {
+	info, err := os.Stat(pkgDir)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if !info.IsDir() {
+		return nil, errors.Errorf("%s isn't a directory", pkgDir)
+	}
+
+	ignores, err := readStowIgnores(pkgDir)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	var imports []Import
+	err = filepath.WalkDir(pkgDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		if path == pkgDir {
+			return nil
+		}
+
+		rel, err := filepath.Rel(pkgDir, path)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		if stowIgnored(ignores, rel) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() {
+			return nil
+		}
+
+		if dotfiles {
+			rel = undotStowPath(rel)
+		}
+		file, err := cf.NewConfigFile(filepath.Join(target, rel))
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		file.Package = filepath.Base(pkgDir)
+		imports = append(imports, Import{Source: path, File: file})
+
+		return nil
+	})
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return imports, nil
+}
+
+// An ignore pattern of a stow package.
+type stowIgnore struct {
+	pattern *regexp.Regexp
+	// Patterns with a slash match the path from the package's root, the others match the file name.
+	fullPath bool
+}
+
+// Reads the package's ignore patterns, or returns the defaults if it has none.
+func readStowIgnores(pkgDir string) ([]stowIgnore, error) {
+	patterns := defaultStowIgnores
+	content, err := os.ReadFile(filepath.Join(pkgDir, stowIgnoreFile))
+	if err == nil {
+		patterns = nil
+		scanner := bufio.NewScanner(bytes.NewReader(content))
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+			if strings.HasPrefix(line, "#") {
+				continue
+			}
+			// Comments follow whitespace.
+			if i := strings.Index(line, " #"); i >= 0 {
+				line = strings.TrimSpace(line[:i])
+			}
+			if line != "" {
+				patterns = append(patterns, line)
+			}
+		}
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return nil, errors.WithStack(err)
+	}
+	patterns = append(patterns, regexp.QuoteMeta(stowIgnoreFile))
+
+	ignores := make([]stowIgnore, len(patterns))
+	for i, pattern := range patterns {
+		ignore := stowIgnore{fullPath: strings.Contains(pattern, "/")}
+		anchored := "^(?:" + pattern + ")$"
+		if ignore.fullPath {
+			anchored = "(?:" + pattern + ")$"
+		}
+		if ignore.pattern, err = regexp.Compile(anchored); err != nil {
+			return nil, errors.WithMessagef(err, "invalid ignore pattern %q", pattern)
+		}
+		ignores[i] = ignore
+	}
+
+	return ignores, nil
+}
+
+func stowIgnored(ignores []stowIgnore, rel string) bool {
+	for _, ignore := range ignores {
+		subject := filepath.Base(rel)
+		if ignore.fullPath {
+			subject = "/" + filepath.ToSlash(rel)
+		}
+		if ignore.pattern.MatchString(subject) {
+			return true
+		}
+	}
+	return false
+}
+
+// Replaces the "dot-" prefixes of the path's components with dots.
+func undotStowPath(rel string) string {
+	parts := strings.Split(rel, string(filepath.Separator))
+	for i, part := range parts {
+		if strings.HasPrefix(part, "dot-") {
+			parts[i] = "." + strings.TrimPrefix(part, "dot-")
+		}
+	}
+	return filepath.Join(parts...)
+}
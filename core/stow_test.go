@@ -0,0 +1,92 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/osamaadam/cfgrr/mapfile"
+	"github.com/osamaadam/cfgrr/vconfig"
+)
+
+func TestImportStow(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	vconfig.GetConfig().SetBackupDir(filepath.Join(home, "backup"))
+	stowDir := filepath.Join(home, "dotfiles")
+
+	files := map[string]string{
+		"vim/.vimrc":               "set number",
+		"vim/.vim/colors/dark.vim": "hi Normal guibg=black",
+		"vim/README.md":            "ignored by stow",
+		"zsh/dot-zshrc":            "export EDITOR=vim",
+		"git/.gitconfig":           "not imported",
+	}
+	for path, content := range files {
+		path = filepath.Join(stowDir, path)
+		os.MkdirAll(filepath.Dir(path), 0755)
+		os.WriteFile(path, []byte(content), 0644)
+	}
+	// Like stow, the .vim directory is folded into a single link.
+	os.Symlink(filepath.Join("dotfiles", "vim", ".vimrc"), filepath.Join(home, ".vimrc"))
+	os.Symlink(filepath.Join("dotfiles", "vim", ".vim"), filepath.Join(home, ".vim"))
+	os.Symlink(filepath.Join("dotfiles", "zsh", "dot-zshrc"), filepath.Join(home, ".zshrc"))
+
+	imports, err := StowImports(stowDir, home, true, "vim", "zsh")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(imports) != 3 {
+		t.Fatalf("expected 3 files to import, got %d", len(imports))
+	}
+	if _, err := ImportFiles(stowDir, imports...); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	m, err := mapfile.NewMapFile().Parse()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	packages := make(map[string]string)
+	for _, file := range m {
+		packages[file.Path] = file.Package
+	}
+
+	tests := []struct {
+		path    string
+		pkg     string
+		content string
+	}{
+		{".vimrc", "vim", "set number"},
+		{filepath.Join(".vim", "colors", "dark.vim"), "vim", "hi Normal guibg=black"},
+		{".zshrc", "zsh", "export EDITOR=vim"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			if packages[tt.path] != tt.pkg {
+				t.Errorf("expected the package %q, got %q", tt.pkg, packages[tt.path])
+			}
+			live := filepath.Join(home, tt.path)
+			if info, err := os.Lstat(live); err != nil || info.Mode()&os.ModeSymlink == 0 {
+				t.Errorf("expected %s to be a symlink, got %v", live, err)
+			}
+			content, err := os.ReadFile(live)
+			if err != nil || string(content) != tt.content {
+				t.Errorf("expected %q, got %q (%v)", tt.content, content, err)
+			}
+		})
+	}
+
+	if info, err := os.Lstat(filepath.Join(home, ".vim")); err != nil || !info.IsDir() {
+		t.Errorf("expected the folded .vim link to be replaced with a directory, got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(stowDir, "zsh")); !os.IsNotExist(err) {
+		t.Errorf("expected the empty zsh package to be removed, got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(stowDir, "vim", "README.md")); err != nil {
+		t.Errorf("expected the ignored README.md to be left, got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(stowDir, "vim", ".vim")); !os.IsNotExist(err) {
+		t.Errorf("expected the empty .vim directory to be removed, got %v", err)
+	}
+}
@@ -0,0 +1,38 @@
+package core
+
+import (
+	cf "github.com/osamaadam/cfgrr/configfile"
+	"github.com/osamaadam/cfgrr/mapfile"
+	"github.com/pkg/errors"
+)
+
+// Keeps the files tagged with any of the tags, all the files are kept if there are no tags.
+func FilterByTags(files []*cf.ConfigFile, tags ...string) []*cf.ConfigFile {
+	if len(tags) == 0 {
+		return files
+	}
+
+	filtered := make([]*cf.ConfigFile, 0, len(files))
+	for _, file := range files {
+		if file.HasTag(tags...) {
+			filtered = append(filtered, file)
+		}
+	}
+	return filtered
+}
+
+// Adds the tags to the files, and removes the others.
+// The map file is updated.
+func TagFiles(add, remove []string, files ...*cf.ConfigFile) error {
+	for _, file := range files {
+		if err := file.UpdateTags(add, remove); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+
+	if err := mapfile.NewMapFile().AddFiles(files...); err != nil {
+		return errors.WithStack(err)
+	}
+
+	return nil
+}
@@ -0,0 +1,173 @@
+package core
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	cf "github.com/osamaadam/cfgrr/configfile"
+	"github.com/osamaadam/cfgrr/fileops"
+	"github.com/osamaadam/cfgrr/vconfig"
+	"github.com/pkg/errors"
+)
+
+// The journal of the running bulk operation is kept in this directory of the backup dir.
+const JournalDirName = ".journal"
+
+func JournalDir() string {
+	return filepath.Join(vconfig.GetConfig().BackupDir, JournalDirName)
+}
+
+// Runs an interrupted bulk operation again, with the arguments and files it was started with.
+type resumeFunc func(j *fileops.Journal, args map[string]string, files []*cf.ConfigFile, resolve ConflictResolver) error
+
+var resumers = map[string]resumeFunc{
+	"backup": func(j *fileops.Journal, _ map[string]string, files []*cf.ConfigFile, _ ConflictResolver) error {
+		return backupFiles(j, files...)
+	},
+	"restore": func(j *fileops.Journal, args map[string]string, files []*cf.ConfigFile, resolve ConflictResolver) error {
+		_, err := restoreFiles(j, cf.ConflictStrategy(args["conflict"]), resolve, files...)
+		return err
+	},
+	"delete": func(j *fileops.Journal, args map[string]string, files []*cf.ConfigFile, _ ConflictResolver) error {
+		restore, _ := strconv.ParseBool(args["restore"])
+		return deleteFiles(j, restore, files...)
+	},
+	"replicate": func(j *fileops.Journal, args map[string]string, files []*cf.ConfigFile, _ ConflictResolver) error {
+		return makeFilesBrowsable(j, args["home"], args["root"], files...)
+	},
+}
+
+// Runs a bulk operation as a journaled transaction, its changes are rolled back if it fails.
+// Operations started by another one join its transaction, planned operations (see `fileops.Planner`) have none.
+func transact(command string, args map[string]string, files []*cf.ConfigFile, run func(j *fileops.Journal) error) error {
+	switch ops := fileops.Current().(type) {
+	case *fileops.Journal:
+		return run(ops)
+	case *fileops.Planner:
+		return run(nil)
+	}
+
+	filesJSON, err := json.Marshal(files)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	j, err := fileops.Begin(JournalDir(), fileops.Header{Command: command, Args: args, Files: filesJSON})
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	return finish(j, run)
+}
+
+// Runs the transaction to its end, committing it if it succeeds and rolling it back otherwise.
+func finish(j *fileops.Journal, run func(j *fileops.Journal) error) error {
+	restore := fileops.Use(j)
+	err := run(j)
+	restore()
+
+	if err != nil {
+		if rollbackErr := j.Rollback(); rollbackErr != nil {
+			return errors.WithMessagef(err, "couldn't roll back the changes (%s), run `cfgrr recover` to retry", rollbackErr)
+		}
+		return errors.WithMessage(err, "the changes were rolled back")
+	}
+
+	return errors.WithStack(j.Commit())
+}
+
+// Runs a step of a bulk operation on the file, unless it was done before the operation was interrupted.
+// The state of the file after the step is recorded in the journal, and loaded from it when the step is skipped.
+// Without a journal, the step is just run.
+func checkpoint(j *fileops.Journal, step string, file *cf.ConfigFile, do func() error) error {
+	if j == nil {
+		return errors.WithStack(do())
+	}
+
+	key := step + ":" + file.PathAbs()
+	if done, err := j.Checkpointed(key, file); err != nil || done {
+		return errors.WithStack(err)
+	}
+
+	if err := do(); err != nil {
+		return errors.WithStack(err)
+	}
+
+	return errors.WithStack(j.Checkpoint(key, file))
+}
+
+// Returns the header of the journal an interrupted bulk operation left, or nil if there's none.
+func PendingJournal() (*fileops.Header, error) {
+	j, err := openJournal()
+	if err != nil || j == nil {
+		return nil, errors.WithStack(err)
+	}
+	defer j.Close()
+
+	header := j.Header()
+	return &header, nil
+}
+
+// Undoes all the changes of the interrupted bulk operation.
+// Returns its header, or nil if there's none.
+func RevertJournal() (*fileops.Header, error) {
+	j, err := openJournal()
+	if err != nil || j == nil {
+		return nil, errors.WithStack(err)
+	}
+
+	header := j.Header()
+	if err := j.Rollback(); err != nil {
+		return &header, errors.WithStack(err)
+	}
+
+	return &header, nil
+}
+
+// Finishes the interrupted bulk operation, keeping the files it was done with.
+// If it fails again, all its changes are rolled back.
+// `resolve` picks the conflict strategy of the files restored with the prompt strategy.
+// Returns its header, or nil if there's none.
+func ResumeJournal(resolve ConflictResolver) (*fileops.Header, error) {
+	j, err := openJournal()
+	if err != nil || j == nil {
+		return nil, errors.WithStack(err)
+	}
+
+	header := j.Header()
+	resume, ok := resumers[header.Command]
+	if !ok {
+		j.Close()
+		return &header, errors.Errorf("%q can't be resumed, revert it instead", header.Command)
+	}
+
+	var files []*cf.ConfigFile
+	if err := json.Unmarshal(header.Files, &files); err != nil {
+		j.Close()
+		return &header, errors.WithMessage(err, "couldn't parse the files of the journal")
+	}
+
+	// The file that was being worked on is started over.
+	if err := j.RollbackUnfinished(); err != nil {
+		j.Close()
+		return &header, errors.WithStack(err)
+	}
+
+	err = finish(j, func(j *fileops.Journal) error {
+		return resume(j, header.Args, files, resolve)
+	})
+
+	return &header, errors.WithStack(err)
+}
+
+// Opens the journal of the interrupted bulk operation, or returns nil if there's none.
+func openJournal() (*fileops.Journal, error) {
+	j, err := fileops.Open(JournalDir())
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+
+	return j, errors.WithStack(err)
+}
@@ -0,0 +1,102 @@
+package core
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	cf "github.com/osamaadam/cfgrr/configfile"
+	"github.com/osamaadam/cfgrr/fileops"
+	"github.com/osamaadam/cfgrr/helpers"
+	"github.com/osamaadam/cfgrr/mapfile"
+)
+
+func TestBackupFiles_Rollback(t *testing.T) {
+	dir := t.TempDir()
+	files := _setupBackupEnv(t.TempDir(), dir, 2)
+	os.WriteFile(files[0].PathAbs(), []byte("content"), 0644)
+	missing, _ := cf.NewConfigFile(filepath.Join(dir, "missing"))
+	files = append(files, missing)
+
+	if err := BackupFiles(files...); err == nil {
+		t.Fatalf("Expected an error backing up a missing file")
+	}
+
+	for _, f := range files[:2] {
+		if ok, err := helpers.CheckIfSymlink(f.PathAbs()); ok || err != nil {
+			t.Errorf("Expected %s to be back in place, got symlink %v, %v", f.PathAbs(), ok, err)
+		}
+	}
+	if content, _ := os.ReadFile(files[0].PathAbs()); string(content) != "content" {
+		t.Errorf("Expected the content to be kept, got %q", content)
+	}
+	if m, _ := mapfile.NewMapFile().Parse(); len(m) != 0 {
+		t.Errorf("Expected the map file to be empty, got %d entries", len(m))
+	}
+	if _, err := os.Stat(JournalDir()); !os.IsNotExist(err) {
+		t.Errorf("Expected the journal to be deleted, got %v", err)
+	}
+}
+
+func TestRecoverJournal(t *testing.T) {
+	tests := []struct {
+		name   string
+		resume bool
+	}{
+		{"resume", true},
+		{"revert", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			files := _setupBackupEnv(t.TempDir(), t.TempDir(), 3)
+
+			// Back up the first file, and get killed while backing up the second.
+			filesJSON, _ := json.Marshal(files)
+			j, err := fileops.Begin(JournalDir(), fileops.Header{Command: "backup", Files: filesJSON})
+			if err != nil {
+				t.Fatalf("Expected no error, got %s", err)
+			}
+			restore := fileops.Use(j)
+			checkpoint(j, "backup", files[0], files[0].Backup)
+			files[1].Backup()
+			restore()
+			j.Close()
+
+			if err := BackupFiles(files[2]); err == nil {
+				t.Fatalf("Expected the interrupted backup to block new ones")
+			}
+			if pending, _ := PendingJournal(); pending == nil || pending.Command != "backup" {
+				t.Fatalf("Expected a pending backup, got %+v", pending)
+			}
+
+			if tt.resume {
+				_, err = ResumeJournal(nil)
+			} else {
+				_, err = RevertJournal()
+			}
+			if err != nil {
+				t.Fatalf("Expected no error, got %s", err)
+			}
+
+			m, _ := mapfile.NewMapFile().Parse()
+			for _, f := range files {
+				linked, _ := helpers.CheckIfSymlink(f.PathAbs())
+				if linked != tt.resume {
+					t.Errorf("Expected %s to be linked: %v, got %v", f.PathAbs(), tt.resume, linked)
+				}
+				entry, ok := m[f.HashShort()]
+				if ok != tt.resume {
+					t.Errorf("Expected %s to be in the map file: %v, got %v", f.PathAbs(), tt.resume, ok)
+				}
+				if ok && entry.Blob == "" {
+					t.Errorf("Expected the blob of %s to be recorded", f.PathAbs())
+				}
+			}
+			if pending, _ := PendingJournal(); pending != nil {
+				t.Errorf("Expected no pending journal, got %+v", pending)
+			}
+		})
+	}
+}
@@ -0,0 +1,290 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	cf "github.com/osamaadam/cfgrr/configfile"
+	"github.com/osamaadam/cfgrr/fileops"
+	"github.com/osamaadam/cfgrr/helpers"
+	"github.com/osamaadam/cfgrr/mapfile"
+	"github.com/osamaadam/cfgrr/vconfig"
+	"github.com/pkg/errors"
+)
+
+// The local state of the background watcher (its pid and log) is kept in this directory of the backup dir.
+const WatchDirName = ".watch"
+
+func WatchDir() string {
+	return filepath.Join(vconfig.GetConfig().BackupDir, WatchDirName)
+}
+
+// Watches the backup files and the live files of the map file's entries for changes.
+// The live files are watched through their directories, so files replaced by editors saving atomically are caught too.
+// Command entries have no files to watch, their changes are only caught when the files are synced.
+type Watcher struct {
+	watcher  *fsnotify.Watcher
+	debounce time.Duration
+	mapPath  string
+	// The content of the map file when it was last read, it's rewritten as is by some operations.
+	mapContent []byte
+	files      []*cf.ConfigFile
+	watched    map[string]bool
+}
+
+// Starts watching the entries of the map file.
+// The changes are reported once no more happened for `debounce`, so a burst of writes is reported as one.
+func NewWatcher(debounce time.Duration) (*Watcher, error) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, errors.WithMessage(err, "couldn't start watching the files")
+	}
+
+	w := &Watcher{
+		watcher:  watcher,
+		debounce: debounce,
+		mapPath:  filepath.Clean(vconfig.GetConfig().GetMapFilePath()),
+		watched:  make(map[string]bool),
+	}
+	if err := w.refresh(); err != nil {
+		watcher.Close()
+		return nil, errors.WithStack(err)
+	}
+
+	return w, nil
+}
+
+func (w *Watcher) Close() error {
+	return errors.WithStack(w.watcher.Close())
+}
+
+// Returns the number of the watched directories.
+func (w *Watcher) Watched() int {
+	return len(w.watched)
+}
+
+// Reads the map file again, and watches the directories of the entries that aren't watched yet.
+func (w *Watcher) refresh() error {
+	m, err := mapfile.NewMapFile().Parse()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	w.files = helpers.GetMapValues(m)
+	w.mapContent, _ = fileops.ReadFile(w.mapPath)
+
+	for _, dir := range []string{filepath.Dir(w.mapPath), cf.BlobsPath()} {
+		if err := w.watchTree(dir, false); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+
+	for _, file := range w.files {
+		var err error
+		switch {
+		case file.IsCommand(), file.Unmet() != "":
+			continue
+		case file.IsDir():
+			// Tracked directories are symlinked, the files inside them are written in the backup.
+			err = w.watchTree(file.BackupPath(), true)
+		default:
+			err = w.watchTree(filepath.Dir(file.PathAbs()), false)
+		}
+		if err != nil {
+			return errors.WithStack(err)
+		}
+	}
+
+	return nil
+}
+
+// Watches the directory, and its sub directories if `recursive` is set.
+// Directories that don't exist (e.g. of files that aren't restored) are skipped.
+func (w *Watcher) watchTree(dir string, recursive bool) error {
+	return filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) || errors.Is(err, os.ErrPermission) {
+				return nil
+			}
+			return errors.WithStack(err)
+		}
+		if !d.IsDir() {
+			return nil
+		}
+		if !w.watched[path] {
+			if err := w.watcher.Add(path); err != nil {
+				return errors.WithMessagef(err, "couldn't watch %s", path)
+			}
+			w.watched[path] = true
+		}
+		if !recursive && path != dir {
+			return filepath.SkipDir
+		}
+		return nil
+	})
+}
+
+// Returns the tracked directory whose backup holds the path, nil if there's none.
+func (w *Watcher) trackedDir(path string) *cf.ConfigFile {
+	for _, file := range w.files {
+		if file.IsDir() && isInside(file.BackupPath(), path) {
+			return file
+		}
+	}
+	return nil
+}
+
+// Returns the paths of the entries (or the map file) changed by the event.
+func (w *Watcher) changedPaths(event fsnotify.Event) ([]string, error) {
+	if event.Op == fsnotify.Chmod {
+		// cfgrr reapplies the modes itself, only the content matters.
+		return nil, nil
+	}
+
+	path := filepath.Clean(event.Name)
+	if path == w.mapPath {
+		if content, err := fileops.ReadFile(path); err == nil && bytes.Equal(content, w.mapContent) {
+			return nil, nil
+		}
+		return []string{path}, nil
+	}
+
+	if dir := w.trackedDir(path); dir != nil {
+		if event.Has(fsnotify.Create) {
+			// New sub directories are watched too.
+			if err := w.watchTree(path, true); err != nil {
+				return nil, errors.WithStack(err)
+			}
+		}
+		return []string{dir.PathAbs()}, nil
+	}
+
+	var paths []string
+	blobsDir := cf.BlobsPath()
+	for _, file := range w.files {
+		switch {
+		case file.IsCommand(), file.IsDir():
+			continue
+		case file.PathAbs() == path,
+			filepath.Dir(path) == blobsDir && file.Blob == filepath.Base(path):
+			paths = append(paths, file.PathAbs())
+		}
+	}
+
+	return paths, nil
+}
+
+// Watches the files until the context is done, sending the paths changed in each burst of writes to `changes`, sorted.
+// The paths changed right before the context is done are sent before it returns.
+// When the map file changes, the entries added to it are watched too.
+func (w *Watcher) Run(ctx context.Context, changes chan<- []string) error {
+	pending := make(map[string]bool)
+	timer := time.NewTimer(w.debounce)
+	timer.Stop()
+
+	flush := func() error {
+		if len(pending) == 0 {
+			return nil
+		}
+		if pending[w.mapPath] {
+			// The map file is read once the writes are over, it could be half written before.
+			if err := w.refresh(); err != nil {
+				return errors.WithStack(err)
+			}
+		}
+		paths := helpers.GetMapKeys(pending)
+		sort.Strings(paths)
+		changes <- paths
+		pending = make(map[string]bool)
+		return nil
+	}
+
+	collect := func(event fsnotify.Event) error {
+		paths, err := w.changedPaths(event)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		for _, path := range paths {
+			pending[path] = true
+		}
+		if len(paths) > 0 {
+			timer.Reset(w.debounce)
+		}
+		return nil
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			// The events queued before it was done are reported too.
+			for {
+				select {
+				case event, ok := <-w.watcher.Events:
+					if !ok {
+						return flush()
+					}
+					if err := collect(event); err != nil {
+						return errors.WithStack(err)
+					}
+				default:
+					return flush()
+				}
+			}
+		case event, ok := <-w.watcher.Events:
+			if !ok {
+				return flush()
+			}
+			if err := collect(event); err != nil {
+				return errors.WithStack(err)
+			}
+		case err, ok := <-w.watcher.Errors:
+			if !ok {
+				return flush()
+			}
+			return errors.WithMessage(err, "couldn't watch the files")
+		case <-timer.C:
+			if err := flush(); err != nil {
+				return errors.WithStack(err)
+			}
+		}
+	}
+}
+
+// Splits the changed paths, once the files are synced, into the ones whose content is in the backup dir
+// and the ones that drifted from it, which syncing doesn't bring back
+// (e.g. a symlinked file replaced by an editor saving through a rename, or a deleted file).
+func SplitDrifted(paths []string) (synced, drifted []string, err error) {
+	m, err := mapfile.NewMapFile().Parse()
+	if err != nil {
+		return nil, nil, errors.WithStack(err)
+	}
+	byPath := make(map[string]*cf.ConfigFile, len(m))
+	for _, file := range m {
+		byPath[file.PathAbs()] = file
+	}
+
+	for _, path := range paths {
+		file, ok := byPath[path]
+		if !ok || file.IsDir() || file.IsCommand() {
+			synced = append(synced, path)
+			continue
+		}
+		drifts, err := file.Drift()
+		if err != nil {
+			return nil, nil, errors.WithMessagef(err, "couldn't check %s", path)
+		}
+		if hasDrift(drifts, cf.DriftMissing) || hasDrift(drifts, cf.DriftElsewhere) ||
+			hasDrift(drifts, cf.DriftReplaced) || hasDrift(drifts, cf.DriftModified) {
+			drifted = append(drifted, path)
+		} else {
+			synced = append(synced, path)
+		}
+	}
+
+	return synced, drifted, nil
+}
@@ -0,0 +1,99 @@
+package core
+
+import (
+	"context"
+	"os"
+	"slices"
+	"testing"
+	"time"
+
+	cf "github.com/osamaadam/cfgrr/configfile"
+	"github.com/osamaadam/cfgrr/vconfig"
+)
+
+func TestWatcher(t *testing.T) {
+	files := _setupBackupEnv(t.TempDir(), t.TempDir(), 3)
+	if err := BackupFiles(files...); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := RelinkFiles(cf.LinkCopy, files[1]); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	watcher, err := NewWatcher(200 * time.Millisecond)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer watcher.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	changes := make(chan []string)
+	done := make(chan error, 1)
+	go func() { done <- watcher.Run(ctx, changes) }()
+
+	// A burst of writes through the symlink and to the copy is reported once.
+	for i := 0; i < 3; i++ {
+		os.WriteFile(files[0].PathAbs(), []byte{byte(i)}, 0644)
+		os.WriteFile(files[1].PathAbs(), []byte{byte(i)}, 0644)
+	}
+
+	want := []string{files[0].PathAbs(), files[1].PathAbs()}
+	slices.Sort(want)
+	select {
+	case paths := <-changes:
+		if !slices.Equal(paths, want) {
+			t.Errorf("expected %v, got %v", want, paths)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the changes to be reported")
+	}
+
+	// The changes pending when the watcher stops are reported too.
+	os.WriteFile(files[2].PathAbs(), []byte("pending"), 0644)
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+	select {
+	case paths := <-changes:
+		if !slices.Equal(paths, []string{files[2].PathAbs()}) {
+			t.Errorf("expected %s, got %v", files[2].PathAbs(), paths)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the pending changes to be reported")
+	}
+	if err := <-done; err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestSplitDrifted(t *testing.T) {
+	files := _setupBackupEnv(t.TempDir(), t.TempDir(), 4)
+	if err := BackupFiles(files...); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := RelinkFiles(cf.LinkCopy, files[2]); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// An editor saving through a rename replaces the symlink with a copy.
+	os.Remove(files[0].PathAbs())
+	os.WriteFile(files[0].PathAbs(), []byte("replaced"), 0644)
+	os.WriteFile(files[1].PathAbs(), []byte("through the symlink"), 0644)
+	os.WriteFile(files[2].PathAbs(), []byte("copy"), 0644)
+	os.Remove(files[3].PathAbs())
+	if err := SyncFiles(files...); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	mapPath := vconfig.GetConfig().GetMapFilePath()
+	paths := []string{files[0].PathAbs(), files[1].PathAbs(), files[2].PathAbs(), files[3].PathAbs(), mapPath}
+	synced, drifted, err := SplitDrifted(paths)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := []string{files[1].PathAbs(), files[2].PathAbs(), mapPath}; !slices.Equal(synced, want) {
+		t.Errorf("expected %v to be synced, got %v", want, synced)
+	}
+	if want := []string{files[0].PathAbs(), files[3].PathAbs()}; !slices.Equal(drifted, want) {
+		t.Errorf("expected %v to have drifted, got %v", want, drifted)
+	}
+}
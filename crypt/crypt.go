@@ -0,0 +1,206 @@
+// Encryption of the backup files.
+package crypt
+
+import (
+	"bytes"
+	"crypto/cipher"
+	"crypto/rand"
+	"os"
+	"sync"
+
+	"github.com/AlecAivazis/survey/v2"
+	"github.com/osamaadam/cfgrr/vconfig"
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/crypto/scrypt"
+)
+
+// The environment variable holding the passphrase.
+const PassphraseEnv = "CFGRR_PASSPHRASE"
+
+// Marks the encrypted files, followed by the version of the format.
+var magic = []byte("cfgrr-enc\x01")
+
+const saltSize = 16
+
+var (
+	mu       sync.Mutex
+	prompted []byte
+	// Whether the prompted passphrase is known to be the right one, i.e. it was typed twice or it decrypted content.
+	confirmed bool
+	// Deriving a key is slow by design, so each key is derived once.
+	keys = make(map[string][]byte)
+)
+
+// Prompts the user for the passphrase, replaced in tests.
+var askPassphrase = func(message string) ([]byte, error) {
+	var passphrase string
+	prompt := &survey.Password{
+		Message: message,
+	}
+	if err := survey.AskOne(prompt, &passphrase, survey.WithValidator(survey.Required)); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return []byte(passphrase), nil
+}
+
+// Encrypts the content with a key derived from the secret.
+// Every call uses a new salt and nonce, so encrypting the same content twice gives different results.
+func Encrypt(secret, plaintext []byte) ([]byte, error) {
+	salt := make([]byte, saltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	aead, err := newAEAD(secret, salt)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(plaintext)+aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	header := append(append([]byte{}, magic...), salt...)
+	sealed := aead.Seal(nonce, nonce, plaintext, header)
+
+	return append(header, sealed...), nil
+}
+
+// Decrypts content encrypted by `Encrypt`.
+func Decrypt(secret, data []byte) ([]byte, error) {
+	if !IsEncrypted(data) {
+		return nil, errors.New("the content isn't encrypted by cfgrr")
+	}
+
+	headerSize := len(magic) + saltSize
+	if len(data) < headerSize+chacha20poly1305.NonceSizeX {
+		return nil, errors.New("the encrypted content is truncated")
+	}
+	header, rest := data[:headerSize], data[headerSize:]
+
+	aead, err := newAEAD(secret, header[len(magic):])
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	nonce, sealed := rest[:aead.NonceSize()], rest[aead.NonceSize():]
+	plaintext, err := aead.Open(nil, nonce, sealed, header)
+	if err != nil {
+		return nil, errors.New("couldn't decrypt, either the passphrase is wrong or the content is corrupted")
+	}
+
+	mu.Lock()
+	if prompted != nil && bytes.Equal(secret, prompted) {
+		confirmed = true
+	}
+	mu.Unlock()
+
+	return plaintext, nil
+}
+
+// Checks whether the content was encrypted by `Encrypt`.
+func IsEncrypted(data []byte) bool {
+	return bytes.HasPrefix(data, magic)
+}
+
+func newAEAD(secret, salt []byte) (cipher.AEAD, error) {
+	key, err := deriveKey(secret, salt)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return chacha20poly1305.NewX(key)
+}
+
+func deriveKey(secret, salt []byte) ([]byte, error) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	id := string(secret) + "\x00" + string(salt)
+	if key, ok := keys[id]; ok {
+		return key, nil
+	}
+
+	key, err := scrypt.Key(secret, salt, 1<<15, 8, 1, chacha20poly1305.KeySize)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	keys[id] = key
+
+	return key, nil
+}
+
+// Returns the secret the keys are derived from.
+// It's read from the key file set as `key_file` in the config, or the `CFGRR_PASSPHRASE` environment variable,
+// otherwise the user is prompted for a passphrase once.
+func Secret() ([]byte, error) {
+	return secret(false)
+}
+
+// Returns the secret new content is encrypted with, see `Secret`.
+// A prompted passphrase is asked for again, unless it already decrypted content, so a typo doesn't lock the content away.
+func EncryptionSecret() ([]byte, error) {
+	return secret(true)
+}
+
+func secret(confirm bool) ([]byte, error) {
+	if keyFile := vconfig.GetConfig().KeyFile; keyFile != "" {
+		return readKeyFile(keyFile)
+	}
+
+	if passphrase := os.Getenv(PassphraseEnv); passphrase != "" {
+		return []byte(passphrase), nil
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	if prompted == nil {
+		passphrase, err := askPassphrase("Passphrase of the encrypted files:")
+		if err != nil {
+			return nil, errors.WithMessagef(err, "couldn't read the passphrase, set 'key_file' in the config or %s instead", PassphraseEnv)
+		}
+		prompted = passphrase
+	}
+
+	if confirm && !confirmed {
+		again, err := askPassphrase("Confirm the passphrase:")
+		if err != nil {
+			return nil, errors.WithMessage(err, "couldn't read the passphrase")
+		}
+		if !bytes.Equal(again, prompted) {
+			prompted = nil
+			return nil, errors.New("the passphrases don't match")
+		}
+		confirmed = true
+	}
+
+	return prompted, nil
+}
+
+// Checks the secret could be read without prompting the user, for the commands running unattended.
+func CheckSecret() error {
+	if keyFile := vconfig.GetConfig().KeyFile; keyFile != "" {
+		_, err := readKeyFile(keyFile)
+		return errors.WithStack(err)
+	}
+	if os.Getenv(PassphraseEnv) == "" {
+		return errors.Errorf("neither 'key_file' in the config nor %s is set", PassphraseEnv)
+	}
+
+	return nil
+}
+
+func readKeyFile(keyFile string) ([]byte, error) {
+	secret, err := os.ReadFile(keyFile)
+	if err != nil {
+		return nil, errors.WithMessage(err, "couldn't read the key file")
+	}
+	if len(bytes.TrimSpace(secret)) == 0 {
+		return nil, errors.Errorf("the key file %s is empty", keyFile)
+	}
+
+	return secret, nil
+}
@@ -0,0 +1,157 @@
+package crypt
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/osamaadam/cfgrr/vconfig"
+)
+
+func TestEncryptDecrypt(t *testing.T) {
+	tests := []struct {
+		name    string
+		secret  string
+		tamper  func(data []byte) []byte
+		wantErr bool
+	}{
+		{"round trip", "hunter2", nil, false},
+		{"wrong secret", "hunter3", nil, true},
+		{"tampered content", "hunter2", func(data []byte) []byte {
+			data[len(data)-1] ^= 0xff
+			return data
+		}, true},
+		{"tampered salt", "hunter2", func(data []byte) []byte {
+			data[len(magic)] ^= 0xff
+			return data
+		}, true},
+		{"truncated", "hunter2", func(data []byte) []byte { return data[:len(magic)+4] }, true},
+		{"not encrypted", "hunter2", func(data []byte) []byte { return []byte("machine example.com") }, true},
+	}
+
+	plaintext := []byte("machine example.com login me password hunter2")
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := Encrypt([]byte("hunter2"), plaintext)
+			if err != nil {
+				t.Fatalf("expected no error, got %s", err)
+			}
+			if bytes.Contains(data, plaintext) {
+				t.Fatalf("expected the plaintext not to be in the encrypted content")
+			}
+			if !IsEncrypted(data) {
+				t.Fatalf("expected the content to be recognized as encrypted")
+			}
+			if tt.tamper != nil {
+				data = tt.tamper(data)
+			}
+
+			out, err := Decrypt([]byte(tt.secret), data)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Decrypt() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !bytes.Equal(out, plaintext) {
+				t.Errorf("expected %q, got %q", plaintext, out)
+			}
+		})
+	}
+}
+
+func TestEncrypt_Unique(t *testing.T) {
+	a, _ := Encrypt([]byte("secret"), []byte("content"))
+	b, _ := Encrypt([]byte("secret"), []byte("content"))
+	if bytes.Equal(a, b) {
+		t.Errorf("expected encrypting twice to give different results")
+	}
+}
+
+func TestCheckSecret(t *testing.T) {
+	dir := t.TempDir()
+	keyFile, emptyKeyFile := filepath.Join(dir, "key"), filepath.Join(dir, "empty")
+	os.WriteFile(keyFile, []byte("hunter2"), 0600)
+	os.WriteFile(emptyKeyFile, []byte("\n"), 0600)
+	config := vconfig.GetConfig()
+	t.Cleanup(func() { config.SetKeyFile("") })
+
+	tests := []struct {
+		name       string
+		keyFile    string
+		passphrase string
+		wantErr    bool
+	}{
+		{"key file", keyFile, "", false},
+		{"passphrase", "", "hunter2", false},
+		{"empty key file", emptyKeyFile, "hunter2", true},
+		{"missing key file", filepath.Join(dir, "missing"), "", true},
+		{"neither", "", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config.SetKeyFile(tt.keyFile)
+			t.Setenv(PassphraseEnv, tt.passphrase)
+
+			if err := CheckSecret(); (err != nil) != tt.wantErr {
+				t.Errorf("expected error %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestEncryptionSecret(t *testing.T) {
+	vconfig.GetConfig().SetKeyFile("")
+	t.Setenv(PassphraseEnv, "")
+	prevAsk := askPassphrase
+	t.Cleanup(func() {
+		askPassphrase = prevAsk
+		prompted, confirmed = nil, false
+	})
+
+	tests := []struct {
+		name    string
+		answers []string
+		// Whether the passphrase decrypted content before, which confirms it.
+		decrypted bool
+		asked     int
+		wantErr   bool
+	}{
+		{"typed twice", []string{"hunter2", "hunter2"}, false, 2, false},
+		{"typo", []string{"hunter2", "hunter3"}, false, 2, true},
+		{"decrypted before", []string{"hunter2"}, true, 1, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			prompted, confirmed = nil, false
+			asked := 0
+			askPassphrase = func(string) ([]byte, error) {
+				if asked >= len(tt.answers) {
+					t.Fatalf("expected to be asked %d times only", len(tt.answers))
+				}
+				asked++
+				return []byte(tt.answers[asked-1]), nil
+			}
+
+			if tt.decrypted {
+				secret, _ := Secret()
+				encrypted, _ := Encrypt([]byte("hunter2"), []byte("content"))
+				if _, err := Decrypt(secret, encrypted); err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+			}
+
+			secret, err := EncryptionSecret()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("expected error %v, got %v", tt.wantErr, err)
+			}
+			if asked != tt.asked {
+				t.Errorf("expected to be asked %d times, got %d", tt.asked, asked)
+			}
+			if !tt.wantErr && string(secret) != "hunter2" {
+				t.Errorf("expected the passphrase, got %q", secret)
+			}
+		})
+	}
+}
@@ -0,0 +1,260 @@
+package fileops
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"time"
+
+	"github.com/osamaadam/cfgrr/helpers"
+	"github.com/pkg/errors"
+)
+
+// The filesystem reads that have to see the changes made through `Ops`,
+// which matters when the changes aren't actually made (see `Planner`).
+type Reads interface {
+	Lstat(path string) (os.FileInfo, error)
+	Stat(path string) (os.FileInfo, error)
+	Readlink(path string) (string, error)
+	ReadFile(path string) ([]byte, error)
+	// Returns where the content of `path` could be read from directly, e.g. to walk a directory.
+	Locate(path string) string
+}
+
+// The filesystem changes cfgrr makes, routed through a swappable implementation
+// so bulk operations could record them in a journal and roll them back, or only plan them.
+// As in the helpers, the destination comes first.
+type Ops interface {
+	Reads
+	// Creates a directory and its parents if they don't exist.
+	MkdirAll(path string) error
+	Remove(path string) error
+	RemoveAll(path string) error
+	// Moves a file or a directory, replacing the destination if it's a file.
+	Move(dest, origin string) error
+	Symlink(dest, target string) error
+	// Hard links the origin at dest, which must not exist.
+	Link(dest, origin string) error
+	// Hard links the origin at dest, replacing dest if it exists.
+	LinkFile(dest, origin string) error
+	WriteFile(path string, content []byte, perm os.FileMode) error
+	CopyFile(dest, origin string) error
+	CopyTree(dest, origin string) error
+	// Mirrors the origin tree at dest with hard links, replacing dest if it exists.
+	LinkTree(dest, origin string) error
+	Chmod(path string, mode os.FileMode) error
+	Chown(path string, uid, gid int) error
+	Chtimes(path string, mtime time.Time) error
+	Setxattr(path, name string, value []byte) error
+}
+
+// Reads the filesystem as is.
+type osReads struct{}
+
+func (osReads) Lstat(path string) (os.FileInfo, error) {
+	info, err := os.Lstat(path)
+	return info, errors.WithStack(err)
+}
+
+func (osReads) Stat(path string) (os.FileInfo, error) {
+	info, err := os.Stat(path)
+	return info, errors.WithStack(err)
+}
+
+func (osReads) Readlink(path string) (string, error) {
+	target, err := os.Readlink(path)
+	return target, errors.WithStack(err)
+}
+
+func (osReads) ReadFile(path string) ([]byte, error) {
+	content, err := os.ReadFile(path)
+	return content, errors.WithStack(err)
+}
+
+func (osReads) Locate(path string) string {
+	return path
+}
+
+// Makes the changes right away.
+type OS struct {
+	osReads
+}
+
+func (OS) MkdirAll(path string) error {
+	return helpers.EnsureDirExists(path)
+}
+
+func (OS) Remove(path string) error {
+	return errors.WithStack(os.Remove(path))
+}
+
+func (OS) RemoveAll(path string) error {
+	return errors.WithStack(os.RemoveAll(path))
+}
+
+func (OS) Move(dest, origin string) error {
+	return helpers.MoveFile(dest, origin)
+}
+
+func (OS) Symlink(dest, target string) error {
+	return errors.WithStack(os.Symlink(target, dest))
+}
+
+func (OS) Link(dest, origin string) error {
+	return errors.WithStack(os.Link(origin, dest))
+}
+
+func (OS) LinkFile(dest, origin string) error {
+	return helpers.LinkFile(dest, origin)
+}
+
+func (OS) WriteFile(path string, content []byte, perm os.FileMode) error {
+	return errors.WithStack(os.WriteFile(path, content, perm))
+}
+
+func (OS) CopyFile(dest, origin string) error {
+	return helpers.CopyFile(dest, origin)
+}
+
+func (OS) CopyTree(dest, origin string) error {
+	return helpers.CopyTree(dest, origin)
+}
+
+func (OS) LinkTree(dest, origin string) error {
+	return helpers.LinkTree(dest, origin)
+}
+
+func (OS) Chmod(path string, mode os.FileMode) error {
+	return errors.WithStack(os.Chmod(path, mode))
+}
+
+func (OS) Chown(path string, uid, gid int) error {
+	return errors.WithStack(os.Chown(path, uid, gid))
+}
+
+func (OS) Chtimes(path string, mtime time.Time) error {
+	return errors.WithStack(os.Chtimes(path, time.Time{}, mtime))
+}
+
+// The implementation the package functions go through.
+var active Ops = OS{}
+
+// Returns the implementation the changes currently go through.
+func Current() Ops {
+	return active
+}
+
+// Routes the changes through `ops` until the returned function is called.
+func Use(ops Ops) (restore func()) {
+	previous := active
+	active = ops
+	return func() { active = previous }
+}
+
+func MkdirAll(path string) error {
+	return active.MkdirAll(path)
+}
+
+func Remove(path string) error {
+	return active.Remove(path)
+}
+
+func RemoveAll(path string) error {
+	return active.RemoveAll(path)
+}
+
+func Move(dest, origin string) error {
+	return active.Move(dest, origin)
+}
+
+func Symlink(dest, target string) error {
+	return active.Symlink(dest, target)
+}
+
+func Link(dest, origin string) error {
+	return active.Link(dest, origin)
+}
+
+func LinkFile(dest, origin string) error {
+	return active.LinkFile(dest, origin)
+}
+
+func WriteFile(path string, content []byte, perm os.FileMode) error {
+	return active.WriteFile(path, content, perm)
+}
+
+func CopyFile(dest, origin string) error {
+	return active.CopyFile(dest, origin)
+}
+
+func CopyTree(dest, origin string) error {
+	return active.CopyTree(dest, origin)
+}
+
+func LinkTree(dest, origin string) error {
+	return active.LinkTree(dest, origin)
+}
+
+func Chmod(path string, mode os.FileMode) error {
+	return active.Chmod(path, mode)
+}
+
+func Chown(path string, uid, gid int) error {
+	return active.Chown(path, uid, gid)
+}
+
+// Sets the modification time, leaving the access time as is.
+func Chtimes(path string, mtime time.Time) error {
+	return active.Chtimes(path, mtime)
+}
+
+func Setxattr(path, name string, value []byte) error {
+	return active.Setxattr(path, name, value)
+}
+
+func Lstat(path string) (os.FileInfo, error) {
+	return active.Lstat(path)
+}
+
+func Stat(path string) (os.FileInfo, error) {
+	return active.Stat(path)
+}
+
+func Readlink(path string) (string, error) {
+	return active.Readlink(path)
+}
+
+func ReadFile(path string) ([]byte, error) {
+	return active.ReadFile(path)
+}
+
+func Locate(path string) string {
+	return active.Locate(path)
+}
+
+// Checks if a file exists, following symlinks like `helpers.CheckFileExists`.
+func Exists(path string) bool {
+	_, err := active.Stat(path)
+	return !errors.Is(err, os.ErrNotExist)
+}
+
+// Checks if the given path is a path to a symlink.
+func IsSymlink(path string) (bool, error) {
+	info, err := active.Lstat(path)
+	if err != nil {
+		return false, errors.WithStack(err)
+	}
+
+	return info.Mode()&os.ModeSymlink != 0, nil
+}
+
+// Returns the hex encoded sha256 digest of the file's content.
+func FileDigest(path string) (string, error) {
+	content, err := active.ReadFile(path)
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+
+	digest := sha256.Sum256(content)
+	return hex.EncodeToString(digest[:]), nil
+}
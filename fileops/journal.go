@@ -0,0 +1,643 @@
+package fileops
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/osamaadam/cfgrr/helpers"
+	"github.com/pkg/errors"
+)
+
+// Returned when starting a transaction while an interrupted one still has a journal.
+var ErrPending = errors.New("an interrupted operation left a journal behind, run `cfgrr recover` to resume or revert it")
+
+const (
+	headerFile = "header.json"
+	stepsFile  = "steps.jsonl"
+	stashDir   = "stash"
+)
+
+// What started the transaction, enough to run it again if it's interrupted.
+type Header struct {
+	Command string            `json:"command"`
+	Args    map[string]string `json:"args,omitempty"`
+	// The files the command was run with, as JSON.
+	Files   json.RawMessage `json:"files,omitempty"`
+	Started time.Time       `json:"started"`
+}
+
+type stepKind string
+
+const (
+	// The path didn't exist, undoing removes it.
+	stepCreate stepKind = "create"
+	// The path was moved to the stash, to be replaced or removed. Undoing moves it back.
+	stepStash stepKind = "stash"
+	stepMove  stepKind = "move"
+	stepMkdir stepKind = "mkdir"
+	// An empty directory was removed, undoing creates it again.
+	stepRmdir stepKind = "rmdir"
+	stepChmod stepKind = "chmod"
+	// The file was copied to the stash before it's written in place, which keeps its hard links.
+	// Undoing writes the copy back in place.
+	stepRewrite stepKind = "rewrite"
+	stepChown   stepKind = "chown"
+	stepChtimes stepKind = "chtimes"
+	// An extended attribute was set, undoing sets its previous value or removes it if it had none.
+	stepSetxattr stepKind = "setxattr"
+	// Marks a unit of work as done, the steps before it are kept when resuming.
+	stepCheckpoint stepKind = "checkpoint"
+)
+
+type step struct {
+	Kind   stepKind `json:"kind"`
+	Path   string   `json:"path,omitempty"`
+	Origin string   `json:"origin,omitempty"`
+	Stash  string   `json:"stash,omitempty"`
+	// Whether the destination of a move existed before it.
+	Existed bool            `json:"existed,omitempty"`
+	Mode    os.FileMode     `json:"mode,omitempty"`
+	UID     int             `json:"uid,omitempty"`
+	GID     int             `json:"gid,omitempty"`
+	ModTime *time.Time      `json:"mtime,omitempty"`
+	Name    string          `json:"name,omitempty"`
+	Value   []byte          `json:"value,omitempty"`
+	Key     string          `json:"key,omitempty"`
+	State   json.RawMessage `json:"state,omitempty"`
+}
+
+// Makes the changes while recording them in a journal directory, so they could be undone.
+// Each step is written to disk before it's made, so a crash leaves a journal that could be reverted.
+// Whatever is removed or replaced is kept in the journal until the transaction is committed.
+type Journal struct {
+	osReads
+	dir    string
+	header Header
+	steps  []step
+	file   *os.File
+}
+
+// Starts a transaction journaled at `dir`.
+// Fails with `ErrPending` if an interrupted transaction left its journal there.
+func Begin(dir string, header Header) (*Journal, error) {
+	if _, err := os.Lstat(dir); err == nil {
+		return nil, errors.WithStack(ErrPending)
+	}
+
+	if err := helpers.EnsureDirExists(dir); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	if header.Started.IsZero() {
+		header.Started = time.Now().UTC()
+	}
+	content, err := json.Marshal(header)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if err := writeSynced(filepath.Join(dir, headerFile), content); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	j := &Journal{dir: dir, header: header}
+	if err := j.openSteps(); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return j, nil
+}
+
+// Opens the journal an interrupted transaction left at `dir`.
+// Fails with an `os.ErrNotExist` error if there's none.
+func Open(dir string) (*Journal, error) {
+	content, err := os.ReadFile(filepath.Join(dir, headerFile))
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	j := &Journal{dir: dir}
+	if err := json.Unmarshal(content, &j.header); err != nil {
+		return nil, errors.WithMessage(err, "couldn't parse the journal header")
+	}
+
+	f, err := os.Open(filepath.Join(dir, stepsFile))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, errors.WithStack(err)
+	}
+	if err == nil {
+		defer f.Close()
+		scanner := bufio.NewScanner(f)
+		scanner.Buffer(nil, 16*1024*1024)
+		for scanner.Scan() {
+			var s step
+			if err := json.Unmarshal(scanner.Bytes(), &s); err != nil {
+				// A crash while writing the last step, which was never made.
+				break
+			}
+			j.steps = append(j.steps, s)
+		}
+	}
+
+	if err := j.openSteps(); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return j, nil
+}
+
+func (j *Journal) Header() Header {
+	return j.header
+}
+
+// Closes the journal, leaving the transaction pending.
+func (j *Journal) Close() error {
+	return errors.WithStack(j.file.Close())
+}
+
+// Ends the transaction keeping its changes, deleting what it removed or replaced.
+func (j *Journal) Commit() error {
+	j.file.Close()
+	return errors.WithStack(os.RemoveAll(j.dir))
+}
+
+// Undoes all the changes, and deletes the journal.
+// If undoing a change fails, the journal is kept with the changes that are left.
+func (j *Journal) Rollback() error {
+	if err := j.undo(0); err != nil {
+		return errors.WithStack(err)
+	}
+
+	j.file.Close()
+	return errors.WithStack(os.RemoveAll(j.dir))
+}
+
+// Undoes the changes made after the last checkpoint, so the transaction could be resumed.
+func (j *Journal) RollbackUnfinished() error {
+	from := 0
+	for i := len(j.steps) - 1; i >= 0; i-- {
+		if j.steps[i].Kind == stepCheckpoint {
+			from = i + 1
+			break
+		}
+	}
+
+	return j.undo(from)
+}
+
+// Marks a unit of work as done, recording its resulting state.
+func (j *Journal) Checkpoint(key string, state interface{}) error {
+	content, err := json.Marshal(state)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	return j.record(step{Kind: stepCheckpoint, Key: key, State: content})
+}
+
+// Checks whether a unit of work was done, loading its resulting state into `state` if it was.
+func (j *Journal) Checkpointed(key string, state interface{}) (bool, error) {
+	for i := len(j.steps) - 1; i >= 0; i-- {
+		s := j.steps[i]
+		if s.Kind != stepCheckpoint || s.Key != key {
+			continue
+		}
+		if err := json.Unmarshal(s.State, state); err != nil {
+			return false, errors.WithStack(err)
+		}
+		return true, nil
+	}
+
+	return false, nil
+}
+
+func (j *Journal) MkdirAll(path string) error {
+	// The topmost directory that's going to be created.
+	top := ""
+	for dir := filepath.Clean(path); ; dir = filepath.Dir(dir) {
+		if _, err := os.Lstat(dir); err == nil {
+			break
+		}
+		top = dir
+		if filepath.Dir(dir) == dir {
+			break
+		}
+	}
+
+	if top != "" {
+		if err := j.record(step{Kind: stepMkdir, Path: filepath.Clean(path), Origin: top}); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+
+	return OS{}.MkdirAll(path)
+}
+
+func (j *Journal) Remove(path string) error {
+	info, err := os.Lstat(path)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	if info.IsDir() {
+		entries, err := os.ReadDir(path)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		if len(entries) > 0 {
+			// Fails the way removing a non empty directory does.
+			return OS{}.Remove(path)
+		}
+		if err := j.record(step{Kind: stepRmdir, Path: path, Mode: info.Mode().Perm()}); err != nil {
+			return errors.WithStack(err)
+		}
+		return OS{}.Remove(path)
+	}
+
+	return j.stash(path)
+}
+
+func (j *Journal) RemoveAll(path string) error {
+	if _, err := os.Lstat(path); errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+
+	return j.stash(path)
+}
+
+func (j *Journal) Move(dest, origin string) error {
+	if !exists(origin) {
+		return OS{}.Move(dest, origin)
+	}
+
+	if info, err := os.Lstat(dest); err == nil && !info.IsDir() {
+		// It's replaced by the move.
+		if err := j.stash(dest); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+
+	if err := j.record(step{Kind: stepMove, Path: dest, Origin: origin, Existed: exists(dest)}); err != nil {
+		return errors.WithStack(err)
+	}
+
+	return OS{}.Move(dest, origin)
+}
+
+func (j *Journal) Symlink(dest, target string) error {
+	if err := j.create(dest, false); err != nil {
+		return errors.WithStack(err)
+	}
+
+	return OS{}.Symlink(dest, target)
+}
+
+func (j *Journal) Link(dest, origin string) error {
+	if err := j.create(dest, false); err != nil {
+		return errors.WithStack(err)
+	}
+
+	return OS{}.Link(dest, origin)
+}
+
+func (j *Journal) LinkFile(dest, origin string) error {
+	if err := j.create(dest, true); err != nil {
+		return errors.WithStack(err)
+	}
+
+	return OS{}.LinkFile(dest, origin)
+}
+
+func (j *Journal) WriteFile(path string, content []byte, perm os.FileMode) error {
+	if err := j.rewrite(path); err != nil {
+		return errors.WithStack(err)
+	}
+
+	return OS{}.WriteFile(path, content, perm)
+}
+
+func (j *Journal) CopyFile(dest, origin string) error {
+	if err := j.rewrite(dest); err != nil {
+		return errors.WithStack(err)
+	}
+
+	return OS{}.CopyFile(dest, origin)
+}
+
+func (j *Journal) CopyTree(dest, origin string) error {
+	if err := j.create(dest, true); err != nil {
+		return errors.WithStack(err)
+	}
+
+	return OS{}.CopyTree(dest, origin)
+}
+
+func (j *Journal) LinkTree(dest, origin string) error {
+	if err := j.create(dest, true); err != nil {
+		return errors.WithStack(err)
+	}
+
+	return OS{}.LinkTree(dest, origin)
+}
+
+func (j *Journal) Chmod(path string, mode os.FileMode) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	oldMode := info.Mode() & (os.ModePerm | os.ModeSetuid | os.ModeSetgid | os.ModeSticky)
+	if err := j.record(step{Kind: stepChmod, Path: path, Mode: oldMode}); err != nil {
+		return errors.WithStack(err)
+	}
+
+	return OS{}.Chmod(path, mode)
+}
+
+func (j *Journal) Chown(path string, uid, gid int) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	if oldUID, oldGID, ok := fileOwner(info); ok {
+		if err := j.record(step{Kind: stepChown, Path: path, UID: oldUID, GID: oldGID}); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+
+	return OS{}.Chown(path, uid, gid)
+}
+
+func (j *Journal) Chtimes(path string, mtime time.Time) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	oldMtime := info.ModTime()
+	if err := j.record(step{Kind: stepChtimes, Path: path, ModTime: &oldMtime}); err != nil {
+		return errors.WithStack(err)
+	}
+
+	return OS{}.Chtimes(path, mtime)
+}
+
+func (j *Journal) Setxattr(path, name string, value []byte) error {
+	oldValue, existed, err := getxattr(path, name)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	if err := j.record(step{Kind: stepSetxattr, Path: path, Name: name, Value: oldValue, Existed: existed}); err != nil {
+		return errors.WithStack(err)
+	}
+
+	return OS{}.Setxattr(path, name, value)
+}
+
+// Records that `path` is about to be created.
+// If it exists, it's moved to the stash first when `replace` is set, otherwise creating it fails without a change to undo.
+func (j *Journal) create(path string, replace bool) error {
+	if exists(path) {
+		if !replace {
+			return nil
+		}
+		if err := j.stash(path); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+
+	return j.record(step{Kind: stepCreate, Path: path})
+}
+
+// Records that `path` is about to be written.
+// Existing files are written in place, as they are outside a transaction, so the other hard links of the file see the change.
+// A copy of the file is stashed instead of the file itself, to be written back if the transaction is rolled back.
+func (j *Journal) rewrite(path string) error {
+	info, err := os.Lstat(path)
+	if err != nil || !info.Mode().IsRegular() {
+		return j.create(path, true)
+	}
+
+	s := step{Kind: stepRewrite, Path: path, Stash: j.stashPath(), Mode: info.Mode().Perm()}
+	// The copy is made before the step is recorded, so a recorded step always has a complete copy.
+	if err := copyToStash(s.Stash, path); err != nil {
+		return errors.WithStack(err)
+	}
+
+	return j.record(s)
+}
+
+// Moves the path to the stash, from where it's moved back if the transaction is rolled back.
+func (j *Journal) stash(path string) error {
+	s := step{Kind: stepStash, Path: path, Stash: j.stashPath()}
+	if err := j.record(s); err != nil {
+		return errors.WithStack(err)
+	}
+
+	return moveToStash(s.Stash, path)
+}
+
+// Returns the stash path of the next step.
+func (j *Journal) stashPath() string {
+	return filepath.Join(j.dir, stashDir, strconv.Itoa(len(j.steps)))
+}
+
+// Writes the step to the journal before it's made.
+func (j *Journal) record(s step) error {
+	content, err := json.Marshal(s)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	if _, err := j.file.Write(append(content, '\n')); err != nil {
+		return errors.WithMessage(err, "couldn't write to the journal")
+	}
+	if err := j.file.Sync(); err != nil {
+		return errors.WithMessage(err, "couldn't write to the journal")
+	}
+
+	j.steps = append(j.steps, s)
+
+	return nil
+}
+
+// Undoes the steps from the given one onwards, latest first.
+// The steps that are undone are dropped from the journal, even if undoing a later one fails.
+func (j *Journal) undo(from int) error {
+	for i := len(j.steps) - 1; i >= from; i-- {
+		if err := undoStep(j.steps[i]); err != nil {
+			if truncErr := j.truncate(i + 1); truncErr != nil {
+				return errors.WithStack(truncErr)
+			}
+			return errors.WithMessagef(err, "couldn't undo the %s of %s", j.steps[i].Kind, j.steps[i].Path)
+		}
+	}
+
+	return j.truncate(from)
+}
+
+// Undoes a step, which might not have been made if the transaction crashed.
+func undoStep(s step) error {
+	switch s.Kind {
+	case stepCreate:
+		return errors.WithStack(os.RemoveAll(s.Path))
+	case stepStash:
+		if !exists(s.Stash) {
+			return nil
+		}
+		if exists(s.Path) {
+			// The path is still there, moving it across filesystems was interrupted.
+			return errors.WithStack(os.RemoveAll(s.Stash))
+		}
+		return unstash(s.Path, s.Stash)
+	case stepMove:
+		if !exists(s.Origin) && exists(s.Path) {
+			return unstash(s.Origin, s.Path)
+		}
+		if !s.Existed {
+			// Moving across filesystems could have been interrupted.
+			return errors.WithStack(os.RemoveAll(s.Path))
+		}
+	case stepMkdir:
+		// Only the directories that are empty again are removed.
+		for dir := s.Path; ; dir = filepath.Dir(dir) {
+			os.Remove(dir)
+			if dir == s.Origin || filepath.Dir(dir) == dir {
+				break
+			}
+		}
+	case stepRmdir:
+		if !exists(s.Path) {
+			return errors.WithStack(os.Mkdir(s.Path, s.Mode))
+		}
+	case stepChmod:
+		if err := os.Chmod(s.Path, s.Mode); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return errors.WithStack(err)
+		}
+	case stepRewrite:
+		if !exists(s.Stash) {
+			return nil
+		}
+		if info, err := os.Lstat(s.Path); err == nil && info.Mode().IsRegular() {
+			// Written back in place, keeping the hard links, owner and attributes of the file.
+			content, err := os.ReadFile(s.Stash)
+			if err != nil {
+				return errors.WithStack(err)
+			}
+			if err := os.WriteFile(s.Path, content, s.Mode); err != nil {
+				return errors.WithStack(err)
+			}
+		} else if err := unstash(s.Path, s.Stash); err != nil {
+			return errors.WithStack(err)
+		}
+		return errors.WithStack(os.Chmod(s.Path, s.Mode))
+	case stepChown:
+		if err := os.Chown(s.Path, s.UID, s.GID); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return errors.WithStack(err)
+		}
+	case stepChtimes:
+		if err := os.Chtimes(s.Path, time.Time{}, *s.ModTime); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return errors.WithStack(err)
+		}
+	case stepSetxattr:
+		if !exists(s.Path) {
+			return nil
+		}
+		if s.Existed {
+			return OS{}.Setxattr(s.Path, s.Name, s.Value)
+		}
+		return removexattr(s.Path, s.Name)
+	}
+
+	return nil
+}
+
+// Drops the steps from the given one onwards from the journal.
+func (j *Journal) truncate(n int) error {
+	j.steps = j.steps[:n]
+
+	var content []byte
+	for _, s := range j.steps {
+		line, err := json.Marshal(s)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		content = append(append(content, line...), '\n')
+	}
+
+	j.file.Close()
+	path := filepath.Join(j.dir, stepsFile)
+	if err := writeSynced(path+".tmp", content); err != nil {
+		return errors.WithStack(err)
+	}
+	if err := os.Rename(path+".tmp", path); err != nil {
+		return errors.WithStack(err)
+	}
+
+	return j.openSteps()
+}
+
+func (j *Journal) openSteps() error {
+	f, err := os.OpenFile(filepath.Join(j.dir, stepsFile), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	j.file = f
+
+	return nil
+}
+
+func moveToStash(stash, path string) error {
+	if err := helpers.EnsureDirExists(filepath.Dir(stash)); err != nil {
+		return errors.WithStack(err)
+	}
+
+	return helpers.MoveFile(stash, path)
+}
+
+// Copies the file to the stash, flushing the copy to disk.
+func copyToStash(stash, path string) error {
+	if err := helpers.EnsureDirExists(filepath.Dir(stash)); err != nil {
+		return errors.WithStack(err)
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	return writeSynced(stash, content)
+}
+
+func unstash(path, stash string) error {
+	if err := helpers.EnsureDirExists(filepath.Dir(path)); err != nil {
+		return errors.WithStack(err)
+	}
+
+	return helpers.MoveFile(path, stash)
+}
+
+func exists(path string) bool {
+	_, err := os.Lstat(path)
+	return err == nil
+}
+
+// Writes the file and flushes it to disk.
+func writeSynced(path string, content []byte) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer f.Close()
+
+	if _, err := f.Write(content); err != nil {
+		return errors.WithStack(err)
+	}
+
+	return errors.WithStack(f.Sync())
+}
@@ -0,0 +1,218 @@
+package fileops
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Creates a tree of files, and returns a function checking it's still as created.
+func _setupTree(t *testing.T) (dir string, check func(t *testing.T)) {
+	dir = t.TempDir()
+	os.WriteFile(filepath.Join(dir, "file"), []byte("file"), 0600)
+	mtime := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	os.Chtimes(filepath.Join(dir, "file"), time.Time{}, mtime)
+	os.WriteFile(filepath.Join(dir, "replaced"), []byte("replaced"), 0644)
+	os.MkdirAll(filepath.Join(dir, "tree", "sub"), 0755)
+	os.WriteFile(filepath.Join(dir, "tree", "sub", "leaf"), []byte("leaf"), 0644)
+
+	return dir, func(t *testing.T) {
+		t.Helper()
+		for name, content := range map[string]string{"file": "file", "replaced": "replaced", "tree/sub/leaf": "leaf"} {
+			got, err := os.ReadFile(filepath.Join(dir, name))
+			if err != nil || string(got) != content {
+				t.Errorf("expected %s to hold %q, got %q, %v", name, content, got, err)
+			}
+		}
+		if info, _ := os.Stat(filepath.Join(dir, "file")); info.Mode().Perm() != 0600 {
+			t.Errorf("expected the mode of file to be %o, got %o", 0600, info.Mode().Perm())
+		}
+		if info, _ := os.Stat(filepath.Join(dir, "file")); !info.ModTime().Equal(mtime) {
+			t.Errorf("expected the modification time of file to be %s, got %s", mtime, info.ModTime())
+		}
+		for _, name := range []string{"moved", "link", "new", "copy", "deep"} {
+			if _, err := os.Lstat(filepath.Join(dir, name)); !errors.Is(err, os.ErrNotExist) {
+				t.Errorf("expected %s not to exist, got %v", name, err)
+			}
+		}
+	}
+}
+
+// Makes one change of each kind.
+func _makeChanges(t *testing.T, ops Ops, dir string) {
+	t.Helper()
+	steps := []error{
+		ops.Chmod(filepath.Join(dir, "file"), 0644),
+		ops.Chtimes(filepath.Join(dir, "file"), time.Now()),
+		ops.Move(filepath.Join(dir, "moved"), filepath.Join(dir, "file")),
+		ops.WriteFile(filepath.Join(dir, "replaced"), []byte("new content"), 0644),
+		ops.Symlink(filepath.Join(dir, "link"), filepath.Join(dir, "moved")),
+		ops.CopyFile(filepath.Join(dir, "new"), filepath.Join(dir, "moved")),
+		ops.CopyTree(filepath.Join(dir, "copy"), filepath.Join(dir, "tree")),
+		ops.RemoveAll(filepath.Join(dir, "tree")),
+		ops.MkdirAll(filepath.Join(dir, "deep", "er")),
+	}
+	for i, err := range steps {
+		if err != nil {
+			t.Fatalf("expected no error at step %d, got %s", i, err)
+		}
+	}
+}
+
+func TestJournal_Rollback(t *testing.T) {
+	dir, check := _setupTree(t)
+	j, err := Begin(filepath.Join(t.TempDir(), "journal"), Header{Command: "test"})
+	if err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+
+	_makeChanges(t, j, dir)
+	if err := j.Rollback(); err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+
+	check(t)
+}
+
+func TestJournal_Crash(t *testing.T) {
+	dir, check := _setupTree(t)
+	journalDir := filepath.Join(t.TempDir(), "journal")
+	j, err := Begin(journalDir, Header{Command: "test"})
+	if err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+	_makeChanges(t, j, dir)
+	j.Close()
+
+	if _, err := Begin(journalDir, Header{Command: "test"}); !errors.Is(err, ErrPending) {
+		t.Fatalf("expected the pending journal to block new transactions, got %v", err)
+	}
+
+	j, err = Open(journalDir)
+	if err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+	if j.Header().Command != "test" {
+		t.Errorf("expected the header to be kept, got %+v", j.Header())
+	}
+	if err := j.Rollback(); err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+
+	check(t)
+	if _, err := os.Lstat(journalDir); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("expected the journal to be deleted, got %v", err)
+	}
+}
+
+func TestJournal_RollbackUnfinished(t *testing.T) {
+	dir := t.TempDir()
+	journalDir := filepath.Join(t.TempDir(), "journal")
+	j, _ := Begin(journalDir, Header{Command: "test"})
+
+	done, unfinished := filepath.Join(dir, "done"), filepath.Join(dir, "unfinished")
+	j.WriteFile(done, []byte("done"), 0644)
+	if err := j.Checkpoint("done", map[string]string{"state": "kept"}); err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+	j.WriteFile(unfinished, []byte("unfinished"), 0644)
+	j.Close()
+
+	j, _ = Open(journalDir)
+	if err := j.RollbackUnfinished(); err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+	if _, err := os.Stat(done); err != nil {
+		t.Errorf("expected the checkpointed change to be kept, got %v", err)
+	}
+	if _, err := os.Stat(unfinished); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("expected the unfinished change to be undone, got %v", err)
+	}
+
+	var state map[string]string
+	if ok, err := j.Checkpointed("done", &state); !ok || err != nil || state["state"] != "kept" {
+		t.Errorf("expected the checkpoint state to be loaded, got %v, %v, %v", ok, state, err)
+	}
+	if ok, _ := j.Checkpointed("unfinished", &state); ok {
+		t.Errorf("expected no checkpoint for unfinished")
+	}
+
+	if err := j.Commit(); err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+	if _, err := os.Stat(done); err != nil {
+		t.Errorf("expected the committed change to be kept, got %v", err)
+	}
+}
+
+func TestJournal_Rollback_HardLinks(t *testing.T) {
+	dir := t.TempDir()
+	file, link := filepath.Join(dir, "file"), filepath.Join(dir, "link")
+	os.WriteFile(file, []byte("file"), 0644)
+	os.Link(file, link)
+
+	tests := []struct {
+		name  string
+		write func(j *Journal) error
+	}{
+		{"write", func(j *Journal) error { return j.WriteFile(file, []byte("written"), 0644) }},
+		{"copy", func(j *Journal) error {
+			origin := filepath.Join(t.TempDir(), "origin")
+			os.WriteFile(origin, []byte("copied"), 0644)
+			return j.CopyFile(file, origin)
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			j, _ := Begin(filepath.Join(t.TempDir(), "journal"), Header{Command: "test"})
+			if err := tt.write(j); err != nil {
+				t.Fatalf("expected no error, got %s", err)
+			}
+			// Written in place, as it is outside a transaction.
+			if content, _ := os.ReadFile(link); string(content) == "file" {
+				t.Errorf("expected the write to show through the other link")
+			}
+
+			if err := j.Rollback(); err != nil {
+				t.Fatalf("expected no error, got %s", err)
+			}
+			fileInfo, _ := os.Stat(file)
+			linkInfo, _ := os.Stat(link)
+			if !os.SameFile(fileInfo, linkInfo) {
+				t.Errorf("expected the hard link to be kept")
+			}
+			if content, _ := os.ReadFile(link); string(content) != "file" {
+				t.Errorf("expected the content to be written back, got %q", content)
+			}
+		})
+	}
+}
+
+func TestJournal_Rollback_Xattr(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "file")
+	os.WriteFile(path, []byte("file"), 0644)
+	if err := (OS{}).Setxattr(path, "user.kept", []byte("old")); err != nil {
+		t.Skipf("extended attributes aren't supported here: %s", err)
+	}
+
+	j, _ := Begin(filepath.Join(t.TempDir(), "journal"), Header{Command: "test"})
+	for name, value := range map[string]string{"user.kept": "new", "user.added": "new"} {
+		if err := j.Setxattr(path, name, []byte(value)); err != nil {
+			t.Fatalf("expected no error, got %s", err)
+		}
+	}
+	if err := j.Rollback(); err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+
+	if value, ok, _ := getxattr(path, "user.kept"); !ok || string(value) != "old" {
+		t.Errorf("expected the previous value to be set back, got %q, %v", value, ok)
+	}
+	if _, ok, _ := getxattr(path, "user.added"); ok {
+		t.Errorf("expected the added attribute to be removed")
+	}
+}
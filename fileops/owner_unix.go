@@ -0,0 +1,18 @@
+//go:build unix
+
+package fileops
+
+import (
+	"os"
+	"syscall"
+)
+
+// Returns the ids of the file's owner and group.
+func fileOwner(info os.FileInfo) (uid, gid int, ok bool) {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, 0, false
+	}
+
+	return int(stat.Uid), int(stat.Gid), true
+}
@@ -0,0 +1,504 @@
+package fileops
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// A planned change.
+type Action struct {
+	Op   string `json:"op"`
+	Path string `json:"path"`
+	// The file the change comes from (e.g. of a move or a copy), or the target of a symlink.
+	Origin string `json:"origin,omitempty"`
+	// The op specific details, e.g. the mode of a chmod.
+	Detail string `json:"detail,omitempty"`
+	// Whether the change replaces an existing file.
+	Replaces bool `json:"replaces,omitempty"`
+}
+
+func (a Action) String() string {
+	s := fmt.Sprintf("%-12s %s", a.Op, a.Path)
+	switch {
+	case a.Op == "symlink":
+		s += " -> " + a.Origin
+	case a.Origin != "":
+		s += " <- " + a.Origin
+	}
+	if a.Detail != "" {
+		s += " (" + a.Detail + ")"
+	}
+	if a.Replaces {
+		s += " [replaces existing]"
+	}
+	return s
+}
+
+// The planned state of a path.
+type node struct {
+	gone bool
+	// The real path holding the content (e.g. the origin of a move).
+	source string
+	// The content of a planned file, or the target of a planned symlink.
+	content []byte
+	target  string
+	file    bool
+	link    bool
+	dir     bool
+	mode    os.FileMode
+	modTime time.Time
+}
+
+// Records the changes instead of making them, the reads see the filesystem as if they were made.
+type Planner struct {
+	actions []Action
+	nodes   map[string]*node
+}
+
+func NewPlanner() *Planner {
+	return &Planner{nodes: make(map[string]*node)}
+}
+
+// Returns the planned changes in order.
+func (p *Planner) Actions() []Action {
+	return p.actions
+}
+
+// Records a change made outside of the filesystem operations (e.g. a git command).
+func (p *Planner) Plan(op, path, detail string) {
+	p.actions = append(p.actions, Action{Op: op, Path: path, Detail: detail})
+}
+
+// Records a change creating `path`.
+func (p *Planner) record(op, path, origin, detail string) {
+	_, err := p.Lstat(path)
+	p.actions = append(p.actions, Action{Op: op, Path: path, Origin: origin, Detail: detail, Replaces: err == nil})
+}
+
+// Returns the planned state of the path, or the real path to read it from if it has none.
+func (p *Planner) resolve(path string) (*node, string) {
+	path = filepath.Clean(path)
+	if n, ok := p.nodes[path]; ok {
+		return n, path
+	}
+
+	for dir := filepath.Dir(path); ; dir = filepath.Dir(dir) {
+		if n, ok := p.nodes[dir]; ok {
+			rel, _ := filepath.Rel(dir, path)
+			switch {
+			case n.source != "":
+				return nil, filepath.Join(n.source, rel)
+			case n.link:
+				return p.resolve(filepath.Join(p.linkTarget(dir, n.target), rel))
+			default:
+				// Planned files and directories have no content besides what's planned.
+				return &node{gone: true}, path
+			}
+		}
+		if dir == filepath.Dir(dir) {
+			return nil, path
+		}
+	}
+}
+
+func (p *Planner) linkTarget(path, target string) string {
+	if filepath.IsAbs(target) {
+		return target
+	}
+	return filepath.Join(filepath.Dir(path), target)
+}
+
+func notExist(op, path string) error {
+	return errors.WithStack(&fs.PathError{Op: op, Path: path, Err: fs.ErrNotExist})
+}
+
+func (p *Planner) Lstat(path string) (os.FileInfo, error) {
+	n, real := p.resolve(path)
+	if n == nil {
+		info, err := os.Lstat(real)
+		return info, errors.WithStack(err)
+	}
+	if n.gone {
+		return nil, notExist("lstat", path)
+	}
+
+	info := plannedInfo{name: filepath.Base(path), mode: n.mode, modTime: n.modTime}
+	if n.source != "" {
+		real, err := os.Lstat(n.source)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		info.FileInfo = real
+		if n.mode == 0 {
+			info.mode = real.Mode()
+		}
+		if n.modTime.IsZero() {
+			info.modTime = real.ModTime()
+		}
+	}
+	switch {
+	case n.link:
+		info.mode = os.ModeSymlink | os.ModePerm
+	case n.dir:
+		info.mode |= os.ModeDir
+	case n.file:
+		info.size = int64(len(n.content))
+	}
+
+	return info, nil
+}
+
+func (p *Planner) Stat(path string) (os.FileInfo, error) {
+	path, err := p.follow(path)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return p.Lstat(path)
+}
+
+// Follows the symlinks at `path` to the file they point to.
+func (p *Planner) follow(path string) (string, error) {
+	for i := 0; i < 40; i++ {
+		info, err := p.Lstat(path)
+		if err != nil || info.Mode()&os.ModeSymlink == 0 {
+			return path, errors.WithStack(err)
+		}
+		target, err := p.Readlink(path)
+		if err != nil {
+			return "", errors.WithStack(err)
+		}
+		path = p.linkTarget(path, target)
+	}
+
+	return "", errors.Errorf("too many levels of symbolic links at %s", path)
+}
+
+func (p *Planner) Readlink(path string) (string, error) {
+	n, real := p.resolve(path)
+	switch {
+	case n == nil:
+		target, err := os.Readlink(real)
+		return target, errors.WithStack(err)
+	case n.gone:
+		return "", notExist("readlink", path)
+	case n.link:
+		return n.target, nil
+	case n.source != "":
+		target, err := os.Readlink(n.source)
+		return target, errors.WithStack(err)
+	default:
+		return "", errors.Errorf("%s isn't a symlink", path)
+	}
+}
+
+func (p *Planner) ReadFile(path string) ([]byte, error) {
+	path, err := p.follow(path)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	n, real := p.resolve(path)
+	switch {
+	case n == nil:
+		content, err := os.ReadFile(real)
+		return content, errors.WithStack(err)
+	case n.gone:
+		return nil, notExist("open", path)
+	case n.source != "":
+		content, err := os.ReadFile(n.source)
+		return content, errors.WithStack(err)
+	case n.file:
+		return n.content, nil
+	default:
+		return nil, errors.Errorf("%s is a directory", path)
+	}
+}
+
+func (p *Planner) Locate(path string) string {
+	if followed, err := p.follow(path); err == nil {
+		path = followed
+	}
+
+	n, real := p.resolve(path)
+	if n != nil && n.source != "" {
+		return n.source
+	}
+	return real
+}
+
+// Sets the planned state of the path, the planned states under it no longer apply.
+func (p *Planner) set(path string, n *node) {
+	path = filepath.Clean(path)
+	p.forget(path)
+	p.nodes[path] = n
+}
+
+func (p *Planner) forget(path string) {
+	prefix := path + string(filepath.Separator)
+	for key := range p.nodes {
+		if key == path || strings.HasPrefix(key, prefix) {
+			delete(p.nodes, key)
+		}
+	}
+}
+
+// Returns a planned state mirroring the file at `path`.
+func (p *Planner) mirror(path string) (*node, error) {
+	if _, err := p.Lstat(path); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	n, real := p.resolve(path)
+	if n == nil {
+		return &node{source: real}, nil
+	}
+	mirror := *n
+	return &mirror, nil
+}
+
+// Copies the planned states of `origin` and the paths under it to `dest`.
+func (p *Planner) mirrorTree(dest, origin string) error {
+	n, err := p.mirror(origin)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	dest, origin = filepath.Clean(dest), filepath.Clean(origin)
+	children := make(map[string]*node)
+	prefix := origin + string(filepath.Separator)
+	for key, child := range p.nodes {
+		if strings.HasPrefix(key, prefix) {
+			mirror := *child
+			children[filepath.Join(dest, strings.TrimPrefix(key, prefix))] = &mirror
+		}
+	}
+
+	p.set(dest, n)
+	for key, child := range children {
+		p.nodes[key] = child
+	}
+
+	return nil
+}
+
+func (p *Planner) MkdirAll(path string) error {
+	path = filepath.Clean(path)
+	if _, err := p.Lstat(path); err == nil {
+		return nil
+	}
+
+	if parent := filepath.Dir(path); parent != path {
+		if err := p.MkdirAll(parent); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+	p.Plan("mkdir", path, "")
+	p.set(path, &node{dir: true, mode: os.ModePerm})
+	return nil
+}
+
+func (p *Planner) Remove(path string) error {
+	if _, err := p.Lstat(path); err != nil {
+		return errors.WithStack(err)
+	}
+
+	p.Plan("remove", path, "")
+	p.set(path, &node{gone: true})
+	return nil
+}
+
+func (p *Planner) RemoveAll(path string) error {
+	if _, err := p.Lstat(path); err != nil {
+		return nil
+	}
+
+	p.Plan("remove-all", path, "")
+	p.set(path, &node{gone: true})
+	return nil
+}
+
+func (p *Planner) Move(dest, origin string) error {
+	if _, err := p.Lstat(origin); err != nil {
+		return errors.WithStack(err)
+	}
+
+	p.record("move", dest, origin, "")
+	if err := p.mirrorTree(dest, origin); err != nil {
+		return errors.WithStack(err)
+	}
+	p.set(origin, &node{gone: true})
+	return nil
+}
+
+func (p *Planner) Symlink(dest, target string) error {
+	if _, err := p.Lstat(dest); err == nil {
+		return errors.WithStack(&fs.PathError{Op: "symlink", Path: dest, Err: fs.ErrExist})
+	}
+
+	p.record("symlink", dest, target, "")
+	p.set(dest, &node{link: true, target: target})
+	return nil
+}
+
+func (p *Planner) Link(dest, origin string) error {
+	if _, err := p.Lstat(dest); err == nil {
+		return errors.WithStack(&fs.PathError{Op: "link", Path: dest, Err: fs.ErrExist})
+	}
+	return p.LinkFile(dest, origin)
+}
+
+func (p *Planner) LinkFile(dest, origin string) error {
+	return p.plan("link", dest, origin, p.mirrorTree)
+}
+
+func (p *Planner) WriteFile(path string, content []byte, perm os.FileMode) error {
+	p.record("write", path, "", fmt.Sprintf("%d bytes", len(content)))
+	p.set(path, &node{file: true, content: content, mode: perm, modTime: time.Now()})
+	return nil
+}
+
+func (p *Planner) CopyFile(dest, origin string) error {
+	return p.plan("copy", dest, origin, p.copy)
+}
+
+func (p *Planner) CopyTree(dest, origin string) error {
+	return p.plan("copy-tree", dest, origin, p.copy)
+}
+
+func (p *Planner) LinkTree(dest, origin string) error {
+	return p.plan("link-tree", dest, origin, p.mirrorTree)
+}
+
+// Copies follow the symlinks to the files they point to.
+func (p *Planner) copy(dest, origin string) error {
+	origin, err := p.follow(origin)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	return p.mirrorTree(dest, origin)
+}
+
+func (p *Planner) plan(op, dest, origin string, do func(dest, origin string) error) error {
+	if _, err := p.Stat(origin); err != nil {
+		return errors.WithStack(err)
+	}
+
+	p.record(op, dest, origin, "")
+	return errors.WithStack(do(dest, origin))
+}
+
+// Returns the planned state of the file a symlink at `path` points to, planning it if it has none.
+func (p *Planner) target(path string) (*node, error) {
+	path, err := p.follow(path)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	n, _ := p.resolve(path)
+	if n == nil || p.nodes[filepath.Clean(path)] != n {
+		if n, err = p.mirror(path); err != nil {
+			return nil, errors.WithStack(err)
+		}
+		p.nodes[filepath.Clean(path)] = n
+	}
+	return n, nil
+}
+
+func (p *Planner) Chmod(path string, mode os.FileMode) error {
+	info, err := p.Stat(path)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if info.Mode()&^os.ModeType == mode {
+		return nil
+	}
+
+	n, err := p.target(path)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	p.Plan("chmod", path, mode.String())
+	n.mode = info.Mode()&os.ModeType | mode
+	return nil
+}
+
+func (p *Planner) Chown(path string, uid, gid int) error {
+	if _, err := p.Stat(path); err != nil {
+		return errors.WithStack(err)
+	}
+
+	p.Plan("chown", path, fmt.Sprintf("%d:%d", uid, gid))
+	return nil
+}
+
+func (p *Planner) Chtimes(path string, mtime time.Time) error {
+	info, err := p.Stat(path)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if info.ModTime().Equal(mtime) {
+		return nil
+	}
+
+	n, err := p.target(path)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	p.Plan("chtimes", path, mtime.Format(time.RFC3339))
+	n.modTime = mtime
+	return nil
+}
+
+func (p *Planner) Setxattr(path, name string, value []byte) error {
+	if _, err := p.Stat(path); err != nil {
+		return errors.WithStack(err)
+	}
+
+	p.Plan("setxattr", path, name)
+	return nil
+}
+
+// The info of a planned file, backed by the info of the real file it mirrors if any.
+type plannedInfo struct {
+	os.FileInfo
+	name    string
+	size    int64
+	mode    os.FileMode
+	modTime time.Time
+}
+
+func (i plannedInfo) Name() string {
+	return i.name
+}
+
+func (i plannedInfo) Size() int64 {
+	if i.FileInfo != nil && i.size == 0 {
+		return i.FileInfo.Size()
+	}
+	return i.size
+}
+
+func (i plannedInfo) Mode() os.FileMode {
+	return i.mode
+}
+
+func (i plannedInfo) ModTime() time.Time {
+	return i.modTime
+}
+
+func (i plannedInfo) IsDir() bool {
+	return i.mode.IsDir()
+}
+
+func (i plannedInfo) Sys() any {
+	if i.FileInfo == nil {
+		return nil
+	}
+	return i.FileInfo.Sys()
+}
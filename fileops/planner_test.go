@@ -0,0 +1,63 @@
+package fileops
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+func TestPlanner(t *testing.T) {
+	dir, check := _setupTree(t)
+	p := NewPlanner()
+	_makeChanges(t, p, dir)
+
+	check(t)
+
+	wantOps := []string{"chmod", "chtimes", "move", "write", "symlink", "copy", "copy-tree", "remove-all", "mkdir", "mkdir"}
+	actions := p.Actions()
+	if len(actions) != len(wantOps) {
+		t.Fatalf("expected %d actions, got %d: %v", len(wantOps), len(actions), actions)
+	}
+	for i, op := range wantOps {
+		if actions[i].Op != op {
+			t.Errorf("expected action %d to be %s, got %s", i, op, actions[i])
+		}
+	}
+	if !actions[3].Replaces {
+		t.Errorf("expected %s to replace an existing file", actions[3])
+	}
+
+	// The reads see the planned changes.
+	tests := []struct {
+		name    string
+		content string
+	}{
+		{"moved", "file"},
+		{"link", "file"},
+		{"new", "file"},
+		{"replaced", "new content"},
+		{"copy/sub/leaf", "leaf"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := p.ReadFile(filepath.Join(dir, tt.name))
+			if err != nil || string(got) != tt.content {
+				t.Errorf("expected %s to read %q, got %q, %v", tt.name, tt.content, got, err)
+			}
+		})
+	}
+
+	for _, name := range []string{"file", "tree/sub/leaf"} {
+		if _, err := p.Lstat(filepath.Join(dir, name)); !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("expected %s to be planned away, got %v", name, err)
+		}
+	}
+	if info, err := p.Stat(filepath.Join(dir, "link")); err != nil || info.Mode().Perm() != 0644 {
+		t.Errorf("expected the link to point to a file with mode %o, got %v, %v", 0644, info, err)
+	}
+	if info, err := p.Stat(filepath.Join(dir, "deep", "er")); err != nil || !info.IsDir() {
+		t.Errorf("expected deep/er to be a directory, got %v, %v", info, err)
+	}
+}
@@ -0,0 +1,49 @@
+//go:build linux || darwin
+
+package fileops
+
+import (
+	"bytes"
+
+	"github.com/pkg/errors"
+	"golang.org/x/sys/unix"
+)
+
+func (OS) Setxattr(path, name string, value []byte) error {
+	return errors.WithStack(unix.Setxattr(path, name, value, 0))
+}
+
+// Returns the value of the extended attribute, and whether the file has it.
+func getxattr(path, name string) ([]byte, bool, error) {
+	size, err := unix.Listxattr(path, nil)
+	if err != nil || size == 0 {
+		// Attributes that aren't supported can't be set either.
+		return nil, false, nil
+	}
+	buf := make([]byte, size)
+	if size, err = unix.Listxattr(path, buf); err != nil {
+		return nil, false, errors.WithStack(err)
+	}
+	found := false
+	for _, attr := range bytes.Split(buf[:size], []byte{0}) {
+		found = found || string(attr) == name
+	}
+	if !found {
+		return nil, false, nil
+	}
+
+	size, err = unix.Getxattr(path, name, nil)
+	if err != nil {
+		return nil, false, errors.WithStack(err)
+	}
+	value := make([]byte, size)
+	if size, err = unix.Getxattr(path, name, value); err != nil {
+		return nil, false, errors.WithStack(err)
+	}
+
+	return value[:size], true, nil
+}
+
+func removexattr(path, name string) error {
+	return errors.WithStack(unix.Removexattr(path, name))
+}
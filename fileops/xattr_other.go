@@ -0,0 +1,18 @@
+//go:build !linux && !darwin
+
+package fileops
+
+import "github.com/pkg/errors"
+
+// Extended attributes aren't supported on this platform.
+func (OS) Setxattr(path, name string, value []byte) error {
+	return errors.New("extended attributes aren't supported on this platform")
+}
+
+func getxattr(path, name string) ([]byte, bool, error) {
+	return nil, false, nil
+}
+
+func removexattr(path, name string) error {
+	return errors.New("extended attributes aren't supported on this platform")
+}
@@ -4,6 +4,7 @@ import (
 	"io"
 	"os"
 	"path/filepath"
+	"syscall"
 
 	"github.com/pkg/errors"
 )
@@ -79,3 +80,31 @@ func LinkFile(dest, origin string) error {
 
 	return nil
 }
+
+// Moves a file or a directory, copying it when it's on another filesystem.
+func MoveFile(dest, origin string) error {
+	err := os.Rename(origin, dest)
+	if err == nil || !errors.Is(err, syscall.EXDEV) {
+		return errors.WithStack(err)
+	}
+
+	info, err := os.Lstat(origin)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	if info.IsDir() {
+		if err := CopyTree(dest, origin); err != nil {
+			return errors.WithStack(err)
+		}
+	} else {
+		if err := CopyFile(dest, origin); err != nil {
+			return errors.WithStack(err)
+		}
+		if err := os.Chmod(dest, info.Mode().Perm()); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+
+	return errors.WithStack(os.RemoveAll(origin))
+}
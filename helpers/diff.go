@@ -0,0 +1,131 @@
+package helpers
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"github.com/sergi/go-diff/diffmatchpatch"
+)
+
+// The lines of context around the changes of a unified diff.
+const diffContext = 3
+
+type diffLine struct {
+	op   byte
+	text string
+}
+
+// Returns the unified diff turning `from` into `to`, or an empty string if they're identical.
+func UnifiedDiff(fromName, toName string, from, to []byte) string {
+	if bytes.Equal(from, to) {
+		return ""
+	}
+
+	var buf strings.Builder
+	fmt.Fprintf(&buf, "--- %s\n+++ %s\n", fromName, toName)
+
+	if bytes.IndexByte(from, 0) != -1 || bytes.IndexByte(to, 0) != -1 {
+		buf.WriteString("Binary files differ\n")
+		return buf.String()
+	}
+
+	lines := diffLines(string(from), string(to))
+
+	// The line numbers (in both files) each line starts at.
+	fromLines, toLines := make([]int, len(lines)+1), make([]int, len(lines)+1)
+	for i, line := range lines {
+		fromLines[i+1], toLines[i+1] = fromLines[i], toLines[i]
+		if line.op != '+' {
+			fromLines[i+1]++
+		}
+		if line.op != '-' {
+			toLines[i+1]++
+		}
+	}
+
+	for start := 0; start < len(lines); {
+		// Find the next change, and extend the hunk while the changes are close enough.
+		first := start
+		for first < len(lines) && lines[first].op == ' ' {
+			first++
+		}
+		if first == len(lines) {
+			break
+		}
+		last := first
+		for i := first; i < len(lines) && i <= last+2*diffContext; i++ {
+			if lines[i].op != ' ' {
+				last = i
+			}
+		}
+
+		hunkStart := max(first-diffContext, start)
+		hunkEnd := min(last+diffContext+1, len(lines))
+		fmt.Fprintf(&buf, "@@ -%s +%s @@\n",
+			hunkRange(fromLines[hunkStart], fromLines[hunkEnd]-fromLines[hunkStart]),
+			hunkRange(toLines[hunkStart], toLines[hunkEnd]-toLines[hunkStart]))
+		for _, line := range lines[hunkStart:hunkEnd] {
+			buf.WriteByte(line.op)
+			buf.WriteString(line.text)
+			if !strings.HasSuffix(line.text, "\n") {
+				buf.WriteString("\n\\ No newline at end of file\n")
+			}
+		}
+
+		start = hunkEnd
+	}
+
+	return buf.String()
+}
+
+// Diffs the texts line by line.
+// Each distinct line is mapped to a rune, so the character diff of the runes is the line diff of the texts.
+func diffLines(from, to string) []diffLine {
+	runeOf := make(map[string]rune)
+	lineOf := make(map[rune]string)
+	toRunes := func(text string) []rune {
+		runes := make([]rune, 0)
+		for _, line := range strings.SplitAfter(text, "\n") {
+			if line == "" {
+				continue
+			}
+			r, ok := runeOf[line]
+			if !ok {
+				// Outside the basic plane, so the runes never clash with surrogates.
+				r = rune(0x10000 + len(runeOf))
+				runeOf[line] = r
+				lineOf[r] = line
+			}
+			runes = append(runes, r)
+		}
+		return runes
+	}
+
+	dmp := diffmatchpatch.New()
+	dmp.DiffTimeout = 0
+	diffs := dmp.DiffMainRunes(toRunes(from), toRunes(to), false)
+
+	lines := make([]diffLine, 0)
+	for _, d := range diffs {
+		op := byte(' ')
+		switch d.Type {
+		case diffmatchpatch.DiffDelete:
+			op = '-'
+		case diffmatchpatch.DiffInsert:
+			op = '+'
+		}
+		for _, r := range d.Text {
+			lines = append(lines, diffLine{op, lineOf[r]})
+		}
+	}
+
+	return lines
+}
+
+func hunkRange(start, count int) string {
+	if count == 0 {
+		return fmt.Sprintf("%d,0", start)
+	}
+	return fmt.Sprintf("%d,%d", start+1, count)
+}
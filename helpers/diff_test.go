@@ -0,0 +1,29 @@
+package helpers
+
+import "testing"
+
+func TestUnifiedDiff(t *testing.T) {
+	tests := []struct {
+		name string
+		from string
+		to   string
+		out  string
+	}{
+		{"identical", "a\nb\n", "a\nb\n", ""},
+		{"changed line", "a\nb\nc\n", "a\nB\nc\n", "--- from\n+++ to\n@@ -1,3 +1,3 @@\n a\n-b\n+B\n c\n"},
+		{"added line", "a\n", "a\nb\n", "--- from\n+++ to\n@@ -1,1 +1,2 @@\n a\n+b\n"},
+		{"new file", "", "a\n", "--- from\n+++ to\n@@ -0,0 +1,1 @@\n+a\n"},
+		{"distant changes", "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n", "0\n2\n3\n4\n5\n6\n7\n8\n9\n11\n",
+			"--- from\n+++ to\n@@ -1,4 +1,4 @@\n-1\n+0\n 2\n 3\n 4\n@@ -7,4 +7,4 @@\n 7\n 8\n 9\n-10\n+11\n"},
+		{"missing newline", "a", "b", "--- from\n+++ to\n@@ -1,1 +1,1 @@\n-a\n\\ No newline at end of file\n+b\n\\ No newline at end of file\n"},
+		{"binary", "a\x00", "b\x00", "--- from\n+++ to\nBinary files differ\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if out := UnifiedDiff("from", "to", []byte(tt.from), []byte(tt.to)); out != tt.out {
+				t.Errorf("expected:\n%s\ngot:\n%s", tt.out, out)
+			}
+		})
+	}
+}
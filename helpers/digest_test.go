@@ -0,0 +1,41 @@
+package helpers
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFileDigest(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		out     string
+	}{
+		{"empty", "", "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"},
+		{"one line", "hello\n", "5891b5b522d5df086d0ff0b110fbd9d21bb4fc7163af34d08286a2e846f6be03"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "file")
+			if err := os.WriteFile(path, []byte(tt.content), 0644); err != nil {
+				t.Fatalf("error writing file: %v", err)
+			}
+
+			digest, err := FileDigest(path)
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			if digest != tt.out {
+				t.Errorf("expected %s, got %s", tt.out, digest)
+			}
+		})
+	}
+
+	t.Run("missing file", func(t *testing.T) {
+		if _, err := FileDigest(filepath.Join(t.TempDir(), "missing")); err == nil {
+			t.Errorf("expected an error, got nil")
+		}
+	})
+}
@@ -0,0 +1,39 @@
+package helpers
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Scores how well the query fuzzy matches the text, i.e. whether the characters of the query appear in order in the text, ignoring case.
+// Consecutive characters, and characters starting words, score higher.
+// Returns false if the text doesn't match.
+func FuzzyScore(query, text string) (int, bool) {
+	q := []rune(strings.ToLower(query))
+	t := []rune(strings.ToLower(text))
+
+	score, matched, last := 0, 0, -2
+	for i := 0; i < len(t) && matched < len(q); i++ {
+		if t[i] != q[matched] {
+			continue
+		}
+		score++
+		if i == last+1 {
+			score += 2
+		}
+		if i == 0 || isWordBoundary(t[i-1]) {
+			score += 3
+		}
+		last = i
+		matched++
+	}
+
+	if matched < len(q) {
+		return 0, false
+	}
+	return score, true
+}
+
+func isWordBoundary(r rune) bool {
+	return unicode.IsSpace(r) || strings.ContainsRune("/\\.-_()~", r)
+}
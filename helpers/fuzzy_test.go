@@ -0,0 +1,34 @@
+package helpers
+
+import "testing"
+
+func TestFuzzyScore(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		text  string
+		match bool
+	}{
+		{"empty query", "", ".zshrc", true},
+		{"substring", "zsh", ".zshrc - (~/.zshrc)", true},
+		{"scattered", "nvinit", "init.vim - (~/.config/nvim/init.vim)", true},
+		{"case insensitive", "ZSH", ".zshrc", true},
+		{"out of order", "hsz", ".zshrc", false},
+		{"missing character", "zshx", ".zshrc", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, match := FuzzyScore(tt.query, tt.text); match != tt.match {
+				t.Errorf("expected %q matching %q to be %t", tt.query, tt.text, tt.match)
+			}
+		})
+	}
+
+	// Consecutive characters at the start of a word score higher than scattered ones.
+	close, _ := FuzzyScore("git", ".gitconfig - (~/.gitconfig)")
+	scattered, _ := FuzzyScore("git", "grepit.conf - (~/.grepit.conf)")
+	if close <= scattered {
+		t.Errorf("expected %d to be higher than %d", close, scattered)
+	}
+}
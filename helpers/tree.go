@@ -0,0 +1,117 @@
+package helpers
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+)
+
+// Copies a directory tree from one place to another, preserving the modes.
+// Symlinks are recreated as is.
+func CopyTree(dest, origin string) error {
+	return walkTree(dest, origin, func(destPath, originPath string, info fs.FileInfo) error {
+		if err := CopyFile(destPath, originPath); err != nil {
+			return errors.WithStack(err)
+		}
+		return os.Chmod(destPath, info.Mode().Perm())
+	})
+}
+
+// Mirrors a directory tree from one place to another, hard linking the files.
+// The destination is replaced if it exists.
+func LinkTree(dest, origin string) error {
+	if err := os.RemoveAll(dest); err != nil {
+		return errors.WithStack(err)
+	}
+
+	return walkTree(dest, origin, func(destPath, originPath string, _ fs.FileInfo) error {
+		return LinkFile(destPath, originPath)
+	})
+}
+
+// Walks the origin tree recreating its directories (and symlinks) at dest,
+// and calling `handleFile` for each regular file.
+func walkTree(dest, origin string, handleFile func(destPath, originPath string, info fs.FileInfo) error) error {
+	// The directories' modes are applied after walking, in case some aren't writable.
+	dirModes := make(map[string]os.FileMode)
+	dirOrder := make([]string, 0)
+
+	err := filepath.WalkDir(origin, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return errors.WithStack(err)
+		}
+
+		rel, err := filepath.Rel(origin, path)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		destPath := filepath.Join(dest, rel)
+
+		info, err := d.Info()
+		if err != nil {
+			return errors.WithStack(err)
+		}
+
+		switch {
+		case d.IsDir():
+			dirModes[destPath] = info.Mode().Perm()
+			dirOrder = append(dirOrder, destPath)
+			return EnsureDirExists(destPath)
+		case info.Mode()&os.ModeSymlink != 0:
+			target, err := os.Readlink(path)
+			if err != nil {
+				return errors.WithStack(err)
+			}
+			return errors.WithStack(os.Symlink(target, destPath))
+		case info.Mode().IsRegular():
+			return handleFile(destPath, path, info)
+		}
+
+		// Sockets, pipes and devices aren't copied.
+		return nil
+	})
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	for i := len(dirOrder) - 1; i >= 0; i-- {
+		if err := os.Chmod(dirOrder[i], dirModes[dirOrder[i]]); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+
+	return nil
+}
+
+// Lists the sub directories of a directory (relative to it) with their permissions.
+func ListDirs(root string) (map[string]os.FileMode, error) {
+	dirs := make(map[string]os.FileMode)
+
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		if !d.IsDir() || path == root {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+
+		dirs[filepath.ToSlash(rel)] = info.Mode().Perm()
+		return nil
+	})
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return dirs, nil
+}
@@ -0,0 +1,57 @@
+package helpers
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestCopyTree(t *testing.T) {
+	tests := []struct {
+		name  string
+		files []string
+		dirs  map[string]os.FileMode
+	}{
+		{"empty tree", nil, map[string]os.FileMode{}},
+		{"flat tree", []string{"a", "b"}, map[string]os.FileMode{}},
+		{"nested tree", []string{"a", "sub/b"}, map[string]os.FileMode{"sub": 0755, "empty": 0700}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			origin := t.TempDir()
+			for dir, mode := range tt.dirs {
+				os.MkdirAll(filepath.Join(origin, dir), mode)
+				os.Chmod(filepath.Join(origin, dir), mode)
+			}
+			for _, name := range tt.files {
+				os.MkdirAll(filepath.Dir(filepath.Join(origin, name)), 0755)
+				os.WriteFile(filepath.Join(origin, name), []byte(name), 0640)
+			}
+
+			dest := filepath.Join(t.TempDir(), "copy")
+			if err := CopyTree(dest, origin); err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+
+			for _, name := range tt.files {
+				content, err := os.ReadFile(filepath.Join(dest, name))
+				if err != nil || string(content) != name {
+					t.Errorf("expected %s to be copied, got %q, %v", name, content, err)
+				}
+				if info, _ := os.Stat(filepath.Join(dest, name)); info.Mode().Perm() != 0640 {
+					t.Errorf("expected %s to keep its mode, got %v", name, info.Mode().Perm())
+				}
+			}
+
+			dirs, err := ListDirs(dest)
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			if !reflect.DeepEqual(dirs, tt.dirs) {
+				t.Errorf("expected %v, got %v", tt.dirs, dirs)
+			}
+		})
+	}
+}
@@ -1,13 +1,15 @@
 package ignorefile
 
 import (
+	"bufio"
+	"bytes"
 	"fmt"
 	"os"
 	"path/filepath"
 	"sort"
 	"strings"
 
-	"github.com/osamaadam/cfgrr/helpers"
+	"github.com/osamaadam/cfgrr/fileops"
 	"github.com/osamaadam/cfgrr/vconfig"
 	"github.com/pkg/errors"
 )
@@ -30,7 +32,7 @@ func NewIgnoreFile(path string) IIgnoreFile {
 }
 
 func (i *IgnoreFile) String() string {
-	r, err := os.ReadFile(i.path)
+	r, err := fileops.ReadFile(i.path)
 	if err != nil {
 		return ""
 	}
@@ -46,17 +48,11 @@ func (i *IgnoreFile) WriteLines(lines ...string) error {
 	lines = append(lines, readLines...)
 	sort.Strings(lines)
 
-	if err := helpers.EnsureDirExists(filepath.Dir(i.path)); err != nil {
+	if err := fileops.MkdirAll(filepath.Dir(i.path)); err != nil {
 		return errors.WithStack(err)
 	}
 
-	file, err := os.OpenFile(i.Path(), os.O_RDWR|os.O_CREATE, os.FileMode(0644))
-	if err != nil {
-		return errors.WithStack(err)
-	}
-	defer file.Close()
-
-	if _, err := file.Write([]byte(strings.Join(lines, "\n"))); err != nil {
+	if err := fileops.WriteFile(i.Path(), []byte(strings.Join(lines, "\n")), os.FileMode(0644)); err != nil {
 		return errors.WithStack(err)
 	}
 
@@ -64,11 +60,17 @@ func (i *IgnoreFile) WriteLines(lines ...string) error {
 }
 
 func (i *IgnoreFile) ReadLines() ([]string, error) {
-	lines, err := helpers.ReadFileLines(i.path)
+	content, err := fileops.ReadFile(i.path)
 	if err != nil && os.IsNotExist(err) {
 		return []string{}, errors.WithStack(err)
 	}
 
+	var lines []string
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+
 	return lines, nil
 }
 
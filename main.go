@@ -1,6 +1,7 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"runtime/debug"
@@ -24,6 +25,10 @@ func main() {
 		pkgPath = info.Main.Path
 	}
 	if err := cmd.Execute(version, tagdate, pkgPath); err != nil {
+		var exitErr *cmd.ExitError
+		if errors.As(err, &exitErr) {
+			os.Exit(exitErr.Code)
+		}
 		fmt.Printf("Run `%s` to print usage.\n", os.Args[0]+" --help")
 	}
 }
@@ -1,9 +1,14 @@
 package mapfile
 
 import (
+	"bytes"
+	"encoding/json"
 	"path/filepath"
 
+	cf "github.com/osamaadam/cfgrr/configfile"
 	"github.com/osamaadam/cfgrr/vconfig"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
 )
 
 // Returns a new IMapFile based on the file extension
@@ -26,3 +31,24 @@ func NewMapFile(optPath ...string) IMapFile {
 		return NewYamlMapFile(path)
 	}
 }
+
+// Parses the content of a map file that isn't on disk (e.g. read from a git revision), in the format of the given path.
+func ParseContent(path string, content []byte) (map[string]*cf.ConfigFile, error) {
+	m := make(map[string]*cf.ConfigFile)
+	if len(bytes.TrimSpace(content)) == 0 {
+		return m, nil
+	}
+
+	var err error
+	switch NewMapFile(path).(type) {
+	case *JsonMapFile:
+		err = json.Unmarshal(content, &m)
+	default:
+		err = yaml.Unmarshal(content, &m)
+	}
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return m, nil
+}
@@ -180,6 +180,8 @@ func TestJsonMapFile_Tidy(t *testing.T) {
 					delete(expected, k)
 				} else {
 					v.Backup()
+					// Backing up names the blob after the content, which is recorded in the map file.
+					jf.AddFiles(v)
 				}
 				i++
 			}
@@ -10,6 +10,7 @@ type IMapFile interface {
 	Path() string
 	Parse() (map[string]*cf.ConfigFile, error)
 	AddFiles(files ...*cf.ConfigFile) error
+	SetFiles(files ...*cf.ConfigFile) error
 	RemoveFiles(files ...*cf.ConfigFile) error
 	Tidy() error
 }
@@ -0,0 +1,55 @@
+package mapfile
+
+import (
+	"fmt"
+
+	cf "github.com/osamaadam/cfgrr/configfile"
+)
+
+// Two different files hashed to the same key of the map file.
+type KeyCollisionError struct {
+	Key      string
+	File     *cf.ConfigFile
+	Existing *cf.ConfigFile
+}
+
+func (e *KeyCollisionError) Error() string {
+	return fmt.Sprintf("%s and %s share the key %s in the map file, run 'cfgrr rekey --length <longer length>' to lengthen the keys", e.File.PathAbs(), e.Existing.PathAbs(), e.Key)
+}
+
+// Adds the files to the map, keeping the existing entries browsable.
+// Fails without adding anything if a file's key is taken by another file.
+func mergeFiles(m map[string]*cf.ConfigFile, files ...*cf.ConfigFile) error {
+	merged := make(map[string]*cf.ConfigFile, len(files))
+	for _, file := range files {
+		key := file.HashShort()
+		existing, ok := merged[key]
+		if !ok {
+			existing, ok = m[key]
+		}
+		if ok && !existing.SamePath(file) {
+			return &KeyCollisionError{Key: key, File: file, Existing: existing}
+		}
+		merged[key] = file
+	}
+
+	for key, file := range merged {
+		if existing, ok := m[key]; ok {
+			file.Browsable = existing.Browsable || file.Browsable
+		}
+		m[key] = file
+	}
+
+	return nil
+}
+
+// Removes the files from the map.
+// Entries of other files sharing their keys are left alone.
+func removeFiles(m map[string]*cf.ConfigFile, files ...*cf.ConfigFile) {
+	for _, file := range files {
+		key := file.HashShort()
+		if existing, ok := m[key]; ok && existing.SamePath(file) {
+			delete(m, key)
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package mapfile
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+
+	cf "github.com/osamaadam/cfgrr/configfile"
+	"github.com/osamaadam/cfgrr/vconfig"
+)
+
+func TestMapFile_KeyCollisions(t *testing.T) {
+	tests := []struct {
+		name string
+		path string
+	}{
+		{"yaml", "test.yaml"},
+		{"json", "test.json"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			temp := t.TempDir()
+			c := vconfig.GetConfig()
+			c.SetBackupDir(temp)
+			// Single character keys, 17 files are bound to collide.
+			c.SetKeyFormat("sha1", 1)
+			t.Cleanup(func() { c.SetKeyFormat("sha1", 8) })
+
+			mf := NewMapFile(filepath.Join(temp, tt.path))
+			files := make([]*cf.ConfigFile, 0, 17)
+			for i := 0; i < 17; i++ {
+				files = append(files, &cf.ConfigFile{Path: filepath.Join("dir", string(rune('a'+i)))})
+			}
+
+			var collision *KeyCollisionError
+			if err := mf.AddFiles(files...); !errors.As(err, &collision) {
+				t.Fatalf("expected a key collision, got %v", err)
+			}
+			if m, _ := mf.Parse(); len(m) != 0 {
+				t.Errorf("expected nothing to be added, got %d files", len(m))
+			}
+
+			// Files added one by one collide with the existing entries.
+			for _, file := range files {
+				if err := mf.AddFiles(file); err != nil {
+					if !errors.As(err, &collision) {
+						t.Fatalf("expected a key collision, got %v", err)
+					}
+					// Removing the colliding file leaves the existing entry alone.
+					if err := mf.RemoveFiles(file); err != nil {
+						t.Fatalf("expected no error, got %s", err)
+					}
+					m, _ := mf.Parse()
+					if existing := m[collision.Key]; existing == nil || existing.Path != collision.Existing.Path {
+						t.Errorf("expected %s to be kept", collision.Existing.Path)
+					}
+					return
+				}
+			}
+			t.Errorf("expected a key collision")
+		})
+	}
+}
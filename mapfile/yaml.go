@@ -1,6 +1,7 @@
 package mapfile
 
 import (
+	"bytes"
 	"fmt"
 	"io"
 	"os"
@@ -8,7 +9,7 @@ import (
 	"slices"
 
 	cf "github.com/osamaadam/cfgrr/configfile"
-	"github.com/osamaadam/cfgrr/helpers"
+	"github.com/osamaadam/cfgrr/fileops"
 	"github.com/pkg/errors"
 	"gopkg.in/yaml.v3"
 )
@@ -35,12 +36,17 @@ func (yf *YamlMapFile) Path() string {
 	return yf.path
 }
 
-// Opens the map file.
-func (yf *YamlMapFile) open() (*os.File, error) {
-	if err := helpers.EnsureDirExists(filepath.Dir(yf.path)); err != nil {
-		return nil, errors.WithMessage(err, "couldn't create base directory for yaml file")
+// Reads the map file, a missing map file is empty.
+func (yf *YamlMapFile) read() (io.Reader, error) {
+	content, err := fileops.ReadFile(yf.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return bytes.NewReader(nil), nil
 	}
-	return os.OpenFile(yf.path, os.O_RDWR|os.O_CREATE, os.FileMode(0644))
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return bytes.NewReader(content), nil
 }
 
 // Writes the map to the map file.
@@ -50,11 +56,11 @@ func (yf *YamlMapFile) write(m map[string]*cf.ConfigFile) error {
 		return errors.WithStack(err)
 	}
 
-	if err := helpers.EnsureDirExists(filepath.Dir(yf.path)); err != nil {
+	if err := fileops.MkdirAll(filepath.Dir(yf.path)); err != nil {
 		return errors.WithStack(err)
 	}
 
-	if err := os.WriteFile(yf.path, marshalledData, os.FileMode(0644)); err != nil {
+	if err := fileops.WriteFile(yf.path, marshalledData, os.FileMode(0644)); err != nil {
 		return errors.WithStack(err)
 	}
 
@@ -74,13 +80,11 @@ func (yf *YamlMapFile) String() string {
 
 // Parses the map file into a `map[string]*cf.ConfigFile`.
 func (yf *YamlMapFile) Parse() (mf map[string]*cf.ConfigFile, err error) {
-	file, err := yf.open()
+	file, err := yf.read()
 	if err != nil {
 		return nil, errors.WithStack(err)
 	}
 
-	defer file.Close()
-
 	if err := yaml.NewDecoder(file).Decode(&mf); err != nil {
 		if errors.Is(err, io.EOF) {
 			return map[string]*cf.ConfigFile{}, nil
@@ -98,12 +102,22 @@ func (yf *YamlMapFile) AddFiles(files ...*cf.ConfigFile) error {
 		return errors.WithStack(err)
 	}
 
-	for _, file := range files {
-		fileHash := file.HashShort()
-		if f, ok := m[fileHash]; ok {
-			file.Browsable = f.Browsable || file.Browsable
-		}
-		m[fileHash] = file
+	if err := mergeFiles(m, files...); err != nil {
+		return errors.WithStack(err)
+	}
+
+	if err := yf.write(m); err != nil {
+		return errors.WithStack(err)
+	}
+
+	return nil
+}
+
+// Overwrites the map file with the given files.
+func (yf *YamlMapFile) SetFiles(files ...*cf.ConfigFile) error {
+	m := make(map[string]*cf.ConfigFile, len(files))
+	if err := mergeFiles(m, files...); err != nil {
+		return errors.WithStack(err)
 	}
 
 	if err := yf.write(m); err != nil {
@@ -120,9 +134,7 @@ func (yf *YamlMapFile) RemoveFiles(files ...*cf.ConfigFile) error {
 		return errors.WithStack(err)
 	}
 
-	for _, file := range files {
-		delete(m, file.HashShort())
-	}
+	removeFiles(m, files...)
 
 	if err := yf.write(m); err != nil {
 		return errors.WithStack(err)
@@ -138,9 +150,9 @@ func (yf *YamlMapFile) Tidy() error {
 		return errors.WithStack(err)
 	}
 
-	for _, file := range m {
-		if !helpers.CheckFileExists(file.BackupPath()) {
-			delete(m, file.HashShort())
+	for key, file := range m {
+		if !fileops.Exists(file.BackupPath()) {
+			delete(m, key)
 		}
 	}
 
@@ -183,6 +183,8 @@ func TestYamlMapFile_Tidy(t *testing.T) {
 					delete(expected, k)
 				} else {
 					v.Backup()
+					// Backing up names the blob after the content, which is recorded in the map file.
+					yf.AddFiles(v)
 				}
 				i++
 			}
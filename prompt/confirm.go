@@ -0,0 +1,18 @@
+package prompt
+
+import (
+	"github.com/AlecAivazis/survey/v2"
+	"github.com/pkg/errors"
+)
+
+// Asks the user a yes or no question, defaulting to no.
+func PromptForConfirmation(message string) (bool, error) {
+	prompt := &survey.Confirm{Message: message}
+
+	var answer bool
+	if err := survey.AskOne(prompt, &answer); err != nil {
+		return false, errors.WithStack(err)
+	}
+
+	return answer, nil
+}
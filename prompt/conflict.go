@@ -0,0 +1,36 @@
+package prompt
+
+import (
+	"fmt"
+
+	"github.com/AlecAivazis/survey/v2"
+	cf "github.com/osamaadam/cfgrr/configfile"
+	"github.com/pkg/errors"
+)
+
+// Shows how the live file differs from its backup, and asks the user how to restore it.
+func PromptForConflictStrategy(file *cf.ConfigFile) (cf.ConflictStrategy, error) {
+	diff, err := file.ConflictDiff()
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	fmt.Print(diff)
+
+	strategies := []cf.ConflictStrategy{cf.ConflictKeepBoth, cf.ConflictOverwrite, cf.ConflictSkip}
+	labels := []string{
+		"keep both (move the local file to " + cf.OrigSuffix + ")",
+		"overwrite the local file",
+		"skip",
+	}
+	prompt := &survey.Select{
+		Message: fmt.Sprintf("%s already exists, how should it be restored?", file.PathAbs()),
+		Options: labels,
+	}
+
+	var answer int
+	if err := survey.AskOne(prompt, &answer); err != nil {
+		return "", errors.WithStack(err)
+	}
+
+	return strategies[answer], nil
+}
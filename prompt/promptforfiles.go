@@ -9,10 +9,14 @@ import (
 )
 
 // Creates a pair of a map, and a slice of strings from a slice of ConfigFiles.
+// The files that don't belong on this machine are labeled with why.
 func promptWorkaround(files []*cf.ConfigFile) (m map[string]*cf.ConfigFile, arr []string) {
 	m = make(map[string]*cf.ConfigFile, len(files))
 	for _, file := range files {
 		readableName := file.String()
+		if reason := file.Unmet(); reason != "" {
+			readableName += " [not for this machine: " + reason + "]"
+		}
 		m[readableName] = file
 		arr = append(arr, readableName)
 	}
@@ -50,3 +54,24 @@ func PromptForFileSelection(files []*cf.ConfigFile, message string) ([]*cf.Confi
 
 	return selectedFiles, nil
 }
+
+// Prompts the user to select a single file from a list of ConfigFiles.
+func PromptForFile(files []*cf.ConfigFile, message string) (*cf.ConfigFile, error) {
+	m, arr := promptWorkaround(files)
+	if len(arr) == 0 {
+		return nil, nil
+	}
+
+	prompt := &survey.Select{
+		Message:  message,
+		Options:  arr,
+		PageSize: 10,
+	}
+
+	selected := ""
+	if err := survey.AskOne(prompt, &selected); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return m[selected], nil
+}
@@ -0,0 +1,81 @@
+package vconfig
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/osamaadam/cfgrr/fileops"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+// The file of the backup dir holding the settings the backup depends on, so they're pushed and cloned along with it.
+const SharedFileName = ".cfgrrshared.yaml"
+
+// The settings kept in the backup dir rather than in `~/.cfgrr.yaml`.
+type Shared struct {
+	// The format of the map file keys, the map file can't be read with another one.
+	KeyAlgorithm string `yaml:"key_algorithm,omitempty"`
+	KeyLength    int    `yaml:"key_length,omitempty"`
+	// The commands run for the tagged files, they run for the files tagged on other machines too.
+	// Unlike the config file, the tags keep their case.
+	TagHooks []TagHook `yaml:"tag_hooks,omitempty"`
+}
+
+// Gets the full path of the shared settings file.
+func (c *Config) GetSharedFilePath() string {
+	return filepath.Join(c.BackupDir, SharedFileName)
+}
+
+// Reads the shared settings of the backup dir.
+// Without the file, the ones of the config file are used, that's where they were kept before they were moved to the backup dir.
+func (c *Config) loadShared() error {
+	c.KeyAlgorithm = v.GetString("key_algorithm")
+	c.KeyLength = v.GetInt("key_length")
+	c.TagHooks = nil
+	if err := v.UnmarshalKey("tag_hooks", &c.TagHooks); err != nil {
+		return errors.WithStack(err)
+	}
+
+	content, err := fileops.ReadFile(c.GetSharedFilePath())
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return errors.WithStack(err)
+	}
+
+	var shared Shared
+	if err := yaml.Unmarshal(content, &shared); err != nil {
+		return errors.WithMessagef(err, "couldn't parse %s", c.GetSharedFilePath())
+	}
+	if shared.KeyAlgorithm != "" {
+		c.KeyAlgorithm = shared.KeyAlgorithm
+	}
+	if shared.KeyLength != 0 {
+		c.KeyLength = shared.KeyLength
+	}
+	c.TagHooks = shared.TagHooks
+
+	return nil
+}
+
+// Saves the shared settings to the backup dir.
+func (c *Config) SaveShared() error {
+	content, err := yaml.Marshal(&Shared{
+		KeyAlgorithm: c.KeyAlgorithm,
+		KeyLength:    c.KeyLength,
+		TagHooks:     c.TagHooks,
+	})
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	if err := fileops.MkdirAll(c.BackupDir); err != nil {
+		return errors.WithStack(err)
+	}
+	if err := fileops.WriteFile(c.GetSharedFilePath(), content, 0644); err != nil {
+		return errors.WithStack(err)
+	}
+
+	return nil
+}
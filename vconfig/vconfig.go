@@ -4,6 +4,8 @@ package vconfig
 import (
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
 
 	"github.com/pkg/errors"
 	"github.com/spf13/viper"
@@ -21,6 +23,31 @@ type Config struct {
 	GitRemote string `mapstructure:"git_remote"`
 	// The git branch to push to, defaults to current branch.
 	GitBranch string `mapstructure:"git_branch"`
+	// The number of revisions kept per file, defaults to 10.
+	HistoryLimit int `mapstructure:"history_limit"`
+	// User defined variables available to templates as `.Vars`.
+	// Viper lowercases the keys.
+	Vars map[string]string `mapstructure:"vars"`
+	// The file the encryption key is derived from, the user is prompted for a passphrase if it's unset.
+	KeyFile string `mapstructure:"key_file"`
+	// The patterns of the extended attributes kept with the files, defaults to `user.*`.
+	Xattrs []string `mapstructure:"xattrs"`
+	// The hash algorithm of the map file keys, defaults to `sha1`.
+	// It's kept in the shared settings of the backup dir (see `Shared`).
+	KeyAlgorithm string `mapstructure:"key_algorithm"`
+	// The length the map file keys are truncated to, defaults to 8.
+	// It's kept in the shared settings of the backup dir.
+	KeyLength int `mapstructure:"key_length"`
+	// The commands run at the events of the operations on the files with a tag.
+	// They're kept in the shared settings of the backup dir, as a list rather than a map keyed by tag.
+	TagHooks []TagHook `mapstructure:"tag_hooks"`
+}
+
+// A command run at an event (e.g. post-restore) for the files tagged with the tag, whenever they were tagged.
+type TagHook struct {
+	Tag     string `mapstructure:"tag" yaml:"tag"`
+	Event   string `mapstructure:"event" yaml:"event"`
+	Command string `mapstructure:"command" yaml:"command"`
 }
 
 var v *viper.Viper
@@ -52,7 +79,10 @@ func GetConfig() *Config {
 
 // Refreshes the config struct.
 func (c *Config) refresh() error {
-	return v.Unmarshal(c)
+	if err := v.Unmarshal(c); err != nil {
+		return errors.WithStack(err)
+	}
+	return c.loadShared()
 }
 
 // Sets the main config file to read from.
@@ -76,12 +106,14 @@ func (c *Config) GetIgnoreFilePath() string {
 	return filepath.Join(c.BackupDir, c.IgnoreFile)
 }
 
-// Sets the backup directory.
+// Sets the backup directory, and reads its shared settings.
 // Does not save the config.
 func (c *Config) SetBackupDir(path string) {
 	path = filepath.Clean(path)
 	v.Set("backup_dir", path)
 	c.BackupDir = path
+	// A malformed file is reported when the config is read on the next run.
+	c.loadShared()
 }
 
 // Sets the map file.
@@ -98,6 +130,47 @@ func (c *Config) SetIgnoreFile(name string) {
 	c.IgnoreFile = name
 }
 
+// Sets the number of revisions kept per file.
+// Does not save the config.
+func (c *Config) SetHistoryLimit(limit int) {
+	v.Set("history_limit", limit)
+	c.HistoryLimit = limit
+}
+
+// Sets the format of the map file keys.
+// Does not save the shared settings, nor rekey the map file.
+func (c *Config) SetKeyFormat(algorithm string, length int) {
+	c.KeyAlgorithm = algorithm
+	c.KeyLength = length
+}
+
+// Sets a variable available to templates.
+// Does not save the config.
+func (c *Config) SetVar(name, value string) {
+	name = strings.ToLower(name)
+	v.Set("vars."+name, value)
+	if c.Vars == nil {
+		c.Vars = make(map[string]string)
+	}
+	c.Vars[name] = value
+}
+
+// Sets the file the encryption key is derived from.
+// Does not save the config.
+func (c *Config) SetKeyFile(path string) {
+	if path != "" {
+		path = filepath.Clean(path)
+	}
+	v.Set("key_file", path)
+	c.KeyFile = path
+}
+
+// Sets the commands run for the tagged files.
+// Does not save the shared settings.
+func (c *Config) SetTagHooks(hooks []TagHook) {
+	c.TagHooks = hooks
+}
+
 func (c *Config) SetBrowsable(browsable bool) {
 	viper.Set("browsable", browsable)
 	c.Browsable = browsable
@@ -105,6 +178,15 @@ func (c *Config) SetBrowsable(browsable bool) {
 
 // Sets a key and value to the config file.
 func (c *Config) Set(key string, values ...string) error {
+	if key == "key_algorithm" || key == "key_length" {
+		return errors.Errorf("%s can't be set directly as the map file must be rekeyed, run 'cfgrr rekey --help' instead", key)
+	}
+
+	if name, ok := strings.CutPrefix(key, "vars."); ok {
+		c.SetVar(name, strings.Join(values, " "))
+		return errors.WithStack(c.Save())
+	}
+
 	v.Set(key, values)
 
 	switch key {
@@ -117,6 +199,16 @@ func (c *Config) Set(key string, values ...string) error {
 	case "browsable":
 		browsable := values[0] == "true"
 		c.SetBrowsable(browsable)
+	case "xattrs":
+		c.Xattrs = values
+	case "key_file":
+		c.SetKeyFile(values[0])
+	case "history_limit":
+		limit, err := strconv.Atoi(values[0])
+		if err != nil || limit < 0 {
+			return errors.Errorf("history_limit must be a non-negative integer, got %q", values[0])
+		}
+		c.SetHistoryLimit(limit)
 	}
 
 	if err := c.Save(); err != nil {
@@ -167,6 +259,10 @@ func (c *Config) init() error {
 	v.SetDefault("ignore_file", ".cfgrrignore")
 	v.SetDefault("git_remote", "origin")
 	v.SetDefault("git_branch", "master")
+	v.SetDefault("history_limit", 10)
+	v.SetDefault("xattrs", []string{"user.*"})
+	v.SetDefault("key_algorithm", "sha1")
+	v.SetDefault("key_length", 8)
 	if err := v.ReadInConfig(); err != nil {
 		if err := c.refresh(); err != nil {
 			return errors.WithStack(err)